@@ -0,0 +1,440 @@
+package main
+
+import (
+	"cp/pkg/acknowledgements"
+	"cp/pkg/blobs"
+	"cp/pkg/conversations"
+	"cp/pkg/emails"
+	"cp/pkg/events"
+	"cp/pkg/exchanges"
+	"cp/pkg/groups"
+	"cp/pkg/images"
+	"cp/pkg/invitations"
+	"cp/pkg/jobs"
+	"cp/pkg/ledger"
+	"cp/pkg/logins"
+	"cp/pkg/mailer"
+	"cp/pkg/memberships"
+	"cp/pkg/messages"
+	"cp/pkg/migrations"
+	"cp/pkg/notifications"
+	"cp/pkg/posts"
+	"cp/pkg/roles"
+	"cp/pkg/search"
+	"cp/pkg/snapshots"
+	"cp/pkg/tokens"
+	"cp/pkg/users"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a subcommand of the binary. Commands parse their own flags
+// from args, and share the stores built from the database
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(s *stores, args []string) error
+}
+
+var commands []*command
+
+// commands are listed in init, since their flag sets refer to the list
+func init() {
+	commands = []*command{
+		{
+			name:        "serve",
+			usage:       "[--migrate=false]",
+			description: "migrate the database and start the web server. This is the default command",
+			run:         runServe,
+		},
+		{
+			name:        "migrate",
+			usage:       "[up | down [--steps <n>] | status]",
+			description: "apply the pending migrations of the database, revert the latest ones, or list them",
+			run:         runMigrate,
+		},
+		{
+			name:        "seed",
+			usage:       "--demo [--owner <user id or email>]",
+			description: "add a demo group with members, posts and transfers",
+			run:         runSeed,
+		},
+		{
+			name:        "import",
+			usage:       "--group <id> --kind <members|posts|credits|acknowledgements> [--dry-run] <file.csv>",
+			description: "import the rows of a csv file into a group",
+			run:         runImport,
+		},
+		{
+			name:        "export-group",
+			usage:       "[--output <file.json>] <group id>",
+			description: "write a json backup of a group and all its data",
+			run:         runExportGroup,
+		},
+		{
+			name:        "grant-admin",
+			usage:       "[--revoke] <user id or email>",
+			description: "allow a user to administer the site",
+			run:         runGrantAdmin,
+		},
+		{
+			name:        "purge-deleted",
+			usage:       "[--older-than <duration>] [--dry-run]",
+			description: "permanently remove the posts deleted a while ago",
+			run:         runPurgeDeleted,
+		},
+		{
+			name:        "clear",
+			usage:       "--yes-delete-everything",
+			description: "delete all the data of the site",
+			run:         runClear,
+		},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func printUsage() {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [arguments]\n\nCommands:\n", name)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s %s\n    \t%s\n", c.name, c.usage, c.description)
+	}
+}
+
+// newFlagSet returns the flag set of a command, printing the usage of the
+// command on errors
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		c := findCommand(name)
+		fmt.Fprintf(flags.Output(), "Usage: %s %s %s\n", filepath.Base(os.Args[0]), c.name, c.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// errUsage is returned by commands called with invalid arguments, after
+// printing their usage
+var errUsage = errors.New("invalid arguments")
+
+// stores holds the stores shared by the web server and the other commands.
+// They can be built on a transaction to make several writes atomic
+type stores struct {
+	db                   *gorm.DB
+	broker               *events.Broker
+	deliverer            *emails.Deliverer
+	jobRunner            *jobs.Runner
+	blobStore            blobs.Store
+	groupStore           *groups.GroupStore
+	membershipStore      *memberships.MembershipStore
+	userStore            *users.UserStore
+	postStore            *posts.PostStore
+	messageStore         *messages.MessageStore
+	acknowledgementStore *acknowledgements.AcknowledgementStore
+	ledgerStore          *ledger.LedgerStore
+	notificationStore    *notifications.NotificationStore
+	imageStore           *images.ImageStore
+	tokenStore           *tokens.TokenStore
+	invitationStore      *invitations.InvitationStore
+	roleStore            *roles.RoleStore
+	exchangeStore        *exchanges.ExchangeStore
+	snapshotStore        *snapshots.SnapshotStore
+	conversationStore    *conversations.ConversationStore
+	emailStore           *emails.EmailStore
+	jobStore             *jobs.JobStore
+	loginStore           *logins.LoginStore
+}
+
+func newStores(db *gorm.DB, broker *events.Broker, deliverer *emails.Deliverer, jobRunner *jobs.Runner, blobStore blobs.Store) *stores {
+	return &stores{
+		db:                   db,
+		broker:               broker,
+		deliverer:            deliverer,
+		jobRunner:            jobRunner,
+		blobStore:            blobStore,
+		groupStore:           groups.NewGroupStore(db),
+		membershipStore:      memberships.NewMembershipStore(db, broker),
+		userStore:            users.NewUserStore(db),
+		postStore:            posts.NewPostStore(db),
+		messageStore:         messages.NewMessageStore(db, broker),
+		acknowledgementStore: acknowledgements.NewAcknowledgementStore(db),
+		ledgerStore:          ledger.NewLedgerStore(db),
+		notificationStore:    notifications.NewNotificationStore(db, broker, deliverer),
+		imageStore:           images.NewImageStore(db),
+		tokenStore:           tokens.NewTokenStore(db),
+		invitationStore:      invitations.NewInvitationStore(db, broker),
+		roleStore:            roles.NewRoleStore(db),
+		exchangeStore:        exchanges.NewExchangeStore(db),
+		snapshotStore:        snapshots.NewSnapshotStore(db),
+		conversationStore:    conversations.NewConversationStore(db),
+		emailStore:           emails.NewEmailStore(db),
+		jobStore:             jobs.NewJobStore(db),
+		loginStore:           logins.NewLoginStore(db),
+	}
+}
+
+func openDatabase() (*gorm.DB, error) {
+	dbProvider := os.Getenv("DB_PROVIDER")
+	if dbProvider == "" || dbProvider == "sqlite" {
+		database, err := gorm.Open(sqlite.Open("gorm.db?_foreign_keys=1"), &gorm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		database.DisableForeignKeyConstraintWhenMigrating = true
+		return database, nil
+	}
+
+	if dbProvider == "postgres" {
+		database, err := gorm.Open(postgres.Open(postgresDSN()), &gorm.Config{})
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := database.DB()
+		if err != nil {
+			return nil, err
+		}
+		db.SetConnMaxLifetime(time.Minute * 5)
+		db.SetConnMaxIdleTime(time.Minute * 5)
+		return database, nil
+	}
+
+	return nil, fmt.Errorf("unknown DB_PROVIDER %q, expected sqlite or postgres", dbProvider)
+}
+
+func postgresDSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+		os.Getenv("DB_PORT"),
+	)
+}
+
+// newBroker returns the broker of the events published by the stores. With
+// EVENTS_BACKEND=postgres, the replicas sharing a Postgres database receive
+// the events of each other
+func newBroker(db *gorm.DB) (*events.Broker, error) {
+	eventsBackend := os.Getenv("EVENTS_BACKEND")
+	if eventsBackend == "" || eventsBackend == "local" {
+		return events.NewBroker(events.LocalBackend{}), nil
+	}
+
+	if eventsBackend == "postgres" {
+		if db.Dialector.Name() != "postgres" {
+			return nil, errors.New("EVENTS_BACKEND=postgres requires DB_PROVIDER=postgres")
+		}
+		return events.NewBroker(events.NewPostgresBackend(db, postgresDSN())), nil
+	}
+
+	return nil, fmt.Errorf("unknown EVENTS_BACKEND %q, expected local or postgres", eventsBackend)
+}
+
+// newDeliverer returns the deliverer of the notification emails. MAILER
+// selects how the emails are sent: smtp, file to write them to MAILER_DIR,
+// or none to drop them
+func newDeliverer(db *gorm.DB) (*emails.Deliverer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "commonpool <noreply@localhost>"
+	}
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+
+	var m mailer.Mailer
+	switch os.Getenv("MAILER") {
+	case "", "none":
+		m = mailer.Discard
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		m = mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	case "file":
+		dir := os.Getenv("MAILER_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		m = mailer.NewFileMailer(dir, from)
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, expected none, smtp or file", os.Getenv("MAILER"))
+	}
+
+	return emails.NewDeliverer(emails.NewEmailStore(db), users.NewUserStore(db), m, baseURL), nil
+}
+
+// newJobRunner returns the runner of the background jobs, with JOB_WORKERS
+// workers
+func newJobRunner(db *gorm.DB) (*jobs.Runner, error) {
+	workers := 4
+	if value := os.Getenv("JOB_WORKERS"); value != "" {
+		var err error
+		workers, err = strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			return nil, fmt.Errorf("invalid JOB_WORKERS %q, expected a positive number", value)
+		}
+	}
+	return jobs.NewRunner(jobs.NewJobStore(db), workers), nil
+}
+
+// newBlobStore returns the store of the images. BLOB_STORE selects where
+// they are kept: file to keep them in PUBLIC_DIR, s3 to keep them in the
+// S3_BUCKET bucket of the S3 compatible service at S3_ENDPOINT, or memory
+// to lose them on exit. The replicas of the server must share an s3 store
+func newBlobStore() (blobs.Store, error) {
+	switch os.Getenv("BLOB_STORE") {
+	case "", "file":
+		publicDir := os.Getenv("PUBLIC_DIR")
+		if publicDir == "" {
+			publicDir = "public"
+		}
+		return blobs.NewFileStore(publicDir), nil
+	case "s3":
+		return blobs.NewS3Store(blobs.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	case "memory":
+		return blobs.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, expected file, s3 or memory", os.Getenv("BLOB_STORE"))
+	}
+}
+
+// newImageURLSigner returns the signer of the image URLs given to the API
+// clients. They are signed with IMAGE_URL_SECRET, shared by the replicas,
+// and valid for IMAGE_URL_TTL. Without a secret, the URLs are signed with
+// a random one and are only valid on this server until it restarts
+func newImageURLSigner() (*images.URLSigner, error) {
+	secret := []byte(os.Getenv("IMAGE_URL_SECRET"))
+	if len(secret) == 0 {
+		fmt.Println("IMAGE_URL_SECRET is not set, the signed image URLs are only valid until the server restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	ttl := 15 * time.Minute
+	if value := os.Getenv("IMAGE_URL_TTL"); value != "" {
+		var err error
+		ttl, err = time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid IMAGE_URL_TTL %q, expected a positive duration", value)
+		}
+	}
+	return images.NewURLSigner(secret, ttl), nil
+}
+
+// newCookieStore returns the store of the session cookies. They are signed
+// and encrypted with keys derived from SESSION_SECRET, shared by the
+// replicas. Without a secret, random keys are used and the users are logged
+// out when the server restarts
+func newCookieStore() (*sessions.CookieStore, error) {
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(secret) == 0 {
+		fmt.Println("SESSION_SECRET is not set, the users are logged out when the server restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return sessions.NewCookieStore(deriveKey(secret, "session-authentication"), deriveKey(secret, "session-encryption")), nil
+}
+
+// deriveKey returns a 32 bytes key for the purpose, so that a single secret
+// is configured
+func deriveKey(secret []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(purpose))
+	return h.Sum(nil)
+}
+
+// migrate brings the schema up to date, and initializes the search engine
+func migrate(s *stores, searchEngine search.Engine) error {
+	if _, err := migrations.NewMigrator(s.db).Up(); err != nil {
+		return err
+	}
+
+	return searchEngine.Init()
+}
+
+func runMigrate(s *stores, args []string) error {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	flags := newFlagSet("migrate")
+	steps := flags.Int("steps", 1, "number of migrations to revert with down")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || *steps < 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	migrator := migrations.NewMigrator(s.db)
+	switch action {
+	case "up":
+		if err := migrate(s, search.NewEngine(s.db)); err != nil {
+			return err
+		}
+		fmt.Println("database is up to date")
+	case "down":
+		reverted, err := migrator.Down(*steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
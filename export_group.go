@@ -0,0 +1,133 @@
+package main
+
+import (
+	"cp/pkg/api"
+	posts2 "cp/pkg/posts"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"os"
+	"time"
+)
+
+// groupBackup is the document written by export-group. Deleted posts are
+// included, and the messages and exchanges are listed with their post
+type groupBackup struct {
+	ExportedAt       time.Time              `json:"exportedAt"`
+	Group            *api.Group             `json:"group"`
+	Roles            []*api.Role            `json:"roles"`
+	Invitations      []*api.Invitation      `json:"invitations"`
+	Posts            []*postBackup          `json:"posts"`
+	Acknowledgements []*api.Acknowledgement `json:"acknowledgements"`
+	JournalEntries   []*api.JournalEntry    `json:"journalEntries"`
+}
+
+type postBackup struct {
+	*api.Post
+	Messages  []*api.Message  `json:"messages"`
+	Exchanges []*api.Exchange `json:"exchanges"`
+}
+
+func runExportGroup(s *stores, args []string) error {
+	flags := newFlagSet("export-group")
+	output := flags.String("output", "", "file to write the backup to, instead of the standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	backup, err := backupGroup(s, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(backup); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "wrote backup of group %s to %s\n", backup.Group.ID, *output)
+	}
+	return nil
+}
+
+func backupGroup(s *stores, groupID string) (*groupBackup, error) {
+	group, err := s.groupStore.Get(groupID)
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil, fmt.Errorf("no group %s", groupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the posts are listed separately, including the deleted ones
+	group.Posts = nil
+
+	roles, err := s.roleStore.GetForGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	invitations, err := s.invitationStore.GetForGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	acknowledgements, _, err := s.acknowledgementStore.GetAllInGroup(groupID, nil)
+	if err != nil {
+		return nil, err
+	}
+	journalEntries, err := s.ledgerStore.GetEntriesForGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, _, err := s.postStore.GetByGroup(groupID, &posts2.FindPostsOptions{
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var postBackups []*postBackup
+	for _, post := range posts {
+		messages, _, err := s.messageStore.GetMessages(post.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		exchanges, err := s.exchangeStore.GetForPost(post.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, exchange := range exchanges {
+			exchange.Post = nil
+		}
+		postBackups = append(postBackups, &postBackup{
+			Post:      post,
+			Messages:  messages,
+			Exchanges: exchanges,
+		})
+	}
+
+	return &groupBackup{
+		ExportedAt:       time.Now(),
+		Group:            group,
+		Roles:            roles,
+		Invitations:      invitations,
+		Posts:            postBackups,
+		Acknowledgements: acknowledgements,
+		JournalEntries:   journalEntries,
+	}, nil
+}
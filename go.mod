@@ -6,12 +6,14 @@ require (
 	github.com/coreos/go-oidc/v3 v3.0.0
 	github.com/go-playground/form/v4 v4.1.3
 	github.com/gorilla/sessions v1.2.1
+	github.com/jackc/pgx/v4 v4.10.1
 	github.com/labstack/echo-contrib v0.9.0
 	github.com/labstack/echo/v4 v4.2.1
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/satori/go.uuid v1.2.0
 	github.com/stretchr/testify v1.6.1 // indirect
 	golang.org/x/oauth2 v0.0.0-20210402161424-2e8d93401602
+	gopkg.in/square/go-jose.v2 v2.5.1
 	gorm.io/driver/postgres v1.0.8
 	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.6
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"cp/pkg/importer"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+var errInvalidRows = errors.New("some rows are invalid")
+
+// runImport imports a csv file into a group, and prints the report
+func runImport(s *stores, args []string) error {
+	flags := newFlagSet("import")
+	groupID := flags.String("group", "", "ID of the group to import into")
+	kind := flags.String("kind", "", "kind of rows in the file: members, posts, credits or acknowledgements")
+	dryRun := flags.Bool("dry-run", false, "validate the file and report what would be imported, without importing it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *groupID == "" || flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+	if !importer.Kind(*kind).IsValid() {
+		return fmt.Errorf("%w %q", importer.ErrInvalidKind, *kind)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := importer.NewImporter(s.db).Import(*groupID, importer.Kind(*kind), file, importer.Options{
+		DryRun: *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "LINE\tRESULT\tID\tMESSAGE")
+	for _, result := range report.Results {
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", result.Line, result.Action, result.ID, result.Message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("created: %d, skipped: %d, invalid: %d", report.Created, report.Skipped, report.Invalid)
+	if report.DryRun {
+		fmt.Print(" (dry run, nothing was imported)")
+	}
+	fmt.Println()
+
+	if report.Invalid > 0 {
+		return errInvalidRows
+	}
+	return nil
+}
@@ -1,38 +1,33 @@
 package main
 
 import (
-	"cp/pkg/acknowledgements"
+	"context"
 	"cp/pkg/api"
-	"cp/pkg/credits"
-	"cp/pkg/groups"
 	"cp/pkg/handler"
-	"cp/pkg/images"
 	"cp/pkg/memberships"
-	"cp/pkg/messages"
 	"cp/pkg/notifications"
-	"cp/pkg/posts"
-	"cp/pkg/users"
+	"cp/pkg/roles"
+	"cp/pkg/search"
 	"cp/pkg/utils"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
-	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 	"html/template"
 	"io"
 	"os"
-	"time"
+	"strings"
 )
 
 type TemplateRenderer struct {
 	templates         *template.Template
 	cookieStore       *sessions.CookieStore
 	membershipStore   memberships.Store
+	roleStore         roles.Store
 	alertManager      *utils.AlertManager
 	notificationStore notifications.Store
 }
@@ -124,6 +119,9 @@ func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c
 				}
 				return m, nil
 			},
+			"getRoles": func(groupID string) ([]*api.Role, error) {
+				return t.roleStore.GetForGroup(groupID)
+			},
 			"loggedInUserID": func() string {
 				if userID, ok := c.Get("loggedInUserID").(string); ok {
 					return userID
@@ -198,6 +196,13 @@ func (t *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c
 				}
 				return p.(*api.Post)
 			},
+			handler.ConversationKey: func() *api.Conversation {
+				conversation := c.Get(handler.ConversationKey)
+				if conversation == nil {
+					return nil
+				}
+				return conversation.(*api.Conversation)
+			},
 			handler.AuthenticatedUserKey: func() *api.User {
 				u := c.Get(handler.AuthenticatedUserKey)
 				if u == nil {
@@ -230,65 +235,87 @@ func main() {
 
 	gob.Register([]utils.Alert{})
 
-	var database *gorm.DB
-	var err error
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return
+	}
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
 
-	dbProvider := os.Getenv("DB_PROVIDER")
-	if dbProvider == "" || dbProvider == "sqlite" {
-		database, err = gorm.Open(sqlite.Open("gorm.db"), &gorm.Config{})
-		if err != nil {
-			panic(err)
-		}
-		database.DisableForeignKeyConstraintWhenMigrating = true
-	} else if dbProvider == "postgres" {
-
-		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s",
-			os.Getenv("DB_HOST"),
-			os.Getenv("DB_USER"),
-			os.Getenv("DB_PASSWORD"),
-			os.Getenv("DB_NAME"),
-			os.Getenv("DB_PORT"),
-		)
-
-		database, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-		if err != nil {
-			panic(err)
-		}
+	database, err := openDatabase()
+	if err != nil {
+		panic(err)
+	}
 
-		db, err := database.DB()
-		if err != nil {
-			panic(err)
-		}
-		db.SetConnMaxLifetime(time.Minute * 5)
-		db.SetConnMaxIdleTime(time.Minute * 5)
+	broker, err := newBroker(database)
+	if err != nil {
+		panic(err)
+	}
 
+	deliverer, err := newDeliverer(database)
+	if err != nil {
+		panic(err)
 	}
 
-	if err := database.AutoMigrate(
-		&api.Group{},
-		&api.Membership{},
-		&api.User{},
-		&api.Post{},
-		&api.Message{},
-		&api.Acknowledgement{},
-		&api.Credits{},
-		&api.Notification{},
-		&api.Image{},
-	); err != nil {
+	jobRunner, err := newJobRunner(database)
+	if err != nil {
 		panic(err)
 	}
 
-	groupStore := groups.NewGroupStore(database)
-	membershipStore := memberships.NewMembershipStore(database)
-	userStore := users.NewUserStore(database)
-	postStore := posts.NewPostStore(database)
-	messageStore := messages.NewMessageStore(database)
-	acknowledgementStore := acknowledgements.NewAcknowledgementStore(database)
-	creditsStore := credits.NewCreditStore(database)
-	cookieStore := sessions.NewCookieStore([]byte("secret"))
+	blobStore, err := newBlobStore()
+	if err != nil {
+		panic(err)
+	}
+
+	err = cmd.run(newStores(database, broker, deliverer, jobRunner, blobStore), args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runServe(s *stores, args []string) error {
+
+	flags := newFlagSet("serve")
+	runMigrations := flags.Bool("migrate", true, "migrate the database before starting the server")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	searchEngine := search.NewEngine(s.db)
+	if *runMigrations {
+		if err := migrate(s, searchEngine); err != nil {
+			return err
+		}
+	}
+
+	// The emails are sent by every replica, each notification is claimed by
+	// one of them
+	go s.deliverer.Run()
+
+	cookieStore, err := newCookieStore()
+	if err != nil {
+		return err
+	}
 	alertManager := utils.NewAlertManager(cookieStore)
-	notificationStore := notifications.NewNotificationStore(database)
-	imageStore := images.NewImageStore(database)
 
 	_, _ = template.New("").Funcs(map[string]interface{}{
 		"session": func() interface{} {
@@ -312,6 +339,9 @@ func main() {
 		"getMembership": func(groupID string, userID string) (*api.Membership, error) {
 			return nil, nil
 		},
+		"getRoles": func(groupID string) ([]*api.Role, error) {
+			return nil, nil
+		},
 		"loggedInUserID": func() string {
 			return ""
 		},
@@ -342,6 +372,9 @@ func main() {
 		handler.PostKey: func() *api.Post {
 			return nil
 		},
+		handler.ConversationKey: func() *api.Conversation {
+			return nil
+		},
 		handler.AuthenticatedUserKey: func() *api.User {
 			return nil
 		},
@@ -363,24 +396,51 @@ func main() {
 			template.New("main").Funcs(funcMap).ParseGlob(fmt.Sprintf("%s/*.gohtml", viewsDir)),
 		),
 		cookieStore:       cookieStore,
-		membershipStore:   membershipStore,
+		membershipStore:   s.membershipStore,
+		roleStore:         s.roleStore,
 		alertManager:      alertManager,
-		notificationStore: notificationStore,
+		notificationStore: s.notificationStore,
+	}
+
+	// The provider is fetched once at startup. If it cannot be reached, it
+	// is fetched again on the next login attempt
+	authenticator := handler.NewAuthenticator(handler.AuthenticatorConfigFromEnv(), s.loginStore)
+	if err := authenticator.Init(context.Background()); err != nil {
+		fmt.Println(fmt.Errorf("failed to initialize oidc authenticator: %w", err))
+	}
+
+	imageURLSigner, err := newImageURLSigner()
+	if err != nil {
+		return err
 	}
 
 	h := handler.NewHandler(
 		cookieStore,
-		groupStore,
-		membershipStore,
-		userStore,
-		postStore,
-		creditsStore,
-		acknowledgementStore,
-		messageStore,
-		notificationStore,
-		imageStore,
+		authenticator,
+		s.groupStore,
+		s.membershipStore,
+		s.userStore,
+		s.postStore,
+		s.ledgerStore,
+		s.acknowledgementStore,
+		s.messageStore,
+		s.notificationStore,
+		s.imageStore,
+		s.tokenStore,
+		s.invitationStore,
+		s.roleStore,
+		s.exchangeStore,
+		s.snapshotStore,
+		s.conversationStore,
+		s.emailStore,
+		s.jobStore,
+		s.blobStore,
+		searchEngine,
+		s.broker,
+		s.jobRunner,
+		imageURLSigner,
 		alertManager,
-		database,
+		s.db,
 	)
 
 	e := echo.New()
@@ -390,9 +450,13 @@ func main() {
 
 	h.Register(e)
 
+	// Every replica runs the jobs, each job is claimed by one of them
+	h.RegisterJobs()
+	go s.jobRunner.Run()
+
 	listenAddress := os.Getenv("LISTEN_ADDRESS")
 	if listenAddress == "" {
 		listenAddress = ":8000"
 	}
-	e.Logger.Fatal(e.Start(listenAddress))
+	return e.Start(listenAddress)
 }
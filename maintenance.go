@@ -0,0 +1,114 @@
+package main
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/maintenance"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// findUser returns the user with the given ID, or with the given email when
+// the value contains an @
+func findUser(s *stores, idOrEmail string) (*api.User, error) {
+	var user *api.User
+	var err error
+	if strings.Contains(idOrEmail, "@") {
+		user, err = s.userStore.GetByEmail(idOrEmail)
+	} else {
+		user, err = s.userStore.Get(idOrEmail)
+	}
+	if errors.Is(err, echo.ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no user %s, users must sign in once before being found", idOrEmail)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func runGrantAdmin(s *stores, args []string) error {
+	flags := newFlagSet("grant-admin")
+	revoke := flags.Bool("revoke", false, "revoke the administration rights instead of granting them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	user, err := findUser(s, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.SetSiteAdministrator(user.ID, !*revoke); err != nil {
+		return err
+	}
+
+	if *revoke {
+		fmt.Printf("%s (%s) is no longer a site administrator\n", user.Username, user.ID)
+	} else {
+		fmt.Printf("%s (%s) is now a site administrator\n", user.Username, user.ID)
+	}
+	return nil
+}
+
+func runPurgeDeleted(s *stores, args []string) error {
+	flags := newFlagSet("purge-deleted")
+	olderThan := flags.Duration("older-than", 30*24*time.Hour, "only purge the posts deleted at least this long ago")
+	dryRun := flags.Bool("dry-run", false, "list the posts that would be purged without purging them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || *olderThan < 0 {
+		flags.Usage()
+		return errUsage
+	}
+	before := time.Now().Add(-*olderThan)
+
+	if *dryRun {
+		posts, err := maintenance.FindDeletedPosts(s.db, before)
+		if err != nil {
+			return err
+		}
+		for _, post := range posts {
+			fmt.Printf("%s\t%s\t%s\n", post.ID, post.DeletedAt.Format(time.RFC3339), post.Title)
+		}
+		fmt.Printf("%d posts would be purged\n", len(posts))
+		return nil
+	}
+
+	posts, err := maintenance.PurgeDeletedPosts(s.db, s.blobStore, before)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d posts were purged\n", len(posts))
+	return nil
+}
+
+// runClear is the command line version of the clear button of the admin
+// page. The flag guards against clearing a database by mistake
+func runClear(s *stores, args []string) error {
+	flags := newFlagSet("clear")
+	confirmed := flags.Bool("yes-delete-everything", false, "confirm that all the data of the site must be deleted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+	if !*confirmed {
+		flags.Usage()
+		return errors.New("refusing to delete all the data without --yes-delete-everything")
+	}
+	if err := maintenance.Clear(s.db); err != nil {
+		return err
+	}
+	fmt.Println("all the data was deleted")
+	return nil
+}
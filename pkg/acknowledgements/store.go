@@ -2,15 +2,18 @@ package acknowledgements
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/pagination"
 	"cp/pkg/utils"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Store interface {
 	Save(acknowledgement *api.Acknowledgement) error
-	GetForUser(userID string) ([]*api.Acknowledgement, error)
-	GetForGroup(groupID string) ([]*api.Acknowledgement, error)
-	GetAllInGroup(groupID string) ([]*api.Acknowledgement, error)
+	GetForUser(userID string, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error)
+	GetForGroup(groupID string, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error)
+	GetAllInGroup(groupID string, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error)
+	GetInGroupBetween(groupID string, after, before time.Time) ([]*api.Acknowledgement, error)
 }
 
 type AcknowledgementStore struct {
@@ -25,55 +28,37 @@ func (s *AcknowledgementStore) Save(acknowledgement *api.Acknowledgement) error
 	return s.db.Create(acknowledgement).Error
 }
 
-func (s *AcknowledgementStore) GetForUser(userID string) ([]*api.Acknowledgement, error) {
-	var acknowledgements []*api.Acknowledgement
-	if err := s.db.
-		Model(&api.Acknowledgement{}).
-		Find(&acknowledgements, "sent_to_user_id = ?", userID).
-		Error; err != nil {
-		return nil, err
-	}
-
-	var allTargets []*api.Target
-	for _, acknowledgement := range acknowledgements {
-		allTargets = append(allTargets, acknowledgement.SentBy)
-		allTargets = append(allTargets, acknowledgement.SentTo)
-	}
-	if err := utils.PopulateTargets(s.db, allTargets); err != nil {
-		return nil, err
-	}
-	return acknowledgements, nil
+func (s *AcknowledgementStore) GetForUser(userID string, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error) {
+	return s.find(s.db.Where("sent_to_user_id = ?", userID), page)
 }
 
-func (s *AcknowledgementStore) GetForGroup(groupID string) ([]*api.Acknowledgement, error) {
-	var acknowledgements []*api.Acknowledgement
-	if err := s.db.
-		Model(&api.Acknowledgement{}).
-		Find(&acknowledgements, "sent_to_group_id = ?", groupID).
-		Error; err != nil {
-		return nil, err
-	}
+func (s *AcknowledgementStore) GetForGroup(groupID string, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error) {
+	return s.find(s.db.Where("sent_to_group_id = ?", groupID), page)
+}
 
-	var allTargets []*api.Target
-	for _, acknowledgement := range acknowledgements {
-		allTargets = append(allTargets, acknowledgement.SentBy)
-		allTargets = append(allTargets, acknowledgement.SentTo)
-	}
-	if err := utils.PopulateTargets(s.db, allTargets); err != nil {
-		return nil, err
-	}
+func (s *AcknowledgementStore) GetAllInGroup(groupID string, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error) {
+	return s.find(s.db.Where("group_id = ?", groupID), page)
+}
 
-	return acknowledgements, nil
+// GetInGroupBetween returns the acknowledgements of the group created
+// strictly between after and before, a zero time leaving the range open
+func (s *AcknowledgementStore) GetInGroupBetween(groupID string, after, before time.Time) ([]*api.Acknowledgement, error) {
+	query := utils.Between(s.db.Where("group_id = ?", groupID), "created_at", after, before)
+	acknowledgements, _, err := s.find(query, nil)
+	return acknowledgements, err
 }
 
-func (s *AcknowledgementStore) GetAllInGroup(groupID string) ([]*api.Acknowledgement, error) {
+// find returns a page of the acknowledgements matching the query, newest
+// first, with their targets populated
+func (s *AcknowledgementStore) find(query *gorm.DB, page *pagination.Page) ([]*api.Acknowledgement, *pagination.Cursor, error) {
 	var acknowledgements []*api.Acknowledgement
-	if err := s.db.
-		Model(&api.Acknowledgement{}).
-		Find(&acknowledgements, "group_id = ?", groupID).
+	if err := page.Apply(query.Model(&api.Acknowledgement{}), "acknowledgements", true).
+		Find(&acknowledgements).
 		Error; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	count, more := page.Trim(len(acknowledgements))
+	acknowledgements = acknowledgements[:count]
 
 	var allTargets []*api.Target
 	for _, acknowledgement := range acknowledgements {
@@ -81,8 +66,12 @@ func (s *AcknowledgementStore) GetAllInGroup(groupID string) ([]*api.Acknowledge
 		allTargets = append(allTargets, acknowledgement.SentTo)
 	}
 	if err := utils.PopulateTargets(s.db, allTargets); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return acknowledgements, nil
+	if !more {
+		return acknowledgements, nil, nil
+	}
+	last := acknowledgements[count-1]
+	return acknowledgements, &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
 }
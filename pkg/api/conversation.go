@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// MaxConversationParticipants is the number of users allowed in a
+// conversation, including the user starting it
+const MaxConversationParticipants = 10
+
+// Conversation is a private thread between members of a group. Its messages
+// have the ID of the conversation as thread ID, and are only visible to the
+// participants
+type Conversation struct {
+	ID            string
+	GroupID       string
+	Group         *Group
+	Subject       string
+	CreatedByID   string
+	CreatedBy     *User
+	Participants  []*ConversationParticipant
+	LastMessageAt time.Time
+	CreatedAt     time.Time
+}
+
+// ConversationParticipant is a user taking part in a conversation. The
+// messages sent after ReadAt are unread by the participant
+type ConversationParticipant struct {
+	ConversationID string `gorm:"primaryKey"`
+	UserID         string `gorm:"primaryKey"`
+	User           *User
+	ReadAt         *time.Time
+	CreatedAt      time.Time
+}
+
+// Participant returns the participant of the user, or nil when the user does
+// not take part in the conversation
+func (c *Conversation) Participant(userID string) *ConversationParticipant {
+	for _, participant := range c.Participants {
+		if participant.UserID == userID {
+			return participant
+		}
+	}
+	return nil
+}
+
+func (c *Conversation) IsParticipant(userID string) bool {
+	return c.Participant(userID) != nil
+}
+
+// Name returns the subject of the conversation, or the usernames of the
+// participants when there is no subject
+func (c *Conversation) Name() string {
+	if c.Subject != "" {
+		return c.Subject
+	}
+	var usernames []string
+	for _, participant := range c.Participants {
+		if participant.User != nil {
+			usernames = append(usernames, participant.User.Username)
+		}
+	}
+	return strings.Join(usernames, ", ")
+}
+
+// SeenBy returns the participants other than the author who read the
+// conversation after the message was sent
+func (c *Conversation) SeenBy(message *Message) []*User {
+	var result []*User
+	for _, participant := range c.Participants {
+		if participant.UserID == message.AuthorID || participant.ReadAt == nil || participant.User == nil {
+			continue
+		}
+		if !participant.ReadAt.Before(message.CreatedAt) {
+			result = append(result, participant.User)
+		}
+	}
+	return result
+}
+
+// HTMLLink links to the conversation in the inbox of the user
+func (c *Conversation) HTMLLink(userID string) string {
+	return fmt.Sprintf(`<a href="/users/%s/conversations/%s">%s</a>`, userID, c.ID, html.EscapeString(c.Name()))
+}
@@ -0,0 +1,68 @@
+package api
+
+import "time"
+
+type EmailFrequency string
+
+const (
+	EmailNever       EmailFrequency = "never"
+	EmailImmediately EmailFrequency = "immediately"
+	EmailDaily       EmailFrequency = "daily"
+	EmailWeekly      EmailFrequency = "weekly"
+)
+
+// DefaultEmailFrequency applies to the users who never chose how often they
+// receive emails
+const DefaultEmailFrequency = EmailDaily
+
+var EmailFrequencies = []EmailFrequency{
+	EmailImmediately,
+	EmailDaily,
+	EmailWeekly,
+	EmailNever,
+}
+
+func (f EmailFrequency) IsValid() bool {
+	for _, frequency := range EmailFrequencies {
+		if f == frequency {
+			return true
+		}
+	}
+	return false
+}
+
+func (f EmailFrequency) Label() string {
+	switch f {
+	case EmailNever:
+		return "Never"
+	case EmailImmediately:
+		return "Immediately"
+	case EmailDaily:
+		return "Daily digest"
+	case EmailWeekly:
+		return "Weekly digest"
+	}
+	return string(f)
+}
+
+// Period returns the time between two digests, or zero when the
+// notifications are not grouped in digests
+func (f EmailFrequency) Period() time.Duration {
+	switch f {
+	case EmailDaily:
+		return 24 * time.Hour
+	case EmailWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// EmailPreference is how often the notifications of a user are emailed.
+// UnsubscribeToken authenticates the unsubscribe links of the emails
+type EmailPreference struct {
+	UserID           string `gorm:"primaryKey"`
+	Frequency        EmailFrequency
+	UnsubscribeToken string
+	LastDigestAt     *time.Time
+	UpdatedAt        time.Time
+}
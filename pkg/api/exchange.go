@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+type ExchangeStatus string
+
+const (
+	// ExchangeProposed is the status of an exchange waiting for the post
+	// author to accept or decline it
+	ExchangeProposed ExchangeStatus = "proposed"
+	// ExchangeAccepted is the status of an exchange in progress, waiting for
+	// both parties to mark it as done
+	ExchangeAccepted  ExchangeStatus = "accepted"
+	ExchangeDeclined  ExchangeStatus = "declined"
+	ExchangeCancelled ExchangeStatus = "cancelled"
+	// ExchangeCompleted is the status of an exchange done by both parties,
+	// and for which the credits were transferred
+	ExchangeCompleted ExchangeStatus = "completed"
+)
+
+func (s ExchangeStatus) IsProposed() bool {
+	return s == ExchangeProposed
+}
+
+func (s ExchangeStatus) IsAccepted() bool {
+	return s == ExchangeAccepted
+}
+
+func (s ExchangeStatus) IsCompleted() bool {
+	return s == ExchangeCompleted
+}
+
+// IsOpen returns true if the exchange can still be accepted, marked as done
+// or cancelled
+func (s ExchangeStatus) IsOpen() bool {
+	return s == ExchangeProposed || s == ExchangeAccepted
+}
+
+// Exchange is the agreement between the author of an offer or request post
+// and a member responding to it. Once both parties marked the exchange as
+// done, the agreed amount of credits is transferred
+type Exchange struct {
+	ID              string
+	GroupID         string
+	Group           *Group
+	PostID          string
+	Post            *Post
+	ResponderID     string
+	Responder       *User
+	Amount          time.Duration
+	Notes           string
+	Status          ExchangeStatus
+	AuthorDoneAt    *time.Time
+	ResponderDoneAt *time.Time
+	JournalEntryID  *string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// IsParty returns true if the user is the author of the post or the
+// responder
+func (e *Exchange) IsParty(userID string) bool {
+	return userID == e.ResponderID || (e.Post != nil && userID == e.Post.AuthorID)
+}
+
+// IsDoneBy returns true if the user already marked the exchange as done
+func (e *Exchange) IsDoneBy(userID string) bool {
+	if userID == e.ResponderID {
+		return e.ResponderDoneAt != nil
+	}
+	if e.Post != nil && userID == e.Post.AuthorID {
+		return e.AuthorDoneAt != nil
+	}
+	return false
+}
+
+// Payer returns the account the credits are sent from. The responder pays
+// for an offer, and the author pays for a request
+func (e *Exchange) Payer() *Target {
+	userID := e.ResponderID
+	if e.Post.Type == RequestPost {
+		userID = e.Post.AuthorID
+	}
+	return &Target{Type: UserTarget, UserID: &userID}
+}
+
+// Payee returns the account the credits are sent to
+func (e *Exchange) Payee() *Target {
+	userID := e.Post.AuthorID
+	if e.Post.Type == RequestPost {
+		userID = e.ResponderID
+	}
+	return &Target{Type: UserTarget, UserID: &userID}
+}
+
+func (e *Exchange) HTMLLink() string {
+	return fmt.Sprintf(`<a href="/groups/%s/posts/%s#exchange-%s">exchange</a>`, e.GroupID, e.PostID, e.ID)
+}
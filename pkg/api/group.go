@@ -2,18 +2,60 @@ package api
 
 import (
 	"fmt"
+	"html"
 	"time"
 )
 
+const (
+	DefaultMemberOverdraftLimit = 10 * time.Hour
+	DefaultGroupOverdraftLimit  = 100 * time.Hour
+	// GroupDeletionGracePeriod is the time a deleted group can be restored,
+	// before it is purged with all its data
+	GroupDeletionGracePeriod = 30 * 24 * time.Hour
+)
+
 type Group struct {
-	ID           string
-	Name         string
-	Memberships  []*Membership
-	Posts        []*Post
-	CreatedAt    time.Time
+	ID                   string
+	Name                 string
+	Memberships          []*Membership
+	Posts                []*Post
+	CreatedAt            time.Time
+	MemberOverdraftLimit time.Duration `gorm:"default:36000000000000"`
+	GroupOverdraftLimit  time.Duration `gorm:"default:360000000000000"`
+	// ArchivedAt is set while the group is read only
+	ArchivedAt *time.Time
+	// DeletedAt is set while the group is deleted, and can be restored. It
+	// is not a gorm soft delete, so that the deleted groups can be loaded
+	// along with the memberships and the posts
+	DeletedAt    *time.Time
 	MyMembership *Membership `gorm:"-"`
 }
 
 func (g Group) HTMLLink() string {
-	return fmt.Sprintf(`<a href="/groups/%s">%s</a>`, g.ID, g.Name)
+	return fmt.Sprintf(`<a href="/groups/%s">%s</a>`, g.ID, html.EscapeString(g.Name))
+}
+
+func (g Group) IsArchived() bool {
+	return g.ArchivedAt != nil
+}
+
+func (g Group) IsDeleted() bool {
+	return g.DeletedAt != nil
+}
+
+// PurgeAt returns the time a deleted group is purged
+func (g Group) PurgeAt() time.Time {
+	if g.DeletedAt == nil {
+		return time.Time{}
+	}
+	return g.DeletedAt.Add(GroupDeletionGracePeriod)
+}
+
+// OverdraftLimitFor returns how far below zero the balance of the given
+// target is allowed to go
+func (g Group) OverdraftLimitFor(target *Target) time.Duration {
+	if target.IsGroup() {
+		return g.GroupOverdraftLimit
+	}
+	return g.MemberOverdraftLimit
 }
@@ -0,0 +1,30 @@
+package api
+
+import "time"
+
+// HistorySnapshot holds the running totals of the group history after the
+// entries created until Until, so that the history can be computed from
+// there instead of from the first entry
+type HistorySnapshot struct {
+	ID              string
+	GroupID         string
+	Until           time.Time
+	AllRequestCount int
+	AllOfferCount   int
+	RequestCount    int
+	OfferCount      int
+	Credits         time.Duration
+	Users           []*HistorySnapshotUser `gorm:"foreignKey:SnapshotID"`
+	CreatedAt       time.Time
+}
+
+// HistorySnapshotUser holds the running totals of a user in a HistorySnapshot
+type HistorySnapshotUser struct {
+	ID           string
+	SnapshotID   string
+	UserID       string
+	User         *User
+	RequestCount int
+	OfferCount   int
+	Credits      time.Duration
+}
@@ -0,0 +1,43 @@
+package api
+
+import "time"
+
+// Invitation lets people join a group without waiting for an admin to
+// confirm them. The group side of the membership is confirmed as soon as
+// the invitation is redeemed.
+type Invitation struct {
+	ID          string
+	GroupID     string
+	Group       *Group
+	CreatedByID string
+	CreatedBy   *User
+	Code        string `gorm:"uniqueIndex"`
+	// MaxUses is the number of times the invitation can be redeemed.
+	// Zero means unlimited
+	MaxUses   int
+	Uses      int
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+func (i *Invitation) IsRevoked() bool {
+	return i.RevokedAt != nil
+}
+
+func (i *Invitation) IsExpired() bool {
+	return i.ExpiresAt != nil && !time.Now().Before(*i.ExpiresAt)
+}
+
+func (i *Invitation) IsExhausted() bool {
+	return i.MaxUses > 0 && i.Uses >= i.MaxUses
+}
+
+// IsValid returns true if the invitation can still be redeemed
+func (i *Invitation) IsValid() bool {
+	return !i.IsRevoked() && !i.IsExpired() && !i.IsExhausted()
+}
+
+func (i *Invitation) Link() string {
+	return "/invite/" + i.Code
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	// JobDead is the status of the jobs that failed on every attempt. They
+	// stay in the queue until an administrator retries or deletes them
+	JobDead JobStatus = "dead"
+)
+
+// JobStatuses are the statuses the admin page filters the jobs by
+var JobStatuses = []JobStatus{
+	JobPending,
+	JobRunning,
+	JobSucceeded,
+	JobDead,
+}
+
+func (s JobStatus) IsValid() bool {
+	for _, status := range JobStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Job is work run in the background by the workers of the job runner.
+// Payload is the json encoded argument of the handler of the kind. A failed
+// job is tried again at RunAt, until it reaches MaxAttempts
+type Job struct {
+	ID          string
+	Kind        string
+	Payload     string
+	Status      JobStatus
+	Attempts    int
+	MaxAttempts int
+	LastError   string
+	RunAt       time.Time
+	LockedAt    *time.Time
+	FinishedAt  *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Decode unmarshals the payload of the job into v
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
+
+// IsRetrying is true for the pending jobs that already failed
+func (j *Job) IsRetrying() bool {
+	return j.Status == JobPending && j.Attempts > 0
+}
@@ -0,0 +1,80 @@
+package api
+
+import "time"
+
+// Account is a ledger account held either by a user within a group or by the
+// group itself
+type Account struct {
+	ID        string
+	GroupID   string
+	Group     *Group
+	Owner     *Target `gorm:"embedded;embeddedPrefix:owner_"`
+	CreatedAt time.Time
+}
+
+// JournalEntry is an immutable, balanced set of postings. Entries are never
+// updated nor deleted, mistakes are corrected by posting a reversal entry.
+// Entries settling an exchange reference the post the credits paid for.
+type JournalEntry struct {
+	ID           string
+	GroupID      string
+	Group        *Group
+	Notes        string
+	ReversalOfID *string
+	PostID       *string
+	Post         *Post
+	Postings     []*Posting `gorm:"foreignKey:EntryID"`
+	CreatedAt    time.Time
+}
+
+type Posting struct {
+	ID        string
+	EntryID   string
+	AccountID string
+	Account   *Account
+	Amount    time.Duration
+}
+
+func (e *JournalEntry) IsReversal() bool {
+	return e.ReversalOfID != nil
+}
+
+// Debits returns the postings withdrawing credits from an account
+func (e *JournalEntry) Debits() []*Posting {
+	var result []*Posting
+	for _, posting := range e.Postings {
+		if posting.Amount < 0 {
+			result = append(result, posting)
+		}
+	}
+	return result
+}
+
+// Credits returns the postings depositing credits into an account
+func (e *JournalEntry) Credits() []*Posting {
+	var result []*Posting
+	for _, posting := range e.Postings {
+		if posting.Amount > 0 {
+			result = append(result, posting)
+		}
+	}
+	return result
+}
+
+// Amount returns the total amount of credits moved by the entry
+func (e *JournalEntry) Amount() time.Duration {
+	var total time.Duration
+	for _, posting := range e.Credits() {
+		total += posting.Amount
+	}
+	return total
+}
+
+// IsBalanced returns true if the postings of the entry sum up to zero
+func (e *JournalEntry) IsBalanced() bool {
+	var total time.Duration
+	for _, posting := range e.Postings {
+		total += posting.Amount
+	}
+	return total == 0
+}
@@ -0,0 +1,16 @@
+package api
+
+import "time"
+
+// Login holds the tokens of the identity provider for a browser session.
+// They are kept on the server, the session cookie only holds the ID of the
+// login along with the profile of the user
+type Login struct {
+	ID           string
+	UserID       string
+	IDToken      string
+	RefreshToken string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
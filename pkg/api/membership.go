@@ -6,6 +6,8 @@ type Membership struct {
 	GroupID         string `gorm:"primaryKey"`
 	UserID          string `gorm:"primaryKey"`
 	Permission      MembershipPermission
+	RoleID          *string
+	Role            *Role
 	User            *User
 	Group           *Group
 	MemberConfirmed bool
@@ -21,10 +23,35 @@ func (m *Membership) IsOwner() bool {
 	return m.IsActive() && m.Permission == Owner
 }
 
+// GetRole returns the custom role of the membership, or the built-in role
+// of its permission
+func (m *Membership) GetRole() *Role {
+	if m.RoleID != nil && m.Role != nil {
+		return m.Role
+	}
+	return GetBuiltInRole(m.Permission)
+}
+
+// HasCapability returns true if the membership is active, and its role has
+// the capability
+func (m *Membership) HasCapability(capability Capability) bool {
+	if !m.IsActive() {
+		return false
+	}
+	role := m.GetRole()
+	return role != nil && role.Has(capability)
+}
+
 func (m *Membership) IsActive() bool {
 	return m.GroupConfirmed && m.MemberConfirmed
 }
 
+// IsPendingApproval returns true if the user requested to join the group,
+// and is waiting for an admin to approve the request
+func (m *Membership) IsPendingApproval() bool {
+	return m.MemberConfirmed && !m.GroupConfirmed
+}
+
 type MembershipPermission string
 
 func (m MembershipPermission) Gte(o MembershipPermission) bool {
@@ -2,12 +2,90 @@ package api
 
 import "time"
 
+type NotificationType string
+
+const (
+	MessageNotification         NotificationType = "message"
+	MembershipNotification      NotificationType = "membership"
+	CreditsNotification         NotificationType = "credits"
+	AcknowledgementNotification NotificationType = "acknowledgement"
+	ExchangeNotification        NotificationType = "exchange"
+)
+
+// NotificationTypes are the types of notifications a user can mute
+var NotificationTypes = []NotificationType{
+	MessageNotification,
+	MembershipNotification,
+	CreditsNotification,
+	AcknowledgementNotification,
+	ExchangeNotification,
+}
+
+func (t NotificationType) IsValid() bool {
+	for _, notificationType := range NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+func (t NotificationType) Label() string {
+	switch t {
+	case MessageNotification:
+		return "Messages"
+	case MembershipNotification:
+		return "Memberships"
+	case CreditsNotification:
+		return "Credits"
+	case AcknowledgementNotification:
+		return "Acknowledgements"
+	case ExchangeNotification:
+		return "Exchanges"
+	}
+	return string(t)
+}
+
 type Notification struct {
-	ID        string
-	UserID    string
-	User      *User
-	Title     string
-	Message   string
-	Link      string
+	ID     string
+	UserID string
+	User   *User
+	Type   NotificationType
+	// GroupID is the group the notification is about, if any
+	GroupID *string
+	Title   string
+	Message string
+	Link    string
+	ReadAt  *time.Time
+	// EmailedAt is set once the notification was emailed, or skipped by the
+	// email preferences of the user. EmailBatchID is the email it was sent in
+	EmailedAt    *time.Time
+	EmailBatchID *string
+	CreatedAt    time.Time
+}
+
+func (n *Notification) IsRead() bool {
+	return n.ReadAt != nil
+}
+
+// NotificationMute stops the notifications of a type, or about a group, from
+// being sent to the user. Either Type or GroupID is empty
+type NotificationMute struct {
+	UserID    string           `gorm:"primaryKey"`
+	Type      NotificationType `gorm:"primaryKey"`
+	GroupID   string           `gorm:"primaryKey"`
 	CreatedAt time.Time
 }
+
+func (m *NotificationMute) Mutes(notification *Notification) bool {
+	if m.UserID != notification.UserID {
+		return false
+	}
+	if m.Type != "" && m.Type != notification.Type {
+		return false
+	}
+	if m.GroupID != "" && (notification.GroupID == nil || m.GroupID != *notification.GroupID) {
+		return false
+	}
+	return true
+}
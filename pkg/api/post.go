@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"gorm.io/gorm"
+	"html"
 	"time"
 )
 
@@ -25,7 +26,7 @@ type Post struct {
 }
 
 func (p Post) HTMLLink() string {
-	return fmt.Sprintf(`<a href="/groups/%s/posts/%s">%s</a>`, p.GroupID, p.ID, p.Title)
+	return fmt.Sprintf(`<a href="/groups/%s/posts/%s">%s</a>`, p.GroupID, p.ID, html.EscapeString(p.Title))
 }
 
 type PostType string
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Capability string
+
+const (
+	// ManageMembersCapability allows inviting, approving, removing members
+	// and assigning them roles
+	ManageMembersCapability Capability = "manage_members"
+	// SendFromGroupCapability allows sending credits and acknowledgements
+	// from the group account
+	SendFromGroupCapability Capability = "send_from_group"
+	// DeleteAnyPostCapability allows deleting the posts of other members
+	DeleteAnyPostCapability Capability = "delete_any_post"
+	// ManageRolesCapability allows defining the custom roles of the group
+	ManageRolesCapability Capability = "manage_roles"
+	// ManageSettingsCapability allows changing the group settings
+	ManageSettingsCapability Capability = "manage_settings"
+	// DeleteGroupCapability allows deleting the group
+	DeleteGroupCapability Capability = "delete_group"
+)
+
+// AllCapabilities lists the capabilities in the order they are displayed
+var AllCapabilities = []Capability{
+	ManageMembersCapability,
+	SendFromGroupCapability,
+	DeleteAnyPostCapability,
+	ManageRolesCapability,
+	ManageSettingsCapability,
+	DeleteGroupCapability,
+}
+
+func (c Capability) IsValid() bool {
+	for _, capability := range AllCapabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Capability) Description() string {
+	switch c {
+	case ManageMembersCapability:
+		return "Invite, approve and remove members, and assign roles"
+	case SendFromGroupCapability:
+		return "Send credits and acknowledgements from the group account"
+	case DeleteAnyPostCapability:
+		return "Delete the posts of other members"
+	case ManageRolesCapability:
+		return "Create and delete roles"
+	case ManageSettingsCapability:
+		return "Change the group settings"
+	case DeleteGroupCapability:
+		return "Delete the group"
+	}
+	return string(c)
+}
+
+// Capabilities is stored as a comma separated list
+type Capabilities []Capability
+
+func (c Capabilities) Value() (driver.Value, error) {
+	var values []string
+	for _, capability := range c {
+		values = append(values, string(capability))
+	}
+	return strings.Join(values, ","), nil
+}
+
+func (c *Capabilities) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case nil:
+		str = ""
+	default:
+		return fmt.Errorf("cannot scan %T into capabilities", value)
+	}
+	*c = Capabilities{}
+	for _, capability := range strings.Split(str, ",") {
+		if capability != "" {
+			*c = append(*c, Capability(capability))
+		}
+	}
+	return nil
+}
+
+func (c Capabilities) Has(capability Capability) bool {
+	for _, cap := range c {
+		if cap == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Role is a named set of capabilities assigned to the members of a group.
+// Every role is based on a built-in permission, which defines how roles rank
+// against each other. Built-in roles are not stored, and memberships without
+// a role have the built-in role of their permission.
+type Role struct {
+	ID           string
+	GroupID      string
+	Name         string
+	Permission   MembershipPermission
+	Capabilities Capabilities `gorm:"type:text"`
+	CreatedAt    time.Time
+}
+
+func (r *Role) IsBuiltIn() bool {
+	return r.GroupID == ""
+}
+
+func (r *Role) Has(capability Capability) bool {
+	return r.Capabilities.Has(capability)
+}
+
+// Includes returns true if the role has every capability of the other role
+func (r *Role) Includes(other *Role) bool {
+	for _, capability := range other.Capabilities {
+		if !r.Has(capability) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	MemberRole = &Role{
+		ID:           string(Member),
+		Name:         "Member",
+		Permission:   Member,
+		Capabilities: Capabilities{},
+	}
+	AdminRole = &Role{
+		ID:         string(Admin),
+		Name:       "Admin",
+		Permission: Admin,
+		Capabilities: Capabilities{
+			ManageMembersCapability,
+			SendFromGroupCapability,
+		},
+	}
+	OwnerRole = &Role{
+		ID:           string(Owner),
+		Name:         "Owner",
+		Permission:   Owner,
+		Capabilities: AllCapabilities,
+	}
+	BuiltInRoles = []*Role{OwnerRole, AdminRole, MemberRole}
+)
+
+// GetBuiltInRole returns the built-in role of the permission, or nil for
+// memberships that are not confirmed yet
+func GetBuiltInRole(permission MembershipPermission) *Role {
+	for _, role := range BuiltInRoles {
+		if role.Permission == permission {
+			return role
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package api
+
+import "time"
+
+type TokenScope string
+
+const (
+	ReadScope  TokenScope = "read"
+	WriteScope TokenScope = "write"
+)
+
+// PersonalAccessToken authenticates non-browser clients on behalf of a user.
+// Only the SHA-256 hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         string
+	UserID     string
+	User       *User
+	Name       string
+	TokenHash  string `gorm:"uniqueIndex"`
+	Prefix     string
+	Scope      TokenScope
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (t *PersonalAccessToken) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
+// CanWrite returns true if the token allows requests that modify data
+func (t *PersonalAccessToken) CanWrite() bool {
+	return t.Scope == WriteScope
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"html"
 	"time"
 )
 
@@ -14,9 +15,13 @@ type User struct {
 	ContactInfo      string
 	About            string
 	ProfilePictureID string
-	CreatedAt        time.Time
+	// SiteAdministrator is set with the grant-admin command, for the users
+	// administering the site without being in the administrators group of
+	// the identity provider
+	SiteAdministrator bool
+	CreatedAt         time.Time
 }
 
 func (u User) HTMLLink() string {
-	return fmt.Sprintf(`<a href="/users/%s">%s</a>`, u.ID, u.Username)
+	return fmt.Sprintf(`<a href="/users/%s">%s</a>`, u.ID, html.EscapeString(u.Username))
 }
@@ -0,0 +1,49 @@
+// Package blobs stores the files of the site, such as the images of the
+// posts and the profile pictures. The file store keeps them on a local
+// disk, the S3 store in a bucket shared by the replicas of the server, and
+// the memory store stands in for them in development and tests.
+package blobs
+
+import (
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Info describes a stored blob
+type Info struct {
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	// ETag changes whenever the content of the blob changes. It is a
+	// quoted string, as in the ETag header
+	ETag string
+}
+
+// Store keeps blobs by key. Keys are slash separated relative paths, such
+// as images/thumb/groups/<id>/posts/<id>/<id>.jpg
+type Store interface {
+	// Put writes a blob, replacing the blob with the same key
+	Put(key string, src io.Reader, contentType string) error
+	// Get returns the content of a blob, to be closed by the caller, or
+	// echo.ErrNotFound
+	Get(key string) (io.ReadCloser, *Info, error)
+	// Delete removes a blob. Removing a missing blob is not an error
+	Delete(key string) error
+	// DeleteAll removes the blobs under a directory, that is the blobs
+	// whose key starts with dir followed by a slash
+	DeleteAll(dir string) error
+}
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// checkKey rejects the keys which are not clean relative paths, so that a
+// key built from a request cannot escape the directory of a file store
+func checkKey(key string) error {
+	if key == "" || key == "." || path.Clean(key) != key || path.IsAbs(key) || key == ".." || strings.HasPrefix(key, "../") {
+		return ErrInvalidKey
+	}
+	return nil
+}
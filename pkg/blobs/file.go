@@ -0,0 +1,104 @@
+package blobs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FileStore keeps the blobs as files of a directory. Their content type is
+// guessed from the extension of the key
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+var _ Store = &FileStore{}
+
+func (s *FileStore) Put(key string, src io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	filePath := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+
+	// the blob is written to a temporary file renamed once complete, so
+	// that readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, src); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+func (s *FileStore) Get(key string) (io.ReadCloser, *Info, error) {
+	if err := checkKey(key); err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if stat.IsDir() {
+		file.Close()
+		return nil, nil, echo.ErrNotFound
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return file, &Info{
+		Size:        stat.Size(),
+		ContentType: contentType,
+		ModTime:     stat.ModTime(),
+		ETag:        fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+	}, nil
+}
+
+func (s *FileStore) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) DeleteAll(dir string) error {
+	if err := checkKey(dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.path(dir))
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
@@ -0,0 +1,82 @@
+package blobs
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	put(t, store, "posts/1/a.jpg", "content")
+	content, info := get(t, store, "posts/1/a.jpg")
+	if content != "content" || info.Size != 7 || info.ContentType != "image/jpeg" || info.ETag == "" {
+		t.Fatalf("blob is %q %+v", content, info)
+	}
+	for _, key := range []string{"posts/1/missing.jpg", "posts/1"} {
+		if _, _, err := store.Get(key); !errors.Is(err, echo.ErrNotFound) {
+			t.Fatalf("get %s: %v, expected not found", key, err)
+		}
+	}
+
+	put(t, store, "posts/1/b/c.jpg", "content")
+	put(t, store, "posts/10/a.jpg", "content")
+	if err := store.DeleteAll("posts/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Get("posts/1/b/c.jpg"); !errors.Is(err, echo.ErrNotFound) {
+		t.Fatalf("get deleted: %v, expected not found", err)
+	}
+	get(t, store, "posts/10/a.jpg")
+	if err := store.Delete("posts/10/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("posts/10/a.jpg"); err != nil {
+		t.Fatalf("delete missing: %v", err)
+	}
+}
+
+func TestFileStoreInvalidKeys(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "blobs")
+	store := NewFileStore(dir)
+	outside := filepath.Join(root, "outside.jpg")
+	if err := os.WriteFile(outside, []byte("outside"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"",
+		".",
+		"..",
+		"../outside.jpg",
+		"posts/../../outside.jpg",
+		"posts/..",
+		"/outside.jpg",
+		filepath.ToSlash(outside),
+		"posts//a.jpg",
+		"posts/./a.jpg",
+		"posts/a.jpg/",
+	} {
+		if err := store.Put(key, strings.NewReader("replaced"), "image/jpeg"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("put %q: %v, expected an invalid key", key, err)
+		}
+		if _, _, err := store.Get(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("get %q: %v, expected an invalid key", key, err)
+		}
+		if err := store.Delete(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("delete %q: %v, expected an invalid key", key, err)
+		}
+		if err := store.DeleteAll(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("delete all %q: %v, expected an invalid key", key, err)
+		}
+	}
+
+	content, err := os.ReadFile(outside)
+	if err != nil || string(content) != "outside" {
+		t.Fatalf("the file outside of the store was changed: %q %v", content, err)
+	}
+}
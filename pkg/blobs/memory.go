@@ -0,0 +1,105 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the blobs in memory. They are lost when the process
+// exits
+type MemoryStore struct {
+	lock  sync.RWMutex
+	blobs map[string]*memoryBlob
+}
+
+type memoryBlob struct {
+	content []byte
+	info    Info
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: map[string]*memoryBlob{}}
+}
+
+var _ Store = &MemoryStore{}
+
+func (s *MemoryStore) Put(key string, src io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.blobs[key] = &memoryBlob{
+		content: content,
+		info: Info{
+			Size:        int64(len(content)),
+			ContentType: contentType,
+			ModTime:     time.Now(),
+			ETag:        fmt.Sprintf(`"%x"`, sha256.Sum256(content)),
+		},
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(key string) (io.ReadCloser, *Info, error) {
+	if err := checkKey(key); err != nil {
+		return nil, nil, err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return nil, nil, echo.ErrNotFound
+	}
+	info := blob.info
+	return ioutil.NopCloser(bytes.NewReader(blob.content)), &info, nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *MemoryStore) DeleteAll(dir string) error {
+	if err := checkKey(dir); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for key := range s.blobs {
+		if strings.HasPrefix(key, dir+"/") {
+			delete(s.blobs, key)
+		}
+	}
+	return nil
+}
+
+// Keys returns the keys of the stored blobs, sorted, for the tests to
+// inspect them
+func (s *MemoryStore) Keys() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var keys []string
+	for key := range s.blobs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,308 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config is the bucket of an S3 store. Endpoint is the base URL of the
+// service, such as https://s3.eu-west-1.amazonaws.com or the URL of a
+// MinIO server
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store keeps the blobs in a bucket of an S3 compatible service, so that
+// they are shared by the replicas of the server. The bucket is addressed
+// with path style URLs, which every S3 compatible service supports
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3Store(config S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("missing S3 bucket")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+var _ Store = &S3Store{}
+
+func (s *S3Store) Put(key string, src io.Reader, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	// the payload is signed, the blobs are images small enough to be read
+	// in memory
+	content, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	req, err := s.newRequest(http.MethodPut, key, nil, content)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	res, err := s.do(req, content)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, *Info, error) {
+	if err := checkKey(key); err != nil {
+		return nil, nil, err
+	}
+	req, err := s.newRequest(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := s.do(req, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &Info{
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		ETag:        res.Header.Get("ETag"),
+	}
+	if modTime, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return res.Body, info, nil
+}
+
+func (s *S3Store) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := s.newRequest(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, nil)
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// listResult is the response of ListObjectsV2
+type listResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Store) DeleteAll(dir string) error {
+	if err := checkKey(dir); err != nil {
+		return err
+	}
+	// the objects are listed again after each page of deletes, the
+	// continuation token of a listing is not valid once the listed objects
+	// are deleted
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", dir+"/")
+		req, err := s.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+		res, err := s.do(req, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, object := range result.Contents {
+			if err := s.Delete(object.Key); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || len(result.Contents) == 0 {
+			return nil
+		}
+	}
+}
+
+// newRequest returns a request on a key of the bucket, or on the bucket
+// itself when the key is empty
+func (s *S3Store) newRequest(method string, key string, query url.Values, content []byte) (*http.Request, error) {
+	u := *s.endpoint
+	u.RawPath = u.Path + "/" + escapePath(s.config.Bucket)
+	u.Path = u.Path + "/" + s.config.Bucket
+	if key != "" {
+		u.RawPath += "/" + escapePath(key)
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalQuery(query)
+	return http.NewRequest(method, u.String(), bytes.NewReader(content))
+}
+
+// do signs and sends a request. Responses with an error status are closed,
+// and returned as an error
+func (s *S3Store) do(req *http.Request, content []byte) (*http.Response, error) {
+	sign(req, content, s.config, time.Now())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, echo.ErrNotFound
+	}
+	var s3Error struct {
+		Code    string
+		Message string
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if xml.Unmarshal(body, &s3Error) == nil && s3Error.Code != "" {
+		return nil, fmt.Errorf("s3: %s %s: %s: %s", req.Method, req.URL.Path, s3Error.Code, s3Error.Message)
+	}
+	return nil, fmt.Errorf("s3: %s %s: %s", req.Method, req.URL.Path, res.Status)
+}
+
+// sign adds the headers of an AWS Signature Version 4 to a request. The
+// host and every header already set on the request are signed
+func sign(req *http.Request, content []byte, config S3Config, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(content)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+config.SecretAccessKey), date)
+	key = hmacSHA256(key, config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes a query with its keys sorted, as signed
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, escape(key, true)+"="+escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapePath(p string) string {
+	return escape(p, false)
+}
+
+// escape encodes every byte but the unreserved characters, and the slashes
+// of paths
+func escape(s string, encodeSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(s) {
+		if 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' ||
+			b == '-' || b == '.' || b == '_' || b == '~' || b == '/' && !encodeSlash {
+			result.WriteByte(b)
+		} else {
+			fmt.Fprintf(&result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,157 @@
+package conversations
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/pagination"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type Store interface {
+	Create(groupID string, createdByID string, subject string, participantIDs []string) (*api.Conversation, error)
+	Get(conversationID string) (*api.Conversation, error)
+	GetForUser(userID string, page *pagination.Page) ([]*api.Conversation, *pagination.Cursor, error)
+	CountUnread(userID string) (map[string]int, error)
+	MarkRead(conversationID string, userID string, at time.Time) error
+	Touch(conversationID string, at time.Time) error
+}
+
+type ConversationStore struct {
+	db *gorm.DB
+}
+
+func NewConversationStore(db *gorm.DB) *ConversationStore {
+	return &ConversationStore{db: db}
+}
+
+var _ Store = &ConversationStore{}
+
+// Create starts a conversation between the creator and the participants.
+// The creator is added to the participants if needed
+func (s *ConversationStore) Create(groupID string, createdByID string, subject string, participantIDs []string) (*api.Conversation, error) {
+	now := time.Now()
+	conversation := &api.Conversation{
+		ID:            uuid.NewV4().String(),
+		GroupID:       groupID,
+		Subject:       subject,
+		CreatedByID:   createdByID,
+		LastMessageAt: now,
+		CreatedAt:     now,
+	}
+	conversation.Participants = append(conversation.Participants, &api.ConversationParticipant{
+		ConversationID: conversation.ID,
+		UserID:         createdByID,
+		ReadAt:         &now,
+	})
+	for _, userID := range participantIDs {
+		if conversation.IsParticipant(userID) {
+			continue
+		}
+		conversation.Participants = append(conversation.Participants, &api.ConversationParticipant{
+			ConversationID: conversation.ID,
+			UserID:         userID,
+		})
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Group", "CreatedBy", "Participants").Create(conversation).Error; err != nil {
+			return err
+		}
+		return tx.Omit("User").Create(conversation.Participants).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conversation, nil
+}
+
+func (s *ConversationStore) Get(conversationID string) (*api.Conversation, error) {
+	var result api.Conversation
+	err := s.db.
+		Preload("Group").
+		Preload("Participants", func(db *gorm.DB) *gorm.DB {
+			return db.Order("conversation_participants.created_at asc")
+		}).
+		Preload("Participants.User").
+		First(&result, "id = ?", conversationID).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetForUser returns a page of the conversations of the user, the ones with
+// the latest messages first
+func (s *ConversationStore) GetForUser(userID string, page *pagination.Page) ([]*api.Conversation, *pagination.Cursor, error) {
+	var result []*api.Conversation
+	query := s.db.
+		Model(&api.Conversation{}).
+		Preload("Group").
+		Preload("Participants.User").
+		Joins("join conversation_participants on conversation_participants.conversation_id = conversations.id").
+		Where("conversation_participants.user_id = ?", userID).
+		Where("conversations.group_id in (select id from groups where deleted_at is null)")
+	if err := page.ApplyBy(query, "conversations", "last_message_at", true).Find(&result).Error; err != nil {
+		return nil, nil, err
+	}
+	count, more := page.Trim(len(result))
+	result = result[:count]
+	if !more {
+		return result, nil, nil
+	}
+	last := result[count-1]
+	return result, &pagination.Cursor{CreatedAt: last.LastMessageAt, ID: last.ID}, nil
+}
+
+// CountUnread returns the number of messages the user did not read, by
+// conversation. The conversations without unread messages are left out
+func (s *ConversationStore) CountUnread(userID string) (map[string]int, error) {
+	var rows []struct {
+		ThreadID string
+		Count    int
+	}
+	if err := s.db.Raw(`select m.thread_id as thread_id, count(*) as count
+		from messages m
+		join conversation_participants p on p.conversation_id = m.thread_id and p.user_id = ?
+		join conversations c on c.id = p.conversation_id
+		join groups g on g.id = c.group_id and g.deleted_at is null
+		where m.author_id <> ? and (p.read_at is null or m.created_at > p.read_at)
+		group by m.thread_id`, userID, userID).
+		Scan(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+	result := map[string]int{}
+	for _, row := range rows {
+		result[row.ThreadID] = row.Count
+	}
+	return result, nil
+}
+
+// MarkRead records that the participant read the messages sent until the
+// given time
+func (s *ConversationStore) MarkRead(conversationID string, userID string, at time.Time) error {
+	return s.db.
+		Model(&api.ConversationParticipant{}).
+		Where("conversation_id = ? and user_id = ?", conversationID, userID).
+		Where("read_at is null or read_at < ?", at).
+		Update("read_at", at).
+		Error
+}
+
+// Touch moves the conversation to the top of the inboxes, when a message is
+// sent
+func (s *ConversationStore) Touch(conversationID string, at time.Time) error {
+	return s.db.
+		Model(&api.Conversation{}).
+		Where("id = ?", conversationID).
+		Update("last_message_at", at).
+		Error
+}
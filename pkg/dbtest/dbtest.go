@@ -0,0 +1,35 @@
+// Package dbtest opens the databases of the tests: a SQLite file in the
+// temporary directory of the test, with the foreign keys enforced.
+package dbtest
+
+import (
+	"cp/pkg/migrations"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"path/filepath"
+	"testing"
+)
+
+// Open returns a database with every migration applied
+func Open(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := OpenEmpty(t)
+	if _, err := migrations.NewMigrator(db).Up(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// OpenEmpty returns a database without any table, for the tests of the
+// migrations
+func OpenEmpty(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=1"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
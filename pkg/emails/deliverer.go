@@ -0,0 +1,255 @@
+// Package emails delivers the notifications by email, one email per
+// notification or in daily and weekly digests, depending on the preference
+// of each user.
+package emails
+
+import (
+	"bytes"
+	"cp/pkg/api"
+	"cp/pkg/mailer"
+	"cp/pkg/notifications"
+	"cp/pkg/users"
+	"embed"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"log"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFiles embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/*.txt.tmpl"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/*.html.tmpl"))
+)
+
+// sweepInterval is the time between two checks of the pending
+// notifications, for the digests and the notifications added by the other
+// processes
+const sweepInterval = time.Minute
+
+// Deliverer is the queue of the notifications store. It is woken up by the
+// new notifications, but reads the pending notifications from the database,
+// so that the notifications added while it was not running are delivered too
+type Deliverer struct {
+	store   Store
+	users   users.Store
+	mailer  mailer.Mailer
+	baseURL string
+	wake    chan string
+}
+
+// NewDeliverer sends the emails with the mailer. The links of the emails
+// point to baseURL
+func NewDeliverer(store Store, userStore users.Store, m mailer.Mailer, baseURL string) *Deliverer {
+	return &Deliverer{
+		store:   store,
+		users:   userStore,
+		mailer:  m,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		wake:    make(chan string, 64),
+	}
+}
+
+var _ notifications.Queue = &Deliverer{}
+
+// Enqueue wakes the deliverer up for the recipients of the notifications. It
+// never blocks, the notifications missed are delivered on the next sweep
+func (d *Deliverer) Enqueue(notifications ...*api.Notification) {
+	seen := map[string]bool{}
+	for _, notification := range notifications {
+		if seen[notification.UserID] {
+			continue
+		}
+		seen[notification.UserID] = true
+		select {
+		case d.wake <- notification.UserID:
+		default:
+		}
+	}
+}
+
+// Run delivers the notifications until the process exits
+func (d *Deliverer) Run() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	d.Sweep()
+	for {
+		select {
+		case userID := <-d.wake:
+			if err := d.Deliver(userID); err != nil {
+				log.Printf("emails: failed to deliver the notifications of %s: %v", userID, err)
+			}
+		case <-ticker.C:
+			d.Sweep()
+		}
+	}
+}
+
+// Sweep delivers the pending notifications of all the users
+func (d *Deliverer) Sweep() {
+	userIDs, err := d.store.GetPendingUserIDs()
+	if err != nil {
+		log.Printf("emails: failed to list the pending notifications: %v", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if err := d.Deliver(userID); err != nil {
+			log.Printf("emails: failed to deliver the notifications of %s: %v", userID, err)
+		}
+	}
+}
+
+// Deliver emails the pending notifications of the user, if the preference
+// of the user allows it now. The notifications of the users without email,
+// or who never want emails, are skipped
+func (d *Deliverer) Deliver(userID string) error {
+
+	preference, err := d.store.GetPreference(userID)
+	if err != nil {
+		return err
+	}
+
+	digest := preference.Frequency.Period() > 0
+	if digest && preference.LastDigestAt != nil && time.Since(*preference.LastDigestAt) < preference.Frequency.Period() {
+		return nil
+	}
+
+	batchID, pending, err := d.store.Claim(userID)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 || preference.Frequency == api.EmailNever {
+		return nil
+	}
+
+	user, err := d.users.Get(userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return nil
+	}
+
+	message, err := d.compose(user, preference, pending, digest)
+	if err != nil {
+		return err
+	}
+	if err := d.mailer.Send(message); err != nil {
+		if releaseErr := d.store.Release(batchID); releaseErr != nil {
+			log.Printf("emails: failed to release batch %s: %v", batchID, releaseErr)
+		}
+		return err
+	}
+
+	if digest {
+		return d.store.SetLastDigestAt(userID, time.Now())
+	}
+	return nil
+}
+
+type notificationView struct {
+	Title       string
+	Message     string
+	URL         string
+	TitleHTML   htmltemplate.HTML
+	MessageHTML htmltemplate.HTML
+}
+
+type emailView struct {
+	User           *api.User
+	Digest         bool
+	Period         api.EmailFrequency
+	Notifications  []*notificationView
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+func (d *Deliverer) compose(user *api.User, preference *api.EmailPreference, pending []*api.Notification, digest bool) (*mailer.Message, error) {
+
+	view := &emailView{
+		User:           user,
+		Digest:         digest,
+		Period:         preference.Frequency,
+		SettingsURL:    fmt.Sprintf("%s/users/%s/notifications/settings", d.baseURL, user.ID),
+		UnsubscribeURL: fmt.Sprintf("%s/unsubscribe/%s", d.baseURL, preference.UnsubscribeToken),
+	}
+	for _, notification := range pending {
+		// The notifications are HTML written by the handlers, with links
+		// relative to the site. The text of the users in them is escaped by
+		// the HTMLLink helpers of the api package
+		view.Notifications = append(view.Notifications, &notificationView{
+			Title:       toText(notification.Title),
+			Message:     toText(notification.Message),
+			URL:         d.linkURL(notification.Link),
+			TitleHTML:   htmltemplate.HTML(d.absoluteLinks(notification.Title)),
+			MessageHTML: htmltemplate.HTML(d.absoluteLinks(notification.Message)),
+		})
+	}
+
+	var subject string
+	switch {
+	case digest:
+		subject = fmt.Sprintf("Your %s digest: %s", preference.Frequency, countNotifications(len(pending)))
+	case len(pending) == 1:
+		subject = view.Notifications[0].Title
+	default:
+		subject = countNotifications(len(pending))
+	}
+
+	var text bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, "notifications.txt.tmpl", view); err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&body, "notifications.html.tmpl", view); err != nil {
+		return nil, err
+	}
+
+	return &mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    body.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", view.UnsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+func countNotifications(count int) string {
+	if count == 1 {
+		return "1 new notification"
+	}
+	return fmt.Sprintf("%d new notifications", count)
+}
+
+var (
+	tagPattern  = regexp.MustCompile(`<[^>]*>`)
+	hrefPattern = regexp.MustCompile(`href="([^"]*)"`)
+)
+
+// toText strips the tags of an HTML snippet
+func toText(snippet string) string {
+	return html.UnescapeString(tagPattern.ReplaceAllString(snippet, ""))
+}
+
+// absoluteLinks makes the links of an HTML snippet point to the site
+func (d *Deliverer) absoluteLinks(snippet string) string {
+	return strings.ReplaceAll(snippet, `href="/`, fmt.Sprintf(`href="%s/`, d.baseURL))
+}
+
+// linkURL returns the absolute URL of the first link of an HTML snippet
+func (d *Deliverer) linkURL(snippet string) string {
+	match := hrefPattern.FindStringSubmatch(d.absoluteLinks(snippet))
+	if match == nil {
+		return ""
+	}
+	return html.UnescapeString(match[1])
+}
@@ -0,0 +1,302 @@
+package emails
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/events"
+	"cp/pkg/mailer"
+	"cp/pkg/notifications"
+	"cp/pkg/users"
+	"errors"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deliveryTest is a user whose notifications are emailed to a memory mailer
+type deliveryTest struct {
+	db            *gorm.DB
+	store         *EmailStore
+	notifications *notifications.NotificationStore
+	mailer        *mailer.MemoryMailer
+	deliverer     *Deliverer
+	user          *api.User
+	groupID       string
+}
+
+func newDeliveryTest(t *testing.T, frequency api.EmailFrequency) *deliveryTest {
+	t.Helper()
+	db := dbtest.Open(t)
+
+	test := &deliveryTest{
+		db:      db,
+		store:   NewEmailStore(db),
+		mailer:  mailer.NewMemoryMailer(),
+		groupID: uuid.NewV4().String(),
+		user: &api.User{
+			ID:       uuid.NewV4().String(),
+			Username: "alice",
+			Email:    "alice@example.com",
+		},
+	}
+	test.deliverer = NewDeliverer(test.store, users.NewUserStore(db), test.mailer, "https://cp.example.com/")
+	test.notifications = notifications.NewNotificationStore(db, events.Discard, test.deliverer)
+	if err := db.Create(test.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&api.Group{ID: test.groupID, Name: "Group"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := test.store.SetFrequency(test.user.ID, frequency); err != nil {
+		t.Fatal(err)
+	}
+	return test
+}
+
+func (d *deliveryTest) notify(t *testing.T, notificationType api.NotificationType, title string) {
+	t.Helper()
+	if err := d.notifications.AddNotification(&api.Notification{
+		ID:      uuid.NewV4().String(),
+		UserID:  d.user.ID,
+		Type:    notificationType,
+		GroupID: &d.groupID,
+		Title:   title,
+		Message: `See <a href="/groups/` + d.groupID + `">the group</a>`,
+		Link:    `<a href="/groups/` + d.groupID + `">the group</a>`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deliver runs the deliverer, and returns the emails sent meanwhile
+func (d *deliveryTest) deliver(t *testing.T) []*mailer.Message {
+	t.Helper()
+	d.mailer.Reset()
+	if err := d.deliverer.Deliver(d.user.ID); err != nil {
+		t.Fatal(err)
+	}
+	return d.mailer.Messages()
+}
+
+func (d *deliveryTest) pending(t *testing.T) []string {
+	t.Helper()
+	userIDs, err := d.store.GetPendingUserIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userIDs
+}
+
+func (d *deliveryTest) setLastDigestAt(t *testing.T, ago time.Duration) {
+	t.Helper()
+	if err := d.store.SetLastDigestAt(d.user.ID, time.Now().Add(-ago)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverImmediately(t *testing.T) {
+	test := newDeliveryTest(t, api.EmailImmediately)
+	test.notify(t, api.MessageNotification, "New message")
+
+	messages := test.deliver(t)
+	if len(messages) != 1 {
+		t.Fatalf("%d emails, expected 1", len(messages))
+	}
+	message := messages[0]
+	if message.To != "alice@example.com" || message.Subject != "New message" {
+		t.Fatalf("email to %s about %q", message.To, message.Subject)
+	}
+	link := "https://cp.example.com/groups/" + test.groupID
+	if !strings.Contains(message.Text, "See the group") || !strings.Contains(message.Text, link) {
+		t.Fatalf("text is %q", message.Text)
+	}
+	if !strings.Contains(message.HTML, `href="`+link+`"`) {
+		t.Fatalf("html is %q", message.HTML)
+	}
+
+	preference, err := test.store.GetPreference(test.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscribeURL := "https://cp.example.com/unsubscribe/" + preference.UnsubscribeToken
+	if message.Headers["List-Unsubscribe"] != "<"+unsubscribeURL+">" || !strings.Contains(message.Text, unsubscribeURL) {
+		t.Fatalf("the email does not link to %s", unsubscribeURL)
+	}
+
+	// Each notification is emailed once
+	if messages := test.deliver(t); len(messages) != 0 {
+		t.Fatalf("%d emails, expected none", len(messages))
+	}
+
+	test.notify(t, api.MessageNotification, "Another message")
+	test.notify(t, api.CreditsNotification, "Credits")
+	messages = test.deliver(t)
+	if len(messages) != 1 || messages[0].Subject != "2 new notifications" {
+		t.Fatalf("emails are %+v, expected 1 email of 2 notifications", messages)
+	}
+}
+
+func TestDeliverDigests(t *testing.T) {
+	for _, frequency := range []api.EmailFrequency{api.EmailDaily, api.EmailWeekly} {
+		t.Run(string(frequency), func(t *testing.T) {
+			test := newDeliveryTest(t, frequency)
+			period := frequency.Period()
+
+			// The first digest is sent right away
+			test.notify(t, api.MessageNotification, "New message")
+			test.notify(t, api.CreditsNotification, "Credits")
+			messages := test.deliver(t)
+			if len(messages) != 1 {
+				t.Fatalf("%d emails, expected 1", len(messages))
+			}
+			if expected := "Your " + string(frequency) + " digest: 2 new notifications"; messages[0].Subject != expected {
+				t.Fatalf("subject is %q, expected %q", messages[0].Subject, expected)
+			}
+
+			// The next ones wait for the end of the period
+			test.notify(t, api.MessageNotification, "Another message")
+			if messages := test.deliver(t); len(messages) != 0 {
+				t.Fatalf("%d emails, expected none before the end of the period", len(messages))
+			}
+			if pending := test.pending(t); len(pending) != 1 {
+				t.Fatalf("%d users with pending notifications, expected 1", len(pending))
+			}
+
+			test.setLastDigestAt(t, period-time.Hour)
+			if messages := test.deliver(t); len(messages) != 0 {
+				t.Fatalf("%d emails, expected none before the end of the period", len(messages))
+			}
+
+			test.setLastDigestAt(t, period+time.Hour)
+			messages = test.deliver(t)
+			if len(messages) != 1 || !strings.Contains(messages[0].Text, "Another message") {
+				t.Fatalf("emails are %+v, expected the digest of the other message", messages)
+			}
+			if pending := test.pending(t); len(pending) != 0 {
+				t.Fatalf("%d users with pending notifications, expected none", len(pending))
+			}
+		})
+	}
+}
+
+func TestDeliverNever(t *testing.T) {
+	test := newDeliveryTest(t, api.EmailNever)
+	test.notify(t, api.MessageNotification, "New message")
+	if messages := test.deliver(t); len(messages) != 0 {
+		t.Fatalf("%d emails, expected none", len(messages))
+	}
+
+	// The notifications are skipped, they are not emailed once the user
+	// subscribes again
+	if pending := test.pending(t); len(pending) != 0 {
+		t.Fatalf("%d users with pending notifications, expected none", len(pending))
+	}
+	if err := test.store.SetFrequency(test.user.ID, api.EmailImmediately); err != nil {
+		t.Fatal(err)
+	}
+	if messages := test.deliver(t); len(messages) != 0 {
+		t.Fatalf("%d emails, expected none", len(messages))
+	}
+}
+
+func TestDeliverMuted(t *testing.T) {
+	test := newDeliveryTest(t, api.EmailImmediately)
+	if err := test.notifications.SetMutes(test.user.ID, []*api.NotificationMute{
+		{Type: api.CreditsNotification},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	test.notify(t, api.CreditsNotification, "Credits")
+	if messages := test.deliver(t); len(messages) != 0 {
+		t.Fatalf("%d emails, expected none for a muted type", len(messages))
+	}
+
+	test.notify(t, api.MessageNotification, "New message")
+	messages := test.deliver(t)
+	if len(messages) != 1 || messages[0].Subject != "New message" {
+		t.Fatalf("emails are %+v, expected the message only", messages)
+	}
+
+	if err := test.notifications.SetMutes(test.user.ID, []*api.NotificationMute{
+		{GroupID: test.groupID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	test.notify(t, api.MessageNotification, "Muted message")
+	if messages := test.deliver(t); len(messages) != 0 {
+		t.Fatalf("%d emails, expected none for a muted group", len(messages))
+	}
+}
+
+func TestDeliverUnsubscribed(t *testing.T) {
+	test := newDeliveryTest(t, api.EmailImmediately)
+	preference, err := test.store.GetPreference(test.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byToken, err := test.store.GetPreferenceByToken(preference.UnsubscribeToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byToken.UserID != test.user.ID {
+		t.Fatalf("the token is the one of %s", byToken.UserID)
+	}
+	if _, err := test.store.GetPreferenceByToken("invalid"); err == nil {
+		t.Fatal("an invalid token was accepted")
+	}
+
+	if err := test.store.SetFrequency(byToken.UserID, api.EmailNever); err != nil {
+		t.Fatal(err)
+	}
+	test.notify(t, api.MessageNotification, "New message")
+	if messages := test.deliver(t); len(messages) != 0 {
+		t.Fatalf("%d emails, expected none once unsubscribed", len(messages))
+	}
+}
+
+// failingMailer fails to send the emails
+type failingMailer struct{}
+
+func (failingMailer) Send(*mailer.Message) error {
+	return errors.New("unavailable")
+}
+
+func TestDeliverFailure(t *testing.T) {
+	test := newDeliveryTest(t, api.EmailImmediately)
+	test.deliverer.mailer = failingMailer{}
+	test.notify(t, api.MessageNotification, "New message")
+	if err := test.deliverer.Deliver(test.user.ID); err == nil {
+		t.Fatal("the failure was not returned")
+	}
+
+	// The notifications are delivered on the next attempt
+	test.deliverer.mailer = test.mailer
+	if pending := test.pending(t); len(pending) != 1 {
+		t.Fatalf("%d users with pending notifications, expected 1", len(pending))
+	}
+	if messages := test.deliver(t); len(messages) != 1 {
+		t.Fatalf("%d emails, expected 1", len(messages))
+	}
+}
+
+func TestDeliverEscapesUserText(t *testing.T) {
+	test := newDeliveryTest(t, api.EmailImmediately)
+	post := api.Post{ID: uuid.NewV4().String(), GroupID: test.groupID, Title: `<img src=x onerror=alert(1)>`}
+	test.notify(t, api.ExchangeNotification, "New exchange on "+post.HTMLLink())
+
+	messages := test.deliver(t)
+	if len(messages) != 1 {
+		t.Fatalf("%d emails, expected 1", len(messages))
+	}
+	message := messages[0]
+	if strings.Contains(message.HTML, "<img") || !strings.Contains(message.HTML, "&lt;img src=x onerror=alert(1)&gt;") {
+		t.Fatalf("html is %q", message.HTML)
+	}
+	if message.Subject != "New exchange on <img src=x onerror=alert(1)>" {
+		t.Fatalf("subject is %q", message.Subject)
+	}
+}
@@ -0,0 +1,145 @@
+package emails
+
+import (
+	"cp/pkg/api"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type Store interface {
+	GetPreference(userID string) (*api.EmailPreference, error)
+	GetPreferenceByToken(token string) (*api.EmailPreference, error)
+	SetFrequency(userID string, frequency api.EmailFrequency) error
+	SetLastDigestAt(userID string, at time.Time) error
+	GetPendingUserIDs() ([]string, error)
+	Claim(userID string) (string, []*api.Notification, error)
+	Release(batchID string) error
+}
+
+type EmailStore struct {
+	db *gorm.DB
+}
+
+func NewEmailStore(db *gorm.DB) *EmailStore {
+	return &EmailStore{db: db}
+}
+
+var _ Store = &EmailStore{}
+
+// GetPreference returns the email preference of the user. It is created with
+// the default frequency the first time, so that the user can unsubscribe
+func (s *EmailStore) GetPreference(userID string) (*api.EmailPreference, error) {
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&api.EmailPreference{
+		UserID:           userID,
+		Frequency:        api.DefaultEmailFrequency,
+		UnsubscribeToken: token,
+	}).Error; err != nil {
+		return nil, err
+	}
+	var result api.EmailPreference
+	if err := s.db.First(&result, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *EmailStore) GetPreferenceByToken(token string) (*api.EmailPreference, error) {
+	var result api.EmailPreference
+	err := s.db.First(&result, "unsubscribe_token = ?", token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *EmailStore) SetFrequency(userID string, frequency api.EmailFrequency) error {
+	if _, err := s.GetPreference(userID); err != nil {
+		return err
+	}
+	return s.db.
+		Model(&api.EmailPreference{}).
+		Where("user_id = ?", userID).
+		Update("frequency", frequency).
+		Error
+}
+
+func (s *EmailStore) SetLastDigestAt(userID string, at time.Time) error {
+	return s.db.
+		Model(&api.EmailPreference{}).
+		Where("user_id = ?", userID).
+		Update("last_digest_at", at).
+		Error
+}
+
+// GetPendingUserIDs returns the users having notifications not emailed yet
+func (s *EmailStore) GetPendingUserIDs() ([]string, error) {
+	var result []string
+	if err := s.db.
+		Model(&api.Notification{}).
+		Where("emailed_at is null").
+		Distinct().
+		Pluck("user_id", &result).
+		Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Claim marks the pending notifications of the user as emailed, and returns
+// them with the ID of their batch. Several processes may deliver the
+// notifications, each notification is only claimed once
+func (s *EmailStore) Claim(userID string) (string, []*api.Notification, error) {
+	batchID := uuid.NewV4().String()
+	if err := s.db.
+		Model(&api.Notification{}).
+		Where("user_id = ? and emailed_at is null", userID).
+		Updates(map[string]interface{}{
+			"emailed_at":     time.Now(),
+			"email_batch_id": batchID,
+		}).
+		Error; err != nil {
+		return "", nil, err
+	}
+	var result []*api.Notification
+	if err := s.db.
+		Order("created_at asc").
+		Find(&result, "email_batch_id = ?", batchID).
+		Error; err != nil {
+		return "", nil, err
+	}
+	return batchID, result, nil
+}
+
+// Release makes the notifications of a batch pending again, when the email
+// could not be sent
+func (s *EmailStore) Release(batchID string) error {
+	return s.db.
+		Model(&api.Notification{}).
+		Where("email_batch_id = ?", batchID).
+		Updates(map[string]interface{}{
+			"emailed_at":     nil,
+			"email_batch_id": nil,
+		}).
+		Error
+}
+
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
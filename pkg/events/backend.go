@@ -0,0 +1,117 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// Backend shares the events between the replicas of the server
+type Backend interface {
+	// Publish sends the event to the other replicas
+	Publish(event *Event) error
+	// Listen calls receive with the events published by the other replicas.
+	// It blocks while listening
+	Listen(receive func(event *Event)) error
+}
+
+// LocalBackend is the backend of a single replica, it shares nothing
+type LocalBackend struct{}
+
+var _ Backend = LocalBackend{}
+
+func (LocalBackend) Publish(*Event) error {
+	return nil
+}
+
+func (LocalBackend) Listen(func(event *Event)) error {
+	return nil
+}
+
+// postgresChannel is the channel of the NOTIFY commands. Postgres limits
+// their payload to 8000 bytes, the larger events are only delivered on the
+// replica publishing them
+const (
+	postgresChannel    = "commonpool_events"
+	postgresMaxPayload = 8000
+)
+
+// postgresEnvelope marks the events with the replica publishing them, since
+// the notifications are also received by the replica sending them
+type postgresEnvelope struct {
+	Origin string `json:"origin"`
+	Event  *Event `json:"event"`
+}
+
+// PostgresBackend shares the events between the replicas connected to the
+// same database, with LISTEN and NOTIFY
+type PostgresBackend struct {
+	db     *gorm.DB
+	dsn    string
+	origin string
+}
+
+// NewPostgresBackend publishes with db, and listens on a connection of its
+// own opened with dsn
+func NewPostgresBackend(db *gorm.DB, dsn string) *PostgresBackend {
+	return &PostgresBackend{
+		db:     db,
+		dsn:    dsn,
+		origin: uuid.NewV4().String(),
+	}
+}
+
+var _ Backend = &PostgresBackend{}
+
+func (b *PostgresBackend) Publish(event *Event) error {
+	payload, err := json.Marshal(&postgresEnvelope{Origin: b.origin, Event: event})
+	if err != nil {
+		return err
+	}
+	if len(payload) >= postgresMaxPayload {
+		return fmt.Errorf("event of %d bytes is too large for postgres", len(payload))
+	}
+	return b.db.Exec("select pg_notify(?, ?)", postgresChannel, string(payload)).Error
+}
+
+// Listen connects again after a pause when the connection is lost. The
+// events published in the meantime are missed
+func (b *PostgresBackend) Listen(receive func(event *Event)) error {
+	for {
+		err := b.listen(receive)
+		log.Printf("events: lost the postgres connection, listening again in 5s: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (b *PostgresBackend) listen(receive func(event *Event)) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, "listen "+postgresChannel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var envelope postgresEnvelope
+		if err := json.Unmarshal([]byte(notification.Payload), &envelope); err != nil {
+			log.Printf("events: ignoring invalid notification: %v", err)
+			continue
+		}
+		if envelope.Origin == b.origin || envelope.Event == nil {
+			continue
+		}
+		receive(envelope.Event)
+	}
+}
@@ -0,0 +1,143 @@
+// Package events pushes the changes made on the site to the connected
+// users. The stores publish events to a broker, which delivers them to the
+// subscriptions of their topic on this replica and, through its backend, on
+// the other replicas of the server.
+package events
+
+import (
+	"log"
+	"sync"
+)
+
+type Type string
+
+const (
+	MessageSent       Type = "message"
+	NotificationAdded Type = "notification"
+	MembershipChanged Type = "membership"
+)
+
+// Event is delivered to the subscriptions of its topic. Data is encoded as
+// json for the clients and the other replicas
+type Event struct {
+	Type  Type        `json:"type"`
+	Topic string      `json:"topic"`
+	Data  interface{} `json:"data"`
+}
+
+// UserTopic receives the events of a user: notifications and changes of
+// memberships
+func UserTopic(userID string) string {
+	return "users/" + userID
+}
+
+// ThreadTopic receives the messages sent on a thread, the replies of a post
+// or a conversation
+func ThreadTopic(threadID string) string {
+	return "threads/" + threadID
+}
+
+// Publisher is implemented by the broker. Publishing never fails the write
+// that caused the event, errors of the backend are logged
+type Publisher interface {
+	Publish(event *Event)
+}
+
+type discard struct{}
+
+func (discard) Publish(*Event) {}
+
+// Discard drops the events, for the stores writing rows that may not be
+// committed
+var Discard Publisher = discard{}
+
+// subscriptionBuffer is the number of events kept for a slow subscriber.
+// The events are dropped once the buffer is full
+const subscriptionBuffer = 16
+
+type Broker struct {
+	backend       Backend
+	listen        sync.Once
+	lock          sync.Mutex
+	subscriptions map[string]map[*Subscription]bool
+}
+
+func NewBroker(backend Backend) *Broker {
+	return &Broker{
+		backend:       backend,
+		subscriptions: map[string]map[*Subscription]bool{},
+	}
+}
+
+var _ Publisher = &Broker{}
+
+// Publish delivers the event to the subscriptions of this replica, and sends
+// it to the other replicas
+func (b *Broker) Publish(event *Event) {
+	b.deliver(event)
+	if err := b.backend.Publish(event); err != nil {
+		log.Printf("events: failed to publish %s event to %s: %v", event.Type, event.Topic, err)
+	}
+}
+
+// Subscribe returns a subscription to the events of the topics. The broker
+// listens to the other replicas from the first subscription on, so that the
+// commands publishing events do not listen
+func (b *Broker) Subscribe(topics ...string) *Subscription {
+	b.listen.Do(func() {
+		go func() {
+			if err := b.backend.Listen(b.deliver); err != nil {
+				log.Printf("events: stopped listening to the other replicas: %v", err)
+			}
+		}()
+	})
+
+	subscription := &Subscription{
+		broker: b,
+		topics: topics,
+		events: make(chan *Event, subscriptionBuffer),
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, topic := range topics {
+		if b.subscriptions[topic] == nil {
+			b.subscriptions[topic] = map[*Subscription]bool{}
+		}
+		b.subscriptions[topic][subscription] = true
+	}
+	return subscription
+}
+
+func (b *Broker) deliver(event *Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for subscription := range b.subscriptions[event.Topic] {
+		select {
+		case subscription.events <- event:
+		default:
+		}
+	}
+}
+
+type Subscription struct {
+	broker *Broker
+	topics []string
+	events chan *Event
+}
+
+// Events returns the channel of the events, closed by Close
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.broker.lock.Lock()
+	defer s.broker.lock.Unlock()
+	for _, topic := range s.topics {
+		delete(s.broker.subscriptions[topic], s)
+		if len(s.broker.subscriptions[topic]) == 0 {
+			delete(s.broker.subscriptions, topic)
+		}
+	}
+	close(s.events)
+}
@@ -0,0 +1,187 @@
+package exchanges
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/ledger"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrInvalidTransition = errors.New("exchange cannot be changed in its current status")
+	ErrAlreadyDone       = errors.New("exchange was already marked as done")
+	// errOtherPartyDone is returned when the other party marked the
+	// exchange done meanwhile, MarkDone then completes it
+	errOtherPartyDone = errors.New("the other party marked the exchange done meanwhile")
+)
+
+type Store interface {
+	Create(exchange *api.Exchange) error
+	Get(exchangeID string) (*api.Exchange, error)
+	GetForPost(postID string) ([]*api.Exchange, error)
+	SetStatus(exchange *api.Exchange, from api.ExchangeStatus, to api.ExchangeStatus) error
+	MarkDone(exchange *api.Exchange, userID string) error
+}
+
+type ExchangeStore struct {
+	db *gorm.DB
+}
+
+func NewExchangeStore(db *gorm.DB) *ExchangeStore {
+	return &ExchangeStore{db: db}
+}
+
+var _ Store = &ExchangeStore{}
+
+func (s *ExchangeStore) Create(exchange *api.Exchange) error {
+	if exchange.ID == "" {
+		exchange.ID = uuid.NewV4().String()
+	}
+	exchange.Status = api.ExchangeProposed
+	return s.db.Omit("Group", "Post", "Responder").Create(exchange).Error
+}
+
+func (s *ExchangeStore) Get(exchangeID string) (*api.Exchange, error) {
+	var result api.Exchange
+	err := s.db.
+		Preload("Post.Author").
+		Preload("Responder").
+		Model(&api.Exchange{}).
+		First(&result, "id = ?", exchangeID).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *ExchangeStore) GetForPost(postID string) ([]*api.Exchange, error) {
+	var result []*api.Exchange
+	if err := s.db.
+		Preload("Post").
+		Preload("Responder").
+		Model(&api.Exchange{}).
+		Order("created_at asc").
+		Find(&result, "post_id = ?", postID).
+		Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetStatus moves the exchange from one status to another. The update is
+// conditional, so that concurrent requests cannot both succeed
+func (s *ExchangeStore) SetStatus(exchange *api.Exchange, from api.ExchangeStatus, to api.ExchangeStatus) error {
+	result := s.db.
+		Model(&api.Exchange{}).
+		Where("id = ? and status = ?", exchange.ID, from).
+		Updates(map[string]interface{}{
+			"status":     to,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+	exchange.Status = to
+	return nil
+}
+
+// MarkDone records that one of the parties considers the exchange done.
+// When both parties did, the agreed amount is transferred from the payer to
+// the payee, and the exchange is completed. Either everything succeeds, or
+// nothing is written
+func (s *ExchangeStore) MarkDone(exchange *api.Exchange, userID string) error {
+	for {
+		err := s.markDone(exchange, userID)
+		if !errors.Is(err, errOtherPartyDone) {
+			return err
+		}
+	}
+}
+
+func (s *ExchangeStore) markDone(exchange *api.Exchange, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+
+		var current api.Exchange
+		err := tx.Preload("Post").Model(&api.Exchange{}).First(&current, "id = ?", exchange.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if !current.Status.IsAccepted() {
+			return ErrInvalidTransition
+		}
+		if current.IsDoneBy(userID) {
+			return ErrAlreadyDone
+		}
+
+		now := time.Now()
+		column, otherColumn := "author_done_at", "responder_done_at"
+		if userID == current.ResponderID {
+			column, otherColumn = otherColumn, column
+			current.ResponderDoneAt = &now
+		} else {
+			current.AuthorDoneAt = &now
+		}
+		completed := current.AuthorDoneAt != nil && current.ResponderDoneAt != nil
+
+		updates := map[string]interface{}{
+			column:       now,
+			"updated_at": now,
+		}
+
+		if completed {
+			entry := &api.JournalEntry{
+				GroupID: current.GroupID,
+				Notes:   fmt.Sprintf("Exchange for post %s", current.Post.Title),
+				PostID:  &current.PostID,
+			}
+			if err := ledger.TransferWithin(tx, entry, current.Payer(), current.Payee(), current.Amount); err != nil {
+				return err
+			}
+			current.Status = api.ExchangeCompleted
+			current.JournalEntryID = &entry.ID
+			updates["status"] = current.Status
+			updates["journal_entry_id"] = entry.ID
+		}
+
+		query := tx.
+			Model(&api.Exchange{}).
+			Where("id = ? and status = ? and "+column+" is null", current.ID, api.ExchangeAccepted)
+		if !completed {
+			// Both parties may mark the exchange done at the same time, each
+			// seeing the other as not done. The update is retried, so that the
+			// last one completes the exchange
+			query = query.Where(otherColumn + " is null")
+		}
+		result := query.Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if !completed {
+				return errOtherPartyDone
+			}
+			return ErrInvalidTransition
+		}
+
+		exchange.Status = current.Status
+		exchange.AuthorDoneAt = current.AuthorDoneAt
+		exchange.ResponderDoneAt = current.ResponderDoneAt
+		exchange.JournalEntryID = current.JournalEntryID
+		return nil
+	})
+}
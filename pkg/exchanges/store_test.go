@@ -0,0 +1,85 @@
+package exchanges
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/ledger"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+// newAcceptedExchange returns an accepted exchange of an hour, answering an
+// offer. The responder pays the author of the post
+func newAcceptedExchange(t *testing.T, db *gorm.DB) *api.Exchange {
+	t.Helper()
+	group := &api.Group{ID: uuid.NewV4().String(), Name: "Group"}
+	author := &api.User{ID: uuid.NewV4().String(), Username: "author", Email: "author@example.com"}
+	responder := &api.User{ID: uuid.NewV4().String(), Username: "responder", Email: "responder@example.com"}
+	post := &api.Post{ID: uuid.NewV4().String(), GroupID: group.ID, AuthorID: author.ID, Title: "Offer", Type: api.OfferPost}
+	for _, value := range []interface{}{group, author, responder, post} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	exchange := &api.Exchange{GroupID: group.ID, PostID: post.ID, ResponderID: responder.ID, Amount: time.Hour}
+	store := NewExchangeStore(db)
+	if err := store.Create(exchange); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetStatus(exchange, api.ExchangeProposed, api.ExchangeAccepted); err != nil {
+		t.Fatal(err)
+	}
+	exchange, err := store.Get(exchange.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exchange
+}
+
+// TestMarkDoneConcurrently marks the exchange done by the author, while the
+// responder commits its own mark right after the author read the exchange
+func TestMarkDoneConcurrently(t *testing.T) {
+	db := dbtest.Open(t)
+	exchange := newAcceptedExchange(t, db)
+	store := NewExchangeStore(db)
+	if err := db.Model(&api.Exchange{}).Where("id = ?", exchange.ID).Update("responder_done_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// The first read of the author does not see the mark of the responder
+	stale := false
+	if err := db.Callback().Query().After("gorm:query").Register("test:stale_read", func(tx *gorm.DB) {
+		current, ok := tx.Statement.Dest.(*api.Exchange)
+		if stale || !ok {
+			return
+		}
+		stale = true
+		current.ResponderDoneAt = nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.MarkDone(exchange, exchange.Post.AuthorID); err != nil {
+		t.Fatal(err)
+	}
+	if !stale {
+		t.Fatal("the exchange was not read")
+	}
+
+	result, err := store.Get(exchange.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != api.ExchangeCompleted || result.JournalEntryID == nil {
+		t.Fatalf("exchange is %s, expected it to be completed with a transfer", result.Status)
+	}
+	balance, err := ledger.NewLedgerStore(db).GetBalance(exchange.GroupID, exchange.Payee())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != time.Hour {
+		t.Fatalf("the author received %s, expected 1h", balance)
+	}
+}
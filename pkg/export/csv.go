@@ -0,0 +1,49 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteCSV writes the table with a header row. Durations are written in the
+// ISO 8601 format, and times in the RFC 3339 format. The strings a
+// spreadsheet would read as a formula are prefixed with a quote
+func (t *Table) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.Columns); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			switch value := cell.(type) {
+			case string:
+				record[i] = escapeFormula(value)
+			case int:
+				record[i] = strconv.Itoa(value)
+			case time.Duration:
+				record[i] = Duration(value)
+			case time.Time:
+				record[i] = value.Format(time.RFC3339)
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeFormula prefixes the strings starting like a formula with a quote,
+// so that the content written by the users, such as the titles of the
+// posts, is not evaluated when the file is opened in a spreadsheet
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,44 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteCSV(t *testing.T) {
+	table := &Table{Columns: []string{"Title", "Amount", "Duration"}}
+	table.AddRow("Gardening", -5, -90*time.Minute)
+	table.AddRow("=HYPERLINK(\"https://example.com\")", 1, nil)
+	table.AddRow("+1", 2, nil)
+	table.AddRow("-1", 3, nil)
+	table.AddRow("@SUM(A1)", 4, nil)
+	table.AddRow("\tcmd", 5, nil)
+	table.AddRow("\rcmd", 6, nil)
+	table.AddRow("a = b", 7, nil)
+
+	var buf bytes.Buffer
+	if err := table.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"Title", "Amount", "Duration"},
+		{"Gardening", "-5", "-PT1H30M"},
+		{"'=HYPERLINK(\"https://example.com\")", "1", ""},
+		{"'+1", "2", ""},
+		{"'-1", "3", ""},
+		{"'@SUM(A1)", "4", ""},
+		{"'\tcmd", "5", ""},
+		{"'\rcmd", "6", ""},
+		{"a = b", "7", ""},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Fatalf("records are %q, expected %q", records, expected)
+	}
+}
@@ -0,0 +1,86 @@
+// Package export writes tables of data as CSV, or as OpenDocument
+// spreadsheets, for download.
+package export
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+	ODS  Format = "ods"
+)
+
+func (f Format) IsValid() bool {
+	return f == CSV || f == JSON || f == ODS
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case ODS:
+		return "application/vnd.oasis.opendocument.spreadsheet"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// Table holds the rows of a sheet. A cell is either a string, an int, a
+// time.Duration, a time.Time, or nil when it is empty
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func (t *Table) AddRow(cells ...interface{}) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// Duration formats the duration as an ISO 8601 duration, such as PT1H30M
+func Duration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var sb strings.Builder
+	if d < 0 {
+		sb.WriteString("-")
+		d = -d
+	}
+	sb.WriteString("PT")
+	if hours := d / time.Hour; hours > 0 {
+		fmt.Fprintf(&sb, "%dH", hours)
+	}
+	if minutes := (d % time.Hour) / time.Minute; minutes > 0 {
+		fmt.Fprintf(&sb, "%dM", minutes)
+	}
+	if seconds := d % time.Minute; seconds > 0 {
+		sb.WriteString(strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.9f", seconds.Seconds()), "0"), "."))
+		sb.WriteString("S")
+	}
+	return sb.String()
+}
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</?p>`)
+	tags       = regexp.MustCompile(`<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// Text returns the plain text of an HTML fragment, such as the descriptions
+// of the group history
+func Text(fragment string) string {
+	text := lineBreaks.ReplaceAllString(fragment, "\n")
+	text = tags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankLines.ReplaceAllString(text, "\n")
+	return strings.TrimSpace(text)
+}
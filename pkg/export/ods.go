@@ -0,0 +1,111 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const odsMimeType = "application/vnd.oasis.opendocument.spreadsheet"
+
+const odsManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.2" manifest:media-type="` + odsMimeType + `"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+
+// WriteODS writes the table as an OpenDocument spreadsheet with a single
+// sheet. Counts are written as numbers, durations as time values and times
+// as date values, so that they can be used in formulas
+func (t *Table) WriteODS(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	// the mimetype must be the first file, and must not be compressed
+	mimeType, err := archive.CreateHeader(&zip.FileHeader{
+		Name:   "mimetype",
+		Method: zip.Store,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimeType, odsMimeType); err != nil {
+		return err
+	}
+
+	manifest, err := archive.Create("META-INF/manifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(manifest, odsManifest); err != nil {
+		return err
+	}
+
+	content, err := archive.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	if err := t.writeODSContent(content); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func (t *Table) writeODSContent(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	out.WriteString(`<office:document-content` +
+		` xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"` +
+		` xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"` +
+		` xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"` +
+		` office:version="1.2"><office:body><office:spreadsheet>`)
+	fmt.Fprintf(out, `<table:table table:name="%s">`, escapeXML(t.Name))
+
+	out.WriteString("<table:table-row>")
+	for _, column := range t.Columns {
+		writeODSCell(out, column)
+	}
+	out.WriteString("</table:table-row>")
+
+	for _, row := range t.Rows {
+		out.WriteString("<table:table-row>")
+		for _, cell := range row {
+			writeODSCell(out, cell)
+		}
+		out.WriteString("</table:table-row>")
+	}
+
+	out.WriteString("</table:table></office:spreadsheet></office:body></office:document-content>")
+	return out.Flush()
+}
+
+func writeODSCell(out *bufio.Writer, cell interface{}) {
+	switch value := cell.(type) {
+	case string:
+		out.WriteString(`<table:table-cell office:value-type="string">`)
+		for _, line := range strings.Split(value, "\n") {
+			fmt.Fprintf(out, "<text:p>%s</text:p>", escapeXML(line))
+		}
+		out.WriteString("</table:table-cell>")
+	case int:
+		fmt.Fprintf(out, `<table:table-cell office:value-type="float" office:value="%d"><text:p>%d</text:p></table:table-cell>`, value, value)
+	case time.Duration:
+		fmt.Fprintf(out, `<table:table-cell office:value-type="time" office:time-value="%s"><text:p>%s</text:p></table:table-cell>`, Duration(value), Duration(value))
+	case time.Time:
+		fmt.Fprintf(out, `<table:table-cell office:value-type="date" office:date-value="%s"><text:p>%s</text:p></table:table-cell>`,
+			value.Format("2006-01-02T15:04:05"), value.Format(time.RFC3339))
+	default:
+		out.WriteString("<table:table-cell/>")
+	}
+}
+
+func escapeXML(value string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(value))
+	return sb.String()
+}
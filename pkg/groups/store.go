@@ -6,6 +6,8 @@ import (
 	"errors"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
 type Store interface {
@@ -13,6 +15,8 @@ type Store interface {
 	Search() ([]*api.Group, error)
 	Get(id string) (*api.Group, error)
 	Update(group *api.Group) error
+	SetArchived(groupID string, archivedAt *time.Time) error
+	SetDeleted(groupID string, deletedAt *time.Time) error
 }
 
 type GroupStore struct {
@@ -21,7 +25,7 @@ type GroupStore struct {
 
 func (g *GroupStore) Search() ([]*api.Group, error) {
 	var groups []*api.Group
-	if err := g.db.Find(&groups).Error; err != nil {
+	if err := g.db.Where("deleted_at is null").Find(&groups).Error; err != nil {
 		return nil, err
 	}
 	return groups, nil
@@ -41,6 +45,7 @@ func (g *GroupStore) Get(id string) (*api.Group, error) {
 	var group api.Group
 	err := g.db.
 		Preload("Memberships.User").
+		Preload("Memberships.Role").
 		Preload("Posts.Author").
 		Model(&api.Group{}).First(&group, "ID = ?", id).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -53,10 +58,32 @@ func (g *GroupStore) Get(id string) (*api.Group, error) {
 }
 
 func (g *GroupStore) Update(group *api.Group) error {
-	err := g.db.Save(group).Error
+	err := g.db.Omit(clause.Associations).Save(group).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return echo.ErrNotFound
 	}
+	return err
+}
+
+// SetArchived archives the group, or unarchives it when archivedAt is nil
+func (g *GroupStore) SetArchived(groupID string, archivedAt *time.Time) error {
+	return g.set(groupID, "archived_at", archivedAt)
+}
+
+// SetDeleted deletes the group until it is purged, or restores it when
+// deletedAt is nil
+func (g *GroupStore) SetDeleted(groupID string, deletedAt *time.Time) error {
+	return g.set(groupID, "deleted_at", deletedAt)
+}
+
+func (g *GroupStore) set(groupID string, column string, value *time.Time) error {
+	result := g.db.Model(&api.Group{}).Where("id = ?", groupID).Update(column, value)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
 	return nil
 }
 
@@ -1,7 +1,7 @@
 package handler
 
 import (
-	"cp/pkg/api"
+	"cp/pkg/maintenance"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
@@ -13,31 +13,7 @@ func (h *Handler) handleAdmin(c echo.Context) error {
 }
 
 func (h *Handler) handleAdminClearAll(c echo.Context) error {
-	if err := h.db.Where("1 = 1").Delete(&api.Acknowledgement{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Credits{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Message{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Notification{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Image{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Post{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Membership{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.Group{}).Error; err != nil {
-		return err
-	}
-	if err := h.db.Where("1 = 1").Delete(&api.User{}).Error; err != nil {
+	if err := maintenance.Clear(h.db); err != nil {
 		return err
 	}
 	c.Response().Header().Set("Location", "/auth/logout")
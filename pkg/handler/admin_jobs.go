@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/utils"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type JobsQuery struct {
+	Status api.JobStatus `query:"status"`
+}
+
+// handleAdminJobs lists the jobs of the runner, the latest first. The dead
+// jobs can be retried or deleted
+func (h *Handler) handleAdminJobs(c echo.Context) error {
+
+	var query JobsQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &query); err != nil {
+		return err
+	}
+	if query.Status != "" && !query.Status.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid status")
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	jobs, next, err := h.jobStore.GetPage(query.Status, page)
+	if err != nil {
+		return err
+	}
+
+	counts, err := h.jobStore.CountByStatus()
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "admin_jobs", map[string]interface{}{
+		"Title":    "Jobs",
+		"Jobs":     jobs,
+		"Status":   query.Status,
+		"Statuses": api.JobStatuses,
+		"Counts":   counts,
+		"NextLink": h.nextPageLink(c, next),
+	})
+}
+
+func (h *Handler) handleAdminJobRetry(c echo.Context) error {
+	if err := h.jobStore.Requeue(c.Param("JobID")); err != nil {
+		return err
+	}
+	return h.redirectToJobs(c, "The job will run again in a moment")
+}
+
+func (h *Handler) handleAdminJobDelete(c echo.Context) error {
+	if err := h.jobStore.Delete(c.Param("JobID")); err != nil {
+		return err
+	}
+	return h.redirectToJobs(c, "The job was deleted")
+}
+
+func (h *Handler) redirectToJobs(c echo.Context, message string) error {
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: message,
+	}); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Location", "/admin/jobs?status="+string(api.JobDead))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
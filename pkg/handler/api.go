@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"cp/pkg/exchanges"
+	"cp/pkg/invitations"
+	"cp/pkg/ledger"
+	"cp/pkg/policy"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type APIErrorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+// apiErrorM renders the errors returned by the API handlers and middlewares
+// as structured JSON, instead of the default error pages
+func (h *Handler) apiErrorM() echo.MiddlewareFunc {
+	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := handlerFunc(c)
+			if err == nil || c.Response().Committed {
+				return err
+			}
+
+			apiError := newAPIError(err)
+			if apiError.Code == http.StatusInternalServerError {
+				c.Logger().Error(err)
+			}
+
+			return c.JSON(apiError.Code, &APIErrorResponse{Error: apiError})
+		}
+	}
+}
+
+func newAPIError(err error) *APIError {
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		return &APIError{
+			Code:    httpError.Code,
+			Message: fmt.Sprintf("%v", httpError.Message),
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &APIError{
+			Code:    http.StatusNotFound,
+			Message: http.StatusText(http.StatusNotFound),
+		}
+	}
+	if errors.Is(err, ledger.ErrOverdraftExceeded) ||
+		errors.Is(err, ledger.ErrInvalidAmount) ||
+		errors.Is(err, ledger.ErrAlreadyReversed) ||
+		errors.Is(err, ledger.ErrIsReversal) ||
+		errors.Is(err, invitations.ErrInvalidInvitation) ||
+		errors.Is(err, invitations.ErrAlreadyMember) ||
+		errors.Is(err, exchanges.ErrInvalidTransition) ||
+		errors.Is(err, exchanges.ErrAlreadyDone) {
+		return &APIError{
+			Code:    http.StatusUnprocessableEntity,
+			Message: err.Error(),
+		}
+	}
+	return &APIError{
+		Code:    http.StatusInternalServerError,
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+}
+
+func (h *Handler) registerAPI(e *echo.Echo) {
+
+	v1 := e.Group("/api/v1", h.apiErrorM(), h.authM(false))
+	v1.GET("/me", h.handleAPIGetMe).Name = "api_v1_get_me"
+	v1.GET("/search", h.handleAPISearch, h.authorizeM(policy.Search)).Name = "api_v1_get_search"
+	v1.GET("/groups", h.handleAPIGetGroups, h.authorizeM(policy.ListGroups)).Name = "api_v1_get_groups"
+	v1.POST("/groups", h.handleAPICreateGroup, h.authorizeM(policy.CreateGroup)).Name = "api_v1_post_groups"
+
+	g := v1.Group(fmt.Sprintf("/groups/:%s", GroupIDKey), h.groupM())
+	g.GET("", h.handleAPIGetGroup, h.authMemberM(true), h.authorizeM(policy.ViewGroup)).Name = "api_v1_get_group"
+	g.GET("/memberships", h.handleAPIGetMemberships, h.authMemberM(false), h.authorizeM(policy.ViewGroupMembers)).Name = "api_v1_get_group_memberships"
+	g.GET("/posts", h.handleAPIGetPosts, h.authMemberM(true), h.authorizeM(policy.ViewGroup)).Name = "api_v1_get_group_posts"
+	g.POST("/posts", h.handleAPISavePost, h.authMemberM(false), h.postM(true), h.authorizeM(policy.CreatePost)).Name = "api_v1_post_group_posts"
+	g.GET("/credits", h.handleAPIGetCredits, h.authMemberM(false), h.authorizeM(policy.ViewCredits)).Name = "api_v1_get_group_credits"
+	g.POST("/credits", h.handleAPISendCredits, h.authMemberM(false), h.authorizeM(policy.SendCredits)).Name = "api_v1_post_group_credits"
+	g.POST(fmt.Sprintf("/credits/:%s/reverse", JournalEntryIDKey), h.handleAPIReverseCredits, h.authMemberM(false), h.authorizeM(policy.ReverseCredits)).Name = "api_v1_post_group_credits_reverse"
+	g.GET("/credits/balance", h.handleAPIGetBalance, h.authMemberM(false), h.authorizeM(policy.ViewCredits)).Name = "api_v1_get_group_credits_balance"
+	g.GET("/acknowledgements", h.handleAPIGetAcknowledgements, h.authMemberM(false), h.authorizeM(policy.ViewGroupAcknowledgements)).Name = "api_v1_get_group_acknowledgements"
+	g.POST("/acknowledgements", h.handleAPISendAcknowledgement, h.authMemberM(false), h.authorizeM(policy.SendAcknowledgement)).Name = "api_v1_post_group_acknowledgements"
+	g.GET("/invitations", h.handleAPIGetInvitations, h.authMemberM(false), h.authorizeM(policy.ManageInvitations)).Name = "api_v1_get_group_invitations"
+	g.POST("/invitations", h.handleAPICreateInvitation, h.authMemberM(false), h.authorizeM(policy.ManageInvitations)).Name = "api_v1_post_group_invitations"
+	g.GET("/roles", h.handleAPIGetRoles, h.authMemberM(false), h.authorizeM(policy.ViewGroupMembers)).Name = "api_v1_get_group_roles"
+	g.POST("/roles", h.handleAPICreateRole, h.authMemberM(false), h.authorizeM(policy.ManageRoles)).Name = "api_v1_post_group_roles"
+	g.DELETE("/roles/:RoleID", h.handleAPIDeleteRole, h.authMemberM(false), h.authorizeM(policy.ManageRoles)).Name = "api_v1_delete_group_role"
+	g.DELETE("/invitations/:InvitationID", h.handleAPIRevokeInvitation, h.authMemberM(false), h.authorizeM(policy.ManageInvitations)).Name = "api_v1_delete_group_invitation"
+
+	m := g.Group(fmt.Sprintf("/memberships/:%s", UserIDKey), h.userM())
+	m.GET("", h.handleAPIGetMembership, h.authMemberM(false), h.memberM(false), h.authorizeM(policy.ViewGroupMembers)).Name = "api_v1_get_group_membership"
+	m.PUT("", h.handleAPIJoinGroup, h.authMemberM(true), h.memberM(true)).Name = "api_v1_put_group_membership"
+	m.DELETE("", h.handleAPILeaveGroup, h.authMemberM(false), h.memberM(false)).Name = "api_v1_delete_group_membership"
+	m.PUT("/permission", h.handleAPISetPermission, h.authMemberM(false), h.memberM(false)).Name = "api_v1_put_group_membership_permission"
+	m.PUT("/role", h.handleAPISetRole, h.authMemberM(false), h.memberM(false)).Name = "api_v1_put_group_membership_role"
+
+	p := g.Group(fmt.Sprintf("/posts/:%s", PostIDKey), h.postM(false))
+	p.GET("", h.handleAPIGetPost, h.authMemberM(true), h.authorizeM(policy.ViewPost)).Name = "api_v1_get_group_post"
+	p.PUT("", h.handleAPISavePost, h.authMemberM(false), h.authorizeM(policy.EditPost)).Name = "api_v1_put_group_post"
+	p.DELETE("", h.handleAPIDeletePost, h.authMemberM(false), h.authorizeM(policy.DeletePost)).Name = "api_v1_delete_group_post"
+	p.GET("/messages", h.handleAPIGetMessages, h.authMemberM(true), h.authorizeM(policy.ViewPost)).Name = "api_v1_get_group_post_messages"
+	p.POST("/messages", h.handleAPISendMessage, h.authMemberM(false), h.authorizeM(policy.SendMessage)).Name = "api_v1_post_group_post_messages"
+	p.GET("/exchanges", h.handleAPIGetExchanges, h.authMemberM(false), h.authorizeM(policy.ViewGroup)).Name = "api_v1_get_group_post_exchanges"
+	p.POST("/exchanges", h.handleAPIProposeExchange, h.authMemberM(false), h.authorizeM(policy.ProposeExchange)).Name = "api_v1_post_group_post_exchanges"
+
+	x := p.Group(fmt.Sprintf("/exchanges/:%s", ExchangeIDKey), h.exchangeM())
+	x.GET("", h.handleAPIGetExchange, h.authMemberM(false), h.authorizeM(policy.ViewGroup)).Name = "api_v1_get_group_post_exchange"
+	x.POST("/accept", h.handleAPIAcceptExchange, h.authMemberM(false), h.authorizeM(policy.AcceptExchange)).Name = "api_v1_post_group_post_exchange_accept"
+	x.POST("/decline", h.handleAPIDeclineExchange, h.authMemberM(false), h.authorizeM(policy.DeclineExchange)).Name = "api_v1_post_group_post_exchange_decline"
+	x.POST("/cancel", h.handleAPICancelExchange, h.authMemberM(false), h.authorizeM(policy.CancelExchange)).Name = "api_v1_post_group_post_exchange_cancel"
+	x.POST("/complete", h.handleAPICompleteExchange, h.authMemberM(false), h.authorizeM(policy.CompleteExchange)).Name = "api_v1_post_group_post_exchange_complete"
+
+	v1.POST("/invitations/:Code/redeem", h.handleAPIRedeemInvitation, h.authorizeM(policy.RedeemInvitation)).Name = "api_v1_post_invitation_redeem"
+
+	u := v1.Group(fmt.Sprintf("/users/:%s", UserIDKey), h.userM())
+	u.GET("", h.handleAPIGetUser, h.authorizeM(policy.ViewUser)).Name = "api_v1_get_user"
+	u.GET("/memberships", h.handleAPIGetUserMemberships, h.authorizeM(policy.ViewUser)).Name = "api_v1_get_user_memberships"
+	u.GET("/posts", h.handleAPIGetUserPosts, h.authorizeM(policy.ViewUser)).Name = "api_v1_get_user_posts"
+	u.GET("/acknowledgements", h.handleAPIGetUserAcknowledgements, h.authorizeM(policy.ViewUser)).Name = "api_v1_get_user_acknowledgements"
+	u.GET("/notifications", h.handleAPIGetUserNotifications, h.authorizeM(policy.ViewUserNotifications)).Name = "api_v1_get_user_notifications"
+	u.POST("/notifications/read", h.handleAPIReadUserNotifications, h.authorizeM(policy.ManageUserNotifications)).Name = "api_v1_post_user_notifications_read"
+	u.POST("/notifications/:NotificationID/read", h.handleAPIReadUserNotification, h.authorizeM(policy.ManageUserNotifications)).Name = "api_v1_post_user_notification_read"
+	u.DELETE("/notifications/:NotificationID", h.handleAPIDeleteUserNotification, h.authorizeM(policy.ManageUserNotifications)).Name = "api_v1_delete_user_notification"
+	u.GET("/notifications/mutes", h.handleAPIGetNotificationMutes, h.authorizeM(policy.ManageUserNotifications)).Name = "api_v1_get_user_notification_mutes"
+	u.PUT("/notifications/mutes", h.handleAPISetNotificationMutes, h.authorizeM(policy.ManageUserNotifications)).Name = "api_v1_put_user_notification_mutes"
+}
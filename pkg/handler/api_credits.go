@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/policy"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+type APISendCredits struct {
+	From   *APITarget `json:"from"`
+	To     *APITarget `json:"to"`
+	Amount string     `json:"amount"`
+	Notes  string     `json:"notes"`
+}
+
+type APIReverseCredits struct {
+	Notes string `json:"notes"`
+}
+
+type APISendAcknowledgement struct {
+	From  *APITarget              `json:"from"`
+	To    *APITarget              `json:"to"`
+	Type  api.AcknowledgementType `json:"type"`
+	Notes string                  `json:"notes"`
+}
+
+type APIBalance struct {
+	User  string  `json:"user"`
+	Group *string `json:"group,omitempty"`
+}
+
+// getAPITargets resolves the source and the target of a send request. The
+// source defaults to the authenticated user
+func (h *Handler) getAPITargets(c echo.Context, action policy.Action, from *APITarget, to *APITarget) (*api.Target, *api.Target, error) {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	membership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if to == nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "target is required")
+	}
+	if from == nil {
+		from = &APITarget{
+			Type:   api.UserTarget,
+			UserID: &membership.UserID,
+		}
+	}
+
+	source, target, err := h.getTargets(group, from.String(), to.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := policy.Can(h.getSubject(c), action, policy.Resource{
+		Group:  group,
+		Source: source,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	return source, target, nil
+}
+
+func (h *Handler) handleAPIGetCredits(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	entries, err := h.ledgerStore.GetEntriesForGroup(group.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIJournalEntries(entries))
+}
+
+func (h *Handler) handleAPISendCredits(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload APISendCredits
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	source, target, err := h.getAPITargets(c, policy.SendCredits, payload.From, payload.To)
+	if err != nil {
+		return err
+	}
+
+	amount, err := time.ParseDuration(payload.Amount)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid amount")
+	}
+
+	entry, err := h.sendCredits(group, source, target, amount, payload.Notes)
+	if err != nil {
+		return err
+	}
+
+	entry, err = h.ledgerStore.GetEntry(entry.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIJournalEntry(entry))
+}
+
+func (h *Handler) handleAPIReverseCredits(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload APIReverseCredits
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	reversal, err := h.reverseEntry(group, c.Param(JournalEntryIDKey), payload.Notes)
+	if err != nil {
+		return err
+	}
+
+	reversal, err = h.ledgerStore.GetEntry(reversal.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIJournalEntry(reversal))
+}
+
+func (h *Handler) handleAPIGetBalance(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	userBalance, err := h.ledgerStore.GetBalance(group.ID, &api.Target{
+		UserID: &membership.UserID,
+		Type:   api.UserTarget,
+	})
+	if err != nil {
+		return err
+	}
+
+	result := &APIBalance{
+		User: userBalance.String(),
+	}
+
+	if policy.Can(h.getSubject(c), policy.ViewGroupBalance, policy.Resource{Group: group}) == nil {
+		groupBalance, err := h.ledgerStore.GetBalance(group.ID, &api.Target{
+			GroupID: &group.ID,
+			Type:    api.GroupTarget,
+		})
+		if err != nil {
+			return err
+		}
+		groupBalanceStr := groupBalance.String()
+		result.Group = &groupBalanceStr
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) handleAPIGetAcknowledgements(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	acknowledgements, next, err := h.acknowledgementStore.GetAllInGroup(group.ID, page)
+	if err != nil {
+		return err
+	}
+
+	h.setNextPageHeader(c, next)
+
+	return c.JSON(http.StatusOK, newAPIAcknowledgements(acknowledgements))
+}
+
+func (h *Handler) handleAPISendAcknowledgement(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload APISendAcknowledgement
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	source, target, err := h.getAPITargets(c, policy.SendAcknowledgement, payload.From, payload.To)
+	if err != nil {
+		return err
+	}
+
+	switch payload.Type {
+	case api.ThanksObjectGift, api.ThanksServiceGift, api.ThanksObjectLent, api.Other:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid acknowledgement type")
+	}
+
+	acknowledgement, err := h.sendAcknowledgement(group, source, target, payload.Type, payload.Notes)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIAcknowledgement(acknowledgement))
+}
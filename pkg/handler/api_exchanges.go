@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleAPIGetExchanges(c echo.Context) error {
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	exchanges, err := h.exchangeStore.GetForPost(post.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIExchanges(exchanges))
+}
+
+func (h *Handler) handleAPIGetExchange(c echo.Context) error {
+
+	exchange, err := h.getExchange(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIExchange(exchange))
+}
+
+func (h *Handler) handleAPIProposeExchange(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	var payload ProposeExchange
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	exchange, err := h.proposeExchange(authenticatedUser, post, payload)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIExchange(exchange))
+}
+
+func (h *Handler) handleAPIAcceptExchange(c echo.Context) error {
+	return h.handleAPIExchangeAction(c, h.acceptExchange)
+}
+
+func (h *Handler) handleAPIDeclineExchange(c echo.Context) error {
+	return h.handleAPIExchangeAction(c, h.declineExchange)
+}
+
+func (h *Handler) handleAPICancelExchange(c echo.Context) error {
+	return h.handleAPIExchangeAction(c, h.cancelExchange)
+}
+
+func (h *Handler) handleAPICompleteExchange(c echo.Context) error {
+	return h.handleAPIExchangeAction(c, h.completeExchange)
+}
+
+func (h *Handler) handleAPIExchangeAction(c echo.Context, action exchangeAction) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	exchange, err := h.getExchange(c)
+	if err != nil {
+		return err
+	}
+
+	if err := action(authenticatedUser, exchange); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIExchange(exchange))
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/memberships"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleAPIGetMe(c echo.Context) error {
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newAPIUser(authenticatedUser))
+}
+
+func (h *Handler) handleAPIGetGroups(c echo.Context) error {
+	groups, err := h.groupStore.Search()
+	if err != nil {
+		return err
+	}
+	var result = []*APIGroup{}
+	for _, group := range groups {
+		result = append(result, newAPIGroup(group))
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) handleAPICreateGroup(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	var payload CreateGroup
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	group, err := h.createGroup(authenticatedUser, payload.Name)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIGroup(group))
+}
+
+func (h *Handler) handleAPIGetGroup(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	result := newAPIGroup(group)
+	result.MyMembership = newAPIMembership(membership)
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) handleAPIGetMemberships(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var ms []*api.Membership
+	if err := h.membershipStore.Find(&ms, &memberships.GetMembershipsOptions{
+		GroupID: &group.ID,
+		Preload: []string{"User"},
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIMemberships(ms))
+}
+
+func (h *Handler) handleAPIGetMembership(c echo.Context) error {
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newAPIMembership(membership))
+}
+
+func (h *Handler) handleAPIJoinGroup(c echo.Context) error {
+
+	invitedUser, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	if membership == nil {
+		status = http.StatusCreated
+	}
+
+	membership, err = h.joinGroup(h.getSubject(c), invitedUser, group, membership)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(status, newAPIMembership(membership))
+}
+
+func (h *Handler) handleAPILeaveGroup(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.leaveGroup(h.getSubject(c), user, group, membership); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPISetPermission(c echo.Context) error {
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SetPermission
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	if err := h.setPermission(h.getSubject(c), membership, payload.Permission); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIMembership(membership))
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleAPIGetInvitations(c echo.Context) error {
+
+	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	invitations, err := h.invitationStore.GetForGroup(authenticatedUserMembership.GroupID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIInvitations(invitations))
+}
+
+func (h *Handler) handleAPICreateInvitation(c echo.Context) error {
+
+	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SubmitInvitation
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	invitation, err := h.createInvitation(authenticatedUserMembership, payload)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIInvitation(invitation))
+}
+
+func (h *Handler) handleAPIRevokeInvitation(c echo.Context) error {
+
+	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.invitationStore.Revoke(authenticatedUserMembership.GroupID, c.Param("InvitationID")); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPIRedeemInvitation(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.invitationStore.Redeem(c.Param("Code"), authenticatedUser.ID)
+	if err != nil {
+		return err
+	}
+
+	membership, err = h.membershipStore.Get(membership.GroupID, membership.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIMembership(membership))
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/policy"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+)
+
+type APISubmitPost struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Type        api.PostType `json:"type"`
+	ValueFrom   string       `json:"valueFrom"`
+	ValueTo     string       `json:"valueTo"`
+}
+
+func (h *Handler) handleAPIGetPosts(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload Query
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	if payload.Type != nil && string(*payload.Type) == "" {
+		payload.Type = nil
+	}
+	if payload.Query != nil && string(*payload.Query) == "" {
+		payload.Query = nil
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	result, next, err := h.getGroupPosts(group, payload, page)
+	if err != nil {
+		return err
+	}
+
+	h.setNextPageHeader(c, next)
+
+	apiPosts, err := h.newAPIPosts(c, result)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiPosts)
+}
+
+func (h *Handler) handleAPIGetPost(c echo.Context) error {
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+	apiPosts, err := h.newAPIPosts(c, []*api.Post{post})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiPosts[0])
+}
+
+// handleAPISavePost creates a new post, or updates the post in the route.
+// Images are not supported through the JSON API
+func (h *Handler) handleAPISavePost(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	existing, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	var payload APISubmitPost
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	valueFrom, valueTo, err := validatePost(payload.Type, payload.Description, payload.ValueFrom, payload.ValueTo)
+	if err != nil {
+		return err
+	}
+
+	post := &api.Post{
+		ID:          uuid.NewV4().String(),
+		GroupID:     group.ID,
+		AuthorID:    authenticatedUser.ID,
+		Title:       payload.Title,
+		Description: payload.Description,
+		ValueFrom:   valueFrom,
+		ValueTo:     valueTo,
+		Type:        payload.Type,
+	}
+
+	status := http.StatusCreated
+	if existing != nil {
+		post.ID = existing.ID
+		post.CreatedAt = existing.CreatedAt
+		if err := h.updatePost(post); err != nil {
+			return err
+		}
+		status = http.StatusOK
+	} else {
+		if err := h.postStore.Create(post); err != nil {
+			return err
+		}
+	}
+
+	post, err = h.postStore.Get(post.ID)
+	if err != nil {
+		return err
+	}
+
+	apiPosts, err := h.newAPIPosts(c, []*api.Post{post})
+	if err != nil {
+		return err
+	}
+	return c.JSON(status, apiPosts[0])
+}
+
+func (h *Handler) handleAPIDeletePost(c echo.Context) error {
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.deletePost(post); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPIGetMessages(c echo.Context) error {
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	messages, next, err := h.messageStore.GetMessages(post.ID, page)
+	if err != nil {
+		return err
+	}
+
+	h.setNextPageHeader(c, next)
+
+	return c.JSON(http.StatusOK, newAPIMessages(messages))
+}
+
+func (h *Handler) handleAPISendMessage(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SubmitMessage
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	message, err := h.sendMessage(authenticatedUser, group, post, payload.Content)
+	if err != nil {
+		return err
+	}
+	message.Author = authenticatedUser
+
+	return c.JSON(http.StatusCreated, newAPIMessage(message))
+}
+
+// newAPIPosts returns the posts of the API. The signed image URLs skip the
+// membership check, so they are only given to the users allowed to view the
+// images of the group of each post
+func (h *Handler) newAPIPosts(c echo.Context, posts []*api.Post) ([]*APIPost, error) {
+	subject := h.getSubject(c)
+	memberships := map[string]*api.Membership{}
+	if subject.Membership != nil {
+		memberships[subject.Membership.GroupID] = subject.Membership
+	}
+
+	var result = []*APIPost{}
+	for _, post := range posts {
+		membership, ok := memberships[post.GroupID]
+		if !ok && subject.User != nil {
+			var err error
+			membership, err = h.membershipStore.Get(post.GroupID, subject.User.ID)
+			if errors.Is(err, echo.ErrNotFound) {
+				membership = nil
+			} else if err != nil {
+				return nil, err
+			}
+			memberships[post.GroupID] = membership
+		}
+
+		postSubject := subject
+		postSubject.Membership = membership
+		urlSigner := h.imageURLSigner
+		if policy.Can(postSubject, policy.ViewPostImages, policy.Resource{Group: post.Group, Post: post}) != nil {
+			urlSigner = nil
+		}
+		result = append(result, newAPIPost(post, urlSigner))
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/events"
+	"cp/pkg/images"
+	"cp/pkg/memberships"
+	"cp/pkg/posts"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIPostImagesAreSignedForMembers(t *testing.T) {
+	db := dbtest.Open(t)
+	h := &Handler{
+		postStore:       posts.NewPostStore(db),
+		membershipStore: memberships.NewMembershipStore(db, events.Discard),
+		imageURLSigner:  images.NewURLSigner([]byte("secret"), time.Hour),
+	}
+
+	group := &api.Group{ID: uuid.NewV4().String(), Name: "Private"}
+	member := &api.User{ID: uuid.NewV4().String(), Username: "member", Email: "member@example.com"}
+	outsider := &api.User{ID: uuid.NewV4().String(), Username: "outsider", Email: "outsider@example.com"}
+	post := &api.Post{ID: uuid.NewV4().String(), GroupID: group.ID, AuthorID: member.ID, Title: "Offer", Type: api.OfferPost}
+	for _, value := range []interface{}{group, member, outsider, &api.Membership{
+		GroupID:         group.ID,
+		UserID:          member.ID,
+		Permission:      api.Member,
+		MemberConfirmed: true,
+		GroupConfirmed:  true,
+	}, post, &api.Image{ID: uuid.NewV4().String(), PostID: post.ID, GroupID: group.ID}} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	post, err := h.postStore.Get(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(post.Images) != 1 {
+		t.Fatalf("%d images, expected 1", len(post.Images))
+	}
+
+	e := echo.New()
+	get := func(user *api.User, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.Set(AuthenticatedUserKey, user)
+		c.Set(UserKey, member)
+		c.Set(PostKey, post)
+		if err := handler(c); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+	imageCount := func(rec *httptest.ResponseRecorder, list bool) int {
+		var result []*APIPost
+		if list {
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			var apiPost APIPost
+			if err := json.Unmarshal(rec.Body.Bytes(), &apiPost); err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, &apiPost)
+		}
+		if len(result) != 1 {
+			t.Fatalf("%d posts, expected 1", len(result))
+		}
+		return len(result[0].Images)
+	}
+
+	if count := imageCount(get(member, h.handleAPIGetPost), false); count != 1 {
+		t.Fatalf("the member got %d images, expected 1", count)
+	}
+	if count := imageCount(get(outsider, h.handleAPIGetPost), false); count != 0 {
+		t.Fatalf("a non-member got %d signed images", count)
+	}
+	if count := imageCount(get(member, h.handleAPIGetUserPosts), true); count != 1 {
+		t.Fatalf("the member got %d images, expected 1", count)
+	}
+	if count := imageCount(get(outsider, h.handleAPIGetUserPosts), true); count != 0 {
+		t.Fatalf("a non-member got %d signed images of the posts of a user", count)
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleAPIGetRoles(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	roles, err := h.roleStore.GetForGroup(group.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIRoles(roles))
+}
+
+func (h *Handler) handleAPICreateRole(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload CreateRole
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	role, err := h.createRole(h.getSubject(c), group, payload)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, newAPIRole(role))
+}
+
+func (h *Handler) handleAPIDeleteRole(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.roleStore.Delete(group.ID, c.Param("RoleID")); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPISetRole(c echo.Context) error {
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SetRole
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	role, err := h.roleStore.Get(membership.GroupID, payload.RoleID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.setRole(h.getSubject(c), membership, role); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIMembership(membership))
+}
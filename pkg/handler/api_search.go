@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleAPISearch(c echo.Context) error {
+
+	var payload SearchQuery
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	results, err := h.search(c, payload)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPISearchResults(results))
+}
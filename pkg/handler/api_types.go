@@ -0,0 +1,479 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/images"
+	"cp/pkg/search"
+	"time"
+)
+
+type APIUser struct {
+	ID               string    `json:"id"`
+	Username         string    `json:"username"`
+	Name             string    `json:"name"`
+	ContactInfo      string    `json:"contactInfo"`
+	About            string    `json:"about"`
+	ProfilePictureID string    `json:"profilePictureId,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+func newAPIUser(user *api.User) *APIUser {
+	if user == nil {
+		return nil
+	}
+	return &APIUser{
+		ID:               user.ID,
+		Username:         user.Username,
+		Name:             user.Name,
+		ContactInfo:      user.ContactInfo,
+		About:            user.About,
+		ProfilePictureID: user.ProfilePictureID,
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+type APIGroup struct {
+	ID                   string         `json:"id"`
+	Name                 string         `json:"name"`
+	MemberOverdraftLimit string         `json:"memberOverdraftLimit"`
+	GroupOverdraftLimit  string         `json:"groupOverdraftLimit"`
+	CreatedAt            time.Time      `json:"createdAt"`
+	MyMembership         *APIMembership `json:"myMembership,omitempty"`
+}
+
+func newAPIGroup(group *api.Group) *APIGroup {
+	if group == nil {
+		return nil
+	}
+	return &APIGroup{
+		ID:                   group.ID,
+		Name:                 group.Name,
+		MemberOverdraftLimit: group.MemberOverdraftLimit.String(),
+		GroupOverdraftLimit:  group.GroupOverdraftLimit.String(),
+		CreatedAt:            group.CreatedAt,
+	}
+}
+
+type APIMembership struct {
+	GroupID         string                   `json:"groupId"`
+	UserID          string                   `json:"userId"`
+	Permission      api.MembershipPermission `json:"permission"`
+	Role            *APIRole                 `json:"role"`
+	MemberConfirmed bool                     `json:"memberConfirmed"`
+	GroupConfirmed  bool                     `json:"groupConfirmed"`
+	User            *APIUser                 `json:"user,omitempty"`
+	Group           *APIGroup                `json:"group,omitempty"`
+	CreatedAt       time.Time                `json:"createdAt"`
+}
+
+func newAPIMembership(membership *api.Membership) *APIMembership {
+	if membership == nil {
+		return nil
+	}
+	return &APIMembership{
+		GroupID:         membership.GroupID,
+		UserID:          membership.UserID,
+		Permission:      membership.Permission,
+		Role:            newAPIRole(membership.GetRole()),
+		MemberConfirmed: membership.MemberConfirmed,
+		GroupConfirmed:  membership.GroupConfirmed,
+		User:            newAPIUser(membership.User),
+		Group:           newAPIGroup(membership.Group),
+		CreatedAt:       membership.CreatedAt,
+	}
+}
+
+func newAPIMemberships(memberships []*api.Membership) []*APIMembership {
+	var result = []*APIMembership{}
+	for _, membership := range memberships {
+		result = append(result, newAPIMembership(membership))
+	}
+	return result
+}
+
+type APISearchResult struct {
+	Kind      search.Kind `json:"kind"`
+	ID        string      `json:"id"`
+	GroupID   string      `json:"groupId,omitempty"`
+	GroupName string      `json:"groupName,omitempty"`
+	PostID    string      `json:"postId,omitempty"`
+	Title     string      `json:"title"`
+	Snippet   string      `json:"snippet"`
+	Rank      float64     `json:"rank"`
+	Link      string      `json:"link"`
+}
+
+func newAPISearchResults(results []*search.Result) []*APISearchResult {
+	var apiResults = []*APISearchResult{}
+	for _, result := range results {
+		apiResults = append(apiResults, &APISearchResult{
+			Kind:      result.Kind,
+			ID:        result.ID,
+			GroupID:   result.GroupID,
+			GroupName: result.GroupName,
+			PostID:    result.PostID,
+			Title:     result.Title,
+			Snippet:   result.Snippet,
+			Rank:      result.Rank,
+			Link:      result.Link(),
+		})
+	}
+	return apiResults
+}
+
+type APIExchange struct {
+	ID              string             `json:"id"`
+	GroupID         string             `json:"groupId"`
+	PostID          string             `json:"postId"`
+	Responder       *APIUser           `json:"responder,omitempty"`
+	Amount          string             `json:"amount"`
+	Notes           string             `json:"notes"`
+	Status          api.ExchangeStatus `json:"status"`
+	AuthorDoneAt    *time.Time         `json:"authorDoneAt,omitempty"`
+	ResponderDoneAt *time.Time         `json:"responderDoneAt,omitempty"`
+	JournalEntryID  *string            `json:"journalEntryId,omitempty"`
+	CreatedAt       time.Time          `json:"createdAt"`
+}
+
+func newAPIExchange(exchange *api.Exchange) *APIExchange {
+	return &APIExchange{
+		ID:              exchange.ID,
+		GroupID:         exchange.GroupID,
+		PostID:          exchange.PostID,
+		Responder:       newAPIUser(exchange.Responder),
+		Amount:          exchange.Amount.String(),
+		Notes:           exchange.Notes,
+		Status:          exchange.Status,
+		AuthorDoneAt:    exchange.AuthorDoneAt,
+		ResponderDoneAt: exchange.ResponderDoneAt,
+		JournalEntryID:  exchange.JournalEntryID,
+		CreatedAt:       exchange.CreatedAt,
+	}
+}
+
+func newAPIExchanges(exchanges []*api.Exchange) []*APIExchange {
+	var result = []*APIExchange{}
+	for _, exchange := range exchanges {
+		result = append(result, newAPIExchange(exchange))
+	}
+	return result
+}
+
+type APIRole struct {
+	ID           string                   `json:"id"`
+	Name         string                   `json:"name"`
+	Permission   api.MembershipPermission `json:"permission"`
+	Capabilities []api.Capability         `json:"capabilities"`
+	BuiltIn      bool                     `json:"builtIn"`
+}
+
+func newAPIRole(role *api.Role) *APIRole {
+	if role == nil {
+		return nil
+	}
+	capabilities := []api.Capability{}
+	capabilities = append(capabilities, role.Capabilities...)
+	return &APIRole{
+		ID:           role.ID,
+		Name:         role.Name,
+		Permission:   role.Permission,
+		Capabilities: capabilities,
+		BuiltIn:      role.IsBuiltIn(),
+	}
+}
+
+func newAPIRoles(roles []*api.Role) []*APIRole {
+	var result = []*APIRole{}
+	for _, role := range roles {
+		result = append(result, newAPIRole(role))
+	}
+	return result
+}
+
+type APIInvitation struct {
+	ID        string     `json:"id"`
+	GroupID   string     `json:"groupId"`
+	Code      string     `json:"code"`
+	Link      string     `json:"link"`
+	CreatedBy *APIUser   `json:"createdBy,omitempty"`
+	MaxUses   int        `json:"maxUses"`
+	Uses      int        `json:"uses"`
+	Valid     bool       `json:"valid"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func newAPIInvitation(invitation *api.Invitation) *APIInvitation {
+	return &APIInvitation{
+		ID:        invitation.ID,
+		GroupID:   invitation.GroupID,
+		Code:      invitation.Code,
+		Link:      invitation.Link(),
+		CreatedBy: newAPIUser(invitation.CreatedBy),
+		MaxUses:   invitation.MaxUses,
+		Uses:      invitation.Uses,
+		Valid:     invitation.IsValid(),
+		ExpiresAt: invitation.ExpiresAt,
+		RevokedAt: invitation.RevokedAt,
+		CreatedAt: invitation.CreatedAt,
+	}
+}
+
+func newAPIInvitations(invitations []*api.Invitation) []*APIInvitation {
+	var result = []*APIInvitation{}
+	for _, invitation := range invitations {
+		result = append(result, newAPIInvitation(invitation))
+	}
+	return result
+}
+
+type APIImage struct {
+	ID     string `json:"id"`
+	Full   string `json:"full"`
+	Medium string `json:"medium"`
+	Thumb  string `json:"thumb"`
+}
+
+type APIPost struct {
+	ID           string       `json:"id"`
+	GroupID      string       `json:"groupId"`
+	AuthorID     string       `json:"authorId"`
+	Author       *APIUser     `json:"author,omitempty"`
+	Title        string       `json:"title"`
+	Description  string       `json:"description"`
+	Type         api.PostType `json:"type"`
+	ValueFrom    *string      `json:"valueFrom,omitempty"`
+	ValueTo      *string      `json:"valueTo,omitempty"`
+	MessageCount int          `json:"messageCount"`
+	Images       []*APIImage  `json:"images"`
+	CreatedAt    time.Time    `json:"createdAt"`
+}
+
+// newAPIPost returns a post with signed image URLs, for the clients to
+// embed the images. The images are left out without a signer
+func newAPIPost(post *api.Post, urlSigner *images.URLSigner) *APIPost {
+	result := &APIPost{
+		ID:           post.ID,
+		GroupID:      post.GroupID,
+		AuthorID:     post.AuthorID,
+		Author:       newAPIUser(post.Author),
+		Title:        post.Title,
+		Description:  post.Description,
+		Type:         post.Type,
+		MessageCount: post.MessageCount,
+		Images:       []*APIImage{},
+		CreatedAt:    post.CreatedAt,
+	}
+	if post.ValueFrom != nil {
+		valueFrom := post.ValueFrom.String()
+		result.ValueFrom = &valueFrom
+	}
+	if post.ValueTo != nil {
+		valueTo := post.ValueTo.String()
+		result.ValueTo = &valueTo
+	}
+	if urlSigner == nil {
+		return result
+	}
+	for _, image := range post.Images {
+		result.Images = append(result.Images, &APIImage{
+			ID:     image.ID,
+			Full:   urlSigner.Sign(images.URL("full", image)),
+			Medium: urlSigner.Sign(images.URL("medium", image)),
+			Thumb:  urlSigner.Sign(images.URL("thumb", image)),
+		})
+	}
+	return result
+}
+
+type APIMessage struct {
+	ID        string    `json:"id"`
+	ThreadID  string    `json:"threadId"`
+	AuthorID  string    `json:"authorId"`
+	Author    *APIUser  `json:"author,omitempty"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newAPIMessage(message *api.Message) *APIMessage {
+	return &APIMessage{
+		ID:        message.ID,
+		ThreadID:  message.ThreadID,
+		AuthorID:  message.AuthorID,
+		Author:    newAPIUser(message.Author),
+		Content:   message.Content,
+		CreatedAt: message.CreatedAt,
+	}
+}
+
+func newAPIMessages(messages []*api.Message) []*APIMessage {
+	var result = []*APIMessage{}
+	for _, message := range messages {
+		result = append(result, newAPIMessage(message))
+	}
+	return result
+}
+
+type APITarget struct {
+	Type    api.TargetType `json:"type"`
+	UserID  *string        `json:"userId,omitempty"`
+	GroupID *string        `json:"groupId,omitempty"`
+}
+
+func newAPITarget(target *api.Target) *APITarget {
+	if target == nil {
+		return nil
+	}
+	result := &APITarget{
+		Type: target.Type,
+	}
+	if target.IsUser() {
+		result.UserID = target.UserID
+	} else if target.IsGroup() {
+		result.GroupID = target.GroupID
+	}
+	return result
+}
+
+// String returns the target in the "user:<id>" or "group:<id>" format
+// understood by getTarget
+func (t *APITarget) String() string {
+	if t.Type == api.UserTarget && t.UserID != nil {
+		return "user:" + *t.UserID
+	}
+	if t.Type == api.GroupTarget && t.GroupID != nil {
+		return "group:" + *t.GroupID
+	}
+	return ""
+}
+
+type APIPosting struct {
+	AccountID string     `json:"accountId"`
+	Owner     *APITarget `json:"owner"`
+	Amount    string     `json:"amount"`
+}
+
+type APIJournalEntry struct {
+	ID           string        `json:"id"`
+	GroupID      string        `json:"groupId"`
+	Notes        string        `json:"notes"`
+	ReversalOfID *string       `json:"reversalOfId,omitempty"`
+	PostID       *string       `json:"postId,omitempty"`
+	Amount       string        `json:"amount"`
+	Postings     []*APIPosting `json:"postings"`
+	CreatedAt    time.Time     `json:"createdAt"`
+}
+
+func newAPIJournalEntry(entry *api.JournalEntry) *APIJournalEntry {
+	result := &APIJournalEntry{
+		ID:           entry.ID,
+		GroupID:      entry.GroupID,
+		Notes:        entry.Notes,
+		ReversalOfID: entry.ReversalOfID,
+		PostID:       entry.PostID,
+		Amount:       entry.Amount().String(),
+		Postings:     []*APIPosting{},
+		CreatedAt:    entry.CreatedAt,
+	}
+	for _, posting := range entry.Postings {
+		apiPosting := &APIPosting{
+			AccountID: posting.AccountID,
+			Amount:    posting.Amount.String(),
+		}
+		if posting.Account != nil {
+			apiPosting.Owner = newAPITarget(posting.Account.Owner)
+		}
+		result.Postings = append(result.Postings, apiPosting)
+	}
+	return result
+}
+
+func newAPIJournalEntries(entries []*api.JournalEntry) []*APIJournalEntry {
+	var result = []*APIJournalEntry{}
+	for _, entry := range entries {
+		result = append(result, newAPIJournalEntry(entry))
+	}
+	return result
+}
+
+type APIAcknowledgement struct {
+	ID        string                  `json:"id"`
+	GroupID   string                  `json:"groupId"`
+	SentBy    *APITarget              `json:"sentBy"`
+	SentTo    *APITarget              `json:"sentTo"`
+	Type      api.AcknowledgementType `json:"type"`
+	Notes     string                  `json:"notes"`
+	CreatedAt time.Time               `json:"createdAt"`
+}
+
+func newAPIAcknowledgement(acknowledgement *api.Acknowledgement) *APIAcknowledgement {
+	return &APIAcknowledgement{
+		ID:        acknowledgement.ID,
+		GroupID:   acknowledgement.GroupID,
+		SentBy:    newAPITarget(acknowledgement.SentBy),
+		SentTo:    newAPITarget(acknowledgement.SentTo),
+		Type:      acknowledgement.Type,
+		Notes:     acknowledgement.Notes,
+		CreatedAt: acknowledgement.CreatedAt,
+	}
+}
+
+func newAPIAcknowledgements(acknowledgements []*api.Acknowledgement) []*APIAcknowledgement {
+	var result = []*APIAcknowledgement{}
+	for _, acknowledgement := range acknowledgements {
+		result = append(result, newAPIAcknowledgement(acknowledgement))
+	}
+	return result
+}
+
+type APINotification struct {
+	ID        string               `json:"id"`
+	Type      api.NotificationType `json:"type,omitempty"`
+	GroupID   *string              `json:"groupId,omitempty"`
+	Title     string               `json:"title"`
+	Message   string               `json:"message"`
+	Link      string               `json:"link"`
+	ReadAt    *time.Time           `json:"readAt"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+func newAPINotifications(notifications []*api.Notification) []*APINotification {
+	var result = []*APINotification{}
+	for _, notification := range notifications {
+		result = append(result, &APINotification{
+			ID:        notification.ID,
+			Type:      notification.Type,
+			GroupID:   notification.GroupID,
+			Title:     notification.Title,
+			Message:   notification.Message,
+			Link:      notification.Link,
+			ReadAt:    notification.ReadAt,
+			CreatedAt: notification.CreatedAt,
+		})
+	}
+	return result
+}
+
+// APINotificationMutes are the notification types and the groups muted by
+// a user
+type APINotificationMutes struct {
+	Types  []api.NotificationType `json:"types"`
+	Groups []string               `json:"groups"`
+}
+
+func newAPINotificationMutes(mutes []*api.NotificationMute) *APINotificationMutes {
+	var result = &APINotificationMutes{
+		Types:  []api.NotificationType{},
+		Groups: []string{},
+	}
+	for _, mute := range mutes {
+		if mute.Type != "" {
+			result.Types = append(result.Types, mute.Type)
+		}
+		if mute.GroupID != "" {
+			result.Groups = append(result.Groups, mute.GroupID)
+		}
+	}
+	return result
+}
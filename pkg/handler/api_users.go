@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/memberships"
+	posts2 "cp/pkg/posts"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleAPIGetUser(c echo.Context) error {
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, newAPIUser(user))
+}
+
+func (h *Handler) handleAPIGetUserMemberships(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	var ms []*api.Membership
+	if err := h.membershipStore.Find(&ms, &memberships.GetMembershipsOptions{
+		UserID:  &user.ID,
+		Preload: []string{"Group"},
+	}); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPIMemberships(ms))
+}
+
+func (h *Handler) handleAPIGetUserPosts(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	posts, next, err := h.postStore.GetByAuthor(user.ID, &posts2.FindPostsOptions{Page: page})
+	if err != nil {
+		return err
+	}
+
+	h.setNextPageHeader(c, next)
+
+	apiPosts, err := h.newAPIPosts(c, posts)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiPosts)
+}
+
+func (h *Handler) handleAPIGetUserAcknowledgements(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	acknowledgements, next, err := h.acknowledgementStore.GetForUser(user.ID, page)
+	if err != nil {
+		return err
+	}
+
+	h.setNextPageHeader(c, next)
+
+	return c.JSON(http.StatusOK, newAPIAcknowledgements(acknowledgements))
+}
+
+func (h *Handler) handleAPIGetUserNotifications(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	notifications, next, err := h.notificationStore.GetNotifications(authenticatedUser.ID, page)
+	if err != nil {
+		return err
+	}
+
+	h.setNextPageHeader(c, next)
+
+	return c.JSON(http.StatusOK, newAPINotifications(notifications))
+}
+
+func (h *Handler) handleAPIReadUserNotifications(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.MarkAllRead(user.ID); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPIReadUserNotification(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.MarkRead(user.ID, c.Param("NotificationID")); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPIDeleteUserNotification(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.DeleteNotification(user.ID, c.Param("NotificationID")); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *Handler) handleAPIGetNotificationMutes(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	mutes, err := h.notificationStore.GetMutes(user.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPINotificationMutes(mutes))
+}
+
+func (h *Handler) handleAPISetNotificationMutes(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	var payload APINotificationMutes
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	var userMemberships []*api.Membership
+	if err := h.membershipStore.Find(&userMemberships, &memberships.GetMembershipsOptions{
+		UserID: &user.ID,
+	}); err != nil {
+		return err
+	}
+
+	mutes, err := newNotificationMutes(userMemberships, payload.Types, payload.Groups)
+	if err != nil {
+		return err
+	}
+	if err := h.notificationStore.SetMutes(user.ID, mutes); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newAPINotificationMutes(mutes))
+}
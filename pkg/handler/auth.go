@@ -3,20 +3,37 @@ package handler
 import (
 	"context"
 	"cp/pkg/api"
+	"cp/pkg/logins"
+	"errors"
 	"fmt"
 	oidc "github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
 	"golang.org/x/oauth2"
 	"os"
+	"sync"
+	"time"
 )
 
+// unusedLoginRetention is how long the tokens of a session are kept without
+// being refreshed. The sessions closed without logging out are forgotten
+// after it
+const unusedLoginRetention = 30 * 24 * time.Hour
+
 func (h *Handler) getSession(c echo.Context) (*sessions.Session, error) {
-	return h.cookieStore.Get(c.Request(), "session")
+	return GetSession(h.cookieStore, c)
 }
 
+// GetSession returns the session of the request. A cookie that cannot be
+// decoded, such as one signed before the session secret changed, starts a
+// new session
 func GetSession(store sessions.Store, c echo.Context) (*sessions.Session, error) {
-	return store.Get(c.Request(), "session")
+	session, err := store.Get(c.Request(), "session")
+	if err != nil && session != nil && session.IsNew {
+		return session, nil
+	}
+	return session, err
 }
 
 func GetProfile(store sessions.Store, c echo.Context) (*api.Profile, error) {
@@ -25,6 +42,12 @@ func GetProfile(store sessions.Store, c echo.Context) (*api.Profile, error) {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
+	// Sessions are only valid as long as the id token they were created
+	// from. Expired sessions must be refreshed with refreshSession
+	if isSessionExpired(session) {
+		return nil, nil
+	}
+
 	idIntf, hasID := session.Values["id"]
 	if !hasID {
 		return nil, nil
@@ -74,29 +97,258 @@ func GetProfile(store sessions.Store, c echo.Context) (*api.Profile, error) {
 	return profile, nil
 }
 
+func isSessionExpired(session *sessions.Session) bool {
+	expiresAt, ok := session.Values["expires_at"].(int64)
+	if !ok {
+		return true
+	}
+	return !time.Now().Before(time.Unix(expiresAt, 0))
+}
+
+type AuthenticatorConfig struct {
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+func AuthenticatorConfigFromEnv() AuthenticatorConfig {
+	return AuthenticatorConfig{
+		DiscoveryURL: os.Getenv("OIDC_DISCOVERY_URL"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+}
+
+// Authenticator wraps the OIDC provider and the oauth2 configuration. The
+// provider discovery document is fetched once, and cached for the lifetime
+// of the authenticator. The tokens of the sessions are kept in the login
+// store.
 type Authenticator struct {
+	config   AuthenticatorConfig
+	logins   logins.Store
+	lock     sync.Mutex
 	provider *oidc.Provider
-	Config   oauth2.Config
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	logout   string
+}
+
+func NewAuthenticator(config AuthenticatorConfig, loginStore logins.Store) *Authenticator {
+	return &Authenticator{
+		config: config,
+		logins: loginStore,
+	}
 }
 
-func NewAuthenticator() (*Authenticator, error) {
-	ctx := context.Background()
-	provider, err := oidc.NewProvider(ctx, os.Getenv("OIDC_DISCOVERY_URL"))
+// Init fetches the provider discovery document. When the provider cannot
+// be reached, Init can be called again later. The provider keeps using ctx
+// to fetch its signing keys, so ctx must not be a request context.
+func (a *Authenticator) Init(ctx context.Context) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.provider != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, a.config.DiscoveryURL)
 	if err != nil {
-		err := fmt.Errorf("failed to get oidc provider: %w", err)
-		return nil, err
+		return fmt.Errorf("failed to get oidc provider: %w", err)
 	}
 
-	conf := oauth2.Config{
-		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
-		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	var claims struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := provider.Claims(&claims); err != nil {
+		return fmt.Errorf("failed to get oidc provider claims: %w", err)
+	}
+
+	a.provider = provider
+	a.logout = claims.EndSessionEndpoint
+	a.verifier = provider.Verifier(&oidc.Config{
+		ClientID: a.config.ClientID,
+	})
+	a.oauth2 = &oauth2.Config{
+		ClientID:     a.config.ClientID,
+		ClientSecret: a.config.ClientSecret,
+		RedirectURL:  a.config.RedirectURL,
 		Endpoint:     provider.Endpoint(),
 		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
 	}
+	return nil
+}
 
-	return &Authenticator{
-		provider: provider,
-		Config:   conf,
-	}, nil
+func (a *Authenticator) getOAuth2Config() (*oauth2.Config, error) {
+	if err := a.Init(context.Background()); err != nil {
+		return nil, err
+	}
+	return a.oauth2, nil
+}
+
+func (a *Authenticator) AuthCodeURL(state string) (string, error) {
+	config, err := a.getOAuth2Config()
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state), nil
+}
+
+func (a *Authenticator) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	config, err := a.getOAuth2Config()
+	if err != nil {
+		return nil, err
+	}
+	return config.Exchange(ctx, code)
+}
+
+func (a *Authenticator) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	config, err := a.getOAuth2Config()
+	if err != nil {
+		return nil, err
+	}
+	return config.TokenSource(ctx, &oauth2.Token{
+		RefreshToken: refreshToken,
+		Expiry:       time.Now().Add(-time.Minute),
+	}).Token()
+}
+
+// LogoutURL returns the RP-initiated logout URL of the provider, or an empty
+// string if the provider does not advertise an end session endpoint
+func (a *Authenticator) LogoutURL() (string, error) {
+	if err := a.Init(context.Background()); err != nil {
+		return "", err
+	}
+	return a.logout, nil
+}
+
+// SaveToken verifies the id token of the oauth2 token, and stores the
+// profile into the session. The id token and the refresh token are kept in
+// the login of the session, which is created when the session has none.
+// The session expires with the id token.
+func (a *Authenticator) SaveToken(ctx context.Context, session *sessions.Session, token *oauth2.Token) (*api.Profile, error) {
+	if err := a.Init(context.Background()); err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("no id_token found in oauth2 token")
+	}
+
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+
+	var profile api.Profile
+	if err := idToken.Claims(&profile); err != nil {
+		return nil, fmt.Errorf("failed to retrieve profile from id_token: %w", err)
+	}
+
+	if profile.Groups == nil {
+		profile.Groups = []string{}
+	}
+
+	loginID, ok := session.Values["login"].(string)
+	if !ok || loginID == "" {
+		loginID = uuid.NewV4().String()
+		// Logging in is a good time to forget the sessions closed without
+		// logging out
+		if err := a.logins.DeleteUnused(time.Now().Add(-unusedLoginRetention)); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.logins.Save(&api.Login{
+		ID:           loginID,
+		UserID:       profile.ID,
+		IDToken:      rawIDToken,
+		RefreshToken: token.RefreshToken,
+		ExpiresAt:    idToken.Expiry,
+	}); err != nil {
+		return nil, err
+	}
+
+	session.Values["login"] = loginID
+	session.Values["expires_at"] = idToken.Expiry.Unix()
+	session.Values["email"] = profile.Email
+	session.Values["username"] = profile.Username
+	session.Values["id"] = profile.ID
+	session.Values["groups"] = profile.Groups
+
+	return &profile, nil
+}
+
+// GetLogin returns the login of the session, or nil when the session has
+// none
+func (a *Authenticator) GetLogin(session *sessions.Session) (*api.Login, error) {
+	loginID, ok := session.Values["login"].(string)
+	if !ok || loginID == "" {
+		return nil, nil
+	}
+	login, err := a.logins.Get(loginID)
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// EndLogin forgets the tokens of the session, and returns them for the
+// logout. It returns nil when the session has no login
+func (a *Authenticator) EndLogin(session *sessions.Session) (*api.Login, error) {
+	login, err := a.GetLogin(session)
+	if err != nil {
+		return nil, err
+	}
+	delete(session.Values, "login")
+	if login == nil {
+		return nil, nil
+	}
+	if err := a.logins.Delete(login.ID); err != nil {
+		return nil, err
+	}
+	return login, nil
+}
+
+// refreshSession refreshes the tokens of an expired session. When the
+// session cannot be refreshed, it is cleared.
+func (h *Handler) refreshSession(c echo.Context) error {
+	session, err := h.getSession(c)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if _, hasID := session.Values["id"]; !hasID {
+		return nil
+	}
+
+	if !isSessionExpired(session) {
+		return nil
+	}
+
+	login, err := h.authenticator.GetLogin(session)
+	if err != nil {
+		return err
+	}
+
+	if login != nil && login.RefreshToken != "" {
+		token, err := h.authenticator.Refresh(c.Request().Context(), login.RefreshToken)
+		if err == nil {
+			_, err = h.authenticator.SaveToken(c.Request().Context(), session, token)
+		}
+		if err == nil {
+			return session.Save(c.Request(), c.Response().Writer)
+		}
+		c.Logger().Warn(fmt.Errorf("failed to refresh session: %w", err))
+	}
+
+	if _, err := h.authenticator.EndLogin(session); err != nil {
+		return err
+	}
+	session.Values = map[interface{}]interface{}{}
+	return session.Save(c.Request(), c.Response().Writer)
 }
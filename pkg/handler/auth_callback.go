@@ -1,13 +1,9 @@
 package handler
 
 import (
-	"context"
-	"cp/pkg/api"
 	"fmt"
-	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/labstack/echo/v4"
 	"net/http"
-	"os"
 )
 
 func (h *Handler) handleOauthCallback(c echo.Context) error {
@@ -20,51 +16,37 @@ func (h *Handler) handleOauthCallback(c echo.Context) error {
 		return fmt.Errorf("invalid state parameter")
 	}
 
-	authenticator, err := NewAuthenticator()
-	if err != nil {
-		err := fmt.Errorf("could not get oidc authenticator: %w", err)
-		return err
-	}
-
-	token, err := authenticator.Config.Exchange(context.TODO(), c.Request().URL.Query().Get("code"))
+	token, err := h.authenticator.Exchange(c.Request().Context(), c.Request().URL.Query().Get("code"))
 	if err != nil {
 		c.Logger().Error(fmt.Errorf("could not exchange token: %w", err))
 		return echo.ErrUnauthorized
 	}
 
-	rawIDToken, ok := token.Extra("id_token").(string)
-	if !ok {
-		c.Logger().Error(fmt.Errorf("no id_token found in oauth2 token."))
+	// A new login is created, the login of the previous user of the
+	// session is ended
+	if _, err := h.authenticator.EndLogin(session); err != nil {
+		c.Logger().Error(fmt.Errorf("failed to end login: %w", err))
 		return echo.ErrInternalServerError
 	}
 
-	oidcConfig := &oidc.Config{
-		ClientID: os.Getenv("OIDC_CLIENT_ID"),
-	}
-
-	idToken, err := authenticator.provider.Verifier(oidcConfig).Verify(context.TODO(), rawIDToken)
-	if err != nil {
-		c.Logger().Error(fmt.Errorf("failed to verify id_token: %w", err))
+	if _, err := h.authenticator.SaveToken(c.Request().Context(), session, token); err != nil {
+		c.Logger().Error(err)
 		return echo.ErrInternalServerError
 	}
 
-	var profile api.Profile
-	if err := idToken.Claims(&profile); err != nil {
-		c.Logger().Error(fmt.Errorf("failed to retrieve profile from id_token: %w", err))
-		return echo.ErrInternalServerError
-	}
+	delete(session.Values, "state")
 
-	session.Values["id_token"] = rawIDToken
-	session.Values["email"] = profile.Email
-	session.Values["username"] = profile.Username
-	session.Values["id"] = profile.ID
-	session.Values["groups"] = profile.Groups
+	redirect := "/"
+	if r, ok := session.Values["redirect"].(string); ok && isLocalPath(r) {
+		redirect = r
+	}
+	delete(session.Values, "redirect")
 
 	if err := session.Save(c.Request(), c.Response().Writer); err != nil {
 		c.Logger().Error(fmt.Errorf("failed to save session: %w", err))
 		return echo.ErrInternalServerError
 	}
 
-	return c.Redirect(http.StatusSeeOther, "/")
+	return c.Redirect(http.StatusSeeOther, redirect)
 
 }
@@ -7,7 +7,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"net/http"
 	url2 "net/url"
-	"os"
+	"strings"
 )
 
 func (h *Handler) handleLogin(c echo.Context) error {
@@ -26,18 +26,27 @@ func (h *Handler) handleLogin(c echo.Context) error {
 		return echo.ErrInternalServerError
 	}
 	session.Values["state"] = state
+
+	// Where to go back to after login, e.g. an invitation link. Only local
+	// paths are accepted, to avoid open redirects
+	if redirect := c.QueryParam("redirect"); isLocalPath(redirect) {
+		session.Values["redirect"] = redirect
+	} else {
+		delete(session.Values, "redirect")
+	}
+
 	if err := session.Save(c.Request(), c.Response().Writer); err != nil {
 		c.Logger().Error(fmt.Errorf("failed to save session: %w", err))
 		return echo.ErrInternalServerError
 	}
 
-	authenticator, err := NewAuthenticator()
+	authCodeURL, err := h.authenticator.AuthCodeURL(state)
 	if err != nil {
 		c.Logger().Error(fmt.Errorf("failed to get authenticator: %w", err))
 		return echo.ErrInternalServerError
 	}
 
-	return c.Redirect(http.StatusTemporaryRedirect, authenticator.Config.AuthCodeURL(state))
+	return c.Redirect(http.StatusTemporaryRedirect, authCodeURL)
 
 }
 
@@ -49,23 +58,53 @@ func (h *Handler) handleLogout(c echo.Context) error {
 		return echo.ErrInternalServerError
 	}
 
+	login, err := h.authenticator.EndLogin(session)
+	if err != nil {
+		c.Logger().Error(fmt.Errorf("failed to end login: %w", err))
+		return echo.ErrInternalServerError
+	}
+	var idTokenHint string
+	if login != nil {
+		idTokenHint = login.IDToken
+	}
+
 	session.Values = map[interface{}]interface{}{}
 	if err := session.Save(c.Request(), c.Response().Writer); err != nil {
 		c.Logger().Error(fmt.Errorf("failed to save session: %w", err))
 		return echo.ErrInternalServerError
 	}
 
-	uri, err := url2.Parse(fmt.Sprintf("%s/protocol/openid-connect/logout?redirect_uri=", os.Getenv("OIDC_DISCOVERY_URL")))
+	logoutURL, err := h.authenticator.LogoutURL()
 	if err != nil {
-		c.Logger().Error(fmt.Errorf("failed to parse oidc discovery url: %w", err))
+		c.Logger().Error(fmt.Errorf("failed to get logout url: %w", err))
 		return echo.ErrInternalServerError
 	}
+
 	redirectUri := fmt.Sprintf("%s://%s", c.Scheme(), c.Request().Host)
+
+	// The provider does not support RP-initiated logout
+	if logoutURL == "" {
+		return c.Redirect(http.StatusTemporaryRedirect, redirectUri)
+	}
+
+	uri, err := url2.Parse(logoutURL)
+	if err != nil {
+		c.Logger().Error(fmt.Errorf("failed to parse oidc logout url: %w", err))
+		return echo.ErrInternalServerError
+	}
 	q := uri.Query()
+	q.Set("post_logout_redirect_uri", redirectUri)
+	// Older Keycloak versions only understand redirect_uri
 	q.Set("redirect_uri", redirectUri)
+	if idTokenHint != "" {
+		q.Set("id_token_hint", idTokenHint)
+	}
 	uri.RawQuery = q.Encode()
 
-	uriStr := uri.String()
-	return c.Redirect(http.StatusTemporaryRedirect, uriStr)
+	return c.Redirect(http.StatusTemporaryRedirect, uri.String())
+
+}
 
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
 }
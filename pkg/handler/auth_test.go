@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/logins"
+	"cp/pkg/oidctest"
+	"cp/pkg/users"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authTest is a server whose users log in with a fake identity provider
+type authTest struct {
+	db     *gorm.DB
+	issuer *oidctest.Issuer
+	server *httptest.Server
+	client *http.Client
+}
+
+var alice = oidctest.Claims{
+	Subject:  "alice",
+	Email:    "alice@example.com",
+	Username: "alice",
+	Groups:   []string{},
+}
+
+func newAuthTest(t *testing.T) *authTest {
+	t.Helper()
+	db := dbtest.Open(t)
+	issuer, err := oidctest.NewIssuer("cp", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(issuer.Close)
+
+	e := echo.New()
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	h := &Handler{
+		cookieStore: sessions.NewCookieStore([]byte("authentication-key-of-the-tests"), []byte("encryption-key-of-the-tests-0000")),
+		authenticator: NewAuthenticator(AuthenticatorConfig{
+			DiscoveryURL: issuer.URL(),
+			ClientID:     "cp",
+			RedirectURL:  server.URL + "/auth/callback",
+		}, logins.NewLoginStore(db)),
+		userStore: users.NewUserStore(db),
+	}
+	e.GET("/auth/login", h.handleLogin)
+	e.GET("/auth/logout", h.handleLogout)
+	e.GET("/auth/callback", h.handleOauthCallback)
+	e.GET("/me", func(c echo.Context) error {
+		user, err := h.getAuthenticatedUser(c)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, user.ID)
+	}, h.authM(false))
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authTest{
+		db:     db,
+		issuer: issuer,
+		server: server,
+		client: &http.Client{Jar: jar},
+	}
+}
+
+// get requests a path of the server, following the redirects
+func (a *authTest) get(t *testing.T, path string) (int, string) {
+	t.Helper()
+	res, err := a.client.Get(a.server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(body)
+}
+
+// redirect requests a path of the server, and returns where it redirects to
+func (a *authTest) redirect(t *testing.T, path string) *url.URL {
+	t.Helper()
+	client := *a.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Get(a.server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	location, err := res.Location()
+	if err != nil {
+		t.Fatalf("GET %s: %d, expected a redirect", path, res.StatusCode)
+	}
+	return location
+}
+
+// login goes through the login flow, and returns to /me
+func (a *authTest) login(t *testing.T) {
+	t.Helper()
+	status, body := a.get(t, "/auth/login?redirect=/me")
+	if status != http.StatusOK {
+		t.Fatalf("login: %d %s", status, body)
+	}
+}
+
+func (a *authTest) logins(t *testing.T) []*api.Login {
+	t.Helper()
+	var result []*api.Login
+	if err := a.db.Find(&result).Error; err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func (a *authTest) expectUser(t *testing.T, userID string) {
+	t.Helper()
+	status, body := a.get(t, "/me")
+	if userID == "" && status != http.StatusUnauthorized {
+		t.Fatalf("GET /me: %d %s, expected to be logged out", status, body)
+	}
+	if userID != "" && (status != http.StatusOK || body != userID) {
+		t.Fatalf("GET /me: %d %s, expected %s", status, body, userID)
+	}
+}
+
+func TestLoginRedirectsToIssuer(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	location := test.redirect(t, "/auth/login")
+	if !strings.HasPrefix(location.String(), test.issuer.URL()+"/auth?") {
+		t.Fatalf("redirected to %s", location)
+	}
+	query := location.Query()
+	if query.Get("client_id") != "cp" || query.Get("state") == "" {
+		t.Fatalf("invalid authorization request %s", location)
+	}
+	if query.Get("redirect_uri") != test.server.URL+"/auth/callback" {
+		t.Fatalf("redirect_uri is %s", query.Get("redirect_uri"))
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	test.expectUser(t, "")
+	test.login(t)
+	test.expectUser(t, "alice")
+
+	var user api.User
+	if err := test.db.First(&user, "id = ?", "alice").Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != alice.Email || user.Username != alice.Username {
+		t.Fatalf("user is %+v", user)
+	}
+
+	loginList := test.logins(t)
+	if len(loginList) != 1 {
+		t.Fatalf("%d logins, expected 1", len(loginList))
+	}
+	login := loginList[0]
+	if login.UserID != "alice" || login.IDToken == "" || login.RefreshToken == "" {
+		t.Fatalf("login is %+v", login)
+	}
+
+	// The tokens are kept on the server only
+	serverURL, _ := url.Parse(test.server.URL)
+	for _, cookie := range test.client.Jar.Cookies(serverURL) {
+		if strings.Contains(cookie.Value, login.RefreshToken) || strings.Contains(cookie.Value, login.IDToken) {
+			t.Fatalf("cookie %s holds the tokens", cookie.Name)
+		}
+	}
+}
+
+func TestLoginWithInvalidState(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	test.redirect(t, "/auth/login")
+	status, _ := test.get(t, "/auth/callback?state=invalid&code=invalid")
+	if status < 400 {
+		t.Fatalf("callback: %d, expected an error", status)
+	}
+	test.expectUser(t, "")
+	if loginList := test.logins(t); len(loginList) != 0 {
+		t.Fatalf("%d logins, expected none", len(loginList))
+	}
+}
+
+func TestLoginAsAnotherUser(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	test.login(t)
+	test.issuer.SetClaims(oidctest.Claims{
+		Subject:  "bob",
+		Email:    "bob@example.com",
+		Username: "bob",
+		Groups:   []string{},
+	})
+	test.login(t)
+	test.expectUser(t, "bob")
+
+	// The login of the previous user of the session is ended
+	loginList := test.logins(t)
+	if len(loginList) != 1 || loginList[0].UserID != "bob" {
+		t.Fatalf("logins are %+v, expected the login of bob", loginList)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	test.issuer.SetTokenTTL(2 * time.Second)
+	test.login(t)
+	before := test.logins(t)[0]
+
+	test.issuer.SetTokenTTL(time.Hour)
+	time.Sleep(2 * time.Second)
+	test.expectUser(t, "alice")
+
+	loginList := test.logins(t)
+	if len(loginList) != 1 {
+		t.Fatalf("%d logins, expected 1", len(loginList))
+	}
+	after := loginList[0]
+	if after.ID != before.ID {
+		t.Fatalf("the refresh created login %s, expected %s", after.ID, before.ID)
+	}
+	if after.RefreshToken == before.RefreshToken || after.IDToken == before.IDToken {
+		t.Fatal("the tokens were not refreshed")
+	}
+	if !after.ExpiresAt.After(before.ExpiresAt.Add(time.Minute)) {
+		t.Fatalf("the login expires at %s", after.ExpiresAt)
+	}
+}
+
+func TestRefreshRevoked(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	test.issuer.SetTokenTTL(2 * time.Second)
+	test.login(t)
+	test.issuer.RevokeRefreshTokens()
+
+	time.Sleep(2 * time.Second)
+	test.expectUser(t, "")
+	if loginList := test.logins(t); len(loginList) != 0 {
+		t.Fatalf("%d logins, expected none", len(loginList))
+	}
+}
+
+func TestLogout(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+	test.login(t)
+	login := test.logins(t)[0]
+
+	location := test.redirect(t, "/auth/logout")
+	if !strings.HasPrefix(location.String(), test.issuer.URL()+"/logout?") {
+		t.Fatalf("redirected to %s", location)
+	}
+	query := location.Query()
+	if query.Get("id_token_hint") != login.IDToken {
+		t.Fatal("the logout does not carry the id token of the login")
+	}
+	if query.Get("post_logout_redirect_uri") == "" {
+		t.Fatal("the logout does not redirect back")
+	}
+
+	test.expectUser(t, "")
+	if loginList := test.logins(t); len(loginList) != 0 {
+		t.Fatalf("%d logins, expected none", len(loginList))
+	}
+}
+
+func TestLoginWithCookieOfAnotherKey(t *testing.T) {
+	t.Parallel()
+	test := newAuthTest(t)
+
+	// A cookie signed before the session secret changed starts a new
+	// session
+	other := sessions.NewCookieStore([]byte("secret"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := other.Get(req, "session")
+	session.Values["id"] = "alice"
+	session.Values["expires_at"] = time.Now().Add(time.Hour).Unix()
+	if err := session.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	serverURL, _ := url.Parse(test.server.URL)
+	test.client.Jar.SetCookies(serverURL, rec.Result().Cookies())
+
+	test.expectUser(t, "")
+	test.login(t)
+	test.expectUser(t, "alice")
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"cp/pkg/events"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// eventsKeepAlive is the interval of the comments sent on idle streams, so
+// that proxies do not close them
+const eventsKeepAlive = 30 * time.Second
+
+// handleUserEvents streams the notifications and the membership changes of
+// the authenticated user
+func (h *Handler) handleUserEvents(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	return h.streamEvents(c, events.UserTopic(authenticatedUser.ID))
+}
+
+// handlePostEvents streams the messages sent on the post, along with the
+// events of the authenticated user, so that the post page needs a single
+// stream
+func (h *Handler) handlePostEvents(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	return h.streamEvents(c, events.UserTopic(authenticatedUser.ID), events.ThreadTopic(post.ID))
+}
+
+// handleConversationEvents streams the messages sent in the conversation,
+// along with the events of the authenticated user
+func (h *Handler) handleConversationEvents(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	return h.streamEvents(c, events.UserTopic(authenticatedUser.ID), events.ThreadTopic(conversation.ID))
+}
+
+// streamEvents writes the events of the topics as server-sent events, until
+// the client disconnects
+func (h *Handler) streamEvents(c echo.Context, topics ...string) error {
+
+	subscription := h.broker.Subscribe(topics...)
+	defer subscription.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case event := <-subscription.Events():
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
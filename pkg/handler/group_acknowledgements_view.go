@@ -11,7 +11,12 @@ func (h *Handler) handleGetGroupAcknowledgements(c echo.Context) error {
 		return err
 	}
 
-	acknowledgements, err := h.acknowledgementStore.GetForGroup(group.ID)
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	acknowledgements, next, err := h.acknowledgementStore.GetForGroup(group.ID, page)
 	if err != nil {
 		return err
 	}
@@ -19,5 +24,6 @@ func (h *Handler) handleGetGroupAcknowledgements(c echo.Context) error {
 	return c.Render(http.StatusOK, "group_acknowledgements_view", map[string]interface{}{
 		"Title": "Hello",
 		"Acknowledgements": acknowledgements,
+		"NextLink": h.nextPageLink(c, next),
 	})
 }
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+// handleGroupArchive makes the group read only. Its members can still view
+// it, and leave it
+func (h *Handler) handleGroupArchive(c echo.Context) error {
+	now := time.Now()
+	return h.setGroupArchived(c, &now, "The group was archived, it can no longer be changed")
+}
+
+func (h *Handler) handleGroupUnarchive(c echo.Context) error {
+	return h.setGroupArchived(c, nil, "The group was unarchived")
+}
+
+func (h *Handler) setGroupArchived(c echo.Context, archivedAt *time.Time, message string) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.groupStore.SetArchived(group.ID, archivedAt); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: message,
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
@@ -2,8 +2,12 @@ package handler
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/pagination"
+	"cp/pkg/policy"
+	posts2 "cp/pkg/posts"
 	"fmt"
 	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
 	"net/http"
 	"sort"
 	"time"
@@ -124,13 +128,16 @@ func (r *UserRow) Clone() *UserRow {
 }
 
 type Row struct {
-	Time          time.Time
-	Description   string
-	GroupRow      *GroupRow
-	UserRows      []*UserRow
-	userIndexMap  map[string]int
-	UserIDs       []string
-	concernsGroup bool
+	Time        time.Time
+	Description string
+	// JournalEntryID is the transfer of the row, which can be reversed. It
+	// is empty for the other rows, and for the reversals
+	JournalEntryID string
+	GroupRow       *GroupRow
+	UserRows       []*UserRow
+	userIndexMap   map[string]int
+	UserIDs        []string
+	concernsGroup  bool
 }
 
 func (r *Row) ConcernsUser(userID string) bool {
@@ -190,13 +197,14 @@ func (r *Row) Clone() *Row {
 	}
 
 	return &Row{
-		Time:          r.Time,
-		Description:   r.Description,
-		GroupRow:      r.GroupRow.Clone(),
-		UserRows:      clonedUserRows,
-		userIndexMap:  clonedUserIndexMap,
-		UserIDs:       clonedUserIds,
-		concernsGroup: r.concernsGroup,
+		Time:           r.Time,
+		Description:    r.Description,
+		JournalEntryID: r.JournalEntryID,
+		GroupRow:       r.GroupRow.Clone(),
+		UserRows:       clonedUserRows,
+		userIndexMap:   clonedUserIndexMap,
+		UserIDs:        clonedUserIds,
+		concernsGroup:  r.concernsGroup,
 	}
 
 }
@@ -204,6 +212,7 @@ func (r *Row) Clone() *Row {
 func (r *Row) AsCombined() *Row {
 	var newRow = r.Clone()
 	newRow.Description = ""
+	newRow.JournalEntryID = ""
 	newRow.Time = time.Time{}
 	return newRow
 }
@@ -211,6 +220,10 @@ func (r *Row) AsCombined() *Row {
 type GroupHistoryQuery struct {
 	Users     []string `query:"users"`
 	ShowGroup bool     `query:"showGroup"`
+	From      string   `query:"from"`
+	To        string   `query:"to"`
+	Before    string   `query:"before"`
+	Limit     int      `query:"limit"`
 }
 
 func NewRow() *Row {
@@ -350,33 +363,45 @@ func (r *Row) processAcknowledgement(acknowledgement *api.Acknowledgement) {
 
 }
 
-func (r *Row) processCredits(credits *api.Credits) {
-	r.Description = fmt.Sprintf("%s %s sent %s credits to %s %s",
-		credits.SentBy.Type,
-		credits.SentBy.HTMLLink(),
-		credits.Amount.String(),
-		credits.SentTo.Type,
-		credits.SentTo.HTMLLink(),
-	)
+func (r *Row) processJournalEntry(entry *api.JournalEntry) {
+	debits := entry.Debits()
+	credits := entry.Credits()
+
+	if len(debits) == 1 && len(credits) == 1 {
+		sentBy := debits[0].Account.Owner
+		sentTo := credits[0].Account.Owner
+		r.Description = fmt.Sprintf("%s %s sent %s credits to %s %s",
+			sentBy.Type,
+			sentBy.HTMLLink(),
+			entry.Amount().String(),
+			sentTo.Type,
+			sentTo.HTMLLink(),
+		)
+	} else {
+		r.Description = fmt.Sprintf("%s credits were transferred", entry.Amount().String())
+	}
 
-	if credits.SentBy.IsGroup() {
-		r.GroupRow.Credits = r.GroupRow.Credits - credits.Amount
-		r.concernsGroup = true
-	} else if credits.SentBy.IsUser() {
-		userID := credits.SentBy.GetUserID()
-		userRow := r.getUserRow(userID)
-		userRow.Credits = userRow.Credits - credits.Amount
-		r.UserIDs = append(r.UserIDs, userID)
+	if entry.Post != nil {
+		r.Description = fmt.Sprintf("%s for post %s", r.Description, entry.Post.HTMLLink())
 	}
 
-	if credits.SentTo.IsGroup() {
-		r.GroupRow.Credits = r.GroupRow.Credits + credits.Amount
-		r.concernsGroup = true
-	} else if credits.SentTo.IsUser() {
-		userID := credits.SentTo.GetUserID()
-		userRow := r.getUserRow(userID)
-		userRow.Credits = userRow.Credits + credits.Amount
-		r.UserIDs = append(r.UserIDs, userID)
+	if entry.IsReversal() {
+		r.Description = "Reversal: " + r.Description
+	} else {
+		r.JournalEntryID = entry.ID
+	}
+
+	for _, posting := range entry.Postings {
+		owner := posting.Account.Owner
+		if owner.IsGroup() {
+			r.GroupRow.Credits = r.GroupRow.Credits + posting.Amount
+			r.concernsGroup = true
+		} else if owner.IsUser() {
+			userID := owner.GetUserID()
+			userRow := r.getUserRow(userID)
+			userRow.Credits = userRow.Credits + posting.Amount
+			r.UserIDs = append(r.UserIDs, userID)
+		}
 	}
 
 }
@@ -439,8 +464,8 @@ func (r *Row) processEntry(entry *Entry) {
 	r.Time = entry.time
 	if entry.acknowledgement != nil {
 		r.processAcknowledgement(entry.acknowledgement)
-	} else if entry.credit != nil {
-		r.processCredits(entry.credit)
+	} else if entry.journalEntry != nil {
+		r.processJournalEntry(entry.journalEntry)
 	} else if entry.post != nil {
 		r.processPost(entry.post)
 	}
@@ -449,7 +474,7 @@ func (r *Row) processEntry(entry *Entry) {
 type Entry struct {
 	time            time.Time
 	acknowledgement *api.Acknowledgement
-	credit          *api.Credits
+	journalEntry    *api.JournalEntry
 	post            *api.Post
 }
 
@@ -466,6 +491,10 @@ var groupHistoryRowComparer = func(comparers []RowComparer) RowComparer {
 	}
 }
 
+// historySnapshotInterval is the number of history rows between two
+// snapshots of the group history
+const historySnapshotInterval = 100
+
 func (h *Handler) handleGetGroupHistory(c echo.Context) error {
 
 	group, err := h.getGroup(c)
@@ -473,26 +502,167 @@ func (h *Handler) handleGetGroupHistory(c echo.Context) error {
 		return err
 	}
 
-	acknowledgements, err := h.acknowledgementStore.GetAllInGroup(group.ID)
+	var query GroupHistoryQuery
+	if err := c.Bind(&query); err != nil {
+		return err
+	}
+
+	from, before, err := parseHistoryRange(query)
 	if err != nil {
 		return err
 	}
 
-	credits, err := h.creditsStore.GetAllForGroup(group.ID)
+	snapshots, userMap, err := h.updateHistorySnapshots(group.ID)
 	if err != nil {
 		return err
 	}
 
-	posts, err := h.postStore.GetByGroup(group.ID)
+	filteredRows, next, err := h.getGroupHistoryPage(group.ID, snapshots, query, from, before, pagination.ClampLimit(query.Limit))
 	if err != nil {
 		return err
 	}
 
-	var query GroupHistoryQuery
-	if err := c.Bind(&query); err != nil {
+	for i, j := 0, len(filteredRows)-1; i < j; i, j = i+1, j-1 {
+		filteredRows[i], filteredRows[j] = filteredRows[j], filteredRows[i]
+	}
+
+	if err := h.hideReversedEntries(filteredRows); err != nil {
 		return err
 	}
 
+	var rowUsers = []*api.User{}
+	for _, queryUserID := range query.Users {
+		rowUsers = append(rowUsers, userMap[queryUserID])
+	}
+
+	type UserOption struct {
+		*api.User
+		Selected bool
+	}
+
+	var options []*UserOption
+	for _, user := range userMap {
+		var selected = false
+		for _, s := range query.Users {
+			if s == user.ID {
+				selected = true
+			}
+		}
+		options = append(options, &UserOption{
+			User:     user,
+			Selected: selected,
+		})
+	}
+
+	var nextLink string
+	if next != nil {
+		nextLink = h.pageLink(c, "before", next.Format(time.RFC3339Nano))
+	}
+
+	return c.Render(http.StatusOK, "group_history_view", map[string]interface{}{
+		"Title":              "Hello",
+		"Rows":               filteredRows,
+		"Users":              options,
+		"RowUsers":           rowUsers,
+		"ShowGroup":          query.ShowGroup,
+		"From":               query.From,
+		"To":                 query.To,
+		"NextLink":           nextLink,
+		"HistoryExportLinks": h.exportLinks(c, fmt.Sprintf("/groups/%s/history/export", group.ID)),
+		"LedgerExportLinks":  h.exportLinks(c, fmt.Sprintf("/groups/%s/ledger/export", group.ID)),
+		"CanReverseCredits":  policy.Can(h.getSubject(c), policy.ReverseCredits, policy.Resource{Group: group}) == nil,
+	})
+
+}
+
+// hideReversedEntries clears the journal entry of the rows whose transfer
+// was already reversed, so that it is not offered to be reversed again
+func (h *Handler) hideReversedEntries(rows []*Row) error {
+	var entryIDs []string
+	for _, row := range rows {
+		if row.JournalEntryID != "" {
+			entryIDs = append(entryIDs, row.JournalEntryID)
+		}
+	}
+	reversedIDs, err := h.ledgerStore.GetReversedEntryIDs(entryIDs)
+	if err != nil {
+		return err
+	}
+	reversed := map[string]bool{}
+	for _, entryID := range reversedIDs {
+		reversed[entryID] = true
+	}
+	for _, row := range rows {
+		if reversed[row.JournalEntryID] {
+			row.JournalEntryID = ""
+		}
+	}
+	return nil
+}
+
+// parseHistoryRange returns the range of the history selected by the from
+// and to dates, and by the cursor of the page. A zero time leaves that side
+// of the range open
+func parseHistoryRange(query GroupHistoryQuery) (from, before time.Time, err error) {
+	from, err = parseHistoryDate(query.From)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseHistoryDate(query.To)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !to.IsZero() {
+		before = to.AddDate(0, 0, 1)
+	}
+	if query.Before != "" {
+		cursor, err := time.Parse(time.RFC3339Nano, query.Before)
+		if err != nil {
+			return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "invalid cursor")
+		}
+		if before.IsZero() || cursor.Before(before) {
+			before = cursor
+		}
+	}
+	return from, before, nil
+}
+
+// parseHistoryDate parses a date of the history range. An empty value
+// leaves the range open
+func parseHistoryDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "invalid date")
+	}
+	return date, nil
+}
+
+// getHistoryEntries returns the entries of the group history created
+// strictly between after and before, sorted by time. A zero time leaves that
+// side of the range open
+func (h *Handler) getHistoryEntries(groupID string, after, before time.Time) ([]*Entry, error) {
+
+	acknowledgements, err := h.acknowledgementStore.GetInGroupBetween(groupID, after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	journalEntries, err := h.ledgerStore.GetEntriesForGroupBetween(groupID, after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, _, err := h.postStore.GetByGroup(groupID, &posts2.FindPostsOptions{
+		After:  after,
+		Before: before,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	var entries []*Entry
 	for _, acknowledgement := range acknowledgements {
 		entries = append(entries, &Entry{
@@ -500,10 +670,10 @@ func (h *Handler) handleGetGroupHistory(c echo.Context) error {
 			acknowledgement: acknowledgement,
 		})
 	}
-	for _, credit := range credits {
+	for _, journalEntry := range journalEntries {
 		entries = append(entries, &Entry{
-			time:   credit.CreatedAt,
-			credit: credit,
+			time:         journalEntry.CreatedAt,
+			journalEntry: journalEntry,
 		})
 	}
 	for _, post := range posts {
@@ -527,75 +697,92 @@ func (h *Handler) handleGetGroupHistory(c echo.Context) error {
 		}
 	}
 
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].time.Before(entries[j].time)
-	})
-
-	var userIdMap = map[string]bool{}
-	var userMap = map[string]*api.User{}
-	for _, acknowledgement := range acknowledgements {
-		if acknowledgement.SentBy.IsUser() {
-			userID := acknowledgement.SentBy.GetUserID()
-			userIdMap[userID] = true
-			userMap[userID] = acknowledgement.SentBy.GetUser()
+	// a post created before the range can be deleted within it, and the
+	// other way around
+	var result []*Entry
+	for _, entry := range entries {
+		if (after.IsZero() || entry.time.After(after)) && (before.IsZero() || entry.time.Before(before)) {
+			result = append(result, entry)
 		}
-		if acknowledgement.SentTo.IsUser() {
-			userID := acknowledgement.SentTo.GetUserID()
-			userIdMap[userID] = true
-			userMap[userID] = acknowledgement.SentTo.User
+	}
+
+	// the entries sharing a time are sorted by ID, so that they are
+	// processed in the same order whatever snapshot the rows are computed
+	// from
+	sort.SliceStable(result, func(i, j int) bool {
+		if !result[i].time.Equal(result[j].time) {
+			return result[i].time.Before(result[j].time)
 		}
+		return result[i].id() < result[j].id()
+	})
+
+	return result, nil
+}
+
+// id returns the ID of the acknowledgement, journal entry or post of the
+// entry
+func (e *Entry) id() string {
+	if e.acknowledgement != nil {
+		return e.acknowledgement.ID
 	}
-	for _, credit := range credits {
-		if credit.SentBy.IsUser() {
-			userID := credit.SentBy.GetUserID()
-			userIdMap[userID] = true
-			userMap[userID] = credit.SentBy.User
+	if e.journalEntry != nil {
+		return e.journalEntry.ID
+	}
+	return e.post.ID
+}
+
+// getUsers returns the users concerned by the entry
+func (e *Entry) getUsers() []*api.User {
+	var users []*api.User
+	if e.acknowledgement != nil {
+		if e.acknowledgement.SentBy.IsUser() {
+			users = append(users, e.acknowledgement.SentBy.GetUser())
 		}
-		if credit.SentTo.IsUser() {
-			userID := credit.SentTo.GetUserID()
-			userIdMap[userID] = true
-			userMap[userID] = credit.SentTo.User
+		if e.acknowledgement.SentTo.IsUser() {
+			users = append(users, e.acknowledgement.SentTo.GetUser())
 		}
 	}
-	for _, post := range posts {
-		userIdMap[post.AuthorID] = true
-		userMap[post.AuthorID] = post.Author
+	if e.journalEntry != nil {
+		for _, posting := range e.journalEntry.Postings {
+			if posting.Account.Owner.IsUser() {
+				users = append(users, posting.Account.Owner.GetUser())
+			}
+		}
 	}
-	var userIds []string
-	var allUsers []*api.User
-
-	var nullRow = NewRow()
-	for userID, _ := range userIdMap {
-		// populate user columns by calling getUserRow
-		nullRow.getUserRow(userID)
-		userIds = append(userIds, userID)
-		allUsers = append(allUsers, userMap[userID])
+	if e.post != nil {
+		users = append(users, e.post.Author)
 	}
+	return users
+}
 
-	var previousRow *Row
+// computeRows processes the entries in order, starting from the running
+// totals of the start row
+func computeRows(start *Row, entries []*Entry) []*Row {
 	var rows []*Row
+	var previousRow = start
 	for _, entry := range entries {
 		if entry.post != nil && entry.post.Type == api.CommentPost {
+			// comments have no row, but their authors can still be selected
+			previousRow.getUserRow(entry.post.AuthorID)
 			continue
 		}
 		row := NewRow()
-		if previousRow != nil {
-			row.processPreviousRow(previousRow)
-		} else {
-			row.processPreviousRow(nullRow)
-		}
+		row.processPreviousRow(previousRow)
 		row.processEntry(entry)
 		rows = append(rows, row)
 		previousRow = row
 	}
+	return rows
+}
+
+// filterRows keeps the rows concerning the group or the users of the query,
+// in chronological order. The rows skipped in between are combined into a
+// row without time when they changed the totals shown
+func filterRows(rows []*Row, query GroupHistoryQuery) []*Row {
 
-	var rowUsers = []*api.User{}
 	var comparers []RowComparer
 
-	queryUserIdMap := map[string]bool{}
 	for _, queryUserID := range query.Users {
-		rowUsers = append(rowUsers, userMap[queryUserID])
-		queryUserIdMap[queryUserID] = true
 		comparers = append(comparers, func(a, b *Row) bool {
 			userA := a.getUserRow(queryUserID)
 			userB := b.getUserRow(queryUserID)
@@ -618,7 +805,7 @@ func (h *Handler) handleGetGroupHistory(c echo.Context) error {
 		if (query.ShowGroup && row.concernsGroup) || row.ConcernsOneOfUsers(query.Users) {
 			if len(skippedRows) > 0 {
 				if !rowComparer(skippedRows[len(skippedRows)-1], row) {
-					filteredRows = append(filteredRows, skippedRows[len(skippedRows)-1].AsCombined())
+					filteredRows = append(filteredRows, skippedRows[len(skippedRows)-1].AsCombined().FilterUsers(query.Users))
 				}
 			}
 			isFirstRow = false
@@ -631,35 +818,208 @@ func (h *Handler) handleGetGroupHistory(c echo.Context) error {
 		}
 	}
 
-	for i, j := 0, len(filteredRows)-1; i < j; i, j = i+1, j-1 {
-		filteredRows[i], filteredRows[j] = filteredRows[j], filteredRows[i]
+	return filteredRows
+}
+
+// latestRows returns the rows holding the limit latest rows shown, along
+// with the rows combined before them. Rows sharing the time of the earliest
+// one are all kept, so that the next page can start strictly before it.
+// complete tells if a row is shown before them, meaning that the rows
+// returned are the same whatever row the computation started from
+func latestRows(filteredRows []*Row, limit int) (rows []*Row, complete bool) {
+	start := len(filteredRows)
+	count := 0
+	for i := len(filteredRows) - 1; i >= 0; i-- {
+		if filteredRows[i].Time.IsZero() {
+			continue
+		}
+		if count >= limit && filteredRows[i].Time.Before(filteredRows[start].Time) {
+			return filteredRows[i+1:], true
+		}
+		start = i
+		count++
 	}
+	return filteredRows, false
+}
 
-	type UserOption struct {
-		*api.User
-		Selected bool
+// getGroupHistoryPage returns the latest rows of the history created after
+// from and strictly before before, and the time to continue from on the
+// next page. Rather than from the first entry of the history, the rows are
+// computed from the latest snapshot giving enough of them
+func (h *Handler) getGroupHistoryPage(groupID string, snapshots []*api.HistorySnapshot, query GroupHistoryQuery, from, before time.Time, limit int) ([]*Row, *time.Time, error) {
+
+	first := firstHistorySnapshot(snapshots, from)
+	last := first
+	for i := first + 1; i < len(snapshots); i++ {
+		if before.IsZero() || snapshots[i].Until.Before(before) {
+			last = i
+		}
 	}
 
-	var options []*UserOption
-	for _, user := range allUsers {
-		var selected = false
-		for _, s := range query.Users {
-			if s == user.ID {
-				selected = true
+	for i := last; ; i-- {
+		rows, err := h.getGroupHistoryRows(groupID, snapshots, i, from, before)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		filteredRows := filterRows(rows, query)
+		latest, complete := latestRows(filteredRows, limit)
+		if complete {
+			var next time.Time
+			for _, row := range latest {
+				if !row.Time.IsZero() {
+					next = row.Time
+					break
+				}
 			}
+			return latest, &next, nil
+		}
+		if i == first {
+			return latest, nil, nil
 		}
-		options = append(options, &UserOption{
-			User:     user,
-			Selected: selected,
-		})
 	}
+}
 
-	return c.Render(http.StatusOK, "group_history_view", map[string]interface{}{
-		"Title":     "Hello",
-		"Rows":      filteredRows,
-		"Users":     options,
-		"RowUsers":  rowUsers,
-		"ShowGroup": query.ShowGroup,
-	})
+// firstHistorySnapshot returns the index of the latest snapshot the history
+// after from can be computed from, or -1 when it must be computed from the
+// first entry. The history before from is needed for its totals
+func firstHistorySnapshot(snapshots []*api.HistorySnapshot, from time.Time) int {
+	first := -1
+	for i, snapshot := range snapshots {
+		if !from.IsZero() && snapshot.Until.Before(from) {
+			first = i
+		}
+	}
+	return first
+}
+
+// getGroupHistoryRows computes the rows of the history created after from
+// and strictly before before, starting from the snapshot at the given index,
+// or from the first entry when it is -1
+func (h *Handler) getGroupHistoryRows(groupID string, snapshots []*api.HistorySnapshot, index int, from, before time.Time) ([]*Row, error) {
+	start := NewRow()
+	var after time.Time
+	if index >= 0 {
+		snapshot, err := h.snapshotStore.Get(snapshots[index].ID)
+		if err != nil {
+			return nil, err
+		}
+		start = newRowFromSnapshot(snapshot)
+		after = snapshot.Until
+	}
+
+	entries, err := h.getHistoryEntries(groupID, after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := computeRows(start, entries)
+	for len(rows) > 0 && rows[0].Time.Before(from) {
+		rows = rows[1:]
+	}
+	return rows, nil
+}
+
+// updateHistorySnapshots takes the snapshots missing since the latest
+// snapshot of the group, one every historySnapshotInterval rows. It returns
+// the snapshots of the group, oldest first, and the users concerned by its
+// history
+func (h *Handler) updateHistorySnapshots(groupID string) ([]*api.HistorySnapshot, map[string]*api.User, error) {
+
+	snapshots, err := h.snapshotStore.GetForGroup(groupID)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	var userMap = map[string]*api.User{}
+	var start = NewRow()
+	var after time.Time
+	if len(snapshots) > 0 {
+		latest, err := h.snapshotStore.Get(snapshots[len(snapshots)-1].ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		start = newRowFromSnapshot(latest)
+		after = latest.Until
+		for _, user := range latest.Users {
+			if user.User != nil {
+				userMap[user.UserID] = user.User
+			}
+		}
+	}
+
+	entries, err := h.getHistoryEntries(groupID, after, time.Time{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		for _, user := range entry.getUsers() {
+			if user != nil {
+				userMap[user.ID] = user
+			}
+		}
+	}
+
+	rows := computeRows(start, entries)
+	for i := historySnapshotInterval - 1; i < len(rows)-1; i++ {
+		// the entries sharing the time of the snapshot would be skipped when
+		// computing the history from it
+		if !rows[i+1].Time.After(rows[i].Time) {
+			continue
+		}
+		snapshot := newSnapshot(groupID, rows[i])
+		if err := h.snapshotStore.Create(snapshot); err != nil {
+			return nil, nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+		i += historySnapshotInterval - 1
+	}
+
+	return snapshots, userMap, nil
+}
+
+// newSnapshot returns a snapshot of the running totals of the row
+func newSnapshot(groupID string, row *Row) *api.HistorySnapshot {
+	snapshot := &api.HistorySnapshot{
+		ID:              uuid.NewV4().String(),
+		GroupID:         groupID,
+		Until:           row.Time,
+		AllRequestCount: row.GroupRow.AllRequestCount,
+		AllOfferCount:   row.GroupRow.AllOfferCount,
+		RequestCount:    row.GroupRow.RequestCount,
+		OfferCount:      row.GroupRow.OfferCount,
+		Credits:         row.GroupRow.Credits,
+	}
+	for _, userRow := range row.UserRows {
+		snapshot.Users = append(snapshot.Users, &api.HistorySnapshotUser{
+			ID:           uuid.NewV4().String(),
+			SnapshotID:   snapshot.ID,
+			UserID:       userRow.UserID,
+			RequestCount: userRow.RequestCount,
+			OfferCount:   userRow.OfferCount,
+			Credits:      userRow.Credits,
+		})
+	}
+	return snapshot
+}
+
+// newRowFromSnapshot returns a row holding the running totals of the
+// snapshot, to compute the following rows from
+func newRowFromSnapshot(snapshot *api.HistorySnapshot) *Row {
+	row := NewRow()
+	row.Time = snapshot.Until
+	row.GroupRow = &GroupRow{
+		AllRequestCount: snapshot.AllRequestCount,
+		AllOfferCount:   snapshot.AllOfferCount,
+		RequestCount:    snapshot.RequestCount,
+		OfferCount:      snapshot.OfferCount,
+		Credits:         snapshot.Credits,
+	}
+	for _, user := range snapshot.Users {
+		userRow := row.getUserRow(user.UserID)
+		userRow.RequestCount = user.RequestCount
+		userRow.OfferCount = user.OfferCount
+		userRow.Credits = user.Credits
+	}
+	return row
 }
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"cp/pkg/export"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+type GroupHistoryExportQuery struct {
+	GroupHistoryQuery
+	Format export.Format `query:"format"`
+}
+
+type HistoryExportRow struct {
+	Time        *time.Time              `json:"time"`
+	Description string                  `json:"description"`
+	Group       *HistoryExportGroupRow  `json:"group,omitempty"`
+	Users       []*HistoryExportUserRow `json:"users"`
+}
+
+type HistoryExportGroupRow struct {
+	AllRequestCount          int    `json:"allRequestCount"`
+	AllOfferCount            int    `json:"allOfferCount"`
+	RequestCount             int    `json:"requestCount"`
+	OfferCount               int    `json:"offerCount"`
+	Credits                  string `json:"credits"`
+	AcknowledgementsReceived string `json:"acknowledgementsReceived"`
+	AcknowledgementsSent     string `json:"acknowledgementsSent"`
+	Note                     string `json:"note"`
+}
+
+type HistoryExportUserRow struct {
+	UserID                   string `json:"userId"`
+	Username                 string `json:"username"`
+	RequestCount             int    `json:"requestCount"`
+	OfferCount               int    `json:"offerCount"`
+	Credits                  string `json:"credits"`
+	AcknowledgementsReceived string `json:"acknowledgementsReceived"`
+	AcknowledgementsSent     string `json:"acknowledgementsSent"`
+	Note                     string `json:"note"`
+}
+
+func (h *Handler) handleGetGroupHistoryExport(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var query GroupHistoryExportQuery
+	if err := c.Bind(&query); err != nil {
+		return err
+	}
+	if !query.Format.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid format")
+	}
+
+	from, before, err := parseHistoryRange(query.GroupHistoryQuery)
+	if err != nil {
+		return err
+	}
+
+	snapshots, userMap, err := h.updateHistorySnapshots(group.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := h.getGroupHistoryRows(group.ID, snapshots, firstHistorySnapshot(snapshots, from), from, before)
+	if err != nil {
+		return err
+	}
+
+	filteredRows := filterRows(rows, query.GroupHistoryQuery)
+	for i, j := 0, len(filteredRows)-1; i < j; i, j = i+1, j-1 {
+		filteredRows[i], filteredRows[j] = filteredRows[j], filteredRows[i]
+	}
+
+	usernames := map[string]string{}
+	for _, userID := range query.Users {
+		usernames[userID] = userID
+		if user, ok := userMap[userID]; ok {
+			usernames[userID] = user.Username
+		}
+	}
+
+	filename := fmt.Sprintf("history-%s.%s", group.ID, query.Format)
+	if query.Format == export.JSON {
+		return writeExport(c, query.Format, filename, nil, newHistoryExportRows(filteredRows, query.GroupHistoryQuery, usernames))
+	}
+	return writeExport(c, query.Format, filename, newHistoryTable(filteredRows, query.GroupHistoryQuery, usernames), nil)
+}
+
+// writeExport sends the export as a file to download, either the table, or
+// the value encoded as JSON
+func writeExport(c echo.Context, format export.Format, filename string, table *export.Table, value interface{}) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	if format == export.JSON {
+		return c.JSON(http.StatusOK, value)
+	}
+	c.Response().Header().Set(echo.HeaderContentType, format.ContentType())
+	c.Response().WriteHeader(http.StatusOK)
+	if format == export.ODS {
+		return table.WriteODS(c.Response())
+	}
+	return table.WriteCSV(c.Response())
+}
+
+// newHistoryTable returns the rows of the history view as a table, with the
+// same columns
+func newHistoryTable(rows []*Row, query GroupHistoryQuery, usernames map[string]string) *export.Table {
+	table := &export.Table{
+		Name:    "History",
+		Columns: []string{"Time", "Description"},
+	}
+	if query.ShowGroup {
+		table.Columns = append(table.Columns,
+			"Group: All requests",
+			"Group: All offers",
+			"Group: Requests by group",
+			"Group: Offers by group",
+			"Group: Hours in bank",
+			"Group: Acknowledgements received",
+			"Group: Acknowledgements sent",
+			"Group: Notes")
+	}
+	for _, userID := range query.Users {
+		username := usernames[userID]
+		table.Columns = append(table.Columns,
+			username+": Requests",
+			username+": Offers",
+			username+": Hours in bank",
+			username+": Acknowledgements received",
+			username+": Acknowledgements sent",
+			username+": Notes")
+	}
+
+	for _, row := range rows {
+		var cells []interface{}
+		if row.Time.IsZero() {
+			cells = append(cells, nil)
+		} else {
+			cells = append(cells, row.Time)
+		}
+		cells = append(cells, export.Text(row.Description))
+		if query.ShowGroup {
+			cells = append(cells,
+				row.GroupRow.AllRequestCount,
+				row.GroupRow.AllOfferCount,
+				row.GroupRow.RequestCount,
+				row.GroupRow.OfferCount,
+				row.GroupRow.Credits,
+				export.Text(row.GroupRow.AcknowledgementsReceived),
+				export.Text(row.GroupRow.AcknowledgementsSent),
+				export.Text(row.GroupRow.Note))
+		}
+		for i := range query.Users {
+			userRow := row.GetRow(i)
+			cells = append(cells,
+				userRow.RequestCount,
+				userRow.OfferCount,
+				userRow.Credits,
+				export.Text(userRow.AcknowledgementsReceived),
+				export.Text(userRow.AcknowledgementsSent),
+				export.Text(userRow.Note))
+		}
+		table.AddRow(cells...)
+	}
+	return table
+}
+
+func newHistoryExportRows(rows []*Row, query GroupHistoryQuery, usernames map[string]string) []*HistoryExportRow {
+	var result = []*HistoryExportRow{}
+	for _, row := range rows {
+		exportRow := &HistoryExportRow{
+			Description: export.Text(row.Description),
+			Users:       []*HistoryExportUserRow{},
+		}
+		if !row.Time.IsZero() {
+			rowTime := row.Time
+			exportRow.Time = &rowTime
+		}
+		if query.ShowGroup {
+			exportRow.Group = &HistoryExportGroupRow{
+				AllRequestCount:          row.GroupRow.AllRequestCount,
+				AllOfferCount:            row.GroupRow.AllOfferCount,
+				RequestCount:             row.GroupRow.RequestCount,
+				OfferCount:               row.GroupRow.OfferCount,
+				Credits:                  export.Duration(row.GroupRow.Credits),
+				AcknowledgementsReceived: export.Text(row.GroupRow.AcknowledgementsReceived),
+				AcknowledgementsSent:     export.Text(row.GroupRow.AcknowledgementsSent),
+				Note:                     export.Text(row.GroupRow.Note),
+			}
+		}
+		for i, userID := range query.Users {
+			userRow := row.GetRow(i)
+			exportRow.Users = append(exportRow.Users, &HistoryExportUserRow{
+				UserID:                   userID,
+				Username:                 usernames[userID],
+				RequestCount:             userRow.RequestCount,
+				OfferCount:               userRow.OfferCount,
+				Credits:                  export.Duration(userRow.Credits),
+				AcknowledgementsReceived: export.Text(userRow.AcknowledgementsReceived),
+				AcknowledgementsSent:     export.Text(userRow.AcknowledgementsSent),
+				Note:                     export.Text(userRow.Note),
+			})
+		}
+		result = append(result, exportRow)
+	}
+	return result
+}
+
+// exportLinks returns the links to the exports of the page, by format. The
+// filters of the page are kept, but not its pagination
+func (h *Handler) exportLinks(c echo.Context, path string) map[string]string {
+	links := map[string]string{}
+	for _, format := range []export.Format{export.CSV, export.JSON, export.ODS} {
+		query := c.Request().URL.Query()
+		query.Del("before")
+		query.Del("limit")
+		query.Set("format", string(format))
+		links[string(format)] = path + "?" + query.Encode()
+	}
+	return links
+}
@@ -0,0 +1,397 @@
+package handler
+
+import (
+	"cp/pkg/acknowledgements"
+	"cp/pkg/api"
+	"cp/pkg/blobs"
+	"cp/pkg/dbtest"
+	"cp/pkg/events"
+	"cp/pkg/importer"
+	"cp/pkg/ledger"
+	"cp/pkg/maintenance"
+	"cp/pkg/messages"
+	"cp/pkg/posts"
+	"cp/pkg/snapshots"
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyTest is a group with enough history for several snapshots
+type historyTest struct {
+	db      *gorm.DB
+	h       *Handler
+	groupID string
+	users   []*api.User
+	posts   []*api.Post
+	start   time.Time
+}
+
+func newHistoryTest(t *testing.T) *historyTest {
+	t.Helper()
+	db := dbtest.Open(t)
+	test := &historyTest{
+		db: db,
+		h: &Handler{
+			postStore:            posts.NewPostStore(db),
+			ledgerStore:          ledger.NewLedgerStore(db),
+			acknowledgementStore: acknowledgements.NewAcknowledgementStore(db),
+			messageStore:         messages.NewMessageStore(db, events.Discard),
+			snapshotStore:        snapshots.NewSnapshotStore(db),
+			db:                   db,
+		},
+		groupID: uuid.NewV4().String(),
+		start:   time.Now().Add(-60 * 24 * time.Hour).Truncate(time.Second),
+	}
+
+	test.create(t, &api.Group{ID: test.groupID, Name: "History", CreatedAt: test.start})
+	for i := 0; i < 4; i++ {
+		user := &api.User{
+			ID:        uuid.NewV4().String(),
+			Username:  fmt.Sprintf("user%d", i),
+			Email:     fmt.Sprintf("user%d@example.com", i),
+			CreatedAt: test.start,
+		}
+		test.create(t, user)
+		test.create(t, &api.Membership{
+			GroupID:         test.groupID,
+			UserID:          user.ID,
+			Permission:      api.Member,
+			MemberConfirmed: true,
+			GroupConfirmed:  true,
+			CreatedAt:       test.start,
+		})
+		test.users = append(test.users, user)
+	}
+
+	// one entry every hour, some of them sharing their time with the
+	// previous one, so that snapshots cannot be taken at every row
+	random := rand.New(rand.NewSource(1))
+	at := test.start
+	for i := 0; i < 250; i++ {
+		if i%7 != 0 {
+			at = at.Add(time.Hour)
+		}
+		from := test.users[random.Intn(len(test.users))]
+		to := test.users[random.Intn(len(test.users))]
+		switch i % 4 {
+		case 0:
+			test.addPost(t, from, api.OfferPost, at)
+		case 1:
+			test.addPost(t, from, api.RequestPost, at)
+		case 2:
+			test.addTransfer(t, from, to, time.Duration(1+random.Intn(4))*time.Hour, at)
+		case 3:
+			test.create(t, &api.Acknowledgement{
+				ID:        uuid.NewV4().String(),
+				GroupID:   test.groupID,
+				SentBy:    userTarget(from),
+				SentTo:    userTarget(to),
+				Type:      api.ThanksServiceGift,
+				CreatedAt: at,
+			})
+		}
+	}
+	return test
+}
+
+func (test *historyTest) create(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := test.db.Create(value).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (test *historyTest) addPost(t *testing.T, author *api.User, postType api.PostType, at time.Time) *api.Post {
+	t.Helper()
+	value := time.Hour
+	post := &api.Post{
+		ID:        uuid.NewV4().String(),
+		GroupID:   test.groupID,
+		AuthorID:  author.ID,
+		Title:     fmt.Sprintf("%s %d", postType, len(test.posts)),
+		Type:      postType,
+		ValueFrom: &value,
+		ValueTo:   &value,
+	}
+	post.CreatedAt = at
+	if err := test.h.postStore.Create(post); err != nil {
+		t.Fatal(err)
+	}
+	test.posts = append(test.posts, post)
+	return post
+}
+
+func (test *historyTest) addTransfer(t *testing.T, from, to *api.User, amount time.Duration, at time.Time) {
+	t.Helper()
+	if err := test.db.Transaction(func(tx *gorm.DB) error {
+		return ledger.ImportWithin(tx, &api.JournalEntry{
+			GroupID:   test.groupID,
+			Notes:     "transfer",
+			CreatedAt: at,
+		}, userTarget(from), userTarget(to), amount)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func userTarget(user *api.User) *api.Target {
+	userID := user.ID
+	return &api.Target{UserID: &userID, Type: api.UserTarget}
+}
+
+// historyRange is a range of the history, as selected by the from and to
+// dates and by the cursor of the pages
+type historyRange struct {
+	name         string
+	from, before time.Time
+}
+
+func (test *historyTest) ranges() []historyRange {
+	return []historyRange{
+		{name: "all"},
+		{name: "from", from: test.start.Add(150 * time.Hour)},
+		{name: "before", before: test.start.Add(180 * time.Hour)},
+		{name: "between", from: test.start.Add(40 * time.Hour), before: test.start.Add(200 * time.Hour)},
+	}
+}
+
+func (test *historyTest) queries() []GroupHistoryQuery {
+	return []GroupHistoryQuery{
+		{ShowGroup: true},
+		{Users: []string{test.users[0].ID}},
+		{Users: []string{test.users[1].ID, test.users[2].ID}},
+		{ShowGroup: true, Users: []string{test.users[3].ID}},
+	}
+}
+
+// check takes the missing snapshots, and makes sure the history computed
+// from them is the history computed from the first entry
+func (test *historyTest) check(t *testing.T) {
+	t.Helper()
+	if err := test.compare(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (test *historyTest) compare() error {
+	h := test.h
+	snapshots, _, err := h.updateHistorySnapshots(test.groupID)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) < 2 {
+		return fmt.Errorf("got %d snapshots, the test needs more of them", len(snapshots))
+	}
+
+	for _, r := range test.ranges() {
+		rows, err := h.getGroupHistoryRows(test.groupID, snapshots, firstHistorySnapshot(snapshots, r.from), r.from, r.before)
+		if err != nil {
+			return err
+		}
+		recomputed, err := h.getGroupHistoryRows(test.groupID, nil, -1, r.from, r.before)
+		if err != nil {
+			return err
+		}
+		if err := compareRows(rows, recomputed); err != nil {
+			return fmt.Errorf("rows %s: %w", r.name, err)
+		}
+
+		for i, query := range test.queries() {
+			for _, limit := range []int{1, 10, 1000} {
+				page, next, err := h.getGroupHistoryPage(test.groupID, snapshots, query, r.from, r.before, limit)
+				if err != nil {
+					return err
+				}
+				recomputedPage, recomputedNext, err := h.getGroupHistoryPage(test.groupID, nil, query, r.from, r.before, limit)
+				if err != nil {
+					return err
+				}
+				if err := compareRows(page, recomputedPage); err != nil {
+					return fmt.Errorf("page %s, query %d, limit %d: %w", r.name, i, limit, err)
+				}
+				if (next == nil) != (recomputedNext == nil) || next != nil && !next.Equal(*recomputedNext) {
+					return fmt.Errorf("page %s, query %d, limit %d: next page at %v, want %v", r.name, i, limit, next, recomputedNext)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// compareRows compares the rows as shown, whatever the order of their users
+func compareRows(got, want []*Row) error {
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if a, b := describeRow(got[i]), describeRow(want[i]); a != b {
+			return fmt.Errorf("row %d is\n%s\nwant\n%s", i, a, b)
+		}
+	}
+	return nil
+}
+
+func describeRow(row *Row) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s %+v", row.Time.UnixNano(), row.Description, *row.GroupRow)
+	userRows := map[string]*UserRow{}
+	var userIDs []string
+	for _, userRow := range row.UserRows {
+		userRows[userRow.UserID] = userRow
+		userIDs = append(userIDs, userRow.UserID)
+	}
+	sort.Strings(userIDs)
+	for _, userID := range userIDs {
+		fmt.Fprintf(&b, " %+v", *userRows[userID])
+	}
+	return b.String()
+}
+
+func TestGroupHistorySnapshots(t *testing.T) {
+	t.Parallel()
+	test := newHistoryTest(t)
+	test.check(t)
+
+	// the snapshots are reused once taken
+	snapshots, err := test.h.snapshotStore.GetForGroup(test.groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.check(t)
+	again, err := test.h.snapshotStore.GetForGroup(test.groupID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(snapshots) || again[0].ID != snapshots[0].ID {
+		t.Fatalf("the snapshots were taken again")
+	}
+
+	// new entries are added after the latest snapshot
+	test.addPost(t, test.users[0], api.RequestPost, time.Now().Add(-time.Minute))
+	test.addTransfer(t, test.users[1], test.users[2], time.Hour, time.Now().Add(-time.Minute))
+	test.check(t)
+}
+
+// TestGroupHistoryStaleSnapshots makes sure the comparison notices the
+// snapshots counting entries changed after they were taken
+func TestGroupHistoryStaleSnapshots(t *testing.T) {
+	t.Parallel()
+	test := newHistoryTest(t)
+	test.check(t)
+
+	post := test.posts[0]
+	post.Type = api.RequestPost
+	if err := test.h.postStore.Update(post); err != nil {
+		t.Fatal(err)
+	}
+	if test.compare() == nil {
+		t.Fatal("the history computed from stale snapshots should differ")
+	}
+}
+
+func TestGroupHistoryInvalidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, test *historyTest)
+	}{
+		{
+			name: "edit post",
+			change: func(t *testing.T, test *historyTest) {
+				post := test.posts[2]
+				post.Type = api.OfferPost
+				if post.Type == test.posts[2].Type {
+					post.Type = api.RequestPost
+				}
+				if err := test.h.updatePost(post); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "edit post into comment",
+			change: func(t *testing.T, test *historyTest) {
+				post := test.posts[len(test.posts)/2]
+				post.Type = api.CommentPost
+				post.Description = "comment"
+				if err := test.h.updatePost(post); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "delete post",
+			change: func(t *testing.T, test *historyTest) {
+				if err := test.h.deletePost(test.posts[5]); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "purge deleted posts",
+			change: func(t *testing.T, test *historyTest) {
+				for _, post := range []*api.Post{test.posts[1], test.posts[len(test.posts)-3]} {
+					if err := test.h.deletePost(post); err != nil {
+						t.Fatal(err)
+					}
+				}
+				test.check(t)
+				if _, err := maintenance.PurgeDeletedPosts(test.db, blobs.NewMemoryStore(), time.Now().Add(time.Second)); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "import posts",
+			change: func(t *testing.T, test *historyTest) {
+				test.importCSV(t, importer.Posts, "author_email,type,title,value_from,value_to,created_at\n"+
+					fmt.Sprintf("%s,offer,imported offer,1h,2h,%s\n", test.users[0].Email, test.start.Add(3*time.Hour+time.Minute).UTC().Format(time.RFC3339))+
+					fmt.Sprintf("%s,request,imported request,1h,2h,%s\n", test.users[1].Email, test.start.Add(150*time.Hour).UTC().Format(time.RFC3339)))
+			},
+		},
+		{
+			name: "import credits",
+			change: func(t *testing.T, test *historyTest) {
+				test.importCSV(t, importer.Credits, "amount,from_email,to_email,created_at\n"+
+					fmt.Sprintf("3h,%s,%s,%s\n", test.users[2].Email, test.users[3].Email, test.start.Add(10*time.Hour+time.Minute).UTC().Format(time.RFC3339))+
+					fmt.Sprintf("2h,,%s,%s\n", test.users[0].Email, test.start.Add(120*time.Hour).UTC().Format(time.RFC3339)))
+			},
+		},
+		{
+			name: "import acknowledgements",
+			change: func(t *testing.T, test *historyTest) {
+				test.importCSV(t, importer.Acknowledgements, "type,from_email,to_email,created_at\n"+
+					fmt.Sprintf("%s,%s,%s,%s\n", api.ThanksObjectGift, test.users[3].Email, test.users[0].Email, test.start.Add(20*time.Hour+time.Minute).UTC().Format(time.RFC3339)))
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			test := newHistoryTest(t)
+			test.check(t)
+			tt.change(t, test)
+			test.check(t)
+		})
+	}
+}
+
+func (test *historyTest) importCSV(t *testing.T, kind importer.Kind, content string) {
+	t.Helper()
+	report, err := importer.NewImporter(test.db).Import(test.groupID, kind, strings.NewReader(content), importer.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Committed() {
+		for _, result := range report.Results {
+			t.Log(result.Line, result.Action, result.Message)
+		}
+		t.Fatal("the import was not committed")
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"cp/pkg/importer"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type SubmitGroupImport struct {
+	Kind   importer.Kind `form:"kind"`
+	DryRun bool          `form:"dryRun"`
+}
+
+func (h *Handler) handleGroupImport(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SubmitGroupImport
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+	if !payload.Kind.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid import kind")
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "missing csv file")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Members cannot be imported with a higher permission than the one of
+	// the member importing them
+	report, err := importer.NewImporter(h.db).Import(group.ID, payload.Kind, src, importer.Options{
+		DryRun:        payload.DryRun,
+		MaxPermission: membership.GetRole().Permission,
+	})
+	if errors.Is(err, importer.ErrInvalidHeader) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "group_import", map[string]interface{}{
+		"Title":    "Import",
+		"Report":   report,
+		"FileName": file.Filename,
+	})
+}
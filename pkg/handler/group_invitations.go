@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"time"
+)
+
+type SubmitInvitation struct {
+	MaxUses   int    `form:"maxUses" json:"maxUses"`
+	ExpiresIn string `form:"expiresIn" json:"expiresIn"`
+}
+
+func (h *Handler) handleGroupInvitationCreate(c echo.Context) error {
+
+	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SubmitInvitation
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	invitation, err := h.createInvitation(authenticatedUserMembership, payload)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s://%s%s", c.Scheme(), c.Request().Host, invitation.Link())
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Successfully created invitation %s. Share this link: %s", invitation.Code, link),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, invitation.GroupID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+func (h *Handler) handleGroupInvitationRevoke(c echo.Context) error {
+
+	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
+	if err != nil {
+		return err
+	}
+
+	groupID := authenticatedUserMembership.GroupID
+	if err := h.invitationStore.Revoke(groupID, c.Param("InvitationID")); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: "Successfully revoked invitation",
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, groupID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// createInvitation creates an invitation to the group of the membership. An empty ExpiresIn creates an invitation that never expires
+func (h *Handler) createInvitation(authenticatedUserMembership *api.Membership, payload SubmitInvitation) (*api.Invitation, error) {
+
+	if payload.MaxUses < 0 {
+		return nil, echo.ErrBadRequest
+	}
+
+	var expiresAt *time.Time
+	if payload.ExpiresIn != "" {
+		expiresIn, err := time.ParseDuration(payload.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			return nil, echo.ErrBadRequest
+		}
+		t := time.Now().Add(expiresIn)
+		expiresAt = &t
+	}
+
+	return h.invitationStore.Create(
+		authenticatedUserMembership.GroupID,
+		authenticatedUserMembership.UserID,
+		payload.MaxUses,
+		expiresAt)
+}
@@ -2,7 +2,7 @@ package handler
 
 import (
 	"cp/pkg/api"
-	"cp/pkg/memberships"
+	"cp/pkg/policy"
 	"cp/pkg/utils"
 	"fmt"
 	"github.com/labstack/echo/v4"
@@ -31,24 +31,69 @@ func (h *Handler) handleGroupJoin(c echo.Context) error {
 		return err
 	}
 
-	// If user being invited is not the currently logged in user,
-	// make sure that the currently logged in user is an admin of
-	// the group
-	if authenticatedUser.ID != invitedUser.ID {
-		var ms []*api.Membership
-		requiredPermission := api.Admin
-		if err := h.membershipStore.Find(&ms, &memberships.GetMembershipsOptions{
-			HasPermission: &requiredPermission,
-			GroupID:       &group.ID,
-			UserID:        &authenticatedUser.ID,
-		}); err != nil {
-			return err
+	isNewMembership := membership == nil
+
+	membership, err = h.joinGroup(h.getSubject(c), invitedUser, group, membership)
+	if err != nil {
+		return err
+	}
+
+	var message string
+	if isNewMembership {
+		if invitedUser.ID != authenticatedUser.ID {
+			message = fmt.Sprintf(`Successfully invited user %s to group %s. Waiting for user confirmation...`, invitedUser.HTMLLink(), group.HTMLLink())
+		} else {
+			message = fmt.Sprintf("Successfully sent join request to group %s. Waiting for group confirmation...", group.HTMLLink())
 		}
-		if len(ms) == 0 {
-			return echo.ErrUnauthorized
+	} else {
+		if invitedUser.ID != authenticatedUser.ID {
+			message = fmt.Sprintf("Successfully accepted user %s into group %s!", invitedUser.HTMLLink(), group.HTMLLink())
+		} else {
+			message = fmt.Sprintf("Successfully joined group %s!", group.HTMLLink())
 		}
 	}
 
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: message,
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", c.Request().Header.Get("Referer"))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+
+}
+
+// joinGroup creates or confirms the membership of the invited user. When the
+// membership does not exist yet, it is created and waits for the confirmation
+// of the other side. When it exists, the side of the authenticated user is
+// confirmed. The permission and role of an active membership are left
+// unchanged, they are changed by setRole only.
+func (h *Handler) joinGroup(subject policy.Subject, invitedUser *api.User, group *api.Group, membership *api.Membership) (*api.Membership, error) {
+
+	ownerCount, err := h.countOwners(group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users can join by themselves, but only admins can add other users
+	action := policy.JoinGroup
+	if subject.User == nil || subject.User.ID != invitedUser.ID {
+		action = policy.AddMember
+	}
+	if err := policy.Can(subject, action, policy.Resource{
+		Group:      group,
+		User:       invitedUser,
+		Membership: membership,
+		OwnerCount: ownerCount,
+	}); err != nil {
+		return nil, err
+	}
+
+	authenticatedUser := subject.User
+
 	if membership == nil {
 
 		// membership does not exist. Create
@@ -61,59 +106,45 @@ func (h *Handler) handleGroupJoin(c echo.Context) error {
 		}
 
 		if err := h.membershipStore.Create(membership); err != nil {
-			return err
+			return nil, err
 		}
 
-		var message string
-		if invitedUser.ID != authenticatedUser.ID {
-			message = fmt.Sprintf(`Successfully invited user %s to group %s. Waiting for user confirmation...`, invitedUser.HTMLLink(), group.HTMLLink())
-		} else {
-			message = fmt.Sprintf("Successfully sent join request to group %s. Waiting for group confirmation...", group.HTMLLink())
+		// The user requested to join the group. Let the admins know
+		if invitedUser.ID == authenticatedUser.ID {
+			if err := h.notifyMembershipRequest(invitedUser, group); err != nil {
+				return nil, err
+			}
 		}
 
-		if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
-			Class:   "alert-success",
-			Message: message,
-		}); err != nil {
-			return err
-		}
+		return membership, nil
 
-		c.Response().Header().Set("Location", c.Request().Header.Get("Referer"))
-		c.Response().WriteHeader(http.StatusSeeOther)
-		return nil
+	}
 
-	} else {
+	// Membership already exists
+	if membership.IsActive() {
+		return membership, nil
+	}
 
-		// Membership already exists
-		if invitedUser.ID != authenticatedUser.ID {
-			membership.GroupConfirmed = true
-		} else {
-			membership.MemberConfirmed = true
-		}
+	isApproval := invitedUser.ID != authenticatedUser.ID && membership.IsPendingApproval()
+	if invitedUser.ID != authenticatedUser.ID {
+		membership.GroupConfirmed = true
+	} else {
+		membership.MemberConfirmed = true
+	}
+	if membership.IsActive() && membership.Permission == api.None {
 		membership.Permission = api.Member
+	}
 
-		if err := h.membershipStore.Update(membership); err != nil {
-			return err
-		}
-
-		var message string
-		if invitedUser.ID != authenticatedUser.ID {
-			message = fmt.Sprintf("Successfully accepted user %s into group %s!", invitedUser.HTMLLink(), group.HTMLLink())
-		} else {
-			message = fmt.Sprintf("Successfully joined group %s!", group.HTMLLink())
-		}
+	if err := h.membershipStore.Update(membership); err != nil {
+		return nil, err
+	}
 
-		if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
-			Class:   "alert-success",
-			Message: message,
-		}); err != nil {
-			return err
+	if isApproval {
+		if err := h.notifyMembershipDecision(invitedUser, group, true); err != nil {
+			return nil, err
 		}
-
-		c.Response().Header().Set("Location", c.Request().Header.Get("Referer"))
-		c.Response().WriteHeader(http.StatusSeeOther)
-		return nil
-
 	}
 
+	return membership, nil
+
 }
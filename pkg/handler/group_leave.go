@@ -2,7 +2,7 @@ package handler
 
 import (
 	"cp/pkg/api"
-	"cp/pkg/memberships"
+	"cp/pkg/policy"
 	"cp/pkg/utils"
 	"fmt"
 	"github.com/labstack/echo/v4"
@@ -36,25 +36,7 @@ func (h *Handler) handleGroupLeave(c echo.Context) error {
 		return err
 	}
 
-	// If user being invited is not the currently logged in user,
-	// make sure that the currently logged in user is an admin of
-	// the group
-	if authenticatedUser.ID != invitedUser.ID {
-		var ms []*api.Membership
-		requiredPermission := api.Admin
-		if err := h.membershipStore.Find(&ms, &memberships.GetMembershipsOptions{
-			HasPermission: &requiredPermission,
-			GroupID:       &group.ID,
-			UserID:        &authenticatedUser.ID,
-		}); err != nil {
-			return err
-		}
-		if len(ms) == 0 {
-			return echo.ErrUnauthorized
-		}
-	}
-
-	if err := h.membershipStore.Delete(membership); err != nil {
+	if err := h.leaveGroup(h.getSubject(c), invitedUser, group, membership); err != nil {
 		return err
 	}
 
@@ -77,3 +59,41 @@ func (h *Handler) handleGroupLeave(c echo.Context) error {
 	return nil
 
 }
+
+// leaveGroup deletes the membership of the given user. Users can leave a
+// group unless they are its last owner, and only admins can kick out other
+// users
+func (h *Handler) leaveGroup(subject policy.Subject, user *api.User, group *api.Group, membership *api.Membership) error {
+
+	ownerCount, err := h.countOwners(group.ID)
+	if err != nil {
+		return err
+	}
+
+	action := policy.LeaveGroup
+	if subject.User == nil || subject.User.ID != user.ID {
+		action = policy.RemoveMember
+	}
+	if err := policy.Can(subject, action, policy.Resource{
+		Group:      group,
+		User:       user,
+		Membership: membership,
+		OwnerCount: ownerCount,
+	}); err != nil {
+		return err
+	}
+
+	authenticatedUser := subject.User
+
+	if err := h.membershipStore.Delete(membership); err != nil {
+		return err
+	}
+
+	// An admin denied the request of the user to join the group
+	if authenticatedUser.ID != user.ID && membership.IsPendingApproval() {
+		return h.notifyMembershipDecision(user, group, false)
+	}
+
+	return nil
+
+}
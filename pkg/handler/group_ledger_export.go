@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/export"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type GroupLedgerExportQuery struct {
+	From   string        `query:"from"`
+	To     string        `query:"to"`
+	Format export.Format `query:"format"`
+}
+
+type LedgerExportEntry struct {
+	ID           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	Description  string    `json:"description"`
+	From         string    `json:"from"`
+	To           string    `json:"to"`
+	Amount       string    `json:"amount"`
+	PostID       *string   `json:"postId"`
+	Notes        string    `json:"notes"`
+	ReversalOfID *string   `json:"reversalOfId"`
+}
+
+func (h *Handler) handleGetGroupLedgerExport(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var query GroupLedgerExportQuery
+	if err := c.Bind(&query); err != nil {
+		return err
+	}
+	if !query.Format.IsValid() {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid format")
+	}
+
+	from, before, err := parseHistoryRange(GroupHistoryQuery{From: query.From, To: query.To})
+	if err != nil {
+		return err
+	}
+	// the range includes the entries created at from
+	if !from.IsZero() {
+		from = from.Add(-time.Nanosecond)
+	}
+
+	entries, err := h.ledgerStore.GetEntriesForGroupBetween(group.ID, from, before)
+	if err != nil {
+		return err
+	}
+
+	var exportEntries = []*LedgerExportEntry{}
+	for _, entry := range entries {
+		row := NewRow()
+		row.processJournalEntry(entry)
+		exportEntries = append(exportEntries, &LedgerExportEntry{
+			ID:           entry.ID,
+			Time:         entry.CreatedAt,
+			Description:  export.Text(row.Description),
+			From:         postingOwners(entry.Debits()),
+			To:           postingOwners(entry.Credits()),
+			Amount:       export.Duration(entry.Amount()),
+			PostID:       entry.PostID,
+			Notes:        entry.Notes,
+			ReversalOfID: entry.ReversalOfID,
+		})
+	}
+
+	filename := fmt.Sprintf("ledger-%s.%s", group.ID, query.Format)
+	if query.Format == export.JSON {
+		return writeExport(c, query.Format, filename, nil, exportEntries)
+	}
+
+	table := &export.Table{
+		Name:    "Ledger",
+		Columns: []string{"ID", "Time", "Description", "From", "To", "Amount", "Post", "Notes", "Reversal of"},
+	}
+	for i, entry := range exportEntries {
+		var postTitle, reversalOfID string
+		if entries[i].Post != nil {
+			postTitle = entries[i].Post.Title
+		}
+		if entry.ReversalOfID != nil {
+			reversalOfID = *entry.ReversalOfID
+		}
+		table.AddRow(entry.ID, entry.Time, entry.Description, entry.From, entry.To, entries[i].Amount(), postTitle, entry.Notes, reversalOfID)
+	}
+	return writeExport(c, query.Format, filename, table, nil)
+}
+
+// postingOwners returns the plain text names of the owners of the accounts
+// of the postings
+func postingOwners(postings []*api.Posting) string {
+	var owners []string
+	for _, posting := range postings {
+		owners = append(owners, export.Text(posting.Account.Owner.HTMLLink()))
+	}
+	return strings.Join(owners, ", ")
+}
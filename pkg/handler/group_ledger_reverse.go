@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/ledger"
+	"cp/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// handleGroupLedgerReverse cancels a transfer of the group with a reversal
+// entry, so that the credits sent by mistake can be corrected without
+// changing the history
+func (h *Handler) handleGroupLedgerReverse(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	alert := utils.Alert{
+		Class:   "alert-success",
+		Message: "The transfer was reversed",
+	}
+	if _, err := h.reverseEntry(group, c.Param(JournalEntryIDKey), c.FormValue("notes")); err != nil {
+		if !errors.Is(err, ledger.ErrAlreadyReversed) && !errors.Is(err, ledger.ErrIsReversal) {
+			return err
+		}
+		alert = utils.Alert{
+			Class:   "alert-danger",
+			Message: fmt.Sprintf("The transfer cannot be reversed: %s", err.Error()),
+		}
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, alert); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/history", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// reverseEntry reverses a journal entry of the group, and notifies the users
+// whose balance changes
+func (h *Handler) reverseEntry(group *api.Group, entryID string, notes string) (*api.JournalEntry, error) {
+
+	entry, err := h.ledgerStore.GetEntry(entryID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.GroupID != group.ID {
+		return nil, echo.ErrNotFound
+	}
+
+	reversal, err := h.ledgerStore.Reverse(entry.ID, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, posting := range entry.Postings {
+		if err := h.notifySent(group, posting.Account.Owner, api.CreditsNotification, "Credits reversed",
+			fmt.Sprintf("A transfer of %s credits was reversed in group %s", entry.Amount().String(), group.HTMLLink()),
+			group.HTMLLink()); err != nil {
+			return nil, err
+		}
+	}
+
+	return reversal, nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/events"
+	"cp/pkg/ledger"
+	"cp/pkg/notifications"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestReverseEntry(t *testing.T) {
+	db := dbtest.Open(t)
+	ledgerStore := ledger.NewLedgerStore(db)
+	notificationStore := notifications.NewNotificationStore(db, events.Discard, notifications.DiscardQueue)
+	h := &Handler{ledgerStore: ledgerStore, notificationStore: notificationStore}
+
+	group := &api.Group{ID: uuid.NewV4().String(), Name: "Group"}
+	otherGroup := &api.Group{ID: uuid.NewV4().String(), Name: "Other"}
+	for _, value := range []interface{}{group, otherGroup} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var users []*api.User
+	for _, name := range []string{"alice", "bob"} {
+		user := &api.User{ID: uuid.NewV4().String(), Username: name, Email: name + "@example.com"}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	alice, bob := userTarget(users[0]), userTarget(users[1])
+
+	entry, err := ledgerStore.Transfer(group.ID, alice, bob, 2*time.Hour, "sent by mistake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := func(owner *api.Target) time.Duration {
+		balance, err := ledgerStore.GetBalance(group.ID, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return balance
+	}
+
+	// The entries of the other groups cannot be reversed from the group
+	if _, err := h.reverseEntry(otherGroup, entry.ID, ""); !errors.Is(err, echo.ErrNotFound) {
+		t.Fatalf("reverse from another group: %v, expected not found", err)
+	}
+
+	reversal, err := h.reverseEntry(group, entry.ID, "wrong member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversal.ReversalOfID == nil || *reversal.ReversalOfID != entry.ID {
+		t.Fatalf("the reversal does not reference %s", entry.ID)
+	}
+	if balance(alice) != 0 || balance(bob) != 0 {
+		t.Fatalf("balances are %s and %s, expected 0", balance(alice), balance(bob))
+	}
+	for _, user := range users {
+		count, err := notificationStore.GetUnreadCount(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Fatalf("%s has %d notifications, expected the reversal", user.Username, count)
+		}
+	}
+
+	if _, err := h.reverseEntry(group, entry.ID, ""); !errors.Is(err, ledger.ErrAlreadyReversed) {
+		t.Fatalf("reverse again: %v, expected already reversed", err)
+	}
+
+	// Reversing the reversal would send the credits again
+	if _, err := h.reverseEntry(group, reversal.ID, ""); !errors.Is(err, ledger.ErrIsReversal) {
+		t.Fatalf("reverse the reversal: %v, expected it to be refused", err)
+	}
+	if balance(alice) != 0 || balance(bob) != 0 {
+		t.Fatalf("balances are %s and %s, expected 0", balance(alice), balance(bob))
+	}
+	if apiError := newAPIError(ledger.ErrIsReversal); apiError.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("the API answers %d, expected 422", apiError.Code)
+	}
+
+	// The history does not offer to reverse the entry again
+	rows := []*Row{{JournalEntryID: entry.ID}, {Description: "post"}}
+	if err := h.hideReversedEntries(rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows[0].JournalEntryID != "" {
+		t.Fatal("the reversed entry can be reversed again")
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/memberships"
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+)
+
+func (h *Handler) handleGroupMembershipApprove(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	if !membership.IsPendingApproval() {
+		return echo.ErrBadRequest
+	}
+
+	if _, err := h.joinGroup(h.getSubject(c), user, group, membership); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Successfully accepted user %s into group %s!", user.HTMLLink(), group.HTMLLink()),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+func (h *Handler) handleGroupMembershipReject(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	if !membership.IsPendingApproval() {
+		return echo.ErrBadRequest
+	}
+
+	if err := h.leaveGroup(h.getSubject(c), user, group, membership); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Successfully rejected the request of user %s to join group %s", user.HTMLLink(), group.HTMLLink()),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// getPendingMemberships returns the memberships waiting for the approval of
+// the group admins
+func (h *Handler) getPendingMemberships(groupID string) ([]*api.Membership, error) {
+	var result []*api.Membership
+	groupConfirmed := false
+	memberConfirmed := true
+	if err := h.membershipStore.Find(&result, &memberships.GetMembershipsOptions{
+		GroupID:         &groupID,
+		GroupConfirmed:  &groupConfirmed,
+		MemberConfirmed: &memberConfirmed,
+		Preload:         []string{"User"},
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// notifyMembershipRequest notifies every member of the group that can
+// manage members that the user requested to join
+func (h *Handler) notifyMembershipRequest(user *api.User, group *api.Group) error {
+
+	var groupMemberships []*api.Membership
+	if err := h.membershipStore.Find(&groupMemberships, &memberships.GetMembershipsOptions{
+		GroupID: &group.ID,
+	}); err != nil {
+		return err
+	}
+
+	var notifications []*api.Notification
+	for _, admin := range groupMemberships {
+		if !admin.HasCapability(api.ManageMembersCapability) {
+			continue
+		}
+		notifications = append(notifications, &api.Notification{
+			ID:      uuid.NewV4().String(),
+			UserID:  admin.UserID,
+			Type:    api.MembershipNotification,
+			GroupID: &group.ID,
+			Title:   fmt.Sprintf("Group %s - New membership request", group.HTMLLink()),
+			Message: fmt.Sprintf("%s requested to join group %s", user.HTMLLink(), group.HTMLLink()),
+			Link:    fmt.Sprintf(`<a href="/groups/%s/settings">Membership requests</a>`, group.ID),
+		})
+	}
+
+	return h.notificationStore.AddNotifications(notifications)
+}
+
+// notifyMembershipDecision notifies the user that an admin approved or
+// rejected the request to join the group
+func (h *Handler) notifyMembershipDecision(user *api.User, group *api.Group, approved bool) error {
+
+	notification := &api.Notification{
+		ID:      uuid.NewV4().String(),
+		UserID:  user.ID,
+		Type:    api.MembershipNotification,
+		GroupID: &group.ID,
+		Link:    group.HTMLLink(),
+	}
+	if approved {
+		notification.Title = fmt.Sprintf("Group %s - Membership request approved", group.HTMLLink())
+		notification.Message = fmt.Sprintf("Your request to join group %s was approved. Welcome!", group.HTMLLink())
+	} else {
+		notification.Title = fmt.Sprintf("Group %s - Membership request rejected", group.HTMLLink())
+		notification.Message = fmt.Sprintf("Your request to join group %s was rejected", group.HTMLLink())
+	}
+
+	return h.notificationStore.AddNotification(notification)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// handleGroupRestore restores a deleted group which was not purged yet. The
+// purge job of the deletion finds the group restored, and keeps it
+func (h *Handler) handleGroupRestore(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.groupStore.SetDeleted(group.ID, nil); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Group %s was restored", group.HTMLLink()),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/policy"
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"html"
+	"net/http"
+	"strings"
+)
+
+type SetRole struct {
+	RoleID string `form:"roleId" json:"roleId"`
+}
+
+type CreateRole struct {
+	Name         string                   `form:"name" json:"name"`
+	Permission   api.MembershipPermission `form:"permission" json:"permission"`
+	Capabilities []api.Capability         `form:"capabilities" json:"capabilities"`
+}
+
+func (h *Handler) handleGroupSetRole(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	membership, err := h.getMembership(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SetRole
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	role, err := h.roleStore.Get(membership.GroupID, payload.RoleID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.setRole(h.getSubject(c), membership, role); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Successfully assigned role <b>%s</b> to user %s", html.EscapeString(role.Name), user.HTMLLink()),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", c.Request().Header.Get("Referer"))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+func (h *Handler) handleGroupRoleCreate(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload CreateRole
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	role, err := h.createRole(h.getSubject(c), group, payload)
+	if err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Successfully created role <b>%s</b>", html.EscapeString(role.Name)),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+func (h *Handler) handleGroupRoleDelete(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.roleStore.Delete(group.ID, c.Param("RoleID")); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: "Successfully deleted role",
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// createRole creates a custom role in the group. Custom roles are based on
+// the member or admin permission, and the subject can only give them
+// capabilities it has itself
+func (h *Handler) createRole(subject policy.Subject, group *api.Group, payload CreateRole) (*api.Role, error) {
+
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "role name is required")
+	}
+
+	if payload.Permission != api.Member && payload.Permission != api.Admin {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "roles must be based on the member or admin permission")
+	}
+
+	capabilities := api.Capabilities{}
+	for _, capability := range payload.Capabilities {
+		if !capability.IsValid() {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown capability %s", capability))
+		}
+		if !capabilities.Has(capability) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+
+	existing, err := h.roleStore.GetForGroup(group.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range existing {
+		if strings.EqualFold(role.Name, name) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "a role with this name already exists")
+		}
+	}
+
+	role := &api.Role{
+		ID:           uuid.NewV4().String(),
+		GroupID:      group.ID,
+		Name:         name,
+		Permission:   payload.Permission,
+		Capabilities: capabilities,
+	}
+
+	if err := policy.Can(subject, policy.ManageRoles, policy.Resource{
+		Group: group,
+		Role:  role,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := h.roleStore.Create(role); err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
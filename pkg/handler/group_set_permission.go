@@ -2,6 +2,7 @@ package handler
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/policy"
 	"cp/pkg/utils"
 	"fmt"
 	"github.com/labstack/echo/v4"
@@ -9,7 +10,7 @@ import (
 )
 
 type SetPermission struct {
-	Permission api.MembershipPermission `form:"permission"`
+	Permission api.MembershipPermission `form:"permission" json:"permission"`
 }
 
 func (h *Handler) handleGroupSetPermission(c echo.Context) error {
@@ -24,40 +25,12 @@ func (h *Handler) handleGroupSetPermission(c echo.Context) error {
 		return err
 	}
 
-	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
-	if err != nil {
-		return err
-	}
-
-	// Make sure the authenticated user is an admin
-	if !authenticatedUserMembership.IsActive() || !authenticatedUserMembership.IsAdmin() {
-		return echo.ErrForbidden
-	}
-
-	// Make sure the authenticated user has greater permissions
-	// than the changed user permission
-	if !authenticatedUserMembership.Permission.Gte(membership.Permission) {
-		return echo.ErrForbidden
-	}
-
 	var payload SetPermission
 	if err := c.Bind(&payload); err != nil {
 		return err
 	}
 
-	// make sure the new permissions are lesser or equal than the
-	// authenticated user permission
-	if !authenticatedUserMembership.Permission.Gte(payload.Permission) {
-		return echo.ErrForbidden
-	}
-
-	// Make sure it's a valid permission
-	if payload.Permission != api.Owner && payload.Permission != api.Admin && payload.Permission != api.Member {
-		return echo.ErrBadRequest
-	}
-
-	membership.Permission = payload.Permission
-	if err := h.membershipStore.Update(membership); err != nil {
+	if err := h.setPermission(h.getSubject(c), membership, payload.Permission); err != nil {
 		return err
 	}
 
@@ -74,3 +47,45 @@ func (h *Handler) handleGroupSetPermission(c echo.Context) error {
 	return nil
 
 }
+
+// setPermission assigns the built-in role of the permission to the
+// membership
+func (h *Handler) setPermission(subject policy.Subject, membership *api.Membership, permission api.MembershipPermission) error {
+	role := api.GetBuiltInRole(permission)
+	if role == nil {
+		return echo.ErrBadRequest
+	}
+	return h.setRole(subject, membership, role)
+}
+
+// setRole assigns the role to the membership. Members can only assign
+// roles ranking up to their own, with capabilities they have, and the last
+// owner of a group cannot give up ownership
+func (h *Handler) setRole(subject policy.Subject, membership *api.Membership, role *api.Role) error {
+
+	ownerCount, err := h.countOwners(membership.GroupID)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.Can(subject, policy.AssignRole, policy.Resource{
+		Group:      membership.Group,
+		User:       membership.User,
+		Membership: membership,
+		Role:       role,
+		OwnerCount: ownerCount,
+	}); err != nil {
+		return err
+	}
+
+	membership.Permission = role.Permission
+	if role.IsBuiltIn() {
+		membership.RoleID = nil
+		membership.Role = nil
+	} else {
+		membership.RoleID = &role.ID
+		membership.Role = role
+	}
+	return h.membershipStore.Update(membership)
+
+}
@@ -2,72 +2,136 @@ package handler
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/groups"
+	"cp/pkg/importer"
+	"cp/pkg/jobs"
+	"cp/pkg/policy"
+	"cp/pkg/utils"
+	"fmt"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"html"
 	"net/http"
-	"strings"
+	"time"
 )
 
-func (h *Handler) handleGroupSettings(c echo.Context) error {
-	return c.Render(http.StatusOK, "group_settings", map[string]interface{}{
-		"Title": "Hello",
-	})
+type SubmitGroupSettings struct {
+	MemberOverdraftLimit string `form:"memberOverdraftLimit"`
+	GroupOverdraftLimit  string `form:"groupOverdraftLimit"`
 }
 
-func (h *Handler) handleGroupDelete(c echo.Context) error {
+func (h *Handler) handleGroupSettings(c echo.Context) error {
 
 	authenticatedUserMembership, err := h.getAuthenticatedUserMembership(c)
 	if err != nil {
 		return err
 	}
 
-	if !authenticatedUserMembership.IsOwner() {
-		return echo.ErrForbidden
+	if c.Request().Method == http.MethodGet {
+		var groupInvitations []*api.Invitation
+		var pendingMemberships []*api.Membership
+		if policy.Can(h.getSubject(c), policy.ManageInvitations, policy.Resource{}) == nil {
+			groupInvitations, err = h.invitationStore.GetForGroup(authenticatedUserMembership.GroupID)
+			if err != nil {
+				return err
+			}
+			pendingMemberships, err = h.getPendingMemberships(authenticatedUserMembership.GroupID)
+			if err != nil {
+				return err
+			}
+		}
+		var groupRoles []*api.Role
+		if authenticatedUserMembership.HasCapability(api.ManageRolesCapability) {
+			groupRoles, err = h.roleStore.GetForGroup(authenticatedUserMembership.GroupID)
+			if err != nil {
+				return err
+			}
+		}
+		return c.Render(http.StatusOK, "group_settings", map[string]interface{}{
+			"Title":              "Hello",
+			"Invitations":        groupInvitations,
+			"PendingMemberships": pendingMemberships,
+			"Roles":              groupRoles,
+			"Capabilities":       api.AllCapabilities,
+			"ImportKinds":        importer.AllKinds,
+			"GracePeriodDays":    int(api.GroupDeletionGracePeriod.Hours() / 24),
+		})
 	}
 
-	var groupID = authenticatedUserMembership.GroupID
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
 
-	if err := h.db.Where("group_id = ?", groupID).Delete(&api.Acknowledgement{}).Error; err != nil {
+	var payload SubmitGroupSettings
+	if err := c.Bind(&payload); err != nil {
 		return err
 	}
-	if err := h.db.Where("group_id = ?", groupID).Delete(&api.Credits{}).Error; err != nil {
+
+	memberOverdraftLimit, err := time.ParseDuration(payload.MemberOverdraftLimit)
+	if err != nil || memberOverdraftLimit < 0 {
+		return echo.ErrBadRequest
+	}
+	groupOverdraftLimit, err := time.ParseDuration(payload.GroupOverdraftLimit)
+	if err != nil || groupOverdraftLimit < 0 {
+		return echo.ErrBadRequest
+	}
+
+	group.MemberOverdraftLimit = memberOverdraftLimit
+	group.GroupOverdraftLimit = groupOverdraftLimit
+	if err := h.groupStore.Update(group); err != nil {
 		return err
 	}
-	if err := h.db.Where("group_id = ?", groupID).Delete(&api.Membership{}).Error; err != nil {
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: "Successfully updated group settings",
+	}); err != nil {
 		return err
 	}
 
-	var posts []*api.Post
-	if err := h.db.Unscoped().Model(&api.Post{}).Find(&posts, "group_id = ?", groupID).Error; err != nil {
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/settings", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// handleGroupDelete deletes the group until it is purged by a job, at the
+// end of the grace period. Its owners can restore it meanwhile
+func (h *Handler) handleGroupDelete(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
 		return err
 	}
 
-	if len(posts) > 0 {
-		var sb strings.Builder
-		sb.WriteString("thread_id in (")
-		var params []interface{}
-		for i, post := range posts {
-			sb.WriteString("?")
-			params = append(params, post.ID)
-			if i < len(posts)-1 {
-				sb.WriteString(",")
-			}
-		}
-		sb.WriteString(")")
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
 
-		if err := h.db.Where(sb.String()).Delete(&api.Message{}).Error; err != nil {
+	now := time.Now()
+	group.DeletedAt = &now
+	purge, err := jobs.NewJob(purgeGroupJob, &purgeGroupPayload{GroupID: group.ID}, group.PurgeAt())
+	if err != nil {
+		return err
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := groups.NewGroupStore(tx).SetDeleted(group.ID, &now); err != nil {
 			return err
 		}
-	}
-
-	if err := h.db.Unscoped().Where("group_id = ?", groupID).Delete(&api.Post{}).Error; err != nil {
+		return jobs.NewJobStore(tx).Create(purge)
+	}); err != nil {
 		return err
 	}
 
-	if err := h.db.Where("id = ?", groupID).Delete(&api.Group{}).Error; err != nil {
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Group %s was deleted. It can be restored until %s", html.EscapeString(group.Name), group.PurgeAt().Format("Jan 02, 2006")),
+	}); err != nil {
 		return err
 	}
 
-	c.Response().Header().Set("Location", "/")
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/users/%s/groups", c.Scheme(), c.Request().Host, authenticatedUser.ID))
 	c.Response().WriteHeader(http.StatusSeeOther)
 	return nil
 }
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/pagination"
 	posts2 "cp/pkg/posts"
+	"cp/pkg/search"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
@@ -31,18 +33,50 @@ func (h *Handler) handleGroupPostsView(c echo.Context) error {
 		payload.Query = nil
 	}
 
-	posts, err := h.postStore.GetByGroup(group.ID, &posts2.FindPostsOptions{
-		Query: payload.Query,
-		Type:  payload.Type,
-	})
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	posts, next, err := h.getGroupPosts(group, payload, page)
 	if err != nil {
 		return err
 	}
 
 	return c.Render(http.StatusOK, "group", map[string]interface{}{
-		"Title": "Hello",
-		"Posts": posts,
-		"Query": payload.Query,
-		"Type":  payload.Type,
+		"Title":    "Hello",
+		"Posts":    posts,
+		"Query":    payload.Query,
+		"Type":     payload.Type,
+		"NextLink": h.nextPageLink(c, next),
+	})
+}
+
+// getGroupPosts returns the posts of the group, ranked by relevance when
+// there is a search query, or by recency otherwise. Only the listing by
+// recency is paginated, search results are limited by the engine
+func (h *Handler) getGroupPosts(group *api.Group, payload Query, page *pagination.Page) ([]*api.Post, *pagination.Cursor, error) {
+	if payload.Query == nil {
+		return h.postStore.GetByGroup(group.ID, &posts2.FindPostsOptions{
+			Type: payload.Type,
+			Page: page,
+		})
+	}
+
+	results, err := h.searchEngine.Search(&search.Query{
+		Text:     *payload.Query,
+		GroupIDs: []string{group.ID},
+		Kinds:    []search.Kind{search.PostKind},
+		PostType: payload.Type,
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var postIDs []string
+	for _, result := range results {
+		postIDs = append(postIDs, result.PostID)
+	}
+	posts, err := h.postStore.GetByKeys(postIDs)
+	return posts, nil, err
 }
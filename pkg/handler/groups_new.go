@@ -9,7 +9,7 @@ import (
 )
 
 type CreateGroup struct {
-	Name string `form:"name"`
+	Name string `form:"name" json:"name"`
 }
 
 func (h *Handler) handleNewGroup(c echo.Context) error {
@@ -30,27 +30,44 @@ func (h *Handler) handleNewGroup(c echo.Context) error {
 		return err
 	}
 
+	group, err := h.createGroup(profile, payload.Name)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s", c.Scheme(), c.Request().Host, group.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+
+}
+
+// createGroup creates a new group owned by the given user
+func (h *Handler) createGroup(owner *api.User, name string) (*api.Group, error) {
+
+	if name == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "group name is required")
+	}
+
 	group := &api.Group{
-		ID:   uuid.NewV4().String(),
-		Name: payload.Name,
+		ID:                   uuid.NewV4().String(),
+		Name:                 name,
+		MemberOverdraftLimit: api.DefaultMemberOverdraftLimit,
+		GroupOverdraftLimit:  api.DefaultGroupOverdraftLimit,
 	}
 	if err := h.groupStore.Create(group); err != nil {
-		return err
+		return nil, err
 	}
 
 	membership := &api.Membership{
-		GroupID:    group.ID,
-		UserID:     profile.ID,
-		Permission: api.Owner,
+		GroupID:         group.ID,
+		UserID:          owner.ID,
+		Permission:      api.Owner,
 		MemberConfirmed: true,
-		GroupConfirmed: true,
+		GroupConfirmed:  true,
 	}
 	if err := h.membershipStore.Create(membership); err != nil {
-		return err
+		return nil, err
 	}
 
-	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s", c.Scheme(), c.Request().Host, group.ID))
-	c.Response().WriteHeader(http.StatusSeeOther)
-	return nil
-
+	return group, nil
 }
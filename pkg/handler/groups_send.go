@@ -2,8 +2,11 @@ package handler
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/ledger"
 	"cp/pkg/memberships"
+	"cp/pkg/policy"
 	"cp/pkg/utils"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	uuid "github.com/satori/go.uuid"
@@ -46,30 +49,35 @@ type SendOption struct {
 type SendTarget struct {
 	DisplayName string
 	Value       string
+	Balance     *time.Duration
 }
 
-func (h *Handler) getTarget(targetStr string) (*api.Target, error) {
+// getTarget resolves a source or a target of the group: an active member,
+// or the group itself. The users and groups outside of the group are
+// refused, the ledger would create accounts for them
+func (h *Handler) getTarget(group *api.Group, targetStr string) (*api.Target, error) {
 
-	if strings.Contains(targetStr, "user:") {
+	if strings.HasPrefix(targetStr, "user:") {
 
-		userID := targetStr[5:]
-		user, err := h.userStore.Get(userID)
-		if err != nil {
+		userID := strings.TrimPrefix(targetStr, "user:")
+		membership, err := h.membershipStore.Get(group.ID, userID)
+		if errors.Is(err, echo.ErrNotFound) || (err == nil && !membership.IsActive()) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "only the members of the group can send or receive")
+		} else if err != nil {
 			return nil, err
 		}
 
 		return &api.Target{
 			UserID: &userID,
-			User:   user,
+			User:   membership.User,
 			Type:   api.UserTarget,
 		}, nil
 
-	} else if strings.Contains(targetStr, "group:") {
+	} else if strings.HasPrefix(targetStr, "group:") {
 
-		groupID := targetStr[6:]
-		group, err := h.groupStore.Get(groupID)
-		if err != nil {
-			return nil, err
+		groupID := strings.TrimPrefix(targetStr, "group:")
+		if groupID != group.ID {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "only the group itself can send or receive")
 		}
 
 		return &api.Target{
@@ -83,6 +91,23 @@ func (h *Handler) getTarget(targetStr string) (*api.Target, error) {
 	}
 }
 
+// getTargets resolves the source and the target of a send, which must
+// differ
+func (h *Handler) getTargets(group *api.Group, sourceStr string, targetStr string) (*api.Target, *api.Target, error) {
+	source, err := h.getTarget(group, sourceStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := h.getTarget(group, targetStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source.Type == target.Type && ((source.IsUser() && source.GetUserID() == target.GetUserID()) || (source.IsGroup() && source.GetGroupID() == target.GetGroupID())) {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "the source and the target must differ")
+	}
+	return source, target, nil
+}
+
 func (h *Handler) handleGroupSend(c echo.Context) error {
 
 	authenticatedUser, err := h.getAuthenticatedUser(c)
@@ -107,9 +132,18 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 
 		var sources []*SendTarget
 
+		userBalance, err := h.ledgerStore.GetBalance(group.ID, &api.Target{
+			UserID: &authenticatedUser.ID,
+			Type:   api.UserTarget,
+		})
+		if err != nil {
+			return err
+		}
+
 		sources = append(sources, &SendTarget{
 			DisplayName: authenticatedUser.Username + " (you)",
 			Value:       "user:" + authenticatedUser.ID,
+			Balance:     &userBalance,
 		})
 
 		var targets []*SendTarget
@@ -119,6 +153,9 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 		})
 
 		for _, m := range ms {
+			if !m.IsActive() {
+				continue
+			}
 			targetName := m.User.Username
 			if m.User.ID == authenticatedUser.ID {
 				targetName = targetName + " (you)"
@@ -128,10 +165,22 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 				Value:       "user:" + m.UserID,
 			})
 			if m.UserID == authenticatedUser.ID {
-				if m.IsAdmin() {
+				groupSource := &api.Target{
+					GroupID: &group.ID,
+					Type:    api.GroupTarget,
+				}
+				if policy.Can(h.getSubject(c), policy.SendCredits, policy.Resource{Group: group, Source: groupSource}) == nil {
+					groupBalance, err := h.ledgerStore.GetBalance(group.ID, &api.Target{
+						GroupID: &group.ID,
+						Type:    api.GroupTarget,
+					})
+					if err != nil {
+						return err
+					}
 					sources = append(sources, &SendTarget{
 						DisplayName: group.Name + " (group)",
 						Value:       "group:" + m.GroupID,
+						Balance:     &groupBalance,
 					})
 				}
 			}
@@ -149,12 +198,19 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 		return err
 	}
 
-	source, err := h.getTarget(payload.Source)
+	source, target, err := h.getTargets(group, payload.Source, payload.Target)
 	if err != nil {
 		return err
 	}
-	target, err := h.getTarget(payload.Target)
-	if err != nil {
+
+	action := policy.SendCredits
+	if payload.Type != Credits {
+		action = policy.SendAcknowledgement
+	}
+	if err := policy.Can(h.getSubject(c), action, policy.Resource{
+		Group:  group,
+		Source: source,
+	}); err != nil {
 		return err
 	}
 
@@ -165,22 +221,24 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 			return err
 		}
 
-		credits := &api.Credits{
-			ID:      uuid.NewV4().String(),
-			GroupID: group.ID,
-			SentTo:  target,
-			SentBy:  source,
-			Amount:  amount,
-			Notes:   payload.Notes,
-		}
-
-		if err := h.creditsStore.Create(credits); err != nil {
-			return err
+		if _, err := h.sendCredits(group, source, target, amount, payload.Notes); err != nil {
+			if !errors.Is(err, ledger.ErrOverdraftExceeded) && !errors.Is(err, ledger.ErrInvalidAmount) {
+				return err
+			}
+			if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+				Class:   "alert-danger",
+				Message: fmt.Sprintf("Could not send %s credits to %s: %s", amount.String(), target.HTMLLink(), err.Error()),
+			}); err != nil {
+				return err
+			}
+			c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/send", c.Scheme(), c.Request().Host, group.ID))
+			c.Response().WriteHeader(http.StatusSeeOther)
+			return nil
 		}
 
 		if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
 			Class:   "alert-success",
-			Message: fmt.Sprintf("Successfully sent %s credits to %s", credits.Amount.String(), target.HTMLLink()),
+			Message: fmt.Sprintf("Successfully sent %s credits to %s", amount.String(), target.HTMLLink()),
 		}); err != nil {
 			return err
 		}
@@ -192,16 +250,7 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 			acknowledgementType = api.Other
 		}
 
-		acknowledgement := &api.Acknowledgement{
-			ID:      uuid.NewV4().String(),
-			GroupID: group.ID,
-			SentTo:  target,
-			SentBy:  source,
-			Type:    acknowledgementType,
-			Notes:   payload.Notes,
-		}
-
-		if err := h.acknowledgementStore.Save(acknowledgement); err != nil {
+		if _, err := h.sendAcknowledgement(group, source, target, acknowledgementType, payload.Notes); err != nil {
 			return err
 		}
 
@@ -219,3 +268,64 @@ func (h *Handler) handleGroupSend(c echo.Context) error {
 	return nil
 
 }
+
+func (h *Handler) sendAcknowledgement(group *api.Group, source *api.Target, target *api.Target, acknowledgementType api.AcknowledgementType, notes string) (*api.Acknowledgement, error) {
+
+	acknowledgement := &api.Acknowledgement{
+		ID:      uuid.NewV4().String(),
+		GroupID: group.ID,
+		SentTo:  target,
+		SentBy:  source,
+		Type:    acknowledgementType,
+		Notes:   notes,
+	}
+
+	if err := h.acknowledgementStore.Save(acknowledgement); err != nil {
+		return nil, err
+	}
+
+	if target.Type == api.UserTarget {
+		if err := h.notifySent(group, target, api.AcknowledgementNotification, "Acknowledgement received",
+			fmt.Sprintf("%s sent you an acknowledgement in group %s", source.HTMLLink(), group.HTMLLink()),
+			fmt.Sprintf(`<a href="/users/%s/acknowledgements">Acknowledgements</a>`, target.User.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	return acknowledgement, nil
+}
+
+// sendCredits transfers credits between the accounts of the source and the
+// target, and notifies the target
+func (h *Handler) sendCredits(group *api.Group, source *api.Target, target *api.Target, amount time.Duration, notes string) (*api.JournalEntry, error) {
+
+	entry, err := h.ledgerStore.Transfer(group.ID, source, target, amount, notes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.notifySent(group, target, api.CreditsNotification, "Credits received",
+		fmt.Sprintf("%s sent you %s credits in group %s", source.HTMLLink(), amount.String(), group.HTMLLink()),
+		group.HTMLLink()); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// notifySent notifies the user receiving credits or an acknowledgement.
+// Nothing is sent when the target is a group
+func (h *Handler) notifySent(group *api.Group, target *api.Target, notificationType api.NotificationType, title string, message string, link string) error {
+	if target.Type != api.UserTarget {
+		return nil
+	}
+	return h.notificationStore.AddNotification(&api.Notification{
+		ID:      uuid.NewV4().String(),
+		UserID:  target.User.ID,
+		Type:    notificationType,
+		GroupID: &group.ID,
+		Title:   fmt.Sprintf("Group %s - %s", group.HTMLLink(), title),
+		Message: message,
+		Link:    link,
+	})
+}
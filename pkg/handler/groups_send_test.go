@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/events"
+	"cp/pkg/memberships"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"testing"
+)
+
+func TestGetTargets(t *testing.T) {
+	db := dbtest.Open(t)
+	h := &Handler{membershipStore: memberships.NewMembershipStore(db, events.Discard)}
+
+	group := &api.Group{ID: uuid.NewV4().String(), Name: "Group"}
+	otherGroup := &api.Group{ID: uuid.NewV4().String(), Name: "Other"}
+	if err := db.Create([]*api.Group{group, otherGroup}).Error; err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]*api.User{}
+	for _, name := range []string{"alice", "bob", "pending", "outsider"} {
+		users[name] = &api.User{ID: uuid.NewV4().String(), Username: name, Email: name + "@example.com"}
+		if err := db.Create(users[name]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, confirmed := range map[string]bool{"alice": true, "bob": true, "pending": false} {
+		if err := db.Create(&api.Membership{
+			GroupID:         group.ID,
+			UserID:          users[name].ID,
+			Permission:      api.Member,
+			MemberConfirmed: true,
+			GroupConfirmed:  confirmed,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	user := func(name string) string {
+		return "user:" + users[name].ID
+	}
+
+	for _, test := range []struct {
+		name   string
+		source string
+		target string
+		valid  bool
+	}{
+		{"member", user("alice"), user("bob"), true},
+		{"group", user("alice"), "group:" + group.ID, true},
+		{"from the group", "group:" + group.ID, user("bob"), true},
+		{"pending member", user("alice"), user("pending"), false},
+		{"outsider", user("alice"), user("outsider"), false},
+		{"unknown user", user("alice"), "user:" + uuid.NewV4().String(), false},
+		{"other group", user("alice"), "group:" + otherGroup.ID, false},
+		{"from an outsider", user("outsider"), user("bob"), false},
+		{"to the source", user("alice"), user("alice"), false},
+		{"from the group to the group", "group:" + group.ID, "group:" + group.ID, false},
+		{"invalid", user("alice"), users["bob"].ID, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			source, target, err := h.getTargets(group, test.source, test.target)
+			if test.valid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if source == nil || target == nil {
+					t.Fatal("the targets are missing")
+				}
+				if target.IsUser() && target.User == nil {
+					t.Fatal("the user of the target is not loaded")
+				}
+				return
+			}
+			var httpError *echo.HTTPError
+			if !errors.As(err, &httpError) || httpError.Code != http.StatusBadRequest {
+				t.Fatalf("%v, expected a bad request", err)
+			}
+		})
+	}
+}
@@ -3,13 +3,26 @@ package handler
 import (
 	"cp/pkg/acknowledgements"
 	"cp/pkg/api"
-	"cp/pkg/credits"
+	"cp/pkg/blobs"
+	"cp/pkg/conversations"
+	"cp/pkg/emails"
+	"cp/pkg/events"
+	"cp/pkg/exchanges"
 	"cp/pkg/groups"
 	"cp/pkg/images"
+	"cp/pkg/invitations"
+	"cp/pkg/jobs"
+	"cp/pkg/ledger"
 	"cp/pkg/memberships"
 	"cp/pkg/messages"
 	"cp/pkg/notifications"
+	"cp/pkg/pagination"
+	"cp/pkg/policy"
 	"cp/pkg/posts"
+	"cp/pkg/roles"
+	"cp/pkg/search"
+	"cp/pkg/snapshots"
+	"cp/pkg/tokens"
 	"cp/pkg/users"
 	"cp/pkg/utils"
 	"errors"
@@ -17,7 +30,8 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
-	"os"
+	"net/http"
+	"strings"
 )
 
 const (
@@ -28,50 +42,98 @@ const (
 	MembershipKey                  = "Membership"
 	PostIDKey                      = "PostID"
 	PostKey                        = "Post"
+	ExchangeIDKey                  = "ExchangeID"
+	ExchangeKey                    = "Exchange"
+	JournalEntryIDKey              = "JournalEntryID"
+	ConversationIDKey              = "ConversationID"
+	ConversationKey                = "Conversation"
 	AuthenticatedUserKey           = "AuthenticatedUser"
 	AuthenticatedUserMembershipKey = "AuthenticatedUserMembership"
 	ProfileKey                     = "Profile"
+	TokenKey                       = "PersonalAccessToken"
 )
 
 type Handler struct {
 	cookieStore          *sessions.CookieStore
+	authenticator        *Authenticator
 	groupStore           groups.Store
 	membershipStore      memberships.Store
 	userStore            users.Store
 	postStore            posts.Store
-	creditsStore         credits.Store
+	ledgerStore          ledger.Store
 	acknowledgementStore acknowledgements.Store
 	messageStore         messages.Store
 	notificationStore    notifications.Store
 	imageStore           images.Store
+	tokenStore           tokens.Store
+	invitationStore      invitations.Store
+	roleStore            roles.Store
+	exchangeStore        exchanges.Store
+	snapshotStore        snapshots.Store
+	conversationStore    conversations.Store
+	emailStore           emails.Store
+	jobStore             jobs.Store
+	blobStore            blobs.Store
+	searchEngine         search.Engine
+	broker               *events.Broker
+	jobRunner            *jobs.Runner
+	imageURLSigner       *images.URLSigner
 	alertManager         *utils.AlertManager
 	db                   *gorm.DB
 }
 
 func NewHandler(
 	cookieStore *sessions.CookieStore,
+	authenticator *Authenticator,
 	groupStore groups.Store,
 	membershipStore memberships.Store,
 	userStore users.Store,
 	postStore posts.Store,
-	creditsStore credits.Store,
+	ledgerStore ledger.Store,
 	acknowledgementStore acknowledgements.Store,
 	messageStore messages.Store,
 	notificationStore notifications.Store,
 	imageStore images.Store,
+	tokenStore tokens.Store,
+	invitationStore invitations.Store,
+	roleStore roles.Store,
+	exchangeStore exchanges.Store,
+	snapshotStore snapshots.Store,
+	conversationStore conversations.Store,
+	emailStore emails.Store,
+	jobStore jobs.Store,
+	blobStore blobs.Store,
+	searchEngine search.Engine,
+	broker *events.Broker,
+	jobRunner *jobs.Runner,
+	imageURLSigner *images.URLSigner,
 	alertManager *utils.AlertManager,
 	db *gorm.DB) *Handler {
 	return &Handler{
 		cookieStore:          cookieStore,
+		authenticator:        authenticator,
 		groupStore:           groupStore,
 		membershipStore:      membershipStore,
 		userStore:            userStore,
 		postStore:            postStore,
-		creditsStore:         creditsStore,
+		ledgerStore:          ledgerStore,
 		acknowledgementStore: acknowledgementStore,
 		messageStore:         messageStore,
 		imageStore:           imageStore,
 		notificationStore:    notificationStore,
+		tokenStore:           tokenStore,
+		invitationStore:      invitationStore,
+		roleStore:            roleStore,
+		exchangeStore:        exchangeStore,
+		snapshotStore:        snapshotStore,
+		conversationStore:    conversationStore,
+		emailStore:           emailStore,
+		jobStore:             jobStore,
+		blobStore:            blobStore,
+		searchEngine:         searchEngine,
+		broker:               broker,
+		jobRunner:            jobRunner,
+		imageURLSigner:       imageURLSigner,
 		alertManager:         alertManager,
 		db:                   db,
 	}
@@ -92,6 +154,16 @@ func (h *Handler) getGroupID(c echo.Context) (string, error) {
 }
 
 func (h *Handler) groupM() echo.MiddlewareFunc {
+	return h.loadGroupM(false)
+}
+
+// deletedGroupM loads the group of the route only while it is deleted, for
+// restoring it
+func (h *Handler) deletedGroupM() echo.MiddlewareFunc {
+	return h.loadGroupM(true)
+}
+
+func (h *Handler) loadGroupM(deleted bool) echo.MiddlewareFunc {
 	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			groupID := c.Param(GroupIDKey)
@@ -101,7 +173,7 @@ func (h *Handler) groupM() echo.MiddlewareFunc {
 			c.Set(GroupIDKey, groupID)
 
 			group, err := h.groupStore.Get(groupID)
-			if err != nil {
+			if err != nil || group.IsDeleted() != deleted {
 				return echo.ErrNotFound
 			}
 			c.Set(GroupKey, group)
@@ -220,6 +292,85 @@ func (h *Handler) postM(optional bool) echo.MiddlewareFunc {
 	}
 }
 
+func (h *Handler) getExchange(c echo.Context) (*api.Exchange, error) {
+	if exchange, ok := c.Get(ExchangeKey).(*api.Exchange); ok {
+		return exchange, nil
+	}
+	return nil, echo.ErrNotFound
+}
+
+// exchangeM loads the exchange of the route. It must come after postM, as
+// the exchange must respond to the post of the route
+func (h *Handler) exchangeM() echo.MiddlewareFunc {
+	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			post, err := h.getPost(c)
+			if err != nil {
+				return err
+			}
+			exchange, err := h.exchangeStore.Get(c.Param(ExchangeIDKey))
+			if err != nil {
+				return err
+			}
+			if exchange.PostID != post.ID {
+				return echo.ErrNotFound
+			}
+			c.Set(ExchangeKey, exchange)
+			return handlerFunc(c)
+		}
+	}
+}
+
+func (h *Handler) getConversation(c echo.Context) (*api.Conversation, error) {
+	if conversation, ok := c.Get(ConversationKey).(*api.Conversation); ok {
+		return conversation, nil
+	}
+	return nil, echo.ErrInternalServerError
+}
+
+// conversationM loads the conversation of the route, and its group as the
+// group of the route, so that authMemberM can load the membership of the
+// authenticated user
+func (h *Handler) conversationM() echo.MiddlewareFunc {
+	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			conversation, err := h.conversationStore.Get(c.Param(ConversationIDKey))
+			if err != nil {
+				return err
+			}
+			if conversation.Group == nil || conversation.Group.IsDeleted() {
+				return echo.ErrNotFound
+			}
+			c.Set(ConversationIDKey, conversation.ID)
+			c.Set(ConversationKey, conversation)
+			c.Set(GroupIDKey, conversation.GroupID)
+			c.Set(GroupKey, conversation.Group)
+			return handlerFunc(c)
+		}
+	}
+}
+
+// conversationGroupM loads the group a new conversation is started in, from
+// the form, so that the membership of the user is authorized like on the
+// routes of the group
+func (h *Handler) conversationGroupM() echo.MiddlewareFunc {
+	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			groupID := c.FormValue("groupId")
+			if groupID == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "group is required")
+			}
+			group, err := h.groupStore.Get(groupID)
+			if err != nil || group.IsDeleted() {
+				return echo.ErrNotFound
+			}
+			c.Set(GroupIDKey, group.ID)
+			c.Set(GroupKey, group)
+			return handlerFunc(c)
+		}
+	}
+}
+
 func (h *Handler) getAuthenticatedUser(c echo.Context) (*api.User, error) {
 	if authenticatedUser, ok := c.Get(AuthenticatedUserKey).(*api.User); ok {
 		if authenticatedUser == nil {
@@ -234,6 +385,34 @@ func (h *Handler) authM(optional bool) echo.MiddlewareFunc {
 	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 
+			token, err := h.getBearerToken(c)
+			if err != nil {
+				return err
+			}
+
+			if token != nil {
+
+				// Read-only tokens cannot be used to modify data
+				method := c.Request().Method
+				if !token.CanWrite() && method != http.MethodGet && method != http.MethodHead {
+					return echo.ErrForbidden
+				}
+
+				c.Set(TokenKey, token)
+				c.Set(ProfileKey, &api.Profile{
+					ID:       token.User.ID,
+					Email:    token.User.Email,
+					Username: token.User.Username,
+					Groups:   []string{},
+				})
+				c.Set(AuthenticatedUserKey, token.User)
+				return handlerFunc(c)
+			}
+
+			if err := h.refreshSession(c); err != nil {
+				return err
+			}
+
 			profile, err := GetProfile(h.cookieStore, c)
 			if err != nil {
 				return err
@@ -274,6 +453,19 @@ func (h *Handler) authM(optional bool) echo.MiddlewareFunc {
 	}
 }
 
+// getBearerToken returns the personal access token found in the
+// Authorization header, or nil when the header is not set
+func (h *Handler) getBearerToken(c echo.Context) (*api.PersonalAccessToken, error) {
+	authorization := c.Request().Header.Get(echo.HeaderAuthorization)
+	if authorization == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, echo.ErrUnauthorized
+	}
+	return h.tokenStore.Authenticate(strings.TrimPrefix(authorization, "Bearer "))
+}
+
 func (h *Handler) getAuthenticatedUserMembership(c echo.Context) (*api.Membership, error) {
 	if membership, ok := c.Get(AuthenticatedUserMembershipKey).(*api.Membership); ok {
 		return membership, nil
@@ -310,33 +502,136 @@ func (h *Handler) authMemberM(optional bool) echo.MiddlewareFunc {
 	}
 }
 
-func (h *Handler) isInGroupM(group string) echo.MiddlewareFunc {
+// getSubject returns the authenticated user, and its membership in the group
+// of the route, as a policy subject
+func (h *Handler) getSubject(c echo.Context) policy.Subject {
+	subject := policy.Subject{}
+	subject.User, _ = c.Get(AuthenticatedUserKey).(*api.User)
+	subject.Profile, _ = c.Get(ProfileKey).(*api.Profile)
+	subject.Membership, _ = c.Get(AuthenticatedUserMembershipKey).(*api.Membership)
+	subject.ViaToken = c.Get(TokenKey) != nil
+	return subject
+}
+
+// getResource returns the group, user, membership and post of the route as
+// a policy resource
+func (h *Handler) getResource(c echo.Context) policy.Resource {
+	resource := policy.Resource{}
+	resource.Group, _ = c.Get(GroupKey).(*api.Group)
+	resource.User, _ = c.Get(UserKey).(*api.User)
+	resource.Membership, _ = c.Get(MembershipKey).(*api.Membership)
+	resource.Post, _ = c.Get(PostKey).(*api.Post)
+	resource.Exchange, _ = c.Get(ExchangeKey).(*api.Exchange)
+	resource.Conversation, _ = c.Get(ConversationKey).(*api.Conversation)
+	return resource
+}
+
+// signedM serves the requests of a signed image URL without checking their
+// user, the URL was signed for a user allowed to see the image. The other
+// requests go through the given middlewares
+func (h *Handler) signedM(middlewares ...echo.MiddlewareFunc) echo.MiddlewareFunc {
 	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
+		checked := handlerFunc
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			checked = middlewares[i](checked)
+		}
 		return func(c echo.Context) error {
-
-			profile, err := GetProfile(h.cookieStore, c)
-			if err != nil {
-				return err
-			}
-			if profile == nil {
-				return echo.ErrUnauthorized
+			if !images.IsSigned(c.Request().URL) {
+				return checked(c)
 			}
-			if !profile.IsInGroup(group) {
-				return echo.ErrForbidden
+			if err := h.imageURLSigner.Verify(c.Request().URL); err != nil {
+				return err
 			}
+			return handlerFunc(c)
+		}
+	}
+}
 
+// authorizeM makes sure the authenticated user can perform the action on
+// the resources of the route. It must come after the middlewares loading
+// these resources
+func (h *Handler) authorizeM(action policy.Action) echo.MiddlewareFunc {
+	return func(handlerFunc echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := policy.Can(h.getSubject(c), action, h.getResource(c)); err != nil {
+				return err
+			}
 			return handlerFunc(c)
 		}
 	}
 }
 
-func (h *Handler) Register(e *echo.Echo) {
+// countOwners returns the number of active owners of the group
+func (h *Handler) countOwners(groupID string) (int, error) {
+	var owners []*api.Membership
+	permission := api.Owner
+	if err := h.membershipStore.Find(&owners, &memberships.GetMembershipsOptions{
+		HasPermission: &permission,
+		GroupID:       &groupID,
+	}); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, owner := range owners {
+		if owner.IsActive() {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type PageQuery struct {
+	After string `query:"after"`
+	Limit int    `query:"limit"`
+}
+
+// getPage returns the page requested with the after and limit query
+// parameters
+func (h *Handler) getPage(c echo.Context) (*pagination.Page, error) {
+	var payload PageQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &payload); err != nil {
+		return nil, err
+	}
+	page, err := pagination.NewPage(payload.After, payload.Limit)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return page, nil
+}
 
-	uploadDir := os.Getenv("PUBLIC_DIR")
-	if uploadDir == "" {
-		uploadDir = "public"
+// nextPageLink returns the URL of the request, moved to the page following
+// the cursor. It is empty when there is no next page
+func (h *Handler) nextPageLink(c echo.Context, next *pagination.Cursor) string {
+	if next == nil {
+		return ""
 	}
-	e.Static("/", uploadDir)
+	return h.pageLink(c, "after", next.String())
+}
+
+// pageLink returns the URL of the request, with the query parameter
+// selecting a page set to value
+func (h *Handler) pageLink(c echo.Context, key, value string) string {
+	u := *c.Request().URL
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// setNextPageHeader advertises the next page of an API listing with a Link
+// header
+func (h *Handler) setNextPageHeader(c echo.Context, next *pagination.Cursor) {
+	if link := h.nextPageLink(c, next); link != "" {
+		c.Response().Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", link))
+	}
+}
+
+func (h *Handler) Register(e *echo.Echo) {
+
+	// The images are served from the blob store, to the users allowed to
+	// see them
+	e.GET(fmt.Sprintf("/images/:Size/groups/:%s/posts/:%s/:File", GroupIDKey, PostIDKey), h.handlePostImage, h.groupM(), h.postM(false), h.signedM(h.authM(false), h.authMemberM(false), h.authorizeM(policy.ViewPostImages))).Name = "get_post_image"
+	e.GET(fmt.Sprintf("/images/users/:%s/:PictureID/:File", UserIDKey), h.handleProfilePicture, h.userM(), h.signedM(h.authM(false), h.authorizeM(policy.ViewUser))).Name = "get_profile_picture"
 
 	e.GET("/", h.handleHomeView, h.authM(true)).Name = "get_home"
 
@@ -345,46 +640,106 @@ func (h *Handler) Register(e *echo.Echo) {
 	a.GET("/logout", h.handleLogout).Name = "get_auth_logout"
 	a.GET("/callback", h.handleOauthCallback).Name = "get_auth_callback"
 
+	// Every route is authorized with authorizeM, except the membership
+	// routes whose action depends on the target user and the payload. These
+	// are authorized by joinGroup, leaveGroup and setRole
+	e.GET("/search", h.handleSearchView, h.authM(false), h.authorizeM(policy.Search)).Name = "get_search"
+
 	gs := e.Group("/groups", h.authM(false))
-	gs.GET("", h.handleGroupsView).Name = "get_groups"
-	gs.GET("/new", h.handleNewGroup).Name = "get_groups_new"
-	gs.POST("/new", h.handleNewGroup).Name = "post_groups_new"
-	gs.GET("/edit", h.handleEditGroup).Name = "get_groups_edit"
+	gs.GET("", h.handleGroupsView, h.authorizeM(policy.ListGroups)).Name = "get_groups"
+	gs.GET("/new", h.handleNewGroup, h.authorizeM(policy.CreateGroup)).Name = "get_groups_new"
+	gs.POST("/new", h.handleNewGroup, h.authorizeM(policy.CreateGroup)).Name = "post_groups_new"
+	gs.GET("/edit", h.handleEditGroup, h.authorizeM(policy.CreateGroup)).Name = "get_groups_edit"
+
+	gs.POST(fmt.Sprintf("/:%s/restore", GroupIDKey), h.handleGroupRestore, h.deletedGroupM(), h.authMemberM(false), h.authorizeM(policy.RestoreGroup)).Name = "post_group_restore"
 
 	g := gs.Group(fmt.Sprintf("/:%s", GroupIDKey), h.groupM())
-	g.GET("", h.handleGroupPostsView, h.authMemberM(true)).Name = "get_group_posts"
-	g.GET("/send", h.handleGroupSend, h.authMemberM(false)).Name = "get_group_send"
-	g.POST("/send", h.handleGroupSend, h.authMemberM(false)).Name = "post_group_send"
-	g.GET("/members", h.handleGroupMembersView, h.authMemberM(false)).Name = "get_group_members"
-	g.GET("/acknowledgements", h.handleGetGroupAcknowledgements, h.authMemberM(false)).Name = "get_group_acknowledgements"
-	g.GET("/settings", h.handleGroupSettings, h.authMemberM(false)).Name = "get_group_settings"
-	g.POST("/delete", h.handleGroupDelete, h.authMemberM(false)).Name = "post_group_delete"
-	g.GET("/history", h.handleGetGroupHistory, h.authMemberM(false)).Name = "get_group_history"
-	g.GET("/posts/new", h.handlePostEdit, h.authMemberM(false), h.postM(true)).Name = "get_group_post_new"
-	g.POST("/posts/new", h.handlePostEdit, h.authMemberM(false), h.postM(true)).Name = "post_group_post_new"
+	g.GET("", h.handleGroupPostsView, h.authMemberM(true), h.authorizeM(policy.ViewGroup)).Name = "get_group_posts"
+	g.GET("/send", h.handleGroupSend, h.authMemberM(false), h.authorizeM(policy.SendCredits)).Name = "get_group_send"
+	g.POST("/send", h.handleGroupSend, h.authMemberM(false), h.authorizeM(policy.SendCredits)).Name = "post_group_send"
+	g.GET("/members", h.handleGroupMembersView, h.authMemberM(false), h.authorizeM(policy.ViewGroupMembers)).Name = "get_group_members"
+	g.GET("/acknowledgements", h.handleGetGroupAcknowledgements, h.authMemberM(false), h.authorizeM(policy.ViewGroupAcknowledgements)).Name = "get_group_acknowledgements"
+	g.GET("/settings", h.handleGroupSettings, h.authMemberM(false), h.authorizeM(policy.ViewGroupSettings)).Name = "get_group_settings"
+	g.POST("/settings", h.handleGroupSettings, h.authMemberM(false), h.authorizeM(policy.UpdateGroupSettings)).Name = "post_group_settings"
+	g.POST("/settings/import", h.handleGroupImport, h.authMemberM(false), h.authorizeM(policy.ImportGroupData)).Name = "post_group_import"
+	g.POST("/invitations", h.handleGroupInvitationCreate, h.authMemberM(false), h.authorizeM(policy.ManageInvitations)).Name = "post_group_invitations"
+	g.POST("/invitations/:InvitationID/revoke", h.handleGroupInvitationRevoke, h.authMemberM(false), h.authorizeM(policy.ManageInvitations)).Name = "post_group_invitation_revoke"
+	g.POST("/roles", h.handleGroupRoleCreate, h.authMemberM(false), h.authorizeM(policy.ManageRoles)).Name = "post_group_roles"
+	g.POST("/roles/:RoleID/delete", h.handleGroupRoleDelete, h.authMemberM(false), h.authorizeM(policy.ManageRoles)).Name = "post_group_role_delete"
+	g.POST("/delete", h.handleGroupDelete, h.authMemberM(false), h.authorizeM(policy.DeleteGroup)).Name = "post_group_delete"
+	g.POST("/archive", h.handleGroupArchive, h.authMemberM(false), h.authorizeM(policy.ArchiveGroup)).Name = "post_group_archive"
+	g.POST("/unarchive", h.handleGroupUnarchive, h.authMemberM(false), h.authorizeM(policy.ArchiveGroup)).Name = "post_group_unarchive"
+	g.GET("/history", h.handleGetGroupHistory, h.authMemberM(false), h.authorizeM(policy.ViewGroupHistory)).Name = "get_group_history"
+	g.GET("/history/export", h.handleGetGroupHistoryExport, h.authMemberM(false), h.authorizeM(policy.ViewGroupHistory)).Name = "get_group_history_export"
+	g.GET("/ledger/export", h.handleGetGroupLedgerExport, h.authMemberM(false), h.authorizeM(policy.ViewCredits)).Name = "get_group_ledger_export"
+	g.POST(fmt.Sprintf("/ledger/:%s/reverse", JournalEntryIDKey), h.handleGroupLedgerReverse, h.authMemberM(false), h.authorizeM(policy.ReverseCredits)).Name = "post_group_ledger_reverse"
+	g.GET("/posts/new", h.handlePostEdit, h.authMemberM(false), h.postM(true), h.authorizeM(policy.CreatePost)).Name = "get_group_post_new"
+	g.POST("/posts/new", h.handlePostEdit, h.authMemberM(false), h.postM(true), h.authorizeM(policy.CreatePost)).Name = "post_group_post_new"
 
 	p := g.Group(fmt.Sprintf("/posts/:%s", PostIDKey), h.postM(false))
-	p.GET("", h.handlePostView, h.authMemberM(true)).Name = "get_group_post"
-	p.GET("/edit", h.handlePostEdit, h.authMemberM(false)).Name = "get_group_post_edit"
-	p.POST("/edit", h.handlePostEdit, h.authMemberM(false)).Name = "post_group_form_edit"
-	p.POST("/delete", h.handlePostDelete, h.authMemberM(false)).Name = "post_group_delete"
-	p.POST("/message", h.handlePostMessage, h.authMemberM(false)).Name = "post_group_post_message"
+	p.GET("", h.handlePostView, h.authMemberM(true), h.authorizeM(policy.ViewPost)).Name = "get_group_post"
+	p.GET("/events", h.handlePostEvents, h.authMemberM(false), h.authorizeM(policy.ViewPost)).Name = "get_group_post_events"
+	p.GET("/edit", h.handlePostEdit, h.authMemberM(false), h.authorizeM(policy.EditPost)).Name = "get_group_post_edit"
+	p.POST("/edit", h.handlePostEdit, h.authMemberM(false), h.authorizeM(policy.EditPost)).Name = "post_group_form_edit"
+	p.POST("/delete", h.handlePostDelete, h.authMemberM(false), h.authorizeM(policy.DeletePost)).Name = "post_group_delete"
+	p.POST("/message", h.handlePostMessage, h.authMemberM(false), h.authorizeM(policy.SendMessage)).Name = "post_group_post_message"
+	p.POST("/exchanges", h.handleExchangePropose, h.authMemberM(false), h.authorizeM(policy.ProposeExchange)).Name = "post_group_post_exchanges"
+
+	x := p.Group(fmt.Sprintf("/exchanges/:%s", ExchangeIDKey), h.exchangeM())
+	x.POST("/accept", h.handleExchangeAccept, h.authMemberM(false), h.authorizeM(policy.AcceptExchange)).Name = "post_group_post_exchange_accept"
+	x.POST("/decline", h.handleExchangeDecline, h.authMemberM(false), h.authorizeM(policy.DeclineExchange)).Name = "post_group_post_exchange_decline"
+	x.POST("/cancel", h.handleExchangeCancel, h.authMemberM(false), h.authorizeM(policy.CancelExchange)).Name = "post_group_post_exchange_cancel"
+	x.POST("/complete", h.handleExchangeComplete, h.authMemberM(false), h.authorizeM(policy.CompleteExchange)).Name = "post_group_post_exchange_complete"
 
 	m := g.Group(fmt.Sprintf("/users/:%s", UserIDKey), h.userM())
 	m.POST("/join", h.handleGroupJoin, h.authMemberM(true), h.memberM(true)).Name = "post_group_join"
 	m.POST("/leave", h.handleGroupLeave, h.authMemberM(false), h.memberM(false)).Name = "post_group_leave"
 	m.POST("/permissions", h.handleGroupSetPermission, h.authMemberM(false), h.memberM(false)).Name = "post_group_permissions"
+	m.POST("/role", h.handleGroupSetRole, h.authMemberM(false), h.memberM(false)).Name = "post_group_role"
+	m.POST("/approve", h.handleGroupMembershipApprove, h.authMemberM(false), h.memberM(false), h.authorizeM(policy.ApproveMembership)).Name = "post_group_membership_approve"
+	m.POST("/reject", h.handleGroupMembershipReject, h.authMemberM(false), h.memberM(false), h.authorizeM(policy.RejectMembership)).Name = "post_group_membership_reject"
+
+	i := e.Group("/invite")
+	i.GET("", h.handleInvitationCode, h.authM(true)).Name = "get_invite_code"
+	i.GET("/:Code", h.handleInvitationView, h.authM(true)).Name = "get_invite"
+	i.POST("/:Code", h.handleInvitationRedeem, h.authM(false), h.authorizeM(policy.RedeemInvitation)).Name = "post_invite"
+
+	e.GET("/unsubscribe/:Token", h.handleUnsubscribe, h.authM(true)).Name = "get_unsubscribe"
+	e.POST("/unsubscribe/:Token", h.handleUnsubscribe, h.authM(true)).Name = "post_unsubscribe"
 
 	u := e.Group(fmt.Sprintf("/users/:%s", UserIDKey), h.authM(false), h.userM())
-	u.GET("", h.handleGetUserPosts).Name = "get_user_posts"
-	u.GET("/groups", h.handleGetUserGroups).Name = "get_user_groups"
-	u.GET("/notifications", h.handleGetUserNotifications).Name = "get_user_notifications"
-	u.GET("/acknowledgements", h.handleGetUserAcknowledgements).Name = "get_user_acknowledgements"
-	u.GET("/profile", h.handleGetUserProfile).Name = "get_user_profile"
-	u.GET("/profile/edit", h.handleEditUserProfile).Name = "get_user_profile_edit"
-	u.POST("/profile/edit", h.handleEditUserProfile).Name = "post_user_profile_edit"
-
-	adm := e.Group("/admin", h.authM(false), h.isInGroupM("administrators"))
+	u.GET("", h.handleGetUserPosts, h.authorizeM(policy.ViewUser)).Name = "get_user_posts"
+	u.GET("/groups", h.handleGetUserGroups, h.authorizeM(policy.ViewUser)).Name = "get_user_groups"
+	u.GET("/notifications", h.handleGetUserNotifications, h.authorizeM(policy.ViewUserNotifications)).Name = "get_user_notifications"
+	u.POST("/notifications/read", h.handleUserNotificationsRead, h.authorizeM(policy.ManageUserNotifications)).Name = "post_user_notifications_read"
+	u.POST("/notifications/clear", h.handleUserNotificationsClear, h.authorizeM(policy.ManageUserNotifications)).Name = "post_user_notifications_clear"
+	u.GET("/notifications/settings", h.handleUserNotificationSettings, h.authorizeM(policy.ManageUserNotifications)).Name = "get_user_notification_settings"
+	u.POST("/notifications/settings", h.handleUserNotificationSettings, h.authorizeM(policy.ManageUserNotifications)).Name = "post_user_notification_settings"
+	u.POST("/notifications/:NotificationID/read", h.handleUserNotificationRead, h.authorizeM(policy.ManageUserNotifications)).Name = "post_user_notification_read"
+	u.POST("/notifications/:NotificationID/delete", h.handleUserNotificationDelete, h.authorizeM(policy.ManageUserNotifications)).Name = "post_user_notification_delete"
+	u.GET("/events", h.handleUserEvents, h.authorizeM(policy.ViewUserNotifications)).Name = "get_user_events"
+	u.GET("/acknowledgements", h.handleGetUserAcknowledgements, h.authorizeM(policy.ViewUser)).Name = "get_user_acknowledgements"
+	u.GET("/profile", h.handleGetUserProfile, h.authorizeM(policy.ViewUser)).Name = "get_user_profile"
+	u.GET("/profile/edit", h.handleEditUserProfile, h.authorizeM(policy.EditUserProfile)).Name = "get_user_profile_edit"
+	u.POST("/profile/edit", h.handleEditUserProfile, h.authorizeM(policy.EditUserProfile)).Name = "post_user_profile_edit"
+	u.GET("/tokens", h.handleUserTokens, h.authorizeM(policy.ManageUserTokens)).Name = "get_user_tokens"
+	u.POST("/tokens", h.handleUserTokens, h.authorizeM(policy.ManageUserTokens)).Name = "post_user_tokens"
+	u.POST("/tokens/:TokenID/revoke", h.handleUserTokenRevoke, h.authorizeM(policy.ManageUserTokens)).Name = "post_user_token_revoke"
+	u.GET("/conversations", h.handleGetUserConversations, h.authorizeM(policy.ViewConversations)).Name = "get_user_conversations"
+	u.GET("/conversations/new", h.handleConversationNew, h.authorizeM(policy.ViewConversations)).Name = "get_user_conversation_new"
+	u.POST("/conversations/new", h.handleConversationNew, h.conversationGroupM(), h.authMemberM(false), h.authorizeM(policy.StartConversation)).Name = "post_user_conversation_new"
+
+	cv := u.Group(fmt.Sprintf("/conversations/:%s", ConversationIDKey), h.conversationM())
+	cv.GET("", h.handleConversationView, h.authMemberM(true), h.authorizeM(policy.ViewConversation)).Name = "get_user_conversation"
+	cv.POST("/messages", h.handleConversationMessage, h.authMemberM(true), h.authorizeM(policy.SendDirectMessage)).Name = "post_user_conversation_message"
+	cv.GET("/events", h.handleConversationEvents, h.authorizeM(policy.ViewConversation)).Name = "get_user_conversation_events"
+
+	adm := e.Group("/admin", h.authM(false), h.authorizeM(policy.AdministerSite))
 	adm.GET("", h.handleAdmin)
 	adm.POST("/clear", h.handleAdminClearAll)
+	adm.GET("/jobs", h.handleAdminJobs).Name = "get_admin_jobs"
+	adm.POST("/jobs/:JobID/retry", h.handleAdminJobRetry).Name = "post_admin_job_retry"
+	adm.POST("/jobs/:JobID/delete", h.handleAdminJobDelete).Name = "post_admin_job_delete"
+
+	h.registerAPI(e)
 }
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/blobs"
+	"cp/pkg/images"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handlePostImage serves a size of a post image to the members of the group
+func (h *Handler) handlePostImage(c echo.Context) error {
+
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	size := c.Param("Size")
+	imageID := strings.TrimSuffix(c.Param("File"), ".jpg")
+	if !images.IsSize(size) || imageID == c.Param("File") {
+		return echo.ErrNotFound
+	}
+
+	return h.serveBlob(c, images.Key(size, &api.Image{
+		ID:      imageID,
+		GroupID: group.ID,
+		PostID:  post.ID,
+	}))
+}
+
+// handleProfilePicture serves a size of a profile picture to the
+// authenticated users
+func (h *Handler) handleProfilePicture(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	size := strings.TrimSuffix(c.Param("File"), ".jpg")
+	if !images.IsProfilePictureSize(size) || size == c.Param("File") {
+		return echo.ErrNotFound
+	}
+
+	return h.serveBlob(c, images.ProfilePictureKey(user.ID, c.Param("PictureID"), size))
+}
+
+// serveBlob writes a blob with its caching headers. The keys of the images
+// are never reused for another content, so the clients keep them for a
+// while, privately since they are not public
+func (h *Handler) serveBlob(c echo.Context, key string) error {
+	content, info, err := h.blobStore.Get(key)
+	if errors.Is(err, blobs.ErrInvalidKey) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "private, max-age=86400")
+	header.Set("X-Content-Type-Options", "nosniff")
+	if info.ETag != "" {
+		header.Set("ETag", info.ETag)
+	}
+	if !info.ModTime.IsZero() {
+		header.Set(echo.HeaderLastModified, info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if isNotModified(c.Request(), info) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	if info.Size >= 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(info.Size, 10))
+	}
+	return c.Stream(http.StatusOK, info.ContentType, content)
+}
+
+// isNotModified returns true if the client has the blob in its cache. The
+// ETag is compared first, and the modification time only without one
+func isNotModified(req *http.Request, info *blobs.Info) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		if info.ETag == "" {
+			return false
+		}
+		for _, etag := range strings.Split(match, ",") {
+			etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+			if etag == "*" || etag == strings.TrimPrefix(info.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get(echo.HeaderIfModifiedSince))
+	if err != nil || info.ModTime.IsZero() {
+		return false
+	}
+	return !info.ModTime.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"cp/pkg/invitations"
+	"cp/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+)
+
+// handleInvitationCode redirects the code typed in the join form to the
+// invitation page
+func (h *Handler) handleInvitationCode(c echo.Context) error {
+	code := invitations.NormalizeCode(c.QueryParam("code"))
+	if code == "" {
+		return echo.ErrBadRequest
+	}
+	return c.Redirect(http.StatusSeeOther, "/invite/"+url.PathEscape(code))
+}
+
+func (h *Handler) handleInvitationView(c echo.Context) error {
+
+	invitation, err := h.invitationStore.GetByCode(c.Param("Code"))
+	if err != nil {
+		return err
+	}
+
+	c.Set(GroupKey, invitation.Group)
+	c.Set(GroupIDKey, invitation.GroupID)
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err == nil {
+		membership, err := h.membershipStore.Get(invitation.GroupID, authenticatedUser.ID)
+		if err == nil {
+			c.Set(AuthenticatedUserMembershipKey, membership)
+		} else if !errors.Is(err, echo.ErrNotFound) {
+			return err
+		}
+	}
+
+	return c.Render(http.StatusOK, "invitation_view", map[string]interface{}{
+		"Title":      "Hello",
+		"Invitation": invitation,
+		"LoginURL":   "/auth/login?redirect=" + url.QueryEscape(invitation.Link()),
+	})
+}
+
+func (h *Handler) handleInvitationRedeem(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	invitation, err := h.invitationStore.GetByCode(c.Param("Code"))
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.invitationStore.Redeem(invitation.Code, authenticatedUser.ID); errors.Is(err, invitations.ErrInvalidInvitation) || errors.Is(err, invitations.ErrAlreadyMember) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: fmt.Sprintf("Successfully joined group %s!", invitation.Group.HTMLLink()),
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s", c.Scheme(), c.Request().Host, invitation.GroupID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/images"
+	"cp/pkg/maintenance"
+	"cp/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"time"
+)
+
+// The kinds of the jobs enqueued by the handlers
+const (
+	resizeImageJob  = "resize-image"
+	notifyThreadJob = "notify-thread"
+	purgeGroupJob   = "purge-group"
+)
+
+type notifyThreadPayload struct {
+	GroupID  string
+	PostID   string
+	AuthorID string
+}
+
+type purgeGroupPayload struct {
+	GroupID string
+}
+
+// RegisterJobs sets the handlers of the jobs enqueued by the handlers
+func (h *Handler) RegisterJobs() {
+	h.jobRunner.Handle(resizeImageJob, h.handleResizeImageJob)
+	h.jobRunner.Handle(notifyThreadJob, h.handleNotifyThreadJob)
+	h.jobRunner.Handle(purgeGroupJob, h.handlePurgeGroupJob)
+}
+
+// handleResizeImageJob writes the sizes of an image uploaded with a post
+func (h *Handler) handleResizeImageJob(job *api.Job) error {
+	var payload api.Image
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	return images.Resize(h.blobStore, &payload)
+}
+
+// handleNotifyThreadJob notifies the post author and the other participants
+// of the thread of a new message. Nothing is sent if the post was deleted
+// meanwhile
+func (h *Handler) handleNotifyThreadJob(job *api.Job) error {
+	var payload notifyThreadPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	post, err := h.postStore.Get(payload.PostID)
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if post.Group == nil {
+		return nil
+	}
+	author, err := h.userStore.Get(payload.AuthorID)
+	if err != nil {
+		return err
+	}
+
+	userIds, err := h.messageStore.FindUserIdsInThread(post.ID)
+	if err != nil {
+		return err
+	}
+	userIds = utils.UniqueStrings(append(userIds, post.AuthorID))
+	users, err := h.userStore.GetByKeys(userIds)
+	if err != nil {
+		return err
+	}
+	userMap := utils.UserMap(users)
+	delete(userMap, author.ID)
+
+	var notifications []*api.Notification
+	for _, user := range userMap {
+		notifications = append(notifications, &api.Notification{
+			ID:      uuid.NewV4().String(),
+			UserID:  user.ID,
+			Type:    api.MessageNotification,
+			GroupID: &payload.GroupID,
+			Title:   fmt.Sprintf("Post %s - New Message", post.HTMLLink()),
+			Message: fmt.Sprintf("%s replied to post %s in group %s",
+				author.HTMLLink(),
+				post.HTMLLink(),
+				post.Group.HTMLLink()),
+			Link: post.HTMLLink(),
+		})
+	}
+
+	return h.notificationStore.AddNotifications(notifications)
+}
+
+// handlePurgeGroupJob removes a deleted group and all its data, once it can
+// no longer be restored. The groups restored meanwhile are kept, and the
+// groups deleted again are purged by the job of their last deletion
+func (h *Handler) handlePurgeGroupJob(job *api.Job) error {
+	var payload purgeGroupPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	group, err := h.groupStore.Get(payload.GroupID)
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !group.IsDeleted() || time.Now().Before(group.PurgeAt()) {
+		return nil
+	}
+
+	return maintenance.PurgeGroup(h.db, h.blobStore, group.ID)
+}
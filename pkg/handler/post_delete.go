@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"cp/pkg/api"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"net/http"
@@ -8,25 +9,12 @@ import (
 
 func (h *Handler) handlePostDelete(c echo.Context) error {
 
-	authenticatedUser, err := h.getAuthenticatedUser(c)
-	if err != nil {
-		return err
-	}
-
 	post, err := h.getPost(c)
 	if err != nil {
 		return err
 	}
 
-	if authenticatedUser.ID != post.AuthorID {
-		return echo.ErrForbidden
-	}
-
-	if err := h.postStore.Delete(post.ID); err != nil {
-		return err
-	}
-
-	if err := h.messageStore.DeleteThread(post.ID); err != nil {
+	if err := h.deletePost(post); err != nil {
 		return err
 	}
 
@@ -43,3 +31,18 @@ func (h *Handler) handlePostDelete(c echo.Context) error {
 	return nil
 
 }
+
+func (h *Handler) deletePost(post *api.Post) error {
+
+	if err := h.postStore.Delete(post.ID); err != nil {
+		return err
+	}
+
+	// the post is no longer counted in the history of the group
+	if err := h.snapshotStore.DeleteFrom(post.GroupID, post.CreatedAt); err != nil {
+		return err
+	}
+
+	return h.messageStore.DeleteThread(post.ID)
+
+}
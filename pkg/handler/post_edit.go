@@ -2,17 +2,14 @@ package handler
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/images"
+	"errors"
 	"fmt"
 	form "github.com/go-playground/form/v4"
 	"github.com/labstack/echo/v4"
-	"github.com/nfnt/resize"
 	uuid "github.com/satori/go.uuid"
 	"image"
-	_ "image/gif"
-	"image/jpeg"
-	_ "image/png"
 	"net/http"
-	"os"
 	"time"
 )
 
@@ -78,49 +75,21 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 		return err
 	}
 
-	var valueFromPtr *time.Duration
-	var valueToPtr *time.Duration
-
-	if payload.Type != api.CommentPost {
-		valueFrom, err := time.ParseDuration(payload.ValueFrom)
-		if err != nil {
-			return err
-		}
-		valueTo, err := time.ParseDuration(payload.ValueTo)
-		if err != nil {
-			return err
-		}
-		if valueFrom < 0 {
-			return fmt.Errorf("invalid value from")
-		}
-		if valueTo < valueFrom {
-			return fmt.Errorf("value to cannot be smaller than value from")
-		}
-		valueFromPtr = &valueFrom
-		valueToPtr = &valueTo
-	}
-
-	if payload.Type == api.CommentPost {
-		if payload.Description == "" {
-			return echo.ErrBadRequest
-		}
-	}
-
-	if payload.Type != api.OfferPost && payload.Type != api.RequestPost && payload.Type != api.CommentPost {
-		return fmt.Errorf("invalid post type")
+	valueFromPtr, valueToPtr, err := validatePost(payload.Type, payload.Description, payload.ValueFrom, payload.ValueTo)
+	if err != nil {
+		return err
 	}
 
 	id := uuid.NewV4().String()
 	var isNewPost = true
+	var createdAt time.Time
 	if post != nil {
 		isNewPost = false
 		id = post.ID
+		createdAt = post.CreatedAt
 		if post.GroupID != payload.GroupID {
 			return echo.ErrBadRequest
 		}
-		if post.AuthorID != authenticatedUser.ID {
-			return echo.ErrBadRequest
-		}
 	}
 
 	post = &api.Post{
@@ -132,6 +101,7 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 		ValueFrom:   valueFromPtr,
 		ValueTo:     valueToPtr,
 		Type:        payload.Type,
+		CreatedAt:   createdAt,
 	}
 
 	form, err := c.MultipartForm()
@@ -139,24 +109,6 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 		return err
 	}
 
-	uploadDir := os.Getenv("PUBLIC_DIR")
-	if uploadDir == "" {
-		uploadDir = "public"
-	}
-
-	imgsPath := fmt.Sprintf("%s/images/full/groups/%s/posts/%s", uploadDir, group.ID, post.ID)
-	if err := os.MkdirAll(imgsPath, 0700); err != nil {
-		return err
-	}
-	mediumPath := fmt.Sprintf("%s/images/medium/groups/%s/posts/%s", uploadDir, group.ID, post.ID)
-	if err := os.MkdirAll(mediumPath, 0700); err != nil {
-		return err
-	}
-	thumbsPath := fmt.Sprintf("%s/images/thumb/groups/%s/posts/%s", uploadDir, group.ID, post.ID)
-	if err := os.MkdirAll(thumbsPath, 0700); err != nil {
-		return err
-	}
-
 	for _, existingImage := range payload.ExistingImages {
 		if existingImage.Delete {
 			if existingImage.GroupID != group.ID || existingImage.PostID != post.ID {
@@ -165,13 +117,19 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 			if err := h.imageStore.Delete(existingImage.ID); err != nil {
 				return err
 			}
-			os.Remove(fmt.Sprintf("%s/images/full/groups/%s/posts/%s/%s.jpg", uploadDir, existingImage.GroupID, existingImage.PostID, existingImage.ID))
-			os.Remove(fmt.Sprintf("%s/public/images/thumb/groups/%s/posts/%s/%s.jpg", uploadDir, existingImage.GroupID, existingImage.PostID, existingImage.ID))
-			os.Remove(fmt.Sprintf("%s/images/medium/groups/%s/posts/%s/%s.jpg", uploadDir, existingImage.GroupID, existingImage.PostID, existingImage.ID))
+			if err := images.Delete(h.blobStore, &api.Image{
+				ID:      existingImage.ID,
+				GroupID: existingImage.GroupID,
+				PostID:  existingImage.PostID,
+			}); err != nil {
+				return err
+			}
 		}
 	}
 
-	var images []*api.Image
+	// The uploads are resized by a job, the request only checks that they
+	// are images
+	var uploads []*api.Image
 
 	var i = 0
 	for {
@@ -181,7 +139,11 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 		}
 		for _, file := range files {
 
-			id := uuid.NewV4().String()
+			upload := &api.Image{
+				ID:      uuid.NewV4().String(),
+				PostID:  post.ID,
+				GroupID: group.ID,
+			}
 
 			src, err := file.Open()
 			if err != nil {
@@ -189,59 +151,20 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 			}
 			defer src.Close()
 
-			img, _, err := image.Decode(src)
-			if err != nil {
+			if err := images.Upload(h.blobStore, upload, src); errors.Is(err, image.ErrFormat) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is not an image", file.Filename))
+			} else if err != nil {
 				return err
 			}
 
-			thumb := resize.Resize(160, 0, img, resize.Lanczos3)
-			thumbDest, err := os.Create(fmt.Sprintf("%s/%s.jpg", thumbsPath, id))
-			if err != nil {
-				return err
-			}
-			defer thumbDest.Close()
-			if err := jpeg.Encode(thumbDest, thumb, &jpeg.Options{
-				Quality: 60,
-			}); err != nil {
-				return err
-			}
-
-			medium := resize.Resize(400, 0, img, resize.Lanczos3)
-			mediumDest, err := os.Create(fmt.Sprintf("%s/%s.jpg", mediumPath, id))
-			if err != nil {
-				return err
-			}
-			defer mediumDest.Close()
-			if err := jpeg.Encode(mediumDest, medium, &jpeg.Options{
-				Quality: 60,
-			}); err != nil {
-				return err
-			}
-
-			imgDest, err := os.Create(fmt.Sprintf("%s/%s.jpg", imgsPath, id))
-			if err != nil {
-				return err
-			}
-			defer imgDest.Close()
-
-			if err := jpeg.Encode(imgDest, img, &jpeg.Options{
-				Quality: 60,
-			}); err != nil {
-				return err
-			}
-
-			images = append(images, &api.Image{
-				ID:      id,
-				PostID:  post.ID,
-				GroupID: group.ID,
-			})
+			uploads = append(uploads, upload)
 
 		}
 		i++
 	}
 
 	if !isNewPost {
-		if err := h.postStore.Update(post); err != nil {
+		if err := h.updatePost(post); err != nil {
 			return err
 		}
 	} else {
@@ -250,12 +173,62 @@ func (h *Handler) handlePostEdit(c echo.Context) error {
 		}
 	}
 
-	if err := h.imageStore.Add(images); err != nil {
+	if err := h.imageStore.Add(uploads); err != nil {
 		return err
 	}
+	for _, upload := range uploads {
+		if err := h.jobRunner.Enqueue(resizeImageJob, upload); err != nil {
+			return err
+		}
+	}
 
 	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/posts/%s", c.Scheme(), c.Request().Host, group.ID, post.ID))
 	c.Response().WriteHeader(http.StatusSeeOther)
 	return nil
 
 }
+
+// updatePost saves the changes to an existing post. The post must keep the
+// creation time it was counted at in the history of the group
+func (h *Handler) updatePost(post *api.Post) error {
+
+	if err := h.postStore.Update(post); err != nil {
+		return err
+	}
+
+	// the type of the post counted in the history of the group may change
+	return h.snapshotStore.DeleteFrom(post.GroupID, post.CreatedAt)
+
+}
+
+// validatePost validates the type, description and value range of a post.
+// Offers and requests must have a value range, comments a description
+func validatePost(postType api.PostType, description string, valueFrom string, valueTo string) (*time.Duration, *time.Duration, error) {
+
+	if postType != api.OfferPost && postType != api.RequestPost && postType != api.CommentPost {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "invalid post type")
+	}
+
+	if postType == api.CommentPost {
+		if description == "" {
+			return nil, nil, echo.ErrBadRequest
+		}
+		return nil, nil, nil
+	}
+
+	from, err := time.ParseDuration(valueFrom)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "invalid value from")
+	}
+	to, err := time.ParseDuration(valueTo)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "invalid value to")
+	}
+	if from < 0 {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "invalid value from")
+	}
+	if to < from {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "value to cannot be smaller than value from")
+	}
+	return &from, &to, nil
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/exchanges"
+	"cp/pkg/ledger"
+	"cp/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"net/http"
+	"time"
+)
+
+type ProposeExchange struct {
+	Amount string `form:"amount" json:"amount"`
+	Notes  string `form:"notes" json:"notes"`
+}
+
+func (h *Handler) handleExchangePropose(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	var payload ProposeExchange
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	if _, err := h.proposeExchange(authenticatedUser, post, payload); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: "Successfully proposed the exchange",
+	}); err != nil {
+		return err
+	}
+	return h.redirectToPostExchanges(c, post)
+}
+
+func (h *Handler) handleExchangeAccept(c echo.Context) error {
+	return h.handleExchangeAction(c, h.acceptExchange, "Successfully accepted the exchange")
+}
+
+func (h *Handler) handleExchangeDecline(c echo.Context) error {
+	return h.handleExchangeAction(c, h.declineExchange, "Successfully declined the exchange")
+}
+
+func (h *Handler) handleExchangeCancel(c echo.Context) error {
+	return h.handleExchangeAction(c, h.cancelExchange, "Successfully cancelled the exchange")
+}
+
+func (h *Handler) handleExchangeComplete(c echo.Context) error {
+	return h.handleExchangeAction(c, h.completeExchange, "Successfully marked the exchange as done")
+}
+
+type exchangeAction func(user *api.User, exchange *api.Exchange) error
+
+func (h *Handler) handleExchangeAction(c echo.Context, action exchangeAction, message string) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	post, err := h.getPost(c)
+	if err != nil {
+		return err
+	}
+
+	exchange, err := h.getExchange(c)
+	if err != nil {
+		return err
+	}
+
+	if err := action(authenticatedUser, exchange); err != nil {
+		if !isExchangeError(err) {
+			return err
+		}
+		if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+			Class:   "alert-danger",
+			Message: fmt.Sprintf("Could not update the exchange: %s", err.Error()),
+		}); err != nil {
+			return err
+		}
+		return h.redirectToPostExchanges(c, post)
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: message,
+	}); err != nil {
+		return err
+	}
+	return h.redirectToPostExchanges(c, post)
+}
+
+func (h *Handler) redirectToPostExchanges(c echo.Context, post *api.Post) error {
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/posts/%s#exchanges", c.Scheme(), c.Request().Host, post.GroupID, post.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// isExchangeError returns true for the errors caused by the state of the
+// exchange or of the payer balance, rather than by a failure
+func isExchangeError(err error) bool {
+	return errors.Is(err, exchanges.ErrInvalidTransition) ||
+		errors.Is(err, exchanges.ErrAlreadyDone) ||
+		errors.Is(err, ledger.ErrOverdraftExceeded) ||
+		errors.Is(err, ledger.ErrInvalidAmount)
+}
+
+// proposeExchange creates an exchange responding to the post. The amount
+// must be within the value range of the post, if it has one
+func (h *Handler) proposeExchange(responder *api.User, post *api.Post, payload ProposeExchange) (*api.Exchange, error) {
+
+	if !post.Type.IsOffer() && !post.Type.IsRequest() {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "exchanges can only respond to offers and requests")
+	}
+
+	amount, err := time.ParseDuration(payload.Amount)
+	if err != nil || amount <= 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid amount")
+	}
+	if post.ValueFrom != nil && amount < *post.ValueFrom {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("amount must be at least %s", post.ValueFrom.String()))
+	}
+	if post.ValueTo != nil && amount > *post.ValueTo {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("amount must be at most %s", post.ValueTo.String()))
+	}
+
+	exchange := &api.Exchange{
+		GroupID:     post.GroupID,
+		PostID:      post.ID,
+		ResponderID: responder.ID,
+		Amount:      amount,
+		Notes:       payload.Notes,
+	}
+	if err := h.exchangeStore.Create(exchange); err != nil {
+		return nil, err
+	}
+	exchange.Post = post
+	exchange.Responder = responder
+
+	if err := h.notifyExchange(exchange, post.AuthorID,
+		"New exchange proposal",
+		fmt.Sprintf("%s proposed an %s of %s for your post %s",
+			responder.HTMLLink(),
+			exchange.HTMLLink(),
+			amount.String(),
+			post.HTMLLink())); err != nil {
+		return nil, err
+	}
+
+	return exchange, nil
+}
+
+func (h *Handler) acceptExchange(user *api.User, exchange *api.Exchange) error {
+	if err := h.exchangeStore.SetStatus(exchange, api.ExchangeProposed, api.ExchangeAccepted); err != nil {
+		return err
+	}
+	return h.notifyExchange(exchange, exchange.ResponderID,
+		"Exchange accepted",
+		fmt.Sprintf("%s accepted your %s for post %s. Mark it as done once it happened",
+			user.HTMLLink(),
+			exchange.HTMLLink(),
+			exchange.Post.HTMLLink()))
+}
+
+func (h *Handler) declineExchange(user *api.User, exchange *api.Exchange) error {
+	if err := h.exchangeStore.SetStatus(exchange, api.ExchangeProposed, api.ExchangeDeclined); err != nil {
+		return err
+	}
+	return h.notifyExchange(exchange, exchange.ResponderID,
+		"Exchange declined",
+		fmt.Sprintf("%s declined your %s for post %s",
+			user.HTMLLink(),
+			exchange.HTMLLink(),
+			exchange.Post.HTMLLink()))
+}
+
+func (h *Handler) cancelExchange(user *api.User, exchange *api.Exchange) error {
+	if !exchange.Status.IsOpen() {
+		return exchanges.ErrInvalidTransition
+	}
+	if err := h.exchangeStore.SetStatus(exchange, exchange.Status, api.ExchangeCancelled); err != nil {
+		return err
+	}
+	return h.notifyExchange(exchange, otherExchangeParty(exchange, user.ID),
+		"Exchange cancelled",
+		fmt.Sprintf("%s cancelled the %s for post %s",
+			user.HTMLLink(),
+			exchange.HTMLLink(),
+			exchange.Post.HTMLLink()))
+}
+
+// completeExchange marks the exchange as done by the user. The credits are
+// transferred once both parties did
+func (h *Handler) completeExchange(user *api.User, exchange *api.Exchange) error {
+	if err := h.exchangeStore.MarkDone(exchange, user.ID); err != nil {
+		return err
+	}
+
+	if !exchange.Status.IsCompleted() {
+		return h.notifyExchange(exchange, otherExchangeParty(exchange, user.ID),
+			"Exchange done",
+			fmt.Sprintf("%s marked the %s for post %s as done. Mark it as done too to transfer the credits",
+				user.HTMLLink(),
+				exchange.HTMLLink(),
+				exchange.Post.HTMLLink()))
+	}
+
+	message := fmt.Sprintf("The %s for post %s is completed, %s credits were transferred",
+		exchange.HTMLLink(),
+		exchange.Post.HTMLLink(),
+		exchange.Amount.String())
+	if err := h.notifyExchange(exchange, exchange.Post.AuthorID, "Exchange completed", message); err != nil {
+		return err
+	}
+	return h.notifyExchange(exchange, exchange.ResponderID, "Exchange completed", message)
+}
+
+func otherExchangeParty(exchange *api.Exchange, userID string) string {
+	if userID == exchange.ResponderID {
+		return exchange.Post.AuthorID
+	}
+	return exchange.ResponderID
+}
+
+func (h *Handler) notifyExchange(exchange *api.Exchange, userID string, title string, message string) error {
+	return h.notificationStore.AddNotification(&api.Notification{
+		ID:      uuid.NewV4().String(),
+		UserID:  userID,
+		Type:    api.ExchangeNotification,
+		GroupID: &exchange.GroupID,
+		Title:   fmt.Sprintf("Post %s - %s", exchange.Post.HTMLLink(), title),
+		Message: message,
+		Link:    exchange.HTMLLink(),
+	})
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"cp/pkg/api"
-	"cp/pkg/utils"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	uuid "github.com/satori/go.uuid"
@@ -10,7 +9,7 @@ import (
 )
 
 type SubmitMessage struct {
-	Content string `form:"content"`
+	Content string `form:"content" json:"content"`
 }
 
 func (h *Handler) handlePostMessage(c echo.Context) error {
@@ -35,48 +34,42 @@ func (h *Handler) handlePostMessage(c echo.Context) error {
 		return err
 	}
 
+	if _, err := h.sendMessage(authenticatedUser, group, post, payload.Content); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/posts/%s", c.Scheme(), c.Request().Host, group.ID, post.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+
+}
+
+// sendMessage adds a message to the post thread. The post author and the
+// other participants of the thread are notified by a job
+func (h *Handler) sendMessage(authenticatedUser *api.User, group *api.Group, post *api.Post, content string) (*api.Message, error) {
+
+	if content == "" {
+		return nil, echo.ErrBadRequest
+	}
+
 	var message = &api.Message{
 		ID:       uuid.NewV4().String(),
 		AuthorID: authenticatedUser.ID,
-		Content:  payload.Content,
+		Content:  content,
 		ThreadID: post.ID,
 	}
 	if err := h.messageStore.SendMessage(message); err != nil {
-		return err
+		return nil, err
 	}
 
-	userIds, err := h.messageStore.FindUserIdsInThread(post.ID)
-	if err != nil {
-		return err
-	}
-	userIds = utils.UniqueStrings(append(userIds, post.AuthorID))
-	users, err := h.userStore.GetByKeys(userIds)
-	if err != nil {
-		return err
-	}
-	userMap := utils.UserMap(users)
-	delete(userMap, authenticatedUser.ID)
-
-	var notifications []*api.Notification
-	for _, user := range userMap {
-		notifications = append(notifications, &api.Notification{
-			ID:     uuid.NewV4().String(),
-			UserID: user.ID,
-			Title:  fmt.Sprintf("Post %s - New Message", post.HTMLLink()),
-			Message: fmt.Sprintf("%s replied to post %s in group %s",
-				user.HTMLLink(),
-				post.HTMLLink(),
-				group.HTMLLink()),
-			Link: post.HTMLLink(),
-		})
-	}
-
-	if err := h.notificationStore.AddNotifications(notifications); err != nil {
-		return err
+	if err := h.jobRunner.Enqueue(notifyThreadJob, &notifyThreadPayload{
+		GroupID:  group.ID,
+		PostID:   post.ID,
+		AuthorID: authenticatedUser.ID,
+	}); err != nil {
+		return nil, err
 	}
 
-	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/groups/%s/posts/%s", c.Scheme(), c.Request().Host, group.ID, post.ID))
-	c.Response().WriteHeader(http.StatusSeeOther)
-	return nil
+	return message, nil
 
 }
@@ -12,13 +12,25 @@ func (h *Handler) handlePostView(c echo.Context) error {
 		return err
 	}
 
-	messages, err := h.messageStore.GetMessages(post.ID)
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	messages, next, err := h.messageStore.GetMessages(post.ID, page)
+	if err != nil {
+		return err
+	}
+
+	exchanges, err := h.exchangeStore.GetForPost(post.ID)
 	if err != nil {
 		return err
 	}
 
 	return c.Render(http.StatusOK, "post_view", map[string]interface{}{
-		"Title":    "Hello",
-		"Messages": messages,
+		"Title":     "Hello",
+		"Messages":  messages,
+		"Exchanges": exchanges,
+		"NextLink":  h.nextPageLink(c, next),
 	})
 }
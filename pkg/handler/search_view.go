@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/memberships"
+	"cp/pkg/search"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+type SearchQuery struct {
+	Query string       `query:"q"`
+	Kind  *search.Kind `query:"kind"`
+}
+
+func (h *Handler) handleSearchView(c echo.Context) error {
+
+	var payload SearchQuery
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	results, err := h.search(c, payload)
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "search_view", map[string]interface{}{
+		"Title":   "Search",
+		"Query":   payload.Query,
+		"Kind":    payload.Kind,
+		"Results": results,
+	})
+}
+
+// search searches the groups the authenticated user is an active member of
+func (h *Handler) search(c echo.Context, payload SearchQuery) ([]*search.Result, error) {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(payload.Query) == "" {
+		return []*search.Result{}, nil
+	}
+
+	var userMemberships []*api.Membership
+	memberConfirmed := true
+	groupConfirmed := true
+	if err := h.membershipStore.Find(&userMemberships, &memberships.GetMembershipsOptions{
+		UserID:          &authenticatedUser.ID,
+		MemberConfirmed: &memberConfirmed,
+		GroupConfirmed:  &groupConfirmed,
+	}); err != nil {
+		return nil, err
+	}
+
+	var groupIDs []string
+	for _, membership := range userMemberships {
+		groupIDs = append(groupIDs, membership.GroupID)
+	}
+
+	query := &search.Query{
+		Text:     payload.Query,
+		GroupIDs: groupIDs,
+	}
+	if payload.Kind != nil && *payload.Kind != "" {
+		query.Kinds = []search.Kind{*payload.Kind}
+	}
+
+	return h.searchEngine.Search(query)
+}
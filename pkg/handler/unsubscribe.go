@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// handleUnsubscribe stops the notification emails of the user owning the
+// token of the link. The link works without signing in, and mail clients
+// may post to it directly, following the List-Unsubscribe-Post header
+func (h *Handler) handleUnsubscribe(c echo.Context) error {
+
+	preference, err := h.emailStore.GetPreferenceByToken(c.Param("Token"))
+	if err != nil {
+		return err
+	}
+
+	if c.Request().Method == http.MethodPost {
+		if err := h.emailStore.SetFrequency(preference.UserID, api.EmailNever); err != nil {
+			return err
+		}
+		preference.Frequency = api.EmailNever
+	}
+
+	return c.Render(http.StatusOK, "unsubscribe", map[string]interface{}{
+		"Title":        "Unsubscribe",
+		"Token":        c.Param("Token"),
+		"Unsubscribed": preference.Frequency == api.EmailNever,
+	})
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/emails"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// dataRenderer keeps the data of the last rendered page
+type dataRenderer struct {
+	data map[string]interface{}
+}
+
+func (r *dataRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	r.data, _ = data.(map[string]interface{})
+	return nil
+}
+
+func TestUnsubscribe(t *testing.T) {
+	db := dbtest.Open(t)
+	emailStore := emails.NewEmailStore(db)
+	h := &Handler{emailStore: emailStore}
+	user := &api.User{ID: uuid.NewV4().String(), Username: "alice", Email: "alice@example.com"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := emailStore.SetFrequency(user.ID, api.EmailImmediately); err != nil {
+		t.Fatal(err)
+	}
+	preference, err := emailStore.GetPreference(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	renderer := &dataRenderer{}
+	e.Renderer = renderer
+	unsubscribe := func(method string, token string) error {
+		c := e.NewContext(httptest.NewRequest(method, "/unsubscribe/"+token, nil), httptest.NewRecorder())
+		c.SetParamNames("Token")
+		c.SetParamValues(token)
+		return h.handleUnsubscribe(c)
+	}
+	frequency := func() api.EmailFrequency {
+		preference, err := emailStore.GetPreference(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return preference.Frequency
+	}
+
+	// Following the link only asks for a confirmation
+	if err := unsubscribe(http.MethodGet, preference.UnsubscribeToken); err != nil {
+		t.Fatal(err)
+	}
+	if renderer.data["Unsubscribed"] != false || frequency() != api.EmailImmediately {
+		t.Fatal("the link unsubscribed the user without confirmation")
+	}
+
+	if err := unsubscribe(http.MethodPost, preference.UnsubscribeToken); err != nil {
+		t.Fatal(err)
+	}
+	if renderer.data["Unsubscribed"] != true || frequency() != api.EmailNever {
+		t.Fatal("the user was not unsubscribed")
+	}
+
+	if err := unsubscribe(http.MethodPost, "invalid"); !errors.Is(err, echo.ErrNotFound) {
+		t.Fatalf("invalid token: %v, expected not found", err)
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/memberships"
+	"cp/pkg/policy"
+	"cp/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type SubmitConversation struct {
+	GroupID      string   `form:"groupId"`
+	Subject      string   `form:"subject"`
+	Participants []string `form:"participants"`
+	Content      string   `form:"content"`
+}
+
+// handleConversationNew starts a conversation with members of one of the
+// groups of the user. The group is chosen first, then the participants
+func (h *Handler) handleConversationNew(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	if c.Request().Method == http.MethodGet {
+		return h.renderConversationNew(c, authenticatedUser, c.QueryParam("groupId"), c.QueryParam("to"))
+	}
+
+	// The group of the form is loaded and authorized by the middlewares
+	group, err := h.getGroup(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SubmitConversation
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	participantIDs := utils.UniqueStrings(payload.Participants)
+	if len(participantIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "at least one participant is required")
+	}
+	if len(participantIDs) >= api.MaxConversationParticipants {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("a conversation has at most %d participants", api.MaxConversationParticipants))
+	}
+	for _, participantID := range participantIDs {
+		if participantID == authenticatedUser.ID {
+			return echo.NewHTTPError(http.StatusBadRequest, "cannot start a conversation with yourself")
+		}
+		membership, err := h.membershipStore.Get(group.ID, participantID)
+		if errors.Is(err, echo.ErrNotFound) {
+			return echo.NewHTTPError(http.StatusBadRequest, "participants must be members of the group")
+		} else if err != nil {
+			return err
+		}
+		if !membership.IsActive() {
+			return echo.NewHTTPError(http.StatusBadRequest, "participants must be members of the group")
+		}
+	}
+
+	if payload.Content == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "message is required")
+	}
+
+	conversation, err := h.conversationStore.Create(group.ID, authenticatedUser.ID, payload.Subject, participantIDs)
+	if err != nil {
+		return err
+	}
+
+	// Reloaded for the participant usernames of the notifications
+	conversation, err = h.conversationStore.Get(conversation.ID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := h.sendDirectMessage(authenticatedUser, conversation, payload.Content); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/users/%s/conversations/%s", c.Scheme(), c.Request().Host, authenticatedUser.ID, conversation.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// canStartConversation checks that the user is an active member of the group
+// the conversation is started in
+func (h *Handler) canStartConversation(c echo.Context, authenticatedUser *api.User, groupID string) error {
+	if groupID == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "group is required")
+	}
+	membership, err := h.membershipStore.Get(groupID, authenticatedUser.ID)
+	if errors.Is(err, echo.ErrNotFound) {
+		return echo.ErrForbidden
+	} else if err != nil {
+		return err
+	}
+	// The group of the membership is not preloaded once it is deleted
+	if membership.Group == nil || membership.Group.IsDeleted() {
+		return echo.ErrNotFound
+	}
+	subject := h.getSubject(c)
+	subject.Membership = membership
+	resource := h.getResource(c)
+	resource.Group = membership.Group
+	return policy.Can(subject, policy.StartConversation, resource)
+}
+
+func (h *Handler) renderConversationNew(c echo.Context, authenticatedUser *api.User, groupID string, to string) error {
+
+	groupConfirmed := true
+	memberConfirmed := true
+	var groupMemberships []*api.Membership
+	if err := h.membershipStore.Find(&groupMemberships, &memberships.GetMembershipsOptions{
+		UserID:          &authenticatedUser.ID,
+		GroupConfirmed:  &groupConfirmed,
+		MemberConfirmed: &memberConfirmed,
+		Preload:         []string{"Group"},
+	}); err != nil {
+		return err
+	}
+
+	var members []*api.Membership
+	if groupID != "" {
+		if err := h.canStartConversation(c, authenticatedUser, groupID); err != nil {
+			return err
+		}
+		if err := h.membershipStore.Find(&members, &memberships.GetMembershipsOptions{
+			GroupID:         &groupID,
+			GroupConfirmed:  &groupConfirmed,
+			MemberConfirmed: &memberConfirmed,
+			Preload:         []string{"User"},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return c.Render(http.StatusOK, "user_conversation_new", map[string]interface{}{
+		"Title":       "New conversation",
+		"Memberships": groupMemberships,
+		"GroupID":     groupID,
+		"Members":     members,
+		"To":          to,
+	})
+}
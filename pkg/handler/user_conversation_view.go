@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"html"
+	"net/http"
+	"time"
+)
+
+func (h *Handler) handleConversationView(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	messages, next, err := h.messageStore.GetMessages(conversation.ID, page)
+	if err != nil {
+		return err
+	}
+
+	// The read receipts are rendered before the conversation is marked as
+	// read, so that the user only sees the receipts of the others
+	if err := h.conversationStore.MarkRead(conversation.ID, authenticatedUser.ID, time.Now()); err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "user_conversation_view", map[string]interface{}{
+		"Title":    conversation.Name(),
+		"Messages": messages,
+		"NextLink": h.nextPageLink(c, next),
+	})
+}
+
+func (h *Handler) handleConversationMessage(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	conversation, err := h.getConversation(c)
+	if err != nil {
+		return err
+	}
+
+	var payload SubmitMessage
+	if err := c.Bind(&payload); err != nil {
+		return err
+	}
+
+	if _, err := h.sendDirectMessage(authenticatedUser, conversation, payload.Content); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/users/%s/conversations/%s", c.Scheme(), c.Request().Host, authenticatedUser.ID, conversation.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
+
+// sendDirectMessage adds a message to the conversation, moves it to the top
+// of the inboxes and notifies the other participants
+func (h *Handler) sendDirectMessage(authenticatedUser *api.User, conversation *api.Conversation, content string) (*api.Message, error) {
+
+	if content == "" {
+		return nil, echo.ErrBadRequest
+	}
+
+	var message = &api.Message{
+		ID:       uuid.NewV4().String(),
+		AuthorID: authenticatedUser.ID,
+		Content:  content,
+		ThreadID: conversation.ID,
+	}
+	if err := h.messageStore.SendMessage(message); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := h.conversationStore.Touch(conversation.ID, now); err != nil {
+		return nil, err
+	}
+	if err := h.conversationStore.MarkRead(conversation.ID, authenticatedUser.ID, now); err != nil {
+		return nil, err
+	}
+
+	var notifications []*api.Notification
+	for _, participant := range conversation.Participants {
+		if participant.UserID == authenticatedUser.ID {
+			continue
+		}
+		notifications = append(notifications, &api.Notification{
+			ID:      uuid.NewV4().String(),
+			UserID:  participant.UserID,
+			Type:    api.MessageNotification,
+			GroupID: &conversation.GroupID,
+			Title:   fmt.Sprintf("New message from %s", html.EscapeString(authenticatedUser.Username)),
+			Message: fmt.Sprintf("%s sent a message in %s", authenticatedUser.HTMLLink(), conversation.HTMLLink(participant.UserID)),
+			Link:    conversation.HTMLLink(participant.UserID),
+		})
+	}
+
+	if err := h.notificationStore.AddNotifications(notifications); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleGetUserConversations(c echo.Context) error {
+
+	authenticatedUser, err := h.getAuthenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	conversations, next, err := h.conversationStore.GetForUser(authenticatedUser.ID, page)
+	if err != nil {
+		return err
+	}
+
+	unread, err := h.conversationStore.CountUnread(authenticatedUser.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.Render(http.StatusOK, "user_conversations_view", map[string]interface{}{
+		"Title":         "Messages",
+		"Conversations": conversations,
+		"Unread":        unread,
+		"NextLink":      h.nextPageLink(c, next),
+	})
+}
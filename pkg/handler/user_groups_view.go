@@ -22,8 +22,28 @@ func (h *Handler) handleGetUserGroups(c echo.Context) error {
 		return err
 	}
 
+	// The deleted groups are listed to the members who can restore them,
+	// until they are purged
+	var deleted []*api.Membership
+	if authenticatedUser, _ := c.Get(AuthenticatedUserKey).(*api.User); authenticatedUser != nil && authenticatedUser.ID == user.ID {
+		var dms []*api.Membership
+		if err := h.membershipStore.Find(&dms, &memberships.GetMembershipsOptions{
+			UserID:       &user.ID,
+			GroupDeleted: true,
+			Preload:      []string{"Group"},
+		}); err != nil {
+			return err
+		}
+		for _, m := range dms {
+			if m.HasCapability(api.DeleteGroupCapability) {
+				deleted = append(deleted, m)
+			}
+		}
+	}
+
 	return c.Render(http.StatusOK, "user_groups_view", map[string]interface{}{
-		"Title":       user.Username + " - Groups",
-		"Memberships": ms,
+		"Title":         user.Username + " - Groups",
+		"Memberships":   ms,
+		"DeletedGroups": deleted,
 	})
 }
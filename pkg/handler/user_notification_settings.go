@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/memberships"
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type SubmitNotificationSettings struct {
+	MutedTypes     []api.NotificationType `form:"mutedTypes"`
+	MutedGroups    []string               `form:"mutedGroups"`
+	EmailFrequency api.EmailFrequency     `form:"emailFrequency"`
+}
+
+// handleUserNotificationSettings lets the user mute the notifications of
+// some types, or about some groups, and choose how often they are emailed
+func (h *Handler) handleUserNotificationSettings(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	var userMemberships []*api.Membership
+	if err := h.membershipStore.Find(&userMemberships, &memberships.GetMembershipsOptions{
+		UserID:  &user.ID,
+		Preload: []string{"Group"},
+	}); err != nil {
+		return err
+	}
+
+	if c.Request().Method == http.MethodPost {
+
+		var payload SubmitNotificationSettings
+		if err := c.Bind(&payload); err != nil {
+			return err
+		}
+
+		if !payload.EmailFrequency.IsValid() {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid email frequency %q", payload.EmailFrequency))
+		}
+		mutes, err := newNotificationMutes(userMemberships, payload.MutedTypes, payload.MutedGroups)
+		if err != nil {
+			return err
+		}
+		if err := h.notificationStore.SetMutes(user.ID, mutes); err != nil {
+			return err
+		}
+		if err := h.emailStore.SetFrequency(user.ID, payload.EmailFrequency); err != nil {
+			return err
+		}
+
+		if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+			Class:   "alert-success",
+			Message: "Successfully saved notification settings",
+		}); err != nil {
+			return err
+		}
+
+		c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/users/%s/notifications/settings", c.Scheme(), c.Request().Host, user.ID))
+		c.Response().WriteHeader(http.StatusSeeOther)
+		return nil
+	}
+
+	mutes, err := h.notificationStore.GetMutes(user.ID)
+	if err != nil {
+		return err
+	}
+	emailPreference, err := h.emailStore.GetPreference(user.ID)
+	if err != nil {
+		return err
+	}
+	mutedTypes := map[api.NotificationType]bool{}
+	mutedGroups := map[string]bool{}
+	for _, mute := range mutes {
+		if mute.Type != "" {
+			mutedTypes[mute.Type] = true
+		}
+		if mute.GroupID != "" {
+			mutedGroups[mute.GroupID] = true
+		}
+	}
+
+	return c.Render(http.StatusOK, "user_notification_settings", map[string]interface{}{
+		"Title":            "Notification settings",
+		"Types":            api.NotificationTypes,
+		"Memberships":      userMemberships,
+		"MutedTypes":       mutedTypes,
+		"MutedGroups":      mutedGroups,
+		"EmailFrequencies": api.EmailFrequencies,
+		"EmailFrequency":   emailPreference.Frequency,
+	})
+}
+
+// newNotificationMutes validates the muted types and groups. Only the groups
+// of the user can be muted
+func newNotificationMutes(userMemberships []*api.Membership, mutedTypes []api.NotificationType, mutedGroups []string) ([]*api.NotificationMute, error) {
+
+	groupIDs := map[string]bool{}
+	for _, membership := range userMemberships {
+		groupIDs[membership.GroupID] = true
+	}
+
+	var mutes []*api.NotificationMute
+	seenTypes := map[api.NotificationType]bool{}
+	for _, notificationType := range mutedTypes {
+		if !notificationType.IsValid() {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid notification type %q", notificationType))
+		}
+		if seenTypes[notificationType] {
+			continue
+		}
+		seenTypes[notificationType] = true
+		mutes = append(mutes, &api.NotificationMute{Type: notificationType})
+	}
+	for _, groupID := range utils.UniqueStrings(mutedGroups) {
+		if !groupIDs[groupID] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "only the notifications of your groups can be muted")
+		}
+		mutes = append(mutes, &api.NotificationMute{GroupID: groupID})
+	}
+	return mutes, nil
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) handleUserNotificationsRead(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.MarkAllRead(user.ID); err != nil {
+		return err
+	}
+
+	return h.redirectToNotifications(c, user.ID)
+}
+
+func (h *Handler) handleUserNotificationsClear(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.ClearNotifications(user.ID); err != nil {
+		return err
+	}
+
+	return h.redirectToNotifications(c, user.ID)
+}
+
+func (h *Handler) handleUserNotificationRead(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.MarkRead(user.ID, c.Param("NotificationID")); err != nil {
+		return err
+	}
+
+	return h.redirectToNotifications(c, user.ID)
+}
+
+func (h *Handler) handleUserNotificationDelete(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationStore.DeleteNotification(user.ID, c.Param("NotificationID")); err != nil {
+		return err
+	}
+
+	return h.redirectToNotifications(c, user.ID)
+}
+
+func (h *Handler) redirectToNotifications(c echo.Context, userID string) error {
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/users/%s/notifications", c.Scheme(), c.Request().Host, userID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
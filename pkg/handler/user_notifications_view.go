@@ -7,21 +7,17 @@ import (
 
 func (h *Handler) handleGetUserNotifications(c echo.Context) error {
 
-	user, err := h.getUser(c)
+	authenticatedUser, err := h.getAuthenticatedUser(c)
 	if err != nil {
 		return err
 	}
 
-	authenticatedUser, err := h.getAuthenticatedUser(c)
+	page, err := h.getPage(c)
 	if err != nil {
 		return err
 	}
 
-	if authenticatedUser.ID != user.ID {
-		return echo.ErrForbidden
-	}
-
-	notifications, err := h.notificationStore.GetNotifications(authenticatedUser.ID)
+	notifications, next, err := h.notificationStore.GetNotifications(authenticatedUser.ID, page)
 	if err != nil {
 		return err
 	}
@@ -29,5 +25,6 @@ func (h *Handler) handleGetUserNotifications(c echo.Context) error {
 	return c.Render(http.StatusOK, "user_notifications_view", map[string]interface{}{
 		"Title": "Hello",
 		"Notifications": notifications,
+		"NextLink": h.nextPageLink(c, next),
 	})
 }
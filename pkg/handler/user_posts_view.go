@@ -1,6 +1,7 @@
 package handler
 
 import (
+	posts2 "cp/pkg/posts"
 	"github.com/labstack/echo/v4"
 	"net/http"
 )
@@ -11,13 +12,19 @@ func (h *Handler) handleGetUserPosts(c echo.Context) error {
 		return err
 	}
 
-	posts, err := h.postStore.GetByAuthor(user.ID)
+	page, err := h.getPage(c)
+	if err != nil {
+		return err
+	}
+
+	posts, next, err := h.postStore.GetByAuthor(user.ID, &posts2.FindPostsOptions{Page: page})
 	if err != nil {
 		return err
 	}
 
 	return c.Render(http.StatusOK, "user_posts_view", map[string]interface{}{
-		"Title": "Hello",
-		"Posts": posts,
+		"Title":    "Hello",
+		"Posts":    posts,
+		"NextLink": h.nextPageLink(c, next),
 	})
 }
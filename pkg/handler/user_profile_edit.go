@@ -1,17 +1,13 @@
 package handler
 
 import (
+	"cp/pkg/images"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
-	"github.com/nfnt/resize"
 	uuid "github.com/satori/go.uuid"
 	"image"
-	"image/draw"
-	_ "image/gif"
-	"image/jpeg"
-	_ "image/png"
 	"net/http"
-	"os"
 )
 
 type SubmitUserProfile struct {
@@ -28,20 +24,11 @@ func (h *Handler) handleEditUserProfile(c echo.Context) error {
 		})
 	}
 
-	authenticatedUser, err := h.getAuthenticatedUser(c)
-	if err != nil {
-		return err
-	}
-
 	user, err := h.getUser(c)
 	if err != nil {
 		return err
 	}
 
-	if authenticatedUser.ID != user.ID {
-		return echo.ErrForbidden
-	}
-
 	var payload SubmitUserProfile
 	if err := c.Bind(&payload); err != nil {
 		return err
@@ -61,69 +48,20 @@ func (h *Handler) handleEditUserProfile(c echo.Context) error {
 		defer src.Close()
 
 		img, _, err := image.Decode(src)
-		if err != nil {
-			return err
-		}
-
-		uploadDir := os.Getenv("PUBLIC_DIR")
-		if uploadDir == "" {
-			uploadDir = "public"
-		}
-
-		id := uuid.NewV4().String()
-		imgPath := fmt.Sprintf("%s/images/users/%s/%s", uploadDir, user.ID, id)
-		if err := os.MkdirAll(imgPath, 0700); err != nil {
-			return err
+		if errors.Is(err, image.ErrFormat) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s is not an image", file.Filename))
 		}
-
-		imgDest, err := os.Create(fmt.Sprintf("%s/full.jpg", imgPath))
 		if err != nil {
 			return err
 		}
-		defer imgDest.Close()
-		resized := resize.Thumbnail(400, 400, img, resize.Lanczos3)
-		if err := jpeg.Encode(imgDest, resized, &jpeg.Options{
-			Quality: 60,
-		}); err != nil {
-			return err
-		}
 
-		bounds := img.Bounds()
-		size := bounds.Size()
-		var min int
-		var offsetX int
-		var offsetY int
-		if size.X < size.Y {
-			min = size.X
-			offsetX = 0
-			offsetY = (size.Y - size.X) / 2
-		} else {
-			min = size.Y
-			offsetY = 0
-			offsetX = (size.X - size.Y) / 2
-		}
-		thumbR := image.Rect(0, 0, min, min)
-		thumb := image.NewRGBA(thumbR)
-		draw.Draw(thumb, thumbR, img, image.Point{
-			X: offsetX,
-			Y: offsetY,
-		}, draw.Src)
-		thumbDest, err := os.Create(fmt.Sprintf("%s/thumb.jpg", imgPath))
-		if err != nil {
-			return err
-		}
-		defer thumbDest.Close()
-		resized = resize.Thumbnail(60, 60, thumb, resize.Lanczos3)
-		if err := jpeg.Encode(thumbDest, resized, &jpeg.Options{
-			Quality: 60,
-		}); err != nil {
+		id := uuid.NewV4().String()
+		if err := images.PutProfilePicture(h.blobStore, user.ID, id, img); err != nil {
 			return err
 		}
 
 		if user.ProfilePictureID != "" {
-			_ = os.Remove(fmt.Sprintf("%s", fmt.Sprintf("%s/images/users/%s/%s/full.jpg", uploadDir, user.ID, user.ProfilePictureID)))
-			_ = os.Remove(fmt.Sprintf("%s", fmt.Sprintf("%s/images/users/%s/%s/thumb.jpg", uploadDir, user.ID, user.ProfilePictureID)))
-			_ = os.Remove(fmt.Sprintf("%s", fmt.Sprintf("%s/images/users/%s/%s", uploadDir, user.ID, user.ProfilePictureID)))
+			_ = images.DeleteProfilePicture(h.blobStore, user.ID, user.ProfilePictureID)
 		}
 
 		user.ProfilePictureID = id
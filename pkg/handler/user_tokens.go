@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/utils"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type SubmitToken struct {
+	Name  string         `form:"name"`
+	Scope api.TokenScope `form:"scope"`
+}
+
+func (h *Handler) handleUserTokens(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	var rawToken string
+
+	if c.Request().Method == http.MethodPost {
+
+		var payload SubmitToken
+		if err := c.Bind(&payload); err != nil {
+			return err
+		}
+
+		if payload.Name == "" {
+			return echo.ErrBadRequest
+		}
+		if payload.Scope != api.ReadScope && payload.Scope != api.WriteScope {
+			return echo.ErrBadRequest
+		}
+
+		_, rawToken, err = h.tokenStore.Create(user.ID, payload.Name, payload.Scope)
+		if err != nil {
+			return err
+		}
+
+	}
+
+	tokens, err := h.tokenStore.GetByUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	// The raw token is rendered directly instead of redirecting, so that it
+	// is never stored in the session
+	return c.Render(http.StatusOK, "user_tokens_view", map[string]interface{}{
+		"Title":    "Hello",
+		"Tokens":   tokens,
+		"NewToken": rawToken,
+	})
+}
+
+func (h *Handler) handleUserTokenRevoke(c echo.Context) error {
+
+	user, err := h.getUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.tokenStore.Revoke(user.ID, c.Param("TokenID")); err != nil {
+		return err
+	}
+
+	if err := h.alertManager.AddAlert(c.Request(), c.Response().Writer, utils.Alert{
+		Class:   "alert-success",
+		Message: "Successfully revoked token",
+	}); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Location", fmt.Sprintf("%s://%s/users/%s/tokens", c.Scheme(), c.Request().Host, user.ID))
+	c.Response().WriteHeader(http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,62 @@
+package images
+
+import (
+	"cp/pkg/blobs"
+	"fmt"
+	"github.com/nfnt/resize"
+	"image"
+	"image/draw"
+)
+
+// ProfilePictureKey returns the key of a size of a profile picture, full or
+// thumb
+func ProfilePictureKey(userID string, pictureID string, size string) string {
+	return fmt.Sprintf("images/users/%s/%s/%s.jpg", userID, pictureID, size)
+}
+
+// IsProfilePictureSize returns true if name is a size of the profile
+// pictures
+func IsProfilePictureSize(name string) bool {
+	return name == "full" || name == "thumb"
+}
+
+// PutProfilePicture writes the sizes of a profile picture. The thumb is the
+// center square of the picture
+func PutProfilePicture(store blobs.Store, userID string, pictureID string, img image.Image) error {
+	full := resize.Thumbnail(400, 400, img, resize.Lanczos3)
+	if err := PutJPEG(store, ProfilePictureKey(userID, pictureID, "full"), full); err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	size := bounds.Size()
+	var min int
+	var offsetX int
+	var offsetY int
+	if size.X < size.Y {
+		min = size.X
+		offsetX = 0
+		offsetY = (size.Y - size.X) / 2
+	} else {
+		min = size.Y
+		offsetY = 0
+		offsetX = (size.X - size.Y) / 2
+	}
+	thumbR := image.Rect(0, 0, min, min)
+	thumb := image.NewRGBA(thumbR)
+	draw.Draw(thumb, thumbR, img, image.Point{
+		X: bounds.Min.X + offsetX,
+		Y: bounds.Min.Y + offsetY,
+	}, draw.Src)
+	return PutJPEG(store, ProfilePictureKey(userID, pictureID, "thumb"), resize.Thumbnail(60, 60, thumb, resize.Lanczos3))
+}
+
+// DeleteProfilePicture removes the sizes of a profile picture
+func DeleteProfilePicture(store blobs.Store, userID string, pictureID string) error {
+	for _, size := range []string{"full", "thumb"} {
+		if err := store.Delete(ProfilePictureKey(userID, pictureID, size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package images
+
+import (
+	"bytes"
+	"cp/pkg/api"
+	"cp/pkg/blobs"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/nfnt/resize"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// sizes are the widths of the resized post images, by directory. A width of
+// zero keeps the size of the upload
+var sizes = []struct {
+	Name  string
+	Width uint
+}{
+	{"full", 0},
+	{"medium", 400},
+	{"thumb", 160},
+}
+
+// Key returns the key of a size of a post image
+func Key(size string, img *api.Image) string {
+	return fmt.Sprintf("images/%s/groups/%s/posts/%s/%s.jpg", size, img.GroupID, img.PostID, img.ID)
+}
+
+// URL returns the path of a size of a post image on the site
+func URL(size string, img *api.Image) string {
+	return "/" + Key(size, img)
+}
+
+// UploadKey returns the key where an uploaded post image is kept until it
+// is resized
+func UploadKey(img *api.Image) string {
+	return fmt.Sprintf("images/uploads/groups/%s/posts/%s/%s", img.GroupID, img.PostID, img.ID)
+}
+
+// GroupDirs returns the directories of the images of a group, for all the
+// sizes and the uploads
+func GroupDirs(groupID string) []string {
+	var dirs []string
+	for _, size := range append(Sizes(), "uploads") {
+		dirs = append(dirs, fmt.Sprintf("images/%s/groups/%s", size, groupID))
+	}
+	return dirs
+}
+
+// PostDirs returns the directories of the images of a post, for all the
+// sizes and the uploads
+func PostDirs(groupID string, postID string) []string {
+	var dirs []string
+	for _, dir := range GroupDirs(groupID) {
+		dirs = append(dirs, fmt.Sprintf("%s/posts/%s", dir, postID))
+	}
+	return dirs
+}
+
+// Sizes returns the names of the sizes of the post images
+func Sizes() []string {
+	var names []string
+	for _, size := range sizes {
+		names = append(names, size.Name)
+	}
+	return names
+}
+
+// IsSize returns true if name is a size of the post images
+func IsSize(name string) bool {
+	for _, size := range sizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Upload checks that src is an image, and keeps it until it is resized
+func Upload(store blobs.Store, img *api.Image, src io.ReadSeeker) error {
+	if _, _, err := image.DecodeConfig(src); err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return store.Put(UploadKey(img), src, "application/octet-stream")
+}
+
+// Resize writes the sizes of an uploaded post image, then removes the
+// upload. Images whose upload was already resized are skipped
+func Resize(store blobs.Store, img *api.Image) error {
+	src, _, err := store.Get(UploadKey(img))
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	decoded, _, err := image.Decode(src)
+	if err != nil {
+		return err
+	}
+
+	for _, size := range sizes {
+		resized := decoded
+		if size.Width > 0 {
+			resized = resize.Resize(size.Width, 0, decoded, resize.Lanczos3)
+		}
+		if err := PutJPEG(store, Key(size.Name, img), resized); err != nil {
+			return err
+		}
+	}
+
+	src.Close()
+	return store.Delete(UploadKey(img))
+}
+
+// Delete removes all the sizes of a post image, and its upload
+func Delete(store blobs.Store, img *api.Image) error {
+	for _, size := range sizes {
+		if err := store.Delete(Key(size.Name, img)); err != nil {
+			return err
+		}
+	}
+	return store.Delete(UploadKey(img))
+}
+
+// PutJPEG encodes an image as a JPEG blob
+func PutJPEG(store blobs.Store, key string, img image.Image) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{
+		Quality: 60,
+	}); err != nil {
+		return err
+	}
+	return store.Put(key, &buf, "image/jpeg")
+}
@@ -0,0 +1,64 @@
+package images
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidSignature = echo.NewHTTPError(http.StatusForbidden, "the image link is invalid or expired")
+
+// URLSigner signs the URLs of the images, so that they can be embedded
+// where the viewer cannot authenticate, such as the image tags of the API
+// clients. A signed URL is valid until it expires, for anyone who has it
+type URLSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewURLSigner signs the URLs with the secret, for at least ttl. The
+// replicas of the server must share the secret
+func NewURLSigner(secret []byte, ttl time.Duration) *URLSigner {
+	return &URLSigner{secret: secret, ttl: ttl}
+}
+
+// Sign returns the path with its expiry and signature in the query. The
+// expiry is rounded, so that the URL of an image stays the same for a
+// while and can be cached by the clients. The URL is valid for ttl to twice
+// ttl
+func (s *URLSigner) Sign(path string) string {
+	expires := time.Now().Truncate(s.ttl).Add(2 * s.ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(path, expires))
+	return path + "?" + query.Encode()
+}
+
+// IsSigned returns true if the URL carries a signature, valid or not
+func IsSigned(u *url.URL) bool {
+	return u.Query().Get("signature") != ""
+}
+
+// Verify checks that a URL was signed, and did not expire
+func (s *URLSigner) Verify(u *url.URL) error {
+	query := u.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(s.signature(u.Path, expires))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(path string, expires int64) string {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,303 @@
+// Package importer imports the members, posts and historical transfers of
+// a group from CSV files.
+//
+// Every kind of row is imported from its own file, whose first line names
+// the columns. Rows are identified by a deterministic ID derived from the
+// group, the kind and either the id column or the content of the row, so
+// that importing the same file twice does not duplicate anything.
+package importer
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/snapshots"
+	"cp/pkg/users"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKind   = errors.New("invalid import kind")
+	ErrInvalidHeader = errors.New("invalid csv header")
+	ErrGroupNotFound = errors.New("group not found")
+
+	// errRollback discards the writes of dry runs and failed imports
+	errRollback = errors.New("rollback")
+
+	namespace = uuid.FromStringOrNil("6b2f3c1e-8d4a-5b7e-9f10-2a3c4d5e6f70")
+)
+
+type Kind string
+
+const (
+	Members          Kind = "members"
+	Posts            Kind = "posts"
+	Credits          Kind = "credits"
+	Acknowledgements Kind = "acknowledgements"
+)
+
+var AllKinds = []Kind{Members, Posts, Credits, Acknowledgements}
+
+func (k Kind) IsValid() bool {
+	for _, kind := range AllKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Columns returns the columns accepted in the files of this kind. The
+// required columns come first
+func (k Kind) Columns() []string {
+	return kinds[k].columns()
+}
+
+type Action string
+
+const (
+	Created Action = "created"
+	Skipped Action = "skipped"
+	Invalid Action = "invalid"
+)
+
+// Result is the outcome of a single row. Line is the number of the record
+// in the file, the header being the first one
+type Result struct {
+	Line    int
+	Action  Action
+	ID      string
+	Message string
+}
+
+type Options struct {
+	// DryRun validates the rows and reports what would be created without
+	// writing anything
+	DryRun bool
+	// MaxPermission is the highest permission members can be imported
+	// with. It is not limited when empty
+	MaxPermission api.MembershipPermission
+}
+
+type Report struct {
+	Kind    Kind
+	DryRun  bool
+	Results []*Result
+	Created int
+	Skipped int
+	Invalid int
+}
+
+// Committed returns true if the rows of the report were written. Nothing is
+// written by dry runs, nor when any row is invalid
+func (r *Report) Committed() bool {
+	return !r.DryRun && r.Invalid == 0
+}
+
+func (r *Report) add(line int, action Action, id string, message string) {
+	r.Results = append(r.Results, &Result{
+		Line:    line,
+		Action:  action,
+		ID:      id,
+		Message: message,
+	})
+	switch action {
+	case Created:
+		r.Created++
+	case Skipped:
+		r.Skipped++
+	case Invalid:
+		r.Invalid++
+	}
+}
+
+type Importer struct {
+	db *gorm.DB
+}
+
+func NewImporter(db *gorm.DB) *Importer {
+	return &Importer{db: db}
+}
+
+// Import reads the rows of the given kind and adds them to the group. All
+// the rows are imported in a single transaction: if any row is invalid,
+// nothing is written and the report lists the errors
+func (i *Importer) Import(groupID string, kind Kind, r io.Reader, options Options) (*Report, error) {
+	definition, ok := kinds[kind]
+	if !ok {
+		return nil, ErrInvalidKind
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidHeader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns, err := definition.parseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Kind:   kind,
+		DryRun: options.DryRun,
+	}
+
+	err = i.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&api.Group{}).Where("id = ?", groupID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrGroupNotFound
+		}
+
+		s := &session{
+			tx:        tx,
+			groupID:   groupID,
+			kind:      kind,
+			options:   options,
+			userStore: users.NewUserStore(tx),
+			users:     map[string]*api.User{},
+		}
+
+		for line := 2; ; line++ {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				report.add(line, Invalid, "", parseErr.Err.Error())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if isBlank(record) {
+				continue
+			}
+			id, err := definition.importRow(s, newRow(columns, record))
+			if errors.Is(err, errExists) {
+				report.add(line, Skipped, id, "already imported")
+				continue
+			}
+			var rowErr *rowError
+			if errors.As(err, &rowErr) {
+				report.add(line, Invalid, id, rowErr.Error())
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			report.add(line, Created, id, "")
+		}
+
+		if !report.Committed() {
+			return errRollback
+		}
+
+		if !s.since.IsZero() {
+			// Cached history snapshots are computed from the rows
+			// present when they were taken
+			if err := snapshots.NewSnapshotStore(tx).DeleteFrom(groupID, s.since); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// session holds the state shared by the rows of an import
+type session struct {
+	tx        *gorm.DB
+	groupID   string
+	kind      Kind
+	options   Options
+	userStore users.Store
+	users     map[string]*api.User
+	// since is the time of the oldest row created by the import
+	since time.Time
+}
+
+// id returns the deterministic ID of a row. It is derived from the id
+// column when present, or else from all the values of the row
+func (s *session) id(r row) string {
+	key := r.get("id")
+	if key == "" {
+		key = strings.Join(r.record, "\x1f")
+	}
+	return uuid.NewV5(namespace, strings.Join([]string{s.groupID, string(s.kind), key}, "\x1e")).String()
+}
+
+// user returns the user with the given email. Users are identified by their
+// sign in provider, so they must have signed in at least once to be found
+func (s *session) user(column string, email string) (*api.User, error) {
+	if email == "" {
+		return nil, invalidf("%s is required", column)
+	}
+	key := strings.ToLower(email)
+	if user, ok := s.users[key]; ok {
+		return user, nil
+	}
+	user, err := s.userStore.GetByEmail(email)
+	if errors.Is(err, echo.ErrNotFound) {
+		return nil, invalidf("%s: no user with email %s, users must sign in once before being imported", column, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.users[key] = user
+	return user, nil
+}
+
+// target returns the account owner with the given email, or the group when
+// the email is empty
+func (s *session) target(column string, email string) (*api.Target, error) {
+	if email == "" {
+		groupID := s.groupID
+		return &api.Target{
+			GroupID: &groupID,
+			Type:    api.GroupTarget,
+		}, nil
+	}
+	user, err := s.user(column, email)
+	if err != nil {
+		return nil, err
+	}
+	userID := user.ID
+	return &api.Target{
+		UserID: &userID,
+		Type:   api.UserTarget,
+	}, nil
+}
+
+func (s *session) created(at time.Time) {
+	if s.since.IsZero() || at.Before(s.since) {
+		s.since = at
+	}
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,364 @@
+package importer
+
+import (
+	"cp/pkg/acknowledgements"
+	"cp/pkg/api"
+	"cp/pkg/events"
+	"cp/pkg/ledger"
+	"cp/pkg/memberships"
+	"cp/pkg/posts"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// errExists is returned for the rows that were already imported
+var errExists = errors.New("row already exists")
+
+// rowError is the validation error of a single row. It is reported
+// instead of aborting the import
+type rowError struct {
+	message string
+}
+
+func (e *rowError) Error() string {
+	return e.message
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &rowError{message: fmt.Sprintf(format, args...)}
+}
+
+type row struct {
+	columns map[string]int
+	record  []string
+}
+
+func newRow(columns map[string]int, record []string) row {
+	return row{columns: columns, record: record}
+}
+
+func (r row) get(column string) string {
+	index, ok := r.columns[column]
+	if !ok || index >= len(r.record) {
+		return ""
+	}
+	return strings.TrimSpace(r.record[index])
+}
+
+// definition describes the columns of a kind of file, and how its rows are
+// imported. importRow returns the ID of the row along with errExists when it
+// was already imported, or a rowError when it is invalid
+type definition struct {
+	required  []string
+	optional  []string
+	importRow func(s *session, r row) (string, error)
+}
+
+func (d definition) columns() []string {
+	return append(append([]string{}, d.required...), d.optional...)
+}
+
+func (d definition) parseHeader(header []string) (map[string]int, error) {
+	allowed := map[string]bool{}
+	for _, column := range d.columns() {
+		allowed[column] = true
+	}
+	result := map[string]int{}
+	for index, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !allowed[column] {
+			return nil, fmt.Errorf("%w: unknown column %q, expected %s", ErrInvalidHeader, column, strings.Join(d.columns(), ", "))
+		}
+		if _, ok := result[column]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidHeader, column)
+		}
+		result[column] = index
+	}
+	for _, column := range d.required {
+		if _, ok := result[column]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidHeader, column)
+		}
+	}
+	return result, nil
+}
+
+var kinds = map[Kind]definition{
+	Members: {
+		required:  []string{"email"},
+		optional:  []string{"permission", "joined_at"},
+		importRow: importMember,
+	},
+	Posts: {
+		required:  []string{"author_email", "type"},
+		optional:  []string{"id", "title", "description", "value_from", "value_to", "created_at"},
+		importRow: importPost,
+	},
+	Credits: {
+		required:  []string{"amount"},
+		optional:  []string{"id", "from_email", "to_email", "notes", "created_at"},
+		importRow: importCredits,
+	},
+	Acknowledgements: {
+		required:  []string{"type"},
+		optional:  []string{"id", "from_email", "to_email", "notes", "created_at"},
+		importRow: importAcknowledgement,
+	},
+}
+
+func importMember(s *session, r row) (string, error) {
+	user, err := s.user("email", r.get("email"))
+	if err != nil {
+		return "", err
+	}
+
+	permission := api.MembershipPermission(strings.ToLower(r.get("permission")))
+	switch permission {
+	case "":
+		permission = api.Member
+	case api.Member, api.Admin, api.Owner:
+	default:
+		return user.ID, invalidf("invalid permission %q", permission)
+	}
+	if s.options.MaxPermission != "" && !s.options.MaxPermission.Gte(permission) {
+		return user.ID, invalidf("cannot import members with the %s permission", permission)
+	}
+
+	joinedAt, err := parseTime("joined_at", r.get("joined_at"))
+	if err != nil {
+		return user.ID, err
+	}
+
+	var count int64
+	if err := s.tx.
+		Model(&api.Membership{}).
+		Where("group_id = ? and user_id = ?", s.groupID, user.ID).
+		Count(&count).
+		Error; err != nil {
+		return user.ID, err
+	}
+	if count > 0 {
+		return user.ID, errExists
+	}
+
+	// the import may be rolled back, the new members are not told
+	return user.ID, memberships.NewMembershipStore(s.tx, events.Discard).Create(&api.Membership{
+		GroupID:         s.groupID,
+		UserID:          user.ID,
+		Permission:      permission,
+		MemberConfirmed: true,
+		GroupConfirmed:  true,
+		CreatedAt:       joinedAt,
+	})
+}
+
+func importPost(s *session, r row) (string, error) {
+	id := s.id(r)
+
+	author, err := s.user("author_email", r.get("author_email"))
+	if err != nil {
+		return id, err
+	}
+
+	postType := api.PostType(strings.ToLower(r.get("type")))
+	description := r.get("description")
+	var valueFrom, valueTo *time.Duration
+	switch postType {
+	case api.OfferPost, api.RequestPost:
+		from, err := parseDuration("value_from", r.get("value_from"))
+		if err != nil {
+			return id, err
+		}
+		to, err := parseDuration("value_to", r.get("value_to"))
+		if err != nil {
+			return id, err
+		}
+		if from < 0 {
+			return id, invalidf("value_from cannot be negative")
+		}
+		if to < from {
+			return id, invalidf("value_to cannot be smaller than value_from")
+		}
+		valueFrom, valueTo = &from, &to
+	case api.CommentPost:
+		if description == "" {
+			return id, invalidf("description is required for comments")
+		}
+	default:
+		return id, invalidf("invalid post type %q", postType)
+	}
+
+	createdAt, err := parseTime("created_at", r.get("created_at"))
+	if err != nil {
+		return id, err
+	}
+
+	var count int64
+	if err := s.tx.Unscoped().Model(&api.Post{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return id, err
+	}
+	if count > 0 {
+		return id, errExists
+	}
+
+	if err := posts.NewPostStore(s.tx).Create(&api.Post{
+		ID:          id,
+		GroupID:     s.groupID,
+		AuthorID:    author.ID,
+		Title:       r.get("title"),
+		Description: description,
+		Type:        postType,
+		ValueFrom:   valueFrom,
+		ValueTo:     valueTo,
+		CreatedAt:   createdAt,
+	}); err != nil {
+		return id, err
+	}
+	s.created(createdAt)
+	return id, nil
+}
+
+func importCredits(s *session, r row) (string, error) {
+	id := s.id(r)
+
+	from, to, err := s.parties(r)
+	if err != nil {
+		return id, err
+	}
+
+	amount, err := parseDuration("amount", r.get("amount"))
+	if err != nil {
+		return id, err
+	}
+	if amount <= 0 {
+		return id, invalidf("amount must be greater than zero")
+	}
+
+	createdAt, err := parseTime("created_at", r.get("created_at"))
+	if err != nil {
+		return id, err
+	}
+
+	var count int64
+	if err := s.tx.Model(&api.JournalEntry{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return id, err
+	}
+	if count > 0 {
+		return id, errExists
+	}
+
+	if err := ledger.ImportWithin(s.tx, &api.JournalEntry{
+		ID:        id,
+		GroupID:   s.groupID,
+		Notes:     r.get("notes"),
+		CreatedAt: createdAt,
+	}, from, to, amount); err != nil {
+		return id, err
+	}
+	s.created(createdAt)
+	return id, nil
+}
+
+func importAcknowledgement(s *session, r row) (string, error) {
+	id := s.id(r)
+
+	from, to, err := s.parties(r)
+	if err != nil {
+		return id, err
+	}
+
+	acknowledgementType := api.AcknowledgementType(strings.ToLower(r.get("type")))
+	switch acknowledgementType {
+	case api.ThanksObjectGift, api.ThanksServiceGift, api.ThanksObjectLent, api.Other:
+	default:
+		return id, invalidf("invalid acknowledgement type %q", acknowledgementType)
+	}
+
+	createdAt, err := parseTime("created_at", r.get("created_at"))
+	if err != nil {
+		return id, err
+	}
+
+	var count int64
+	if err := s.tx.Model(&api.Acknowledgement{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return id, err
+	}
+	if count > 0 {
+		return id, errExists
+	}
+
+	if err := acknowledgements.NewAcknowledgementStore(s.tx).Save(&api.Acknowledgement{
+		ID:        id,
+		GroupID:   s.groupID,
+		SentBy:    from,
+		SentTo:    to,
+		Type:      acknowledgementType,
+		Notes:     r.get("notes"),
+		CreatedAt: createdAt,
+	}); err != nil {
+		return id, err
+	}
+	s.created(createdAt)
+	return id, nil
+}
+
+// parties returns the sender and the recipient of a row. An empty email
+// designates the group itself
+func (s *session) parties(r row) (*api.Target, *api.Target, error) {
+	fromEmail, toEmail := r.get("from_email"), r.get("to_email")
+	if fromEmail == "" && toEmail == "" {
+		return nil, nil, invalidf("from_email and to_email cannot both be the group")
+	}
+	if strings.EqualFold(fromEmail, toEmail) {
+		return nil, nil, invalidf("from_email and to_email must be different")
+	}
+	from, err := s.target("from_email", fromEmail)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := s.target("to_email", toEmail)
+	if err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses the original time of a row. Times without a zone are
+// UTC, and an empty value is the current time
+func parseTime(column string, value string) (time.Time, error) {
+	now := time.Now()
+	if value == "" {
+		return now, nil
+	}
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		if t.After(now) {
+			return time.Time{}, invalidf("%s cannot be in the future", column)
+		}
+		return t, nil
+	}
+	return time.Time{}, invalidf("invalid %s %q, expected a date such as 2006-01-02 or 2006-01-02T15:04:05Z", column, value)
+}
+
+func parseDuration(column string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, invalidf("%s is required", column)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, invalidf("invalid %s %q, expected a duration such as 1h30m", column, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,226 @@
+package invitations
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/events"
+	"cp/pkg/memberships"
+	"crypto/rand"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// codeAlphabet leaves out characters that are easily confused when a code
+// is read aloud or typed by hand
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const codeLength = 8
+
+var (
+	ErrInvalidInvitation = errors.New("invitation is expired, revoked, already used up, or its group is closed")
+	ErrAlreadyMember     = errors.New("already a member of the group")
+)
+
+type Store interface {
+	Create(groupID string, createdByID string, maxUses int, expiresAt *time.Time) (*api.Invitation, error)
+	Get(groupID string, invitationID string) (*api.Invitation, error)
+	GetByCode(code string) (*api.Invitation, error)
+	GetForGroup(groupID string) ([]*api.Invitation, error)
+	Revoke(groupID string, invitationID string) error
+	Redeem(code string, userID string) (*api.Membership, error)
+}
+
+type InvitationStore struct {
+	db     *gorm.DB
+	events events.Publisher
+}
+
+func NewInvitationStore(db *gorm.DB, publisher events.Publisher) *InvitationStore {
+	return &InvitationStore{
+		db:     db,
+		events: publisher,
+	}
+}
+
+var _ Store = &InvitationStore{}
+
+func (s *InvitationStore) Create(groupID string, createdByID string, maxUses int, expiresAt *time.Time) (*api.Invitation, error) {
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+	invitation := &api.Invitation{
+		ID:          uuid.NewV4().String(),
+		GroupID:     groupID,
+		CreatedByID: createdByID,
+		Code:        code,
+		MaxUses:     maxUses,
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.db.Omit("Group", "CreatedBy").Create(invitation).Error; err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (s *InvitationStore) Get(groupID string, invitationID string) (*api.Invitation, error) {
+	var result api.Invitation
+	err := s.db.
+		Preload("Group").
+		Preload("CreatedBy").
+		Model(&api.Invitation{}).
+		First(&result, "group_id = ? and id = ?", groupID, invitationID).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *InvitationStore) GetByCode(code string) (*api.Invitation, error) {
+	var result api.Invitation
+	err := s.db.
+		Preload("Group").
+		Preload("CreatedBy").
+		Model(&api.Invitation{}).
+		First(&result, "code = ?", NormalizeCode(code)).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *InvitationStore) GetForGroup(groupID string) ([]*api.Invitation, error) {
+	var result []*api.Invitation
+	if err := s.db.
+		Preload("CreatedBy").
+		Model(&api.Invitation{}).
+		Order("created_at desc").
+		Find(&result, "group_id = ?", groupID).
+		Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *InvitationStore) Revoke(groupID string, invitationID string) error {
+	result := s.db.
+		Model(&api.Invitation{}).
+		Where("id = ? and group_id = ? and revoked_at is null", invitationID, groupID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
+
+// Redeem uses the invitation for the user, and creates or confirms the
+// membership of the user in the group. The invitation use is only counted
+// when the membership changed.
+func (s *InvitationStore) Redeem(code string, userID string) (*api.Membership, error) {
+	var membership *api.Membership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+
+		var invitation api.Invitation
+		err := tx.Preload("Group").Model(&api.Invitation{}).First(&invitation, "code = ?", NormalizeCode(code)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !invitation.IsValid() {
+			return ErrInvalidInvitation
+		}
+		// nobody joins the archived and deleted groups
+		if invitation.Group == nil || invitation.Group.IsArchived() || invitation.Group.IsDeleted() {
+			return ErrInvalidInvitation
+		}
+
+		var existing api.Membership
+		err = tx.Model(&api.Membership{}).First(&existing, "group_id = ? and user_id = ?", invitation.GroupID, userID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && existing.IsActive() {
+			return ErrAlreadyMember
+		}
+
+		// The conditional update guards against concurrent redemptions
+		// using more than MaxUses
+		result := tx.Model(&api.Invitation{}).
+			Where("id = ? and revoked_at is null and (max_uses = 0 or uses < max_uses)", invitation.ID).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		if err == nil {
+			existing.GroupConfirmed = true
+			existing.MemberConfirmed = true
+			if existing.Permission == api.None {
+				existing.Permission = api.Member
+			}
+			if err := tx.Omit("Group", "User").Save(&existing).Error; err != nil {
+				return err
+			}
+			membership = &existing
+			return nil
+		}
+
+		membership = &api.Membership{
+			GroupID:         invitation.GroupID,
+			UserID:          userID,
+			Permission:      api.Member,
+			GroupConfirmed:  true,
+			MemberConfirmed: true,
+		}
+		return tx.Omit("Group", "User").Create(membership).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The membership is written within the transaction, so the event is
+	// published once it is committed
+	s.events.Publish(memberships.ChangedEvent(membership, false))
+	return membership, nil
+}
+
+// NormalizeCode makes codes case insensitive, and ignores the separators
+// people add when typing them
+func NormalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
+func generateCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,59 @@
+package invitations
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/events"
+	"errors"
+	uuid "github.com/satori/go.uuid"
+	"testing"
+)
+
+// recorder keeps the published events
+type recorder struct {
+	events []*events.Event
+}
+
+func (r *recorder) Publish(event *events.Event) {
+	r.events = append(r.events, event)
+}
+
+func TestRedeemPublishesMembership(t *testing.T) {
+	db := dbtest.Open(t)
+	publisher := &recorder{}
+	store := NewInvitationStore(db, publisher)
+
+	group := &api.Group{ID: uuid.NewV4().String(), Name: "Group"}
+	var users []*api.User
+	for _, name := range []string{"alice", "bob", "carol"} {
+		users = append(users, &api.User{ID: uuid.NewV4().String(), Username: name, Email: name + "@example.com"})
+	}
+	for _, value := range []interface{}{group, users} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	invitation, err := store.Create(group.ID, users[0].ID, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Redeem(invitation.Code, users[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.events) != 1 {
+		t.Fatalf("%d events, expected 1", len(publisher.events))
+	}
+	event := publisher.events[0]
+	if event.Type != events.MembershipChanged || event.Topic != events.UserTopic(users[1].ID) {
+		t.Fatalf("event %s on %s", event.Type, event.Topic)
+	}
+
+	// Nothing is published when the membership is not written
+	if _, err := store.Redeem(invitation.Code, users[2].ID); !errors.Is(err, ErrInvalidInvitation) {
+		t.Fatalf("redeem a used up invitation: %v", err)
+	}
+	if len(publisher.events) != 1 {
+		t.Fatalf("%d events, expected 1", len(publisher.events))
+	}
+}
@@ -0,0 +1,187 @@
+// Package jobs runs work in the background, out of the requests. The jobs
+// are stored in the database, so that they survive restarts and are shared
+// by the replicas of the server. A failed job is tried again later, and
+// moved to the dead jobs once it failed on every attempt.
+package jobs
+
+import (
+	"cp/pkg/api"
+	"encoding/json"
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a job is run before it is
+	// moved to the dead jobs
+	DefaultMaxAttempts = 5
+	// pollInterval is the time between two checks of the due jobs, for the
+	// retries and the jobs added by the other replicas
+	pollInterval = 5 * time.Second
+	// lockTimeout is the time after which a running job is assumed to be
+	// abandoned by its worker, and is claimed again
+	lockTimeout = 10 * time.Minute
+	// retention is the time the succeeded jobs are kept for the admin page
+	retention   = 7 * 24 * time.Hour
+	minBackoff  = 10 * time.Second
+	maxBackoff  = time.Hour
+	cleanPeriod = time.Hour
+)
+
+// Handler runs a job of a kind. The job is tried again later when an error
+// is returned, so handlers must be safe to run more than once
+type Handler func(job *api.Job) error
+
+type Runner struct {
+	store    Store
+	workers  int
+	lock     sync.RWMutex
+	handlers map[string]Handler
+	wake     chan struct{}
+}
+
+// NewRunner runs the jobs with the given number of workers
+func NewRunner(store Store, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Runner{
+		store:    store,
+		workers:  workers,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, workers),
+	}
+}
+
+// Handle sets the handler of the jobs of a kind
+func (r *Runner) Handle(kind string, handler Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handlers[kind] = handler
+}
+
+// Enqueue adds a job, run as soon as a worker is free. The payload is
+// encoded as json
+func (r *Runner) Enqueue(kind string, payload interface{}) error {
+	return r.EnqueueAt(kind, payload, time.Now())
+}
+
+// EnqueueAt adds a job run at the given time
+func (r *Runner) EnqueueAt(kind string, payload interface{}, runAt time.Time) error {
+	job, err := NewJob(kind, payload, runAt)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Create(job); err != nil {
+		return err
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// NewJob returns a pending job, for the writes adding a job with a store
+// built on their transaction. Workers pick it up on their next check
+func NewJob(kind string, payload interface{}, runAt time.Time) (*api.Job, error) {
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &api.Job{
+		ID:          uuid.NewV4().String(),
+		Kind:        kind,
+		Payload:     string(bytes),
+		Status:      api.JobPending,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// Run starts the workers, and removes the old succeeded jobs until the
+// process exits
+func (r *Runner) Run() {
+	for i := 0; i < r.workers; i++ {
+		go r.work()
+	}
+	ticker := time.NewTicker(cleanPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := r.store.DeleteSucceeded(time.Now().Add(-retention)); err != nil {
+			log.Printf("jobs: failed to delete the succeeded jobs: %v", err)
+		}
+	}
+}
+
+func (r *Runner) work() {
+	for {
+		job, err := r.store.Claim(lockTimeout)
+		if err != nil {
+			log.Printf("jobs: failed to claim a job: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-r.wake:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		r.run(job)
+	}
+}
+
+func (r *Runner) run(job *api.Job) {
+	err := r.call(job)
+	if err == nil {
+		if err := r.store.Complete(job); err != nil {
+			log.Printf("jobs: failed to complete %s job %s: %v", job.Kind, job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("jobs: %s job %s failed on attempt %d of %d: %v", job.Kind, job.ID, job.Attempts, job.MaxAttempts, err)
+	if job.Attempts >= job.MaxAttempts {
+		err = r.store.Bury(job, err.Error())
+	} else {
+		err = r.store.Retry(job, err.Error(), time.Now().Add(Backoff(job.Attempts)))
+	}
+	if err != nil {
+		log.Printf("jobs: failed to record the failure of %s job %s: %v", job.Kind, job.ID, err)
+	}
+}
+
+// call runs the handler of the job. A panic of the handler fails the job
+func (r *Runner) call(job *api.Job) (err error) {
+	r.lock.RLock()
+	handler, ok := r.handlers[job.Kind]
+	r.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler for %s jobs", job.Kind)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return handler(job)
+}
+
+// Backoff returns the time to wait before running a job again, after the
+// given number of attempts. It doubles on every attempt
+func Backoff(attempts int) time.Duration {
+	backoff := minBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,236 @@
+package jobs
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/pagination"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrLockLost is returned when recording the outcome of a job which was
+// claimed again meanwhile, its lock timed out
+var ErrLockLost = errors.New("the job was claimed again by another worker")
+
+type Store interface {
+	Create(job *api.Job) error
+	Get(jobID string) (*api.Job, error)
+	GetPage(status api.JobStatus, page *pagination.Page) ([]*api.Job, *pagination.Cursor, error)
+	CountByStatus() (map[api.JobStatus]int, error)
+	Claim(lockTimeout time.Duration) (*api.Job, error)
+	Complete(job *api.Job) error
+	Retry(job *api.Job, lastError string, runAt time.Time) error
+	Bury(job *api.Job, lastError string) error
+	Requeue(jobID string) error
+	Delete(jobID string) error
+	DeleteSucceeded(before time.Time) error
+}
+
+type JobStore struct {
+	db *gorm.DB
+}
+
+func NewJobStore(db *gorm.DB) *JobStore {
+	return &JobStore{db: db}
+}
+
+var _ Store = &JobStore{}
+
+func (s *JobStore) Create(job *api.Job) error {
+	return s.db.Create(job).Error
+}
+
+func (s *JobStore) Get(jobID string) (*api.Job, error) {
+	var result api.Job
+	err := s.db.First(&result, "id = ?", jobID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetPage returns a page of the jobs with the status, the latest first. An
+// empty status selects the jobs of every status
+func (s *JobStore) GetPage(status api.JobStatus, page *pagination.Page) ([]*api.Job, *pagination.Cursor, error) {
+	var result []*api.Job
+	query := s.db.Model(&api.Job{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := page.Apply(query, "jobs", true).Find(&result).Error; err != nil {
+		return nil, nil, err
+	}
+	count, more := page.Trim(len(result))
+	result = result[:count]
+	if !more {
+		return result, nil, nil
+	}
+	last := result[count-1]
+	return result, &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+func (s *JobStore) CountByStatus() (map[api.JobStatus]int, error) {
+	var rows []struct {
+		Status api.JobStatus
+		Count  int
+	}
+	if err := s.db.
+		Model(&api.Job{}).
+		Select("status, count(*) as count").
+		Group("status").
+		Scan(&rows).
+		Error; err != nil {
+		return nil, err
+	}
+	result := map[api.JobStatus]int{}
+	for _, row := range rows {
+		result[row.Status] = row.Count
+	}
+	return result, nil
+}
+
+// Claim locks the next job due, and counts the attempt. The jobs locked for
+// longer than lockTimeout are claimed again, their worker is assumed to have
+// stopped, unless that was their last attempt: they are buried instead.
+// Claim returns nil when no job is due
+func (s *JobStore) Claim(lockTimeout time.Duration) (*api.Job, error) {
+	for {
+		now := time.Now()
+		var due []*api.Job
+		if err := s.db.
+			Where("(status = ? and run_at <= ?) or (status = ? and locked_at < ?)", api.JobPending, now, api.JobRunning, now.Add(-lockTimeout)).
+			Order("run_at asc").
+			Limit(1).
+			Find(&due).
+			Error; err != nil {
+			return nil, err
+		}
+		if len(due) == 0 {
+			return nil, nil
+		}
+		job := due[0]
+
+		if job.Status == api.JobRunning && job.Attempts >= job.MaxAttempts {
+			if err := s.Bury(job, "the worker stopped during the last attempt"); err != nil && !errors.Is(err, ErrLockLost) {
+				return nil, err
+			}
+			continue
+		}
+
+		// The status and the number of attempts change on every claim, the
+		// job was claimed by another worker when no row is updated
+		result := s.db.
+			Model(&api.Job{}).
+			Where("id = ? and status = ? and attempts = ?", job.ID, job.Status, job.Attempts).
+			Updates(map[string]interface{}{
+				"status":     api.JobRunning,
+				"attempts":   job.Attempts + 1,
+				"locked_at":  now,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		job.Status = api.JobRunning
+		job.Attempts++
+		job.LockedAt = &now
+		return job, nil
+	}
+}
+
+func (s *JobStore) Complete(job *api.Job) error {
+	now := time.Now()
+	return s.update(job, map[string]interface{}{
+		"status":      api.JobSucceeded,
+		"locked_at":   nil,
+		"finished_at": now,
+	})
+}
+
+// Retry unlocks a failed job, to run it again at runAt
+func (s *JobStore) Retry(job *api.Job, lastError string, runAt time.Time) error {
+	return s.update(job, map[string]interface{}{
+		"status":     api.JobPending,
+		"last_error": lastError,
+		"run_at":     runAt,
+		"locked_at":  nil,
+	})
+}
+
+// Bury moves a job which failed on its last attempt to the dead jobs
+func (s *JobStore) Bury(job *api.Job, lastError string) error {
+	now := time.Now()
+	return s.update(job, map[string]interface{}{
+		"status":      api.JobDead,
+		"last_error":  lastError,
+		"locked_at":   nil,
+		"finished_at": now,
+	})
+}
+
+// Requeue runs a dead job again, with all its attempts
+func (s *JobStore) Requeue(jobID string) error {
+	result := s.db.
+		Model(&api.Job{}).
+		Where("id = ? and status = ?", jobID, api.JobDead).
+		Updates(map[string]interface{}{
+			"status":      api.JobPending,
+			"attempts":    0,
+			"run_at":      time.Now(),
+			"finished_at": nil,
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a job which is not running
+func (s *JobStore) Delete(jobID string) error {
+	result := s.db.Where("id = ? and status <> ?", jobID, api.JobRunning).Delete(&api.Job{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
+
+// DeleteSucceeded removes the jobs which succeeded before the given time
+func (s *JobStore) DeleteSucceeded(before time.Time) error {
+	return s.db.
+		Where("status = ? and finished_at < ?", api.JobSucceeded, before).
+		Delete(&api.Job{}).
+		Error
+}
+
+// update records the outcome of the attempt of a running job. The attempts
+// are counted on every claim, so the job was claimed again when no row
+// matches them
+func (s *JobStore) update(job *api.Job, values map[string]interface{}) error {
+	values["updated_at"] = time.Now()
+	result := s.db.
+		Model(&api.Job{}).
+		Where("id = ? and status = ? and attempts = ?", job.ID, api.JobRunning, job.Attempts).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *JobStore {
+	t.Helper()
+	return NewJobStore(dbtest.Open(t))
+}
+
+func enqueue(t *testing.T, store *JobStore, maxAttempts int) *api.Job {
+	t.Helper()
+	job, err := NewJob("test", nil, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.MaxAttempts = maxAttempts
+	if err := store.Create(job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func claim(t *testing.T, store *JobStore, lockTimeout time.Duration) *api.Job {
+	t.Helper()
+	job, err := store.Claim(lockTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestReclaimedJob(t *testing.T) {
+	store := newTestStore(t)
+	enqueue(t, store, 3)
+
+	first := claim(t, store, time.Hour)
+	if first == nil || first.Attempts != 1 {
+		t.Fatalf("claimed %+v, expected the first attempt", first)
+	}
+	if job := claim(t, store, time.Hour); job != nil {
+		t.Fatal("a locked job was claimed")
+	}
+
+	// The lock times out, the job is run by another worker
+	second := claim(t, store, 0)
+	if second == nil || second.ID != first.ID || second.Attempts != 2 {
+		t.Fatalf("claimed %+v, expected the second attempt", second)
+	}
+
+	// The first worker cannot record its outcome anymore
+	if err := store.Complete(first); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("complete: %v, expected the lock to be lost", err)
+	}
+	if err := store.Retry(first, "failed", time.Now()); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("retry: %v, expected the lock to be lost", err)
+	}
+	if err := store.Bury(first, "failed"); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("bury: %v, expected the lock to be lost", err)
+	}
+
+	if err := store.Complete(second); err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.Get(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != api.JobSucceeded || job.LastError != "" {
+		t.Fatalf("job is %s with error %q", job.Status, job.LastError)
+	}
+}
+
+func TestReclaimedJobOnLastAttempt(t *testing.T) {
+	store := newTestStore(t)
+	abandoned := enqueue(t, store, 1)
+	if job := claim(t, store, time.Hour); job == nil || job.ID != abandoned.ID {
+		t.Fatalf("claimed %+v, expected %s", job, abandoned.ID)
+	}
+	next := enqueue(t, store, 1)
+
+	// The abandoned job is buried instead of being run once more
+	if job := claim(t, store, 0); job == nil || job.ID != next.ID {
+		t.Fatalf("claimed %+v, expected %s", job, next.ID)
+	}
+	job, err := store.Get(abandoned.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != api.JobDead || job.Attempts != 1 || job.LastError == "" {
+		t.Fatalf("job is %s after %d attempts, with error %q", job.Status, job.Attempts, job.LastError)
+	}
+}
@@ -0,0 +1,381 @@
+package ledger
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/utils"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrInvalidAmount     = errors.New("amount must be greater than zero")
+	ErrOverdraftExceeded = errors.New("overdraft limit exceeded")
+	ErrUnbalancedEntry   = errors.New("journal entry postings do not sum up to zero")
+	ErrAlreadyReversed   = errors.New("journal entry was already reversed")
+	ErrIsReversal        = errors.New("journal entry is a reversal, and cannot be reversed")
+)
+
+type Store interface {
+	GetOrCreateAccount(groupID string, owner *api.Target) (*api.Account, error)
+	Balance(accountID string, asOf time.Time) (time.Duration, error)
+	GetBalance(groupID string, owner *api.Target) (time.Duration, error)
+	Transfer(groupID string, from *api.Target, to *api.Target, amount time.Duration, notes string) (*api.JournalEntry, error)
+	Post(entry *api.JournalEntry) error
+	Reverse(entryID string, notes string) (*api.JournalEntry, error)
+	GetReversedEntryIDs(entryIDs []string) ([]string, error)
+	GetEntry(entryID string) (*api.JournalEntry, error)
+	GetEntriesForGroup(groupID string) ([]*api.JournalEntry, error)
+	GetEntriesForGroupBetween(groupID string, after, before time.Time) ([]*api.JournalEntry, error)
+}
+
+type LedgerStore struct {
+	db *gorm.DB
+}
+
+func NewLedgerStore(db *gorm.DB) *LedgerStore {
+	return &LedgerStore{db: db}
+}
+
+var _ Store = &LedgerStore{}
+
+func (s *LedgerStore) GetOrCreateAccount(groupID string, owner *api.Target) (*api.Account, error) {
+	var result *api.Account
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockGroup(tx, groupID); err != nil {
+			return err
+		}
+		account, err := getOrCreateAccount(tx, groupID, owner)
+		if err != nil {
+			return err
+		}
+		result = account
+		return nil
+	})
+	return result, err
+}
+
+func (s *LedgerStore) Balance(accountID string, asOf time.Time) (time.Duration, error) {
+	return balance(s.db, accountID, asOf)
+}
+
+// GetBalance returns the current balance of the account owned by the given
+// target. Owners without an account yet have a balance of zero
+func (s *LedgerStore) GetBalance(groupID string, owner *api.Target) (time.Duration, error) {
+	account, err := findAccount(s.db, groupID, owner)
+	if errors.Is(err, echo.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return balance(s.db, account.ID, time.Now())
+}
+
+// Transfer moves credits from one account to another, after making sure
+// that the sender's balance does not go below the group overdraft limit
+func (s *LedgerStore) Transfer(groupID string, from *api.Target, to *api.Target, amount time.Duration, notes string) (*api.JournalEntry, error) {
+	entry := &api.JournalEntry{
+		GroupID: groupID,
+		Notes:   notes,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return TransferWithin(tx, entry, from, to, amount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// TransferWithin is like Transfer, but runs within the given transaction so
+// that other stores can move credits atomically with their own writes. The
+// postings are added to the given entry before it is posted
+func TransferWithin(tx *gorm.DB, entry *api.JournalEntry, from *api.Target, to *api.Target, amount time.Duration) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	group, err := lockGroup(tx, entry.GroupID)
+	if err != nil {
+		return err
+	}
+
+	fromAccount, err := getOrCreateAccount(tx, entry.GroupID, from)
+	if err != nil {
+		return err
+	}
+	toAccount, err := getOrCreateAccount(tx, entry.GroupID, to)
+	if err != nil {
+		return err
+	}
+
+	fromBalance, err := balance(tx, fromAccount.ID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	limit := group.OverdraftLimitFor(from)
+	if fromBalance-amount < -limit {
+		return fmt.Errorf("%w: balance is %s, cannot go below -%s", ErrOverdraftExceeded, fromBalance, limit)
+	}
+
+	entry.Postings = []*api.Posting{
+		{AccountID: fromAccount.ID, Amount: -amount},
+		{AccountID: toAccount.ID, Amount: amount},
+	}
+	return post(tx, entry)
+}
+
+func (s *LedgerStore) Post(entry *api.JournalEntry) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return post(tx, entry)
+	})
+}
+
+// Reverse posts a new entry cancelling the effects of the given entry. The
+// reversals themselves cannot be reversed, that would post the original
+// transfer again without checking the overdraft limits
+func (s *LedgerStore) Reverse(entryID string, notes string) (*api.JournalEntry, error) {
+	var reversal *api.JournalEntry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+
+		original, err := getEntry(tx, entryID)
+		if err != nil {
+			return err
+		}
+		if original.IsReversal() {
+			return ErrIsReversal
+		}
+
+		if _, err := lockGroup(tx, original.GroupID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&api.JournalEntry{}).Where("reversal_of_id = ?", original.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyReversed
+		}
+
+		reversal = &api.JournalEntry{
+			GroupID:      original.GroupID,
+			Notes:        notes,
+			ReversalOfID: &original.ID,
+		}
+		for _, posting := range original.Postings {
+			reversal.Postings = append(reversal.Postings, &api.Posting{
+				AccountID: posting.AccountID,
+				Amount:    -posting.Amount,
+			})
+		}
+		return post(tx, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// GetReversedEntryIDs returns the entries among the given ones which were
+// reversed
+func (s *LedgerStore) GetReversedEntryIDs(entryIDs []string) ([]string, error) {
+	var result []string
+	if len(entryIDs) == 0 {
+		return result, nil
+	}
+	if err := s.db.
+		Model(&api.JournalEntry{}).
+		Where("reversal_of_id in ?", entryIDs).
+		Pluck("reversal_of_id", &result).
+		Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *LedgerStore) GetEntry(entryID string) (*api.JournalEntry, error) {
+	entry, err := getEntry(s.db, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := populateOwners(s.db, []*api.JournalEntry{entry}); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *LedgerStore) GetEntriesForGroup(groupID string) ([]*api.JournalEntry, error) {
+	return s.GetEntriesForGroupBetween(groupID, time.Time{}, time.Time{})
+}
+
+// GetEntriesForGroupBetween returns the journal entries of the group created
+// strictly between after and before, a zero time leaving the range open
+func (s *LedgerStore) GetEntriesForGroupBetween(groupID string, after, before time.Time) ([]*api.JournalEntry, error) {
+	var result []*api.JournalEntry
+	if err := utils.Between(s.db, "created_at", after, before).
+		Preload("Postings.Account").
+		Preload("Post").
+		Model(&api.JournalEntry{}).
+		Order("created_at asc").
+		Find(&result, "group_id = ?", groupID).
+		Error; err != nil {
+		return nil, err
+	}
+	if err := populateOwners(s.db, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ImportWithin posts a historical transfer within the given transaction.
+// Unlike TransferWithin, the ID and creation time of the entry are kept and
+// the overdraft limit is not enforced, since the balances at the time of
+// the transfer are not known
+func ImportWithin(tx *gorm.DB, entry *api.JournalEntry, from *api.Target, to *api.Target, amount time.Duration) error {
+	if _, err := lockGroup(tx, entry.GroupID); err != nil {
+		return err
+	}
+	fromAccount, err := getOrCreateAccount(tx, entry.GroupID, from)
+	if err != nil {
+		return err
+	}
+	toAccount, err := getOrCreateAccount(tx, entry.GroupID, to)
+	if err != nil {
+		return err
+	}
+	entry.Postings = []*api.Posting{
+		{AccountID: fromAccount.ID, Amount: -amount},
+		{AccountID: toAccount.ID, Amount: amount},
+	}
+	return post(tx, entry)
+}
+
+// lockGroup locks the group row so that concurrent ledger writes within the
+// same group are serialized while balances are being checked
+func lockGroup(tx *gorm.DB, groupID string) (*api.Group, error) {
+	var group api.Group
+	if err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Model(&api.Group{}).
+		First(&group, "id = ?", groupID).
+		Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func findAccount(db *gorm.DB, groupID string, owner *api.Target) (*api.Account, error) {
+	query := db.Model(&api.Account{}).Where("group_id = ? and owner_type = ?", groupID, owner.Type)
+	if owner.IsGroup() {
+		query = query.Where("owner_group_id = ?", owner.GetGroupID())
+	} else if owner.IsUser() {
+		query = query.Where("owner_user_id = ?", owner.GetUserID())
+	} else {
+		return nil, fmt.Errorf("invalid account owner type %s", owner.Type)
+	}
+
+	var result api.Account
+	err := query.First(&result).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func getOrCreateAccount(tx *gorm.DB, groupID string, owner *api.Target) (*api.Account, error) {
+	account, err := findAccount(tx, groupID, owner)
+	if err == nil {
+		return account, nil
+	}
+	if !errors.Is(err, echo.ErrNotFound) {
+		return nil, err
+	}
+
+	account = &api.Account{
+		ID:      uuid.NewV4().String(),
+		GroupID: groupID,
+		Owner: &api.Target{
+			UserID:  owner.UserID,
+			GroupID: owner.GroupID,
+			Type:    owner.Type,
+		},
+	}
+	if err := tx.Omit(clause.Associations).Create(account).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func balance(db *gorm.DB, accountID string, asOf time.Time) (time.Duration, error) {
+	var result int64
+	if err := db.
+		Model(&api.Posting{}).
+		Select("coalesce(sum(postings.amount), 0)").
+		Joins("join journal_entries on journal_entries.id = postings.entry_id").
+		Where("postings.account_id = ? and journal_entries.created_at <= ?", accountID, asOf).
+		Scan(&result).
+		Error; err != nil {
+		return 0, err
+	}
+	return time.Duration(result), nil
+}
+
+func post(tx *gorm.DB, entry *api.JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("journal entry must have at least two postings")
+	}
+	if !entry.IsBalanced() {
+		return ErrUnbalancedEntry
+	}
+	if entry.ID == "" {
+		entry.ID = uuid.NewV4().String()
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	for _, posting := range entry.Postings {
+		if posting.ID == "" {
+			posting.ID = uuid.NewV4().String()
+		}
+		posting.EntryID = entry.ID
+	}
+	return tx.Omit("Postings.Account", "Post").Create(entry).Error
+}
+
+func getEntry(db *gorm.DB, entryID string) (*api.JournalEntry, error) {
+	var result api.JournalEntry
+	err := db.
+		Preload("Postings.Account").
+		Model(&api.JournalEntry{}).
+		First(&result, "id = ?", entryID).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func populateOwners(db *gorm.DB, entries []*api.JournalEntry) error {
+	var allTargets []*api.Target
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if posting.Account != nil {
+				allTargets = append(allTargets, posting.Account.Owner)
+			}
+		}
+	}
+	return utils.PopulateTargets(db, allTargets)
+}
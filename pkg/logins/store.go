@@ -0,0 +1,53 @@
+package logins
+
+import (
+	"cp/pkg/api"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"time"
+)
+
+type Store interface {
+	Get(loginID string) (*api.Login, error)
+	Save(login *api.Login) error
+	Delete(loginID string) error
+	DeleteUnused(before time.Time) error
+}
+
+type LoginStore struct {
+	db *gorm.DB
+}
+
+func NewLoginStore(db *gorm.DB) *LoginStore {
+	return &LoginStore{db: db}
+}
+
+var _ Store = &LoginStore{}
+
+func (s *LoginStore) Get(loginID string) (*api.Login, error) {
+	var result api.Login
+	err := s.db.First(&result, "id = ?", loginID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Save creates the login, or updates its tokens when they were refreshed
+func (s *LoginStore) Save(login *api.Login) error {
+	return s.db.Save(login).Error
+}
+
+func (s *LoginStore) Delete(loginID string) error {
+	return s.db.Delete(&api.Login{}, "id = ?", loginID).Error
+}
+
+// DeleteUnused removes the logins whose tokens were not refreshed since the
+// given time. Their sessions were closed without logging out
+func (s *LoginStore) DeleteUnused(before time.Time) error {
+	return s.db.Where("updated_at < ?", before).Delete(&api.Login{}).Error
+}
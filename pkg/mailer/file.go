@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"fmt"
+	uuid "github.com/satori/go.uuid"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes each email to a .eml file of a directory, to read the
+// emails sent by a development server
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+var _ Mailer = &FileMailer{}
+
+func (m *FileMailer) Send(message *Message) error {
+	content, err := message.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.NewV4().String())
+	return os.WriteFile(filepath.Join(m.dir, name), content, 0644)
+}
@@ -0,0 +1,86 @@
+// Package mailer sends emails. The SMTP mailer is used in production, the
+// file and memory mailers stand in for it in development and tests.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"sort"
+	"time"
+)
+
+// Message is an email with a plain text and an HTML body
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added to the standard headers of the email
+	Headers map[string]string
+}
+
+type Mailer interface {
+	Send(message *Message) error
+}
+
+type discard struct{}
+
+func (discard) Send(*Message) error {
+	return nil
+}
+
+// Discard drops the emails, when no mailer is configured
+var Discard Mailer = discard{}
+
+// Bytes encodes the message as a multipart/alternative email sent by from
+func (m *Message) Bytes(from string) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(partWriter)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	fmt.Fprintf(&result, "From: %s\r\n", from)
+	fmt.Fprintf(&result, "To: %s\r\n", m.To)
+	fmt.Fprintf(&result, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&result, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&result, "MIME-Version: 1.0\r\n")
+	var names []string
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&result, "%s: %s\r\n", name, m.Headers[name])
+	}
+	fmt.Fprintf(&result, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary())
+	result.Write(body.Bytes())
+	return result.Bytes(), nil
+}
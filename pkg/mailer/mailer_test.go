@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var message = &Message{
+	To:      "alice@example.com",
+	Subject: "Crédits reçus",
+	Text:    "You received 10 credits",
+	HTML:    "<p>You received <strong>10</strong> credits</p>",
+	Headers: map[string]string{
+		"List-Unsubscribe": "<https://cp.example.com/unsubscribe/token>",
+	},
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "emails")
+	if err := NewFileMailer(dir, "cp@example.com").Send(message); err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.Ext(files[0].Name()) != ".eml" {
+		t.Fatalf("files are %v, expected one email", files)
+	}
+
+	file, err := os.Open(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	email, err := mail.ReadMessage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(email.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Header.Get("From") != "cp@example.com" || email.Header.Get("To") != message.To || subject != message.Subject {
+		t.Fatalf("headers are %v", email.Header)
+	}
+	if email.Header.Get("List-Unsubscribe") != message.Headers["List-Unsubscribe"] {
+		t.Fatal("the headers of the message are missing")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(email.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("content type is %s", mediaType)
+	}
+	reader := multipart.NewReader(email.Body, params["boundary"])
+	for _, expected := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Type") != expected.contentType || string(content) != expected.content {
+			t.Fatalf("part %s is %q", part.Header.Get("Content-Type"), content)
+		}
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	if err := m.Send(message); err != nil {
+		t.Fatal(err)
+	}
+	if messages := m.Messages(); len(messages) != 1 || messages[0] != message {
+		t.Fatalf("messages are %v", messages)
+	}
+	m.Reset()
+	if messages := m.Messages(); len(messages) != 0 {
+		t.Fatalf("messages are %v, expected none", messages)
+	}
+}
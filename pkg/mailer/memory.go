@@ -0,0 +1,35 @@
+package mailer
+
+import "sync"
+
+// MemoryMailer keeps the emails in memory, for the tests to inspect them
+type MemoryMailer struct {
+	lock     sync.Mutex
+	messages []*Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+var _ Mailer = &MemoryMailer{}
+
+func (m *MemoryMailer) Send(message *Message) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (m *MemoryMailer) Messages() []*Message {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]*Message(nil), m.messages...)
+}
+
+func (m *MemoryMailer) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messages = nil
+}
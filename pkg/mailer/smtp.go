@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+)
+
+// SMTPMailer sends the emails through an SMTP server. The connection is
+// upgraded with STARTTLS when the server supports it
+type SMTPMailer struct {
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+// NewSMTPMailer authenticates with the username and password, unless the
+// username is empty
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		address: net.JoinHostPort(host, port),
+		auth:    auth,
+		from:    from,
+	}
+}
+
+var _ Mailer = &SMTPMailer{}
+
+func (m *SMTPMailer) Send(message *Message) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.from, err)
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", message.To, err)
+	}
+	content, err := message.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.address, m.auth, from.Address, []string{to.Address}, content)
+}
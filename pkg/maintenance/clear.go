@@ -0,0 +1,47 @@
+// Package maintenance holds the operations run by site administrators on
+// the whole database, from the admin pages or the command line.
+package maintenance
+
+import (
+	"cp/pkg/api"
+	"gorm.io/gorm"
+)
+
+// clearedModels are deleted in order, the rows referencing other rows
+// first
+var clearedModels = []interface{}{
+	&api.Acknowledgement{},
+	&api.Exchange{},
+	&api.Posting{},
+	&api.JournalEntry{},
+	&api.Account{},
+	&api.Message{},
+	&api.ConversationParticipant{},
+	&api.Conversation{},
+	&api.Notification{},
+	&api.NotificationMute{},
+	&api.EmailPreference{},
+	&api.Image{},
+	&api.Post{},
+	&api.HistorySnapshotUser{},
+	&api.HistorySnapshot{},
+	&api.Invitation{},
+	&api.Membership{},
+	&api.Role{},
+	&api.Group{},
+	&api.PersonalAccessToken{},
+	&api.User{},
+	&api.Job{},
+}
+
+// Clear deletes all the data of the site
+func Clear(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range clearedModels {
+			if err := tx.Unscoped().Where("1 = 1").Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
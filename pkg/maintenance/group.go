@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/blobs"
+	"cp/pkg/images"
+	"gorm.io/gorm"
+)
+
+// PurgeGroup permanently removes a group and all its data, in one
+// transaction. Images are removed from the blob store once the rows are
+// deleted
+func PurgeGroup(db *gorm.DB, blobStore blobs.Store, groupID string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		deletes := []struct {
+			where string
+			model interface{}
+		}{
+			{"group_id = ?", &api.Acknowledgement{}},
+			{"group_id = ?", &api.Exchange{}},
+			{"entry_id in (select id from journal_entries where group_id = ?)", &api.Posting{}},
+			{"group_id = ?", &api.JournalEntry{}},
+			{"group_id = ?", &api.Account{}},
+			{"snapshot_id in (select id from history_snapshots where group_id = ?)", &api.HistorySnapshotUser{}},
+			{"group_id = ?", &api.HistorySnapshot{}},
+			{"group_id = ?", &api.Invitation{}},
+			{"group_id = ?", &api.Membership{}},
+			{"group_id = ?", &api.Role{}},
+			{"group_id = ?", &api.NotificationMute{}},
+			{"thread_id in (select id from posts where group_id = ?)", &api.Message{}},
+			{"thread_id in (select id from conversations where group_id = ?)", &api.Message{}},
+			{"conversation_id in (select id from conversations where group_id = ?)", &api.ConversationParticipant{}},
+			{"group_id = ?", &api.Conversation{}},
+			{"group_id = ?", &api.Image{}},
+			{"group_id = ?", &api.Post{}},
+			{"id = ?", &api.Group{}},
+		}
+		for _, d := range deletes {
+			if err := tx.Unscoped().Where(d.where, groupID).Delete(d.model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range images.GroupDirs(groupID) {
+		if err := blobStore.DeleteAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
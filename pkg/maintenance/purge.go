@@ -0,0 +1,87 @@
+package maintenance
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/blobs"
+	"cp/pkg/images"
+	"cp/pkg/snapshots"
+	"gorm.io/gorm"
+	"time"
+)
+
+// FindDeletedPosts returns the posts deleted before the given time
+func FindDeletedPosts(db *gorm.DB, before time.Time) ([]*api.Post, error) {
+	var posts []*api.Post
+	if err := db.
+		Unscoped().
+		Model(&api.Post{}).
+		Where("deleted_at is not null and deleted_at < ?", before).
+		Order("deleted_at asc").
+		Find(&posts).
+		Error; err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// PurgeDeletedPosts permanently removes the posts deleted before the given
+// time, along with their messages, exchanges and images. The journal
+// entries of completed exchanges are kept, so that balances do not change.
+// Images are removed from the blob store once the rows are deleted
+func PurgeDeletedPosts(db *gorm.DB, blobStore blobs.Store, before time.Time) ([]*api.Post, error) {
+	var posts []*api.Post
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		posts, err = FindDeletedPosts(tx, before)
+		if err != nil {
+			return err
+		}
+		if len(posts) == 0 {
+			return nil
+		}
+
+		var postIDs []string
+		since := map[string]time.Time{}
+		for _, post := range posts {
+			postIDs = append(postIDs, post.ID)
+			if t, ok := since[post.GroupID]; !ok || post.CreatedAt.Before(t) {
+				since[post.GroupID] = post.CreatedAt
+			}
+		}
+
+		if err := tx.Where("thread_id in ?", postIDs).Delete(&api.Message{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id in ?", postIDs).Delete(&api.Exchange{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id in ?", postIDs).Delete(&api.Image{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("id in ?", postIDs).Delete(&api.Post{}).Error; err != nil {
+			return err
+		}
+
+		// the history of the groups counted the purged posts
+		snapshotStore := snapshots.NewSnapshotStore(tx)
+		for groupID, t := range since {
+			if err := snapshotStore.DeleteFrom(groupID, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, post := range posts {
+		for _, dir := range images.PostDirs(post.GroupID, post.ID) {
+			if err := blobStore.DeleteAll(dir); err != nil {
+				return posts, err
+			}
+		}
+	}
+
+	return posts, nil
+}
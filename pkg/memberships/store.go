@@ -2,6 +2,7 @@ package memberships
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/events"
 	"errors"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
@@ -9,10 +10,15 @@ import (
 )
 
 type GetMembershipsOptions struct {
-	HasPermission *api.MembershipPermission
-	GroupID       *string
-	UserID        *string
-	Preload       []string
+	HasPermission   *api.MembershipPermission
+	GroupID         *string
+	UserID          *string
+	GroupConfirmed  *bool
+	MemberConfirmed *bool
+	// GroupDeleted selects the memberships of the deleted groups, instead
+	// of the memberships of the other groups
+	GroupDeleted bool
+	Preload      []string
 }
 
 type Store interface {
@@ -24,12 +30,14 @@ type Store interface {
 }
 
 type MembershipStore struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events events.Publisher
 }
 
-func NewMembershipStore(db *gorm.DB) *MembershipStore {
+func NewMembershipStore(db *gorm.DB, publisher events.Publisher) *MembershipStore {
 	return &MembershipStore{
-		db: db,
+		db:     db,
+		events: publisher,
 	}
 }
 
@@ -37,15 +45,51 @@ var _ Store = &MembershipStore{}
 
 func (m *MembershipStore) Get(groupID string, userID string) (*api.Membership, error) {
 	var result api.Membership
-	err := m.db.Preload("Group").Preload("User").Model(&api.Membership{}).First(&result, "group_id = ? and user_id = ?", groupID, userID).Error
+	err := m.db.Preload("Group").Preload("User").Preload("Role").Model(&api.Membership{}).First(&result, "group_id = ? and user_id = ?", groupID, userID).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, echo.ErrNotFound
 	}
 	return &result, err
 }
 
+// changedMembership is the data of the events of the memberships, sent to
+// the member
+type changedMembership struct {
+	GroupID         string                   `json:"groupId"`
+	UserID          string                   `json:"userId"`
+	Permission      api.MembershipPermission `json:"permission"`
+	MemberConfirmed bool                     `json:"memberConfirmed"`
+	GroupConfirmed  bool                     `json:"groupConfirmed"`
+	Deleted         bool                     `json:"deleted"`
+}
+
+// ChangedEvent is the event sent to the member when the membership is
+// created, updated or deleted
+func ChangedEvent(membership *api.Membership, deleted bool) *events.Event {
+	return &events.Event{
+		Type:  events.MembershipChanged,
+		Topic: events.UserTopic(membership.UserID),
+		Data: &changedMembership{
+			GroupID:         membership.GroupID,
+			UserID:          membership.UserID,
+			Permission:      membership.Permission,
+			MemberConfirmed: membership.MemberConfirmed,
+			GroupConfirmed:  membership.GroupConfirmed,
+			Deleted:         deleted,
+		},
+	}
+}
+
+func (m *MembershipStore) publish(membership *api.Membership, deleted bool) {
+	m.events.Publish(ChangedEvent(membership, deleted))
+}
+
 func (m *MembershipStore) Create(membership *api.Membership) error {
-	return m.db.Create(membership).Error
+	if err := m.db.Create(membership).Error; err != nil {
+		return err
+	}
+	m.publish(membership, false)
+	return nil
 }
 
 func (m *MembershipStore) Update(membership *api.Membership) error {
@@ -56,11 +100,16 @@ func (m *MembershipStore) Update(membership *api.Membership) error {
 	if err != nil {
 		return err
 	}
+	m.publish(membership, false)
 	return nil
 }
 
 func (m *MembershipStore) Delete(membership *api.Membership) error {
-	return m.db.Delete(&api.Membership{}, "user_id = ? and group_id = ?", membership.UserID, membership.GroupID).Error
+	if err := m.db.Delete(&api.Membership{}, "user_id = ? and group_id = ?", membership.UserID, membership.GroupID).Error; err != nil {
+		return err
+	}
+	m.publish(membership, true)
+	return nil
 }
 
 func (m *MembershipStore) Find(out interface{}, option *GetMembershipsOptions) error {
@@ -77,6 +126,22 @@ func (m *MembershipStore) Find(out interface{}, option *GetMembershipsOptions) e
 		params = append(params, *option.UserID)
 	}
 
+	if option.GroupConfirmed != nil {
+		clauses = append(clauses, "group_confirmed = ?")
+		params = append(params, *option.GroupConfirmed)
+	}
+
+	if option.MemberConfirmed != nil {
+		clauses = append(clauses, "member_confirmed = ?")
+		params = append(params, *option.MemberConfirmed)
+	}
+
+	if option.GroupDeleted {
+		clauses = append(clauses, "group_id in (select id from groups where deleted_at is not null)")
+	} else {
+		clauses = append(clauses, "group_id in (select id from groups where deleted_at is null)")
+	}
+
 	if option.HasPermission != nil {
 		hasPermission := *option.HasPermission
 		if hasPermission == api.Owner {
@@ -88,7 +153,7 @@ func (m *MembershipStore) Find(out interface{}, option *GetMembershipsOptions) e
 		}
 	}
 
-	query := m.db
+	query := m.db.Preload("Role")
 	for _, preload := range option.Preload {
 		query = query.Preload(preload)
 	}
@@ -2,30 +2,61 @@ package messages
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/events"
+	"cp/pkg/pagination"
 	"gorm.io/gorm"
 )
 
 type Store interface {
 	SendMessage(message *api.Message) error
-	GetMessages(threadID string) ([]*api.Message, error)
+	GetMessages(threadID string, page *pagination.Page) ([]*api.Message, *pagination.Cursor, error)
 	DeleteThread(threadID string) error
 	FindUserIdsInThread(threadID string) ([]string, error)
 }
 
 type MessageStore struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events events.Publisher
+}
+
+// sentMessage is the data of the events of the messages. Clients fetch the
+// thread again to render the message
+type sentMessage struct {
+	ID       string `json:"id"`
+	ThreadID string `json:"threadId"`
+	AuthorID string `json:"authorId"`
 }
 
 func (m MessageStore) SendMessage(message *api.Message) error {
-	return m.db.Create(message).Error
+	if err := m.db.Create(message).Error; err != nil {
+		return err
+	}
+	m.events.Publish(&events.Event{
+		Type:  events.MessageSent,
+		Topic: events.ThreadTopic(message.ThreadID),
+		Data: &sentMessage{
+			ID:       message.ID,
+			ThreadID: message.ThreadID,
+			AuthorID: message.AuthorID,
+		},
+	})
+	return nil
 }
 
-func (m MessageStore) GetMessages(threadID string) ([]*api.Message, error) {
+// GetMessages returns a page of the messages of the thread, oldest first
+func (m MessageStore) GetMessages(threadID string, page *pagination.Page) ([]*api.Message, *pagination.Cursor, error) {
 	var result []*api.Message
-	if err := m.db.Preload("Author").Model(&api.Message{}).Find(&result, "thread_id = ?", threadID).Error; err != nil {
-		return nil, err
+	query := m.db.Preload("Author").Model(&api.Message{})
+	if err := page.Apply(query, "messages", false).Find(&result, "thread_id = ?", threadID).Error; err != nil {
+		return nil, nil, err
 	}
-	return result, nil
+	count, more := page.Trim(len(result))
+	result = result[:count]
+	if !more {
+		return result, nil, nil
+	}
+	last := result[count-1]
+	return result, &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
 }
 
 func (m MessageStore) DeleteThread(threadID string) error {
@@ -40,6 +71,6 @@ func (m MessageStore) FindUserIdsInThread(threadID string) ([]string, error) {
 	return result, nil
 }
 
-func NewMessageStore(db *gorm.DB) *MessageStore {
-	return &MessageStore{db: db}
+func NewMessageStore(db *gorm.DB, publisher events.Publisher) *MessageStore {
+	return &MessageStore{db: db, events: publisher}
 }
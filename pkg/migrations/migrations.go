@@ -0,0 +1,285 @@
+// Package migrations applies the versioned SQL migrations embedded in the
+// binary. Each dialect has its own files, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, and the applied
+// versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+var ErrUnsupportedDialect = errors.New("migrations: unsupported database")
+
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// Status is a migration, with the time it was applied at. AppliedAt is nil
+// for the pending migrations
+type Status struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db *gorm.DB
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{db: db}
+}
+
+// load returns the migrations of the dialect of the database, by version
+func (m *Migrator) load() ([]*Migration, error) {
+	dialect := m.db.Dialector.Name()
+	if dialect != "sqlite" && dialect != "postgres" {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedDialect, dialect)
+	}
+	names, err := fs.Glob(files, dialect+"/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, name := range names {
+		base := path.Base(name)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migrations: %s is neither an up nor a down migration", name)
+		}
+		parts := strings.SplitN(strings.TrimSuffix(base, "."+direction+".sql"), "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migrations: %s does not start with a version", name)
+		}
+		content, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	var result []*Migration
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migrations: %04d_%s needs both an up and a down migration", migration.Version, migration.Name)
+		}
+		result = append(result, migration)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// conn returns a connection of the pool, on which the history table exists.
+// The migrations must run on a single connection, since the pragmas of
+// SQLite only apply to the connection running them
+func (m *Migrator) conn(ctx context.Context) (*sql.Conn, error) {
+	db, err := m.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `create table if not exists schema_migrations (
+		version bigint primary key,
+		name text not null,
+		applied_at timestamp not null
+	)`); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+// Status returns all the migrations, applied or not
+func (m *Migrator) Status() ([]*Status, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	versions, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Status
+	for _, migration := range migrations {
+		status := &Status{Migration: migration}
+		if appliedAt, ok := versions[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Up applies the pending migrations, and returns them
+func (m *Migrator) Up() ([]*Migration, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	versions, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Migration
+	for _, migration := range migrations {
+		if _, ok := versions[migration.Version]; ok {
+			continue
+		}
+		if err := m.run(ctx, conn, migration.up, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)",
+				migration.Version, migration.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return result, fmt.Errorf("migrations: %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		result = append(result, migration)
+	}
+	return result, nil
+}
+
+// Down reverts the given number of migrations, the latest first, and
+// returns them
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	migrations, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := m.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	versions, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+	var appliedVersions []int
+	for version := range versions {
+		appliedVersions = append(appliedVersions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(appliedVersions)))
+
+	var result []*Migration
+	for i := 0; i < steps && i < len(appliedVersions); i++ {
+		migration, ok := byVersion[appliedVersions[i]]
+		if !ok {
+			return result, fmt.Errorf("migrations: version %d was applied by a newer release, and cannot be reverted by this one", appliedVersions[i])
+		}
+		if err := m.run(ctx, conn, migration.down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "delete from schema_migrations where version = $1", migration.Version)
+			return err
+		}); err != nil {
+			return result, fmt.Errorf("migrations: reverting %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		result = append(result, migration)
+	}
+	return result, nil
+}
+
+// run executes the statements of a migration and records it in the same
+// transaction. On SQLite, the foreign keys are disabled while the tables are
+// created again, the pragma having no effect within a transaction
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, statements string, record func(tx *sql.Tx) error) error {
+	if m.db.Dialector.Name() == "sqlite" {
+		var foreignKeys bool
+		if err := conn.QueryRowContext(ctx, "pragma foreign_keys").Scan(&foreignKeys); err != nil {
+			return err
+		}
+		if foreignKeys {
+			if _, err := conn.ExecContext(ctx, "pragma foreign_keys = off"); err != nil {
+				return err
+			}
+			defer conn.ExecContext(ctx, "pragma foreign_keys = on")
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
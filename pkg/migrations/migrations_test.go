@@ -0,0 +1,156 @@
+package migrations_test
+
+import (
+	"cp/pkg/api"
+	"cp/pkg/dbtest"
+	"cp/pkg/ledger"
+	"cp/pkg/migrations"
+	"testing"
+	"time"
+)
+
+func status(t *testing.T, migrator *migrations.Migrator) (applied, pending int) {
+	t.Helper()
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			applied++
+		} else {
+			pending++
+		}
+	}
+	return applied, pending
+}
+
+func TestUpIsIdempotent(t *testing.T) {
+	migrator := migrations.NewMigrator(dbtest.OpenEmpty(t))
+	if applied, pending := status(t, migrator); applied != 0 || pending == 0 {
+		t.Fatalf("%d applied and %d pending migrations on an empty database", applied, pending)
+	}
+
+	result, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, pending := status(t, migrator)
+	if applied != len(result) || pending != 0 {
+		t.Fatalf("%d applied and %d pending migrations, after applying %d", applied, pending, len(result))
+	}
+	for i := 1; i < len(result); i++ {
+		if result[i].Version <= result[i-1].Version {
+			t.Fatalf("%04d was applied after %04d", result[i].Version, result[i-1].Version)
+		}
+	}
+
+	if result, err := migrator.Up(); err != nil || len(result) != 0 {
+		t.Fatalf("applied %d migrations again: %v", len(result), err)
+	}
+	if result, err := migrator.Down(0); err != nil || len(result) != 0 {
+		t.Fatalf("reverted %d migrations without any step: %v", len(result), err)
+	}
+	if again, _ := status(t, migrator); again != applied {
+		t.Fatalf("%d applied migrations, expected %d", again, applied)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	db := dbtest.Open(t)
+	migrator := migrations.NewMigrator(db)
+	applied, _ := status(t, migrator)
+
+	// Reverting more steps than applied stops at the first migration
+	reverted, err := migrator.Down(applied + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != applied {
+		t.Fatalf("reverted %d migrations, expected %d", len(reverted), applied)
+	}
+	for i := 1; i < len(reverted); i++ {
+		if reverted[i].Version >= reverted[i-1].Version {
+			t.Fatalf("%04d was reverted after %04d", reverted[i].Version, reverted[i-1].Version)
+		}
+	}
+	var tables []string
+	if err := db.Raw("select name from sqlite_master where type = 'table' and name not like 'sqlite_%' and name != 'schema_migrations'").Scan(&tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Fatalf("the tables %v are left after reverting every migration", tables)
+	}
+
+	result, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != applied {
+		t.Fatalf("applied %d migrations, expected %d", len(result), applied)
+	}
+	if again, pending := status(t, migrator); again != applied || pending != 0 {
+		t.Fatalf("%d applied and %d pending migrations", again, pending)
+	}
+}
+
+// TestMigrateBaseline migrates a database created by the releases before the
+// migrations, the credits of which are moved to the ledger
+func TestMigrateBaseline(t *testing.T) {
+	db := dbtest.OpenEmpty(t)
+	for _, statement := range []string{
+		"CREATE TABLE `groups` (`id` text,`name` text,`created_at` datetime,PRIMARY KEY (`id`))",
+		"CREATE TABLE `users` (`id` text,`username` text,`email` text,`name` text,`contact_info` text,`about` text,`profile_picture_id` text,`created_at` datetime,PRIMARY KEY (`id`))",
+		"CREATE TABLE `memberships` (`group_id` text,`user_id` text,`permission` text,`member_confirmed` numeric,`group_confirmed` numeric,`created_at` datetime,PRIMARY KEY (`group_id`,`user_id`))",
+		"CREATE TABLE `credits` (`id` text,`group_id` text,`sent_to_user_id` text,`sent_to_group_id` text,`sent_to_type` text,`sent_by_user_id` text,`sent_by_group_id` text,`sent_by_type` text,`amount` integer,`created_at` datetime,`notes` text,PRIMARY KEY (`id`))",
+		"INSERT INTO `groups` VALUES ('group', 'Group', '2021-01-01 00:00:00')",
+		"INSERT INTO `users` VALUES ('alice', 'alice', 'alice@example.com', 'Alice', '', '', NULL, '2021-01-01 00:00:00')",
+		"INSERT INTO `users` VALUES ('bob', 'bob', 'bob@example.com', 'Bob', '', '', NULL, '2021-01-01 00:00:00')",
+		"INSERT INTO `memberships` VALUES ('group', 'alice', 'admin', 1, 1, '2021-01-01 00:00:00')",
+		"INSERT INTO `memberships` VALUES ('group', 'bob', 'member', 1, 1, '2021-01-01 00:00:00')",
+		"INSERT INTO `credits` VALUES ('00000000-0000-0000-0000-000000000001', 'group', 'alice', NULL, 'user', NULL, 'group', 'group', 36000000000000, '2021-01-02 00:00:00', 'Welcome')",
+		"INSERT INTO `credits` VALUES ('00000000-0000-0000-0000-000000000002', 'group', 'bob', NULL, 'user', 'alice', NULL, 'user', 10800000000000, '2021-01-03 00:00:00', 'Gardening')",
+		"INSERT INTO `credits` VALUES ('00000000-0000-0000-0000-000000000003', 'group', NULL, 'group', 'group', 'bob', NULL, 'user', 3600000000000, '2021-01-04 00:00:00', '')",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := migrations.NewMigrator(db).Up(); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable("credits") {
+		t.Fatal("the credits table is left")
+	}
+	var user api.User
+	if err := db.First(&user, "id = ?", "alice").Error; err != nil || user.Email != "alice@example.com" {
+		t.Fatalf("the user is %+v: %v", user, err)
+	}
+
+	ledgerStore := ledger.NewLedgerStore(db)
+	groupID, alice, bob := "group", "alice", "bob"
+	for _, test := range []struct {
+		owner    *api.Target
+		expected time.Duration
+	}{
+		{&api.Target{Type: api.GroupTarget, GroupID: &groupID}, -9 * time.Hour},
+		{&api.Target{Type: api.UserTarget, UserID: &alice}, 7 * time.Hour},
+		{&api.Target{Type: api.UserTarget, UserID: &bob}, 2 * time.Hour},
+	} {
+		balance, err := ledgerStore.GetBalance(groupID, test.owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if balance != test.expected {
+			t.Fatalf("the balance of the %s is %s, expected %s", test.owner.Type, balance, test.expected)
+		}
+	}
+	entry, err := ledgerStore.GetEntry("00000000-0000-0000-0000-000000000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Notes != "Gardening" || len(entry.Postings) != 2 {
+		t.Fatalf("the entry is %+v", entry)
+	}
+}
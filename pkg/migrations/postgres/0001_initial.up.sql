@@ -0,0 +1,14 @@
+-- The tables of the releases before the migrations, as created by their
+-- AutoMigrate. Existing databases already have them, so that this migration
+-- only records them. The columns and tables added since then are created by
+-- the next migration.
+CREATE TABLE IF NOT EXISTS "groups" (id text, name text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE IF NOT EXISTS users (id text, username text, email text, name text, contact_info text, about text, profile_picture_id text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE IF NOT EXISTS memberships (group_id text, user_id text, permission text, member_confirmed boolean, group_confirmed boolean, created_at timestamptz, PRIMARY KEY (group_id, user_id));
+CREATE TABLE IF NOT EXISTS posts (id text, created_at timestamptz, updated_at timestamptz, deleted_at timestamptz, group_id text, author_id text, title text, description text, type text, value_from bigint, value_to bigint, PRIMARY KEY (id));
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at);
+CREATE TABLE IF NOT EXISTS messages (id text, author_id text, content text, thread_id text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE IF NOT EXISTS acknowledgements (id text, group_id text, sent_to_user_id text, sent_to_group_id text, sent_to_type text, sent_by_user_id text, sent_by_group_id text, sent_by_type text, created_at timestamptz, type text, notes text, PRIMARY KEY (id));
+CREATE TABLE IF NOT EXISTS credits (id text, group_id text, sent_to_user_id text, sent_to_group_id text, sent_to_type text, sent_by_user_id text, sent_by_group_id text, sent_by_type text, amount bigint, created_at timestamptz, notes text, PRIMARY KEY (id));
+CREATE TABLE IF NOT EXISTS notifications (id text, user_id text, title text, message text, link text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE IF NOT EXISTS images (id text, post_id text, group_id text, created_at timestamptz, PRIMARY KEY (id));
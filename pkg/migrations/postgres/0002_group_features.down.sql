@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS history_snapshot_users;
+DROP TABLE IF EXISTS history_snapshots;
+DROP TABLE IF EXISTS exchanges;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS roles;
+ALTER TABLE memberships DROP COLUMN role_id;
+ALTER TABLE users DROP COLUMN site_administrator;
+ALTER TABLE "groups" DROP COLUMN group_overdraft_limit;
+ALTER TABLE "groups" DROP COLUMN member_overdraft_limit;
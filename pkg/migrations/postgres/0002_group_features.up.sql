@@ -0,0 +1,20 @@
+-- The overdraft limits, the site administrators, the roles, the ledger, the
+-- access tokens, the invitations, the exchanges and the history snapshots.
+-- The added columns get their default in the existing rows. The credits are
+-- moved to the ledger by 0011_retire_credits.
+ALTER TABLE "groups" ADD COLUMN member_overdraft_limit bigint DEFAULT 36000000000000;
+ALTER TABLE "groups" ADD COLUMN group_overdraft_limit bigint DEFAULT 360000000000000;
+ALTER TABLE users ADD COLUMN site_administrator boolean DEFAULT false;
+ALTER TABLE memberships ADD COLUMN role_id text;
+
+CREATE TABLE roles (id text, group_id text, name text, permission text, capabilities text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE accounts (id text, group_id text, owner_user_id text, owner_group_id text, owner_type text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE journal_entries (id text, group_id text, notes text, reversal_of_id text, post_id text, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE postings (id text, entry_id text, account_id text, amount bigint, PRIMARY KEY (id));
+CREATE TABLE personal_access_tokens (id text, user_id text, name text, token_hash text, prefix text, scope text, created_at timestamptz, last_used_at timestamptz, revoked_at timestamptz, PRIMARY KEY (id));
+CREATE UNIQUE INDEX idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+CREATE TABLE invitations (id text, group_id text, created_by_id text, code text, max_uses bigint, uses bigint, expires_at timestamptz, revoked_at timestamptz, created_at timestamptz, PRIMARY KEY (id));
+CREATE UNIQUE INDEX idx_invitations_code ON invitations (code);
+CREATE TABLE exchanges (id text, group_id text, post_id text, responder_id text, amount bigint, notes text, status text, author_done_at timestamptz, responder_done_at timestamptz, journal_entry_id text, created_at timestamptz, updated_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE history_snapshots (id text, group_id text, until timestamptz, all_request_count bigint, all_offer_count bigint, request_count bigint, offer_count bigint, credits bigint, created_at timestamptz, PRIMARY KEY (id));
+CREATE TABLE history_snapshot_users (id text, snapshot_id text, user_id text, request_count bigint, offer_count bigint, credits bigint, PRIMARY KEY (id));
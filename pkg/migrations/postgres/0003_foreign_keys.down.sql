@@ -0,0 +1,33 @@
+ALTER TABLE history_snapshot_users DROP CONSTRAINT IF EXISTS fk_history_snapshot_users_user;
+ALTER TABLE history_snapshot_users DROP CONSTRAINT IF EXISTS fk_history_snapshot_users_snapshot;
+ALTER TABLE history_snapshots DROP CONSTRAINT IF EXISTS fk_history_snapshots_group;
+ALTER TABLE exchanges DROP CONSTRAINT IF EXISTS fk_exchanges_journal_entry;
+ALTER TABLE exchanges DROP CONSTRAINT IF EXISTS fk_exchanges_responder;
+ALTER TABLE exchanges DROP CONSTRAINT IF EXISTS fk_exchanges_post;
+ALTER TABLE exchanges DROP CONSTRAINT IF EXISTS fk_exchanges_group;
+ALTER TABLE invitations DROP CONSTRAINT IF EXISTS fk_invitations_created_by;
+ALTER TABLE invitations DROP CONSTRAINT IF EXISTS fk_invitations_group;
+ALTER TABLE personal_access_tokens DROP CONSTRAINT IF EXISTS fk_personal_access_tokens_user;
+ALTER TABLE postings DROP CONSTRAINT IF EXISTS fk_postings_account;
+ALTER TABLE postings DROP CONSTRAINT IF EXISTS fk_postings_entry;
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS fk_journal_entries_post;
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS fk_journal_entries_reversal_of;
+ALTER TABLE journal_entries DROP CONSTRAINT IF EXISTS fk_journal_entries_group;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS fk_accounts_owner_group;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS fk_accounts_owner_user;
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS fk_accounts_group;
+ALTER TABLE images DROP CONSTRAINT IF EXISTS fk_images_group;
+ALTER TABLE images DROP CONSTRAINT IF EXISTS fk_images_post;
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS fk_notifications_user;
+ALTER TABLE acknowledgements DROP CONSTRAINT IF EXISTS fk_acknowledgements_sent_by_group;
+ALTER TABLE acknowledgements DROP CONSTRAINT IF EXISTS fk_acknowledgements_sent_by_user;
+ALTER TABLE acknowledgements DROP CONSTRAINT IF EXISTS fk_acknowledgements_sent_to_group;
+ALTER TABLE acknowledgements DROP CONSTRAINT IF EXISTS fk_acknowledgements_sent_to_user;
+ALTER TABLE acknowledgements DROP CONSTRAINT IF EXISTS fk_acknowledgements_group;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_messages_author;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_author;
+ALTER TABLE posts DROP CONSTRAINT IF EXISTS fk_posts_group;
+ALTER TABLE memberships DROP CONSTRAINT IF EXISTS fk_memberships_role;
+ALTER TABLE memberships DROP CONSTRAINT IF EXISTS fk_memberships_user;
+ALTER TABLE memberships DROP CONSTRAINT IF EXISTS fk_memberships_group;
+ALTER TABLE roles DROP CONSTRAINT IF EXISTS fk_roles_group;
@@ -0,0 +1,35 @@
+-- The constraints are NOT VALID, so that the rows left behind by deleted
+-- groups do not prevent the migration. Only the new rows are checked.
+ALTER TABLE roles ADD CONSTRAINT fk_roles_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE memberships ADD CONSTRAINT fk_memberships_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE memberships ADD CONSTRAINT fk_memberships_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE memberships ADD CONSTRAINT fk_memberships_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE SET NULL NOT VALID;
+ALTER TABLE posts ADD CONSTRAINT fk_posts_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE posts ADD CONSTRAINT fk_posts_author FOREIGN KEY (author_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE messages ADD CONSTRAINT fk_messages_author FOREIGN KEY (author_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE acknowledgements ADD CONSTRAINT fk_acknowledgements_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE acknowledgements ADD CONSTRAINT fk_acknowledgements_sent_to_user FOREIGN KEY (sent_to_user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE acknowledgements ADD CONSTRAINT fk_acknowledgements_sent_to_group FOREIGN KEY (sent_to_group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE acknowledgements ADD CONSTRAINT fk_acknowledgements_sent_by_user FOREIGN KEY (sent_by_user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE acknowledgements ADD CONSTRAINT fk_acknowledgements_sent_by_group FOREIGN KEY (sent_by_group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE notifications ADD CONSTRAINT fk_notifications_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE images ADD CONSTRAINT fk_images_post FOREIGN KEY (post_id) REFERENCES posts (id) NOT VALID;
+ALTER TABLE images ADD CONSTRAINT fk_images_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE accounts ADD CONSTRAINT fk_accounts_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE accounts ADD CONSTRAINT fk_accounts_owner_user FOREIGN KEY (owner_user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE accounts ADD CONSTRAINT fk_accounts_owner_group FOREIGN KEY (owner_group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE journal_entries ADD CONSTRAINT fk_journal_entries_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE journal_entries ADD CONSTRAINT fk_journal_entries_reversal_of FOREIGN KEY (reversal_of_id) REFERENCES journal_entries (id) NOT VALID;
+ALTER TABLE journal_entries ADD CONSTRAINT fk_journal_entries_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE SET NULL NOT VALID;
+ALTER TABLE postings ADD CONSTRAINT fk_postings_entry FOREIGN KEY (entry_id) REFERENCES journal_entries (id) NOT VALID;
+ALTER TABLE postings ADD CONSTRAINT fk_postings_account FOREIGN KEY (account_id) REFERENCES accounts (id) NOT VALID;
+ALTER TABLE personal_access_tokens ADD CONSTRAINT fk_personal_access_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE invitations ADD CONSTRAINT fk_invitations_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE invitations ADD CONSTRAINT fk_invitations_created_by FOREIGN KEY (created_by_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE exchanges ADD CONSTRAINT fk_exchanges_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE exchanges ADD CONSTRAINT fk_exchanges_post FOREIGN KEY (post_id) REFERENCES posts (id) NOT VALID;
+ALTER TABLE exchanges ADD CONSTRAINT fk_exchanges_responder FOREIGN KEY (responder_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE exchanges ADD CONSTRAINT fk_exchanges_journal_entry FOREIGN KEY (journal_entry_id) REFERENCES journal_entries (id) NOT VALID;
+ALTER TABLE history_snapshots ADD CONSTRAINT fk_history_snapshots_group FOREIGN KEY (group_id) REFERENCES "groups" (id) NOT VALID;
+ALTER TABLE history_snapshot_users ADD CONSTRAINT fk_history_snapshot_users_snapshot FOREIGN KEY (snapshot_id) REFERENCES history_snapshots (id) ON DELETE CASCADE NOT VALID;
+ALTER TABLE history_snapshot_users ADD CONSTRAINT fk_history_snapshot_users_user FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
@@ -0,0 +1,23 @@
+DROP INDEX IF EXISTS idx_history_snapshot_users_snapshot_id;
+DROP INDEX IF EXISTS idx_history_snapshots_group_id;
+DROP INDEX IF EXISTS idx_exchanges_responder_id;
+DROP INDEX IF EXISTS idx_exchanges_post_id;
+DROP INDEX IF EXISTS idx_exchanges_group_id;
+DROP INDEX IF EXISTS idx_invitations_group_id;
+DROP INDEX IF EXISTS idx_personal_access_tokens_user_id;
+DROP INDEX IF EXISTS idx_postings_account_id;
+DROP INDEX IF EXISTS idx_postings_entry_id;
+DROP INDEX IF EXISTS idx_journal_entries_post_id;
+DROP INDEX IF EXISTS idx_journal_entries_group_id;
+DROP INDEX IF EXISTS idx_accounts_group_id;
+DROP INDEX IF EXISTS idx_images_group_id;
+DROP INDEX IF EXISTS idx_images_post_id;
+DROP INDEX IF EXISTS idx_notifications_user_id;
+DROP INDEX IF EXISTS idx_roles_group_id;
+DROP INDEX IF EXISTS idx_memberships_user_id;
+DROP INDEX IF EXISTS idx_credits_group_id;
+DROP INDEX IF EXISTS idx_acknowledgements_group_id;
+DROP INDEX IF EXISTS idx_messages_author_id;
+DROP INDEX IF EXISTS idx_messages_thread_id;
+DROP INDEX IF EXISTS idx_posts_author_id;
+DROP INDEX IF EXISTS idx_posts_group_id;
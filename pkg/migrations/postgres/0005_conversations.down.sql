@@ -0,0 +1,3 @@
+DELETE FROM messages WHERE thread_id IN (SELECT id FROM conversations);
+DROP TABLE IF EXISTS conversation_participants;
+DROP TABLE IF EXISTS conversations;
@@ -0,0 +1,4 @@
+CREATE TABLE conversations (id text, group_id text, subject text, created_by_id text, last_message_at timestamptz, created_at timestamptz, PRIMARY KEY (id), CONSTRAINT fk_conversations_group FOREIGN KEY (group_id) REFERENCES "groups" (id), CONSTRAINT fk_conversations_created_by FOREIGN KEY (created_by_id) REFERENCES users (id));
+CREATE INDEX idx_conversations_group_id ON conversations (group_id);
+CREATE TABLE conversation_participants (conversation_id text, user_id text, read_at timestamptz, created_at timestamptz, PRIMARY KEY (conversation_id, user_id), CONSTRAINT fk_conversation_participants_conversation FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE, CONSTRAINT fk_conversation_participants_user FOREIGN KEY (user_id) REFERENCES users (id));
+CREATE INDEX idx_conversation_participants_user_id ON conversation_participants (user_id);
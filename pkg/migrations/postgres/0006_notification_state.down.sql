@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS notification_mutes;
+DROP INDEX IF EXISTS idx_notifications_user_id_unread;
+ALTER TABLE notifications DROP COLUMN IF EXISTS type, DROP COLUMN IF EXISTS group_id, DROP COLUMN IF EXISTS read_at;
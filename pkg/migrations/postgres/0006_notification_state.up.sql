@@ -0,0 +1,3 @@
+ALTER TABLE notifications ADD COLUMN type text NOT NULL DEFAULT '', ADD COLUMN group_id text, ADD COLUMN read_at timestamptz;
+CREATE INDEX idx_notifications_user_id_unread ON notifications (user_id) WHERE read_at IS NULL;
+CREATE TABLE notification_mutes (user_id text, type text NOT NULL DEFAULT '', group_id text NOT NULL DEFAULT '', created_at timestamptz, PRIMARY KEY (user_id, type, group_id), CONSTRAINT fk_notification_mutes_user FOREIGN KEY (user_id) REFERENCES users (id));
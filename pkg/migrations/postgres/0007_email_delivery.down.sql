@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS email_preferences;
+DROP INDEX IF EXISTS idx_notifications_email_batch_id;
+DROP INDEX IF EXISTS idx_notifications_user_id_pending;
+ALTER TABLE notifications DROP COLUMN IF EXISTS emailed_at, DROP COLUMN IF EXISTS email_batch_id;
@@ -0,0 +1,3 @@
+CREATE TABLE jobs (id text, kind text, payload text, status text, attempts bigint, max_attempts bigint, last_error text, run_at timestamptz, locked_at timestamptz, finished_at timestamptz, created_at timestamptz, updated_at timestamptz, PRIMARY KEY (id));
+CREATE INDEX idx_jobs_status_run_at ON jobs (status, run_at);
+CREATE INDEX idx_jobs_created_at ON jobs (created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_groups_deleted_at;
+ALTER TABLE "groups" DROP COLUMN IF EXISTS archived_at, DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,2 @@
+ALTER TABLE "groups" ADD COLUMN archived_at timestamptz, ADD COLUMN deleted_at timestamptz;
+CREATE INDEX idx_groups_deleted_at ON "groups" (deleted_at);
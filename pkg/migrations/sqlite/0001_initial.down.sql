@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS `users_fts`;
+DROP TABLE IF EXISTS `messages_fts`;
+DROP TABLE IF EXISTS `posts_fts`;
+DROP TABLE IF EXISTS `images`;
+DROP TABLE IF EXISTS `notifications`;
+DROP TABLE IF EXISTS `credits`;
+DROP TABLE IF EXISTS `acknowledgements`;
+DROP TABLE IF EXISTS `messages`;
+DROP TABLE IF EXISTS `posts`;
+DROP TABLE IF EXISTS `memberships`;
+DROP TABLE IF EXISTS `users`;
+DROP TABLE IF EXISTS "groups";
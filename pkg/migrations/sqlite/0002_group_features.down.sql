@@ -0,0 +1,24 @@
+DROP TABLE IF EXISTS `history_snapshot_users`;
+DROP TABLE IF EXISTS `history_snapshots`;
+DROP TABLE IF EXISTS `exchanges`;
+DROP TABLE IF EXISTS `invitations`;
+DROP TABLE IF EXISTS `personal_access_tokens`;
+DROP TABLE IF EXISTS `postings`;
+DROP TABLE IF EXISTS `journal_entries`;
+DROP TABLE IF EXISTS `accounts`;
+DROP TABLE IF EXISTS `roles`;
+
+CREATE TABLE `memberships_new` (`group_id` text,`user_id` text,`permission` text,`member_confirmed` numeric,`group_confirmed` numeric,`created_at` datetime,PRIMARY KEY (`group_id`,`user_id`));
+INSERT INTO `memberships_new` (`group_id`,`user_id`,`permission`,`member_confirmed`,`group_confirmed`,`created_at`) SELECT `group_id`,`user_id`,`permission`,`member_confirmed`,`group_confirmed`,`created_at` FROM `memberships`;
+DROP TABLE `memberships`;
+ALTER TABLE `memberships_new` RENAME TO `memberships`;
+
+CREATE TABLE `users_new` (`id` text,`username` text,`email` text,`name` text,`contact_info` text,`about` text,`profile_picture_id` text,`created_at` datetime,PRIMARY KEY (`id`));
+INSERT INTO `users_new` (`id`,`username`,`email`,`name`,`contact_info`,`about`,`profile_picture_id`,`created_at`) SELECT `id`,`username`,`email`,`name`,`contact_info`,`about`,`profile_picture_id`,`created_at` FROM `users`;
+DROP TABLE `users`;
+ALTER TABLE `users_new` RENAME TO `users`;
+
+CREATE TABLE `groups_new` (`id` text,`name` text,`created_at` datetime,PRIMARY KEY (`id`));
+INSERT INTO `groups_new` (`id`,`name`,`created_at`) SELECT `id`,`name`,`created_at` FROM "groups";
+DROP TABLE "groups";
+ALTER TABLE `groups_new` RENAME TO "groups";
@@ -0,0 +1,20 @@
+-- The overdraft limits, the site administrators, the roles, the ledger, the
+-- access tokens, the invitations, the exchanges and the history snapshots.
+-- The added columns get their default in the existing rows. The credits are
+-- moved to the ledger by 0011_retire_credits.
+ALTER TABLE `groups` ADD COLUMN `member_overdraft_limit` integer DEFAULT 36000000000000;
+ALTER TABLE `groups` ADD COLUMN `group_overdraft_limit` integer DEFAULT 360000000000000;
+ALTER TABLE `users` ADD COLUMN `site_administrator` numeric DEFAULT false;
+ALTER TABLE `memberships` ADD COLUMN `role_id` text;
+
+CREATE TABLE `roles` (`id` text,`group_id` text,`name` text,`permission` text,`capabilities` text,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE TABLE `accounts` (`id` text,`group_id` text,`owner_user_id` text,`owner_group_id` text,`owner_type` text,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE TABLE `journal_entries` (`id` text,`group_id` text,`notes` text,`reversal_of_id` text,`post_id` text,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE TABLE `postings` (`id` text,`entry_id` text,`account_id` text,`amount` integer,PRIMARY KEY (`id`));
+CREATE TABLE `personal_access_tokens` (`id` text,`user_id` text,`name` text,`token_hash` text,`prefix` text,`scope` text,`created_at` datetime,`last_used_at` datetime,`revoked_at` datetime,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_personal_access_tokens_token_hash` ON `personal_access_tokens`(`token_hash`);
+CREATE TABLE `invitations` (`id` text,`group_id` text,`created_by_id` text,`code` text,`max_uses` integer,`uses` integer,`expires_at` datetime,`revoked_at` datetime,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE UNIQUE INDEX `idx_invitations_code` ON `invitations`(`code`);
+CREATE TABLE `exchanges` (`id` text,`group_id` text,`post_id` text,`responder_id` text,`amount` integer,`notes` text,`status` text,`author_done_at` datetime,`responder_done_at` datetime,`journal_entry_id` text,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`));
+CREATE TABLE `history_snapshots` (`id` text,`group_id` text,`until` datetime,`all_request_count` integer,`all_offer_count` integer,`request_count` integer,`offer_count` integer,`credits` integer,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE TABLE `history_snapshot_users` (`id` text,`snapshot_id` text,`user_id` text,`request_count` integer,`offer_count` integer,`credits` integer,PRIMARY KEY (`id`));
@@ -0,0 +1,93 @@
+-- SQLite cannot add constraints to a table, so that the tables are created
+-- again with their foreign keys and their rows copied. The rows are not
+-- checked, like the NOT VALID constraints of Postgres: the rows left behind
+-- by deleted groups are kept, and only the new rows must reference existing
+-- ones. The search index of the posts and the messages is dropped, since its
+-- triggers would prevent renaming the tables. The search engine creates it
+-- again on startup.
+DROP TRIGGER IF EXISTS `posts_fts_ai`;
+DROP TRIGGER IF EXISTS `posts_fts_ad`;
+DROP TRIGGER IF EXISTS `posts_fts_au`;
+DROP TRIGGER IF EXISTS `messages_fts_ai`;
+DROP TRIGGER IF EXISTS `messages_fts_ad`;
+DROP TRIGGER IF EXISTS `messages_fts_au`;
+DROP TABLE IF EXISTS `posts_fts`;
+DROP TABLE IF EXISTS `messages_fts`;
+
+CREATE TABLE `roles_new` (`id` text,`group_id` text,`name` text,`permission` text,`capabilities` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_roles_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`));
+INSERT INTO `roles_new` (`id`,`group_id`,`name`,`permission`,`capabilities`,`created_at`) SELECT `id`,`group_id`,`name`,`permission`,`capabilities`,`created_at` FROM `roles`;
+DROP TABLE `roles`;
+ALTER TABLE `roles_new` RENAME TO `roles`;
+
+CREATE TABLE `memberships_new` (`group_id` text,`user_id` text,`permission` text,`role_id` text,`member_confirmed` numeric,`group_confirmed` numeric,`created_at` datetime,PRIMARY KEY (`group_id`,`user_id`),CONSTRAINT `fk_memberships_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_memberships_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_memberships_role` FOREIGN KEY (`role_id`) REFERENCES `roles`(`id`) ON DELETE SET NULL);
+INSERT INTO `memberships_new` (`group_id`,`user_id`,`permission`,`role_id`,`member_confirmed`,`group_confirmed`,`created_at`) SELECT `group_id`,`user_id`,`permission`,`role_id`,`member_confirmed`,`group_confirmed`,`created_at` FROM `memberships`;
+DROP TABLE `memberships`;
+ALTER TABLE `memberships_new` RENAME TO `memberships`;
+
+CREATE TABLE `posts_new` (`id` text,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`group_id` text,`author_id` text,`title` text,`description` text,`type` text,`value_from` integer,`value_to` integer,PRIMARY KEY (`id`),CONSTRAINT `fk_posts_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`));
+INSERT INTO `posts_new` (`id`,`created_at`,`updated_at`,`deleted_at`,`group_id`,`author_id`,`title`,`description`,`type`,`value_from`,`value_to`) SELECT `id`,`created_at`,`updated_at`,`deleted_at`,`group_id`,`author_id`,`title`,`description`,`type`,`value_from`,`value_to` FROM `posts`;
+DROP TABLE `posts`;
+ALTER TABLE `posts_new` RENAME TO `posts`;
+CREATE INDEX `idx_posts_deleted_at` ON `posts`(`deleted_at`);
+
+CREATE TABLE `messages_new` (`id` text,`author_id` text,`content` text,`thread_id` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_messages_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`));
+INSERT INTO `messages_new` (`id`,`author_id`,`content`,`thread_id`,`created_at`) SELECT `id`,`author_id`,`content`,`thread_id`,`created_at` FROM `messages`;
+DROP TABLE `messages`;
+ALTER TABLE `messages_new` RENAME TO `messages`;
+
+CREATE TABLE `acknowledgements_new` (`id` text,`group_id` text,`sent_to_user_id` text,`sent_to_group_id` text,`sent_to_type` text,`sent_by_user_id` text,`sent_by_group_id` text,`sent_by_type` text,`created_at` datetime,`type` text,`notes` text,PRIMARY KEY (`id`),CONSTRAINT `fk_acknowledgements_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_acknowledgements_sent_to_user` FOREIGN KEY (`sent_to_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_acknowledgements_sent_to_group` FOREIGN KEY (`sent_to_group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_acknowledgements_sent_by_user` FOREIGN KEY (`sent_by_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_acknowledgements_sent_by_group` FOREIGN KEY (`sent_by_group_id`) REFERENCES "groups"(`id`));
+INSERT INTO `acknowledgements_new` (`id`,`group_id`,`sent_to_user_id`,`sent_to_group_id`,`sent_to_type`,`sent_by_user_id`,`sent_by_group_id`,`sent_by_type`,`created_at`,`type`,`notes`) SELECT `id`,`group_id`,`sent_to_user_id`,`sent_to_group_id`,`sent_to_type`,`sent_by_user_id`,`sent_by_group_id`,`sent_by_type`,`created_at`,`type`,`notes` FROM `acknowledgements`;
+DROP TABLE `acknowledgements`;
+ALTER TABLE `acknowledgements_new` RENAME TO `acknowledgements`;
+
+CREATE TABLE `notifications_new` (`id` text,`user_id` text,`title` text,`message` text,`link` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_notifications_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+INSERT INTO `notifications_new` (`id`,`user_id`,`title`,`message`,`link`,`created_at`) SELECT `id`,`user_id`,`title`,`message`,`link`,`created_at` FROM `notifications`;
+DROP TABLE `notifications`;
+ALTER TABLE `notifications_new` RENAME TO `notifications`;
+
+CREATE TABLE `images_new` (`id` text,`post_id` text,`group_id` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_images_post` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`),CONSTRAINT `fk_images_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`));
+INSERT INTO `images_new` (`id`,`post_id`,`group_id`,`created_at`) SELECT `id`,`post_id`,`group_id`,`created_at` FROM `images`;
+DROP TABLE `images`;
+ALTER TABLE `images_new` RENAME TO `images`;
+
+CREATE TABLE `accounts_new` (`id` text,`group_id` text,`owner_user_id` text,`owner_group_id` text,`owner_type` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_accounts_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_accounts_owner_user` FOREIGN KEY (`owner_user_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_accounts_owner_group` FOREIGN KEY (`owner_group_id`) REFERENCES "groups"(`id`));
+INSERT INTO `accounts_new` (`id`,`group_id`,`owner_user_id`,`owner_group_id`,`owner_type`,`created_at`) SELECT `id`,`group_id`,`owner_user_id`,`owner_group_id`,`owner_type`,`created_at` FROM `accounts`;
+DROP TABLE `accounts`;
+ALTER TABLE `accounts_new` RENAME TO `accounts`;
+
+CREATE TABLE `journal_entries_new` (`id` text,`group_id` text,`notes` text,`reversal_of_id` text,`post_id` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_journal_entries_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_journal_entries_reversal_of` FOREIGN KEY (`reversal_of_id`) REFERENCES `journal_entries`(`id`),CONSTRAINT `fk_journal_entries_post` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`) ON DELETE SET NULL);
+INSERT INTO `journal_entries_new` (`id`,`group_id`,`notes`,`reversal_of_id`,`post_id`,`created_at`) SELECT `id`,`group_id`,`notes`,`reversal_of_id`,`post_id`,`created_at` FROM `journal_entries`;
+DROP TABLE `journal_entries`;
+ALTER TABLE `journal_entries_new` RENAME TO `journal_entries`;
+
+CREATE TABLE `postings_new` (`id` text,`entry_id` text,`account_id` text,`amount` integer,PRIMARY KEY (`id`),CONSTRAINT `fk_postings_entry` FOREIGN KEY (`entry_id`) REFERENCES `journal_entries`(`id`),CONSTRAINT `fk_postings_account` FOREIGN KEY (`account_id`) REFERENCES `accounts`(`id`));
+INSERT INTO `postings_new` (`id`,`entry_id`,`account_id`,`amount`) SELECT `id`,`entry_id`,`account_id`,`amount` FROM `postings`;
+DROP TABLE `postings`;
+ALTER TABLE `postings_new` RENAME TO `postings`;
+
+CREATE TABLE `personal_access_tokens_new` (`id` text,`user_id` text,`name` text,`token_hash` text,`prefix` text,`scope` text,`created_at` datetime,`last_used_at` datetime,`revoked_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_personal_access_tokens_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+INSERT INTO `personal_access_tokens_new` (`id`,`user_id`,`name`,`token_hash`,`prefix`,`scope`,`created_at`,`last_used_at`,`revoked_at`) SELECT `id`,`user_id`,`name`,`token_hash`,`prefix`,`scope`,`created_at`,`last_used_at`,`revoked_at` FROM `personal_access_tokens`;
+DROP TABLE `personal_access_tokens`;
+ALTER TABLE `personal_access_tokens_new` RENAME TO `personal_access_tokens`;
+CREATE UNIQUE INDEX `idx_personal_access_tokens_token_hash` ON `personal_access_tokens`(`token_hash`);
+
+CREATE TABLE `invitations_new` (`id` text,`group_id` text,`created_by_id` text,`code` text,`max_uses` integer,`uses` integer,`expires_at` datetime,`revoked_at` datetime,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_invitations_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_invitations_created_by` FOREIGN KEY (`created_by_id`) REFERENCES `users`(`id`));
+INSERT INTO `invitations_new` (`id`,`group_id`,`created_by_id`,`code`,`max_uses`,`uses`,`expires_at`,`revoked_at`,`created_at`) SELECT `id`,`group_id`,`created_by_id`,`code`,`max_uses`,`uses`,`expires_at`,`revoked_at`,`created_at` FROM `invitations`;
+DROP TABLE `invitations`;
+ALTER TABLE `invitations_new` RENAME TO `invitations`;
+CREATE UNIQUE INDEX `idx_invitations_code` ON `invitations`(`code`);
+
+CREATE TABLE `exchanges_new` (`id` text,`group_id` text,`post_id` text,`responder_id` text,`amount` integer,`notes` text,`status` text,`author_done_at` datetime,`responder_done_at` datetime,`journal_entry_id` text,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_exchanges_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`),CONSTRAINT `fk_exchanges_post` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`),CONSTRAINT `fk_exchanges_responder` FOREIGN KEY (`responder_id`) REFERENCES `users`(`id`),CONSTRAINT `fk_exchanges_journal_entry` FOREIGN KEY (`journal_entry_id`) REFERENCES `journal_entries`(`id`));
+INSERT INTO `exchanges_new` (`id`,`group_id`,`post_id`,`responder_id`,`amount`,`notes`,`status`,`author_done_at`,`responder_done_at`,`journal_entry_id`,`created_at`,`updated_at`) SELECT `id`,`group_id`,`post_id`,`responder_id`,`amount`,`notes`,`status`,`author_done_at`,`responder_done_at`,`journal_entry_id`,`created_at`,`updated_at` FROM `exchanges`;
+DROP TABLE `exchanges`;
+ALTER TABLE `exchanges_new` RENAME TO `exchanges`;
+
+CREATE TABLE `history_snapshots_new` (`id` text,`group_id` text,`until` datetime,`all_request_count` integer,`all_offer_count` integer,`request_count` integer,`offer_count` integer,`credits` integer,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_history_snapshots_group` FOREIGN KEY (`group_id`) REFERENCES "groups"(`id`));
+INSERT INTO `history_snapshots_new` (`id`,`group_id`,`until`,`all_request_count`,`all_offer_count`,`request_count`,`offer_count`,`credits`,`created_at`) SELECT `id`,`group_id`,`until`,`all_request_count`,`all_offer_count`,`request_count`,`offer_count`,`credits`,`created_at` FROM `history_snapshots`;
+DROP TABLE `history_snapshots`;
+ALTER TABLE `history_snapshots_new` RENAME TO `history_snapshots`;
+
+CREATE TABLE `history_snapshot_users_new` (`id` text,`snapshot_id` text,`user_id` text,`request_count` integer,`offer_count` integer,`credits` integer,PRIMARY KEY (`id`),CONSTRAINT `fk_history_snapshot_users_snapshot` FOREIGN KEY (`snapshot_id`) REFERENCES `history_snapshots`(`id`) ON DELETE CASCADE,CONSTRAINT `fk_history_snapshot_users_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+INSERT INTO `history_snapshot_users_new` (`id`,`snapshot_id`,`user_id`,`request_count`,`offer_count`,`credits`) SELECT `id`,`snapshot_id`,`user_id`,`request_count`,`offer_count`,`credits` FROM `history_snapshot_users`;
+DROP TABLE `history_snapshot_users`;
+ALTER TABLE `history_snapshot_users_new` RENAME TO `history_snapshot_users`;
@@ -0,0 +1,23 @@
+CREATE INDEX IF NOT EXISTS idx_posts_group_id ON posts (group_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_posts_author_id ON posts (author_id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread_id ON messages (thread_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_author_id ON messages (author_id);
+CREATE INDEX IF NOT EXISTS idx_acknowledgements_group_id ON acknowledgements (group_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_credits_group_id ON credits (group_id);
+CREATE INDEX IF NOT EXISTS idx_memberships_user_id ON memberships (user_id);
+CREATE INDEX IF NOT EXISTS idx_roles_group_id ON roles (group_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_images_post_id ON images (post_id);
+CREATE INDEX IF NOT EXISTS idx_images_group_id ON images (group_id);
+CREATE INDEX IF NOT EXISTS idx_accounts_group_id ON accounts (group_id);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_group_id ON journal_entries (group_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_post_id ON journal_entries (post_id);
+CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account_id ON postings (account_id);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_group_id ON invitations (group_id);
+CREATE INDEX IF NOT EXISTS idx_exchanges_group_id ON exchanges (group_id);
+CREATE INDEX IF NOT EXISTS idx_exchanges_post_id ON exchanges (post_id);
+CREATE INDEX IF NOT EXISTS idx_exchanges_responder_id ON exchanges (responder_id);
+CREATE INDEX IF NOT EXISTS idx_history_snapshots_group_id ON history_snapshots (group_id, until);
+CREATE INDEX IF NOT EXISTS idx_history_snapshot_users_snapshot_id ON history_snapshot_users (snapshot_id);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS `notification_mutes`;
+DROP INDEX IF EXISTS idx_notifications_user_id_unread;
+DROP INDEX IF EXISTS idx_notifications_user_id;
+CREATE TABLE `notifications_new` (`id` text,`user_id` text,`title` text,`message` text,`link` text,`created_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_notifications_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+INSERT INTO `notifications_new` (`id`,`user_id`,`title`,`message`,`link`,`created_at`) SELECT `id`,`user_id`,`title`,`message`,`link`,`created_at` FROM `notifications`;
+DROP TABLE `notifications`;
+ALTER TABLE `notifications_new` RENAME TO `notifications`;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, created_at);
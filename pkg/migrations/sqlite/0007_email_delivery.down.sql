@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS `email_preferences`;
+DROP INDEX IF EXISTS idx_notifications_email_batch_id;
+DROP INDEX IF EXISTS idx_notifications_user_id_pending;
+DROP INDEX IF EXISTS idx_notifications_user_id_unread;
+DROP INDEX IF EXISTS idx_notifications_user_id;
+CREATE TABLE `notifications_new` (`id` text,`user_id` text,`title` text,`message` text,`link` text,`created_at` datetime,`type` text NOT NULL DEFAULT '',`group_id` text,`read_at` datetime,PRIMARY KEY (`id`),CONSTRAINT `fk_notifications_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+INSERT INTO `notifications_new` (`id`,`user_id`,`title`,`message`,`link`,`created_at`,`type`,`group_id`,`read_at`) SELECT `id`,`user_id`,`title`,`message`,`link`,`created_at`,`type`,`group_id`,`read_at` FROM `notifications`;
+DROP TABLE `notifications`;
+ALTER TABLE `notifications_new` RENAME TO `notifications`;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id, created_at);
+CREATE INDEX idx_notifications_user_id_unread ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE `notifications` ADD COLUMN `emailed_at` datetime;
+ALTER TABLE `notifications` ADD COLUMN `email_batch_id` text;
+UPDATE `notifications` SET `emailed_at` = `created_at`;
+CREATE INDEX idx_notifications_user_id_pending ON notifications (user_id) WHERE emailed_at IS NULL;
+CREATE INDEX idx_notifications_email_batch_id ON notifications (email_batch_id);
+CREATE TABLE `email_preferences` (`user_id` text,`frequency` text,`unsubscribe_token` text,`last_digest_at` datetime,`updated_at` datetime,PRIMARY KEY (`user_id`),CONSTRAINT `fk_email_preferences_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+CREATE UNIQUE INDEX idx_email_preferences_unsubscribe_token ON email_preferences (unsubscribe_token);
@@ -0,0 +1,3 @@
+CREATE TABLE `jobs` (`id` text,`kind` text,`payload` text,`status` text,`attempts` integer,`max_attempts` integer,`last_error` text,`run_at` datetime,`locked_at` datetime,`finished_at` datetime,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX idx_jobs_status_run_at ON jobs (status, run_at);
+CREATE INDEX idx_jobs_created_at ON jobs (created_at);
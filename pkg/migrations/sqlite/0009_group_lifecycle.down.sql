@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_groups_deleted_at;
+CREATE TABLE `groups_new` (`id` text,`name` text,`created_at` datetime,`member_overdraft_limit` integer DEFAULT 36000000000000,`group_overdraft_limit` integer DEFAULT 360000000000000,PRIMARY KEY (`id`));
+INSERT INTO `groups_new` (`id`,`name`,`created_at`,`member_overdraft_limit`,`group_overdraft_limit`) SELECT `id`,`name`,`created_at`,`member_overdraft_limit`,`group_overdraft_limit` FROM "groups";
+DROP TABLE "groups";
+ALTER TABLE `groups_new` RENAME TO "groups";
@@ -0,0 +1,3 @@
+ALTER TABLE "groups" ADD COLUMN `archived_at` datetime;
+ALTER TABLE "groups" ADD COLUMN `deleted_at` datetime;
+CREATE INDEX idx_groups_deleted_at ON "groups" (deleted_at);
@@ -0,0 +1,5 @@
+-- The tokens of the identity provider, previously stored in the session
+-- cookies. The users logged in before have to log in again once their id
+-- token expires
+CREATE TABLE `logins` (`id` text,`user_id` text,`id_token` text,`refresh_token` text,`expires_at` datetime,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX idx_logins_updated_at ON logins (updated_at);
@@ -0,0 +1,3 @@
+-- The table is created again empty, the credits stay in the ledger
+CREATE TABLE `credits` (`id` text,`group_id` text,`sent_to_user_id` text,`sent_to_group_id` text,`sent_to_type` text,`sent_by_user_id` text,`sent_by_group_id` text,`sent_by_type` text,`amount` integer,`created_at` datetime,`notes` text,PRIMARY KEY (`id`));
+CREATE INDEX idx_credits_group_id ON credits (group_id);
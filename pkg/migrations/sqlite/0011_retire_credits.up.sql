@@ -0,0 +1,48 @@
+-- The legacy credits are moved to the ledger, and their table is dropped.
+-- The journal entries keep the ID of the credits they were created from, the
+-- credits moved by an earlier release are skipped.
+INSERT INTO `accounts` (`id`,`group_id`,`owner_user_id`,`owner_group_id`,`owner_type`,`created_at`)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6))),
+       `group_id`,
+       CASE WHEN `owner_type` = 'user' THEN `owner_id` END,
+       CASE WHEN `owner_type` = 'group' THEN `owner_id` END,
+       `owner_type`,
+       `created_at`
+FROM (
+    SELECT `group_id`, `owner_type`, `owner_id`, min(`created_at`) AS `created_at`
+    FROM (
+        SELECT `group_id`, `sent_by_type` AS `owner_type`, CASE WHEN `sent_by_type` = 'user' THEN `sent_by_user_id` ELSE `sent_by_group_id` END AS `owner_id`, `created_at` FROM `credits`
+        UNION ALL
+        SELECT `group_id`, `sent_to_type`, CASE WHEN `sent_to_type` = 'user' THEN `sent_to_user_id` ELSE `sent_to_group_id` END, `created_at` FROM `credits`
+    ) AS `targets`
+    GROUP BY `group_id`, `owner_type`, `owner_id`
+) AS `owners`
+WHERE NOT EXISTS (
+    SELECT 1 FROM `accounts`
+    WHERE `accounts`.`group_id` = `owners`.`group_id`
+      AND `accounts`.`owner_type` = `owners`.`owner_type`
+      AND CASE WHEN `owners`.`owner_type` = 'user' THEN `accounts`.`owner_user_id` ELSE `accounts`.`owner_group_id` END = `owners`.`owner_id`
+);
+INSERT INTO `journal_entries` (`id`,`group_id`,`notes`,`created_at`)
+SELECT `id`, `group_id`, `notes`, `created_at` FROM `credits`
+WHERE `id` NOT IN (SELECT `id` FROM `journal_entries`);
+-- The postings of both sides are inserted by a single statement, the entries
+-- having postings already were moved by an earlier release
+INSERT INTO `postings` (`id`,`entry_id`,`account_id`,`amount`)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6))),
+       `entry_id`, `account_id`, `amount`
+FROM (
+    SELECT `credits`.`id` AS `entry_id`, `accounts`.`id` AS `account_id`, -`credits`.`amount` AS `amount`
+    FROM `credits` JOIN `accounts`
+      ON `accounts`.`group_id` = `credits`.`group_id`
+     AND `accounts`.`owner_type` = `credits`.`sent_by_type`
+     AND CASE WHEN `credits`.`sent_by_type` = 'user' THEN `accounts`.`owner_user_id` = `credits`.`sent_by_user_id` ELSE `accounts`.`owner_group_id` = `credits`.`sent_by_group_id` END
+    UNION ALL
+    SELECT `credits`.`id`, `accounts`.`id`, `credits`.`amount`
+    FROM `credits` JOIN `accounts`
+      ON `accounts`.`group_id` = `credits`.`group_id`
+     AND `accounts`.`owner_type` = `credits`.`sent_to_type`
+     AND CASE WHEN `credits`.`sent_to_type` = 'user' THEN `accounts`.`owner_user_id` = `credits`.`sent_to_user_id` ELSE `accounts`.`owner_group_id` = `credits`.`sent_to_group_id` END
+) AS `sides`
+WHERE NOT EXISTS (SELECT 1 FROM `postings` WHERE `postings`.`entry_id` = `sides`.`entry_id`);
+DROP TABLE `credits`;
@@ -2,55 +2,210 @@ package notifications
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/events"
+	"cp/pkg/pagination"
+	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"time"
 )
 
 type Store interface {
-	GetNotifications(userID string) ([]*api.Notification, error)
+	GetNotifications(userID string, page *pagination.Page) ([]*api.Notification, *pagination.Cursor, error)
 	ClearNotifications(userID string) error
+	DeleteNotification(userID string, notificationID string) error
+	MarkRead(userID string, notificationID string) error
+	MarkAllRead(userID string) error
 	AddNotification(notification *api.Notification) error
 	AddNotifications(notifications []*api.Notification) error
 	GetUnreadCount(userID string) (int, error)
+	GetMutes(userID string) ([]*api.NotificationMute, error)
+	SetMutes(userID string, mutes []*api.NotificationMute) error
 }
 
+// Queue receives the new notifications, to deliver them outside the site
+type Queue interface {
+	Enqueue(notifications ...*api.Notification)
+}
+
+type discardQueue struct{}
+
+func (discardQueue) Enqueue(...*api.Notification) {}
+
+// DiscardQueue delivers the notifications nowhere else than on the site
+var DiscardQueue Queue = discardQueue{}
+
 type NotificationStore struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events events.Publisher
+	queue  Queue
+}
+
+func NewNotificationStore(db *gorm.DB, publisher events.Publisher, queue Queue) *NotificationStore {
+	return &NotificationStore{db: db, events: publisher, queue: queue}
+}
+
+var _ Store = &NotificationStore{}
+
+type addedNotification struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
 }
 
-func NewNotificationStore(db *gorm.DB) *NotificationStore {
-	return &NotificationStore{db: db}
+func (n *NotificationStore) publish(notifications ...*api.Notification) {
+	for _, notification := range notifications {
+		n.events.Publish(&events.Event{
+			Type:  events.NotificationAdded,
+			Topic: events.UserTopic(notification.UserID),
+			Data: &addedNotification{
+				ID:    notification.ID,
+				Title: notification.Title,
+				Link:  notification.Link,
+			},
+		})
+	}
 }
 
-func (n *NotificationStore) GetNotifications(userID string) ([]*api.Notification, error) {
+// GetNotifications returns a page of the notifications of the user, newest
+// first
+func (n *NotificationStore) GetNotifications(userID string, page *pagination.Page) ([]*api.Notification, *pagination.Cursor, error) {
 	var result []*api.Notification
-	if err := n.db.Model(&api.Notification{}).
-		Order("created_at desc").
+	if err := page.Apply(n.db.Model(&api.Notification{}), "notifications", true).
 		Find(&result, "user_id = ?", userID).
 		Error; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return result, nil
+	count, more := page.Trim(len(result))
+	result = result[:count]
+	if !more {
+		return result, nil, nil
+	}
+	last := result[count-1]
+	return result, &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
 }
 
 func (n *NotificationStore) ClearNotifications(userID string) error {
-	return n.db.Where("user_id = ?").Delete(&api.Notification{}).Error
+	return n.db.Where("user_id = ?", userID).Delete(&api.Notification{}).Error
+}
+
+// DeleteNotification dismisses a notification of the user
+func (n *NotificationStore) DeleteNotification(userID string, notificationID string) error {
+	result := n.db.Where("id = ? and user_id = ?", notificationID, userID).Delete(&api.Notification{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
+
+// MarkRead marks a notification of the user as read. The time it was first
+// read at is kept
+func (n *NotificationStore) MarkRead(userID string, notificationID string) error {
+	result := n.db.
+		Model(&api.Notification{}).
+		Where("id = ? and user_id = ?", notificationID, userID).
+		Update("read_at", gorm.Expr("coalesce(read_at, ?)", time.Now()))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
+
+func (n *NotificationStore) MarkAllRead(userID string) error {
+	return n.db.
+		Model(&api.Notification{}).
+		Where("user_id = ? and read_at is null", userID).
+		Update("read_at", time.Now()).
+		Error
 }
 
 func (n *NotificationStore) AddNotification(notification *api.Notification) error {
-	return n.db.Create(notification).Error
+	return n.AddNotifications([]*api.Notification{notification})
 }
 
+// AddNotifications saves the notifications, except the ones muted by their
+// recipient
 func (n *NotificationStore) AddNotifications(notifications []*api.Notification) error {
+	notifications, err := n.withoutMuted(notifications)
+	if err != nil {
+		return err
+	}
 	if len(notifications) == 0 {
 		return nil
 	}
-	return n.db.Create(notifications).Error
+	if err := n.db.Create(notifications).Error; err != nil {
+		return err
+	}
+	n.publish(notifications...)
+	n.queue.Enqueue(notifications...)
+	return nil
 }
 
 func (n *NotificationStore) GetUnreadCount(userID string) (int, error) {
 	var result int64
-	if err := n.db.Model(&api.Notification{}).Where("user_id = ?", userID).Count(&result).Error; err != nil {
+	if err := n.db.Model(&api.Notification{}).Where("user_id = ? and read_at is null", userID).Count(&result).Error; err != nil {
 		return 0, err
 	}
 	return int(result), nil
 }
+
+func (n *NotificationStore) withoutMuted(notifications []*api.Notification) ([]*api.Notification, error) {
+	if len(notifications) == 0 {
+		return nil, nil
+	}
+	var userIDs []string
+	for _, notification := range notifications {
+		userIDs = append(userIDs, notification.UserID)
+	}
+	var mutes []*api.NotificationMute
+	if err := n.db.Where("user_id in ?", userIDs).Find(&mutes).Error; err != nil {
+		return nil, err
+	}
+	if len(mutes) == 0 {
+		return notifications, nil
+	}
+
+	var result []*api.Notification
+	for _, notification := range notifications {
+		muted := false
+		for _, mute := range mutes {
+			if mute.Mutes(notification) {
+				muted = true
+				break
+			}
+		}
+		if !muted {
+			result = append(result, notification)
+		}
+	}
+	return result, nil
+}
+
+func (n *NotificationStore) GetMutes(userID string) ([]*api.NotificationMute, error) {
+	var result []*api.NotificationMute
+	if err := n.db.Where("user_id = ?", userID).Find(&result).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetMutes replaces the mutes of the user
+func (n *NotificationStore) SetMutes(userID string, mutes []*api.NotificationMute) error {
+	return n.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&api.NotificationMute{}).Error; err != nil {
+			return err
+		}
+		if len(mutes) == 0 {
+			return nil
+		}
+		for _, mute := range mutes {
+			mute.UserID = userID
+		}
+		return tx.Create(mutes).Error
+	})
+}
@@ -0,0 +1,258 @@
+// Package oidctest provides an in-process OpenID Connect issuer, so that the
+// login flow can be exercised without a real identity provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "oidctest"
+
+type Claims struct {
+	Subject  string   `json:"sub"`
+	Email    string   `json:"email"`
+	Username string   `json:"preferred_username"`
+	Groups   []string `json:"groups"`
+}
+
+// Issuer is a fake OIDC issuer. Every authorization request is approved
+// automatically for the configured user.
+type Issuer struct {
+	Server   *httptest.Server
+	ClientID string
+
+	lock          sync.Mutex
+	key           *rsa.PrivateKey
+	claims        Claims
+	tokenTTL      time.Duration
+	codes         map[string]Claims
+	refreshTokens map[string]Claims
+}
+
+func NewIssuer(clientID string, claims Claims) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &Issuer{
+		ClientID:      clientID,
+		key:           key,
+		claims:        claims,
+		tokenTTL:      time.Hour,
+		codes:         map[string]Claims{},
+		refreshTokens: map[string]Claims{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.handleDiscovery)
+	mux.HandleFunc("/auth", issuer.handleAuth)
+	mux.HandleFunc("/token", issuer.handleToken)
+	mux.HandleFunc("/keys", issuer.handleKeys)
+	mux.HandleFunc("/logout", issuer.handleLogout)
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer, nil
+}
+
+// URL returns the issuer URL, to be used as the discovery URL
+func (i *Issuer) URL() string {
+	return i.Server.URL
+}
+
+func (i *Issuer) Close() {
+	i.Server.Close()
+}
+
+// SetClaims changes the user logged in by the next authorization requests
+func (i *Issuer) SetClaims(claims Claims) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.claims = claims
+}
+
+// SetTokenTTL changes the lifetime of the id tokens issued afterwards
+func (i *Issuer) SetTokenTTL(ttl time.Duration) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.tokenTTL = ttl
+}
+
+// RevokeRefreshTokens invalidates all the refresh tokens issued so far
+func (i *Issuer) RevokeRefreshTokens() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.refreshTokens = map[string]Claims{}
+}
+
+func (i *Issuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                i.URL(),
+		"authorization_endpoint":                i.URL() + "/auth",
+		"token_endpoint":                        i.URL() + "/token",
+		"jwks_uri":                              i.URL() + "/keys",
+		"end_session_endpoint":                  i.URL() + "/logout",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *Issuer) handleAuth(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != i.ClientID {
+		http.Error(w, "invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	i.lock.Lock()
+	code := randomString()
+	i.codes[code] = i.claims
+	i.lock.Unlock()
+
+	q := redirectURI.Query()
+	q.Set("code", code)
+	q.Set("state", query.Get("state"))
+	redirectURI.RawQuery = q.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (i *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+	if clientID != i.ClientID {
+		writeTokenError(w, "invalid_client")
+		return
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	var claims Claims
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		c, ok := i.codes[code]
+		if !ok {
+			writeTokenError(w, "invalid_grant")
+			return
+		}
+		delete(i.codes, code)
+		claims = c
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		c, ok := i.refreshTokens[refreshToken]
+		if !ok {
+			writeTokenError(w, "invalid_grant")
+			return
+		}
+		delete(i.refreshTokens, refreshToken)
+		claims = c
+	default:
+		writeTokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	idToken, err := i.signIDToken(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken := randomString()
+	i.refreshTokens[refreshToken] = claims
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  randomString(),
+		"token_type":    "Bearer",
+		"refresh_token": refreshToken,
+		"expires_in":    int(i.tokenTTL.Seconds()),
+		"id_token":      idToken,
+	})
+}
+
+func (i *Issuer) handleKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{
+			Key:       &i.key.PublicKey,
+			KeyID:     keyID,
+			Algorithm: string(jose.RS256),
+			Use:       "sig",
+		}},
+	})
+}
+
+func (i *Issuer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	redirectURI := r.URL.Query().Get("post_logout_redirect_uri")
+	if redirectURI == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+func (i *Issuer) signIDToken(claims Claims) (string, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       i.key,
+	}, (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	registered := jwt.Claims{
+		Issuer:   i.URL(),
+		Subject:  claims.Subject,
+		Audience: jwt.Audience{i.ClientID},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(i.tokenTTL)),
+	}
+
+	return jwt.Signed(signer).Claims(registered).Claims(claims).CompactSerialize()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeTokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{
+		"error": code,
+	})
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("failed to generate random string: %w", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,118 @@
+// Package pagination implements cursor based pagination. Rows are sorted by
+// creation time then by ID, and a page starts right after the row of the
+// cursor, so that rows created while browsing do not shift the pages.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor identifies the last row of a page
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// String encodes the cursor so that it can be used in URLs
+func (c *Cursor) String() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: createdAt, ID: parts[1]}, nil
+}
+
+// ClampLimit returns the default limit when the limit is not set, and keeps
+// it below the maximum
+func ClampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+// Page selects the rows following a cursor. A nil page selects every row
+type Page struct {
+	After *Cursor
+	Limit int
+}
+
+// NewPage parses the cursor and the limit received from a request. An empty
+// cursor selects the first page, and the limit is kept within bounds
+func NewPage(after string, limit int) (*Page, error) {
+	page := &Page{Limit: ClampLimit(limit)}
+	if after != "" {
+		cursor, err := ParseCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		page.After = cursor
+	}
+	return page, nil
+}
+
+// Apply sorts the query, and restricts it to the page. The query fetches
+// one more row than the limit, so that Trim can tell if there is a next page
+func (p *Page) Apply(query *gorm.DB, table string, descending bool) *gorm.DB {
+	return p.ApplyBy(query, table, "created_at", descending)
+}
+
+// ApplyBy is Apply sorting the rows by another time column than the
+// creation time. The CreatedAt of the cursors is then the time of that
+// column
+func (p *Page) ApplyBy(query *gorm.DB, table string, column string, descending bool) *gorm.DB {
+	direction, comparison := "asc", ">"
+	if descending {
+		direction, comparison = "desc", "<"
+	}
+	createdAt := table + "." + column
+	id := table + ".id"
+
+	query = query.Order(fmt.Sprintf("%s %s, %s %s", createdAt, direction, id, direction))
+	if p == nil {
+		return query
+	}
+	if p.After != nil {
+		query = query.Where(
+			fmt.Sprintf("(%[1]s %[3]s ? or (%[1]s = ? and %[2]s %[3]s ?))", createdAt, id, comparison),
+			p.After.CreatedAt, p.After.CreatedAt, p.After.ID)
+	}
+	return query.Limit(p.Limit + 1)
+}
+
+// Trim returns the number of rows to keep out of the rows fetched by a
+// query restricted by Apply, and whether there is a next page
+func (p *Page) Trim(count int) (int, bool) {
+	if p == nil || count <= p.Limit {
+		return count, false
+	}
+	return p.Limit, true
+}
@@ -0,0 +1,405 @@
+// Package policy decides whether a user is allowed to perform an action.
+// Every permission check of the handlers goes through Can, so that the
+// rules are defined in a single place.
+package policy
+
+import (
+	"cp/pkg/api"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type Action string
+
+const (
+	ListGroups                Action = "groups:list"
+	CreateGroup               Action = "groups:create"
+	ViewGroup                 Action = "group:view"
+	ViewGroupMembers          Action = "group:members:view"
+	ViewGroupAcknowledgements Action = "group:acknowledgements:view"
+	ViewGroupHistory          Action = "group:history:view"
+	ViewGroupSettings         Action = "group:settings:view"
+	UpdateGroupSettings       Action = "group:settings:update"
+	ImportGroupData           Action = "group:import"
+	ArchiveGroup              Action = "group:archive"
+	DeleteGroup               Action = "group:delete"
+	RestoreGroup              Action = "group:restore"
+	ViewCredits               Action = "group:credits:view"
+	ViewGroupBalance          Action = "group:credits:view_group_balance"
+	SendCredits               Action = "group:credits:send"
+	ReverseCredits            Action = "group:credits:reverse"
+	SendAcknowledgement       Action = "group:acknowledgements:send"
+	ManageInvitations         Action = "group:invitations:manage"
+	RedeemInvitation          Action = "invitation:redeem"
+	Search                    Action = "search"
+
+	JoinGroup         Action = "membership:join"
+	AddMember         Action = "membership:add"
+	LeaveGroup        Action = "membership:leave"
+	RemoveMember      Action = "membership:remove"
+	ApproveMembership Action = "membership:approve"
+	RejectMembership  Action = "membership:reject"
+	AssignRole        Action = "membership:assign_role"
+	ManageRoles       Action = "group:roles:manage"
+
+	CreatePost     Action = "post:create"
+	ViewPost       Action = "post:view"
+	ViewPostImages Action = "post:images:view"
+	EditPost       Action = "post:edit"
+	DeletePost     Action = "post:delete"
+	SendMessage    Action = "post:message"
+
+	ProposeExchange  Action = "exchange:propose"
+	AcceptExchange   Action = "exchange:accept"
+	DeclineExchange  Action = "exchange:decline"
+	CancelExchange   Action = "exchange:cancel"
+	CompleteExchange Action = "exchange:complete"
+
+	ViewUser                Action = "user:view"
+	EditUserProfile         Action = "user:profile:edit"
+	ViewUserNotifications   Action = "user:notifications:view"
+	ManageUserNotifications Action = "user:notifications:manage"
+	ManageUserTokens        Action = "user:tokens:manage"
+
+	ViewConversations Action = "conversations:view"
+	StartConversation Action = "conversations:start"
+	ViewConversation  Action = "conversation:view"
+	SendDirectMessage Action = "conversation:message"
+
+	AdministerSite Action = "site:administer"
+)
+
+// SiteAdministratorsGroup is the identity provider group of the users
+// allowed to administer the whole site
+const SiteAdministratorsGroup = "administrators"
+
+var (
+	ErrUnauthenticated = echo.ErrUnauthorized
+	ErrForbidden       = echo.ErrForbidden
+	ErrLastOwner       = echo.NewHTTPError(http.StatusForbidden, "the last owner of a group cannot leave or give up ownership")
+	ErrSelfAction      = echo.NewHTTPError(http.StatusForbidden, "this action cannot be performed on yourself")
+	ErrTokenNotAllowed = echo.NewHTTPError(http.StatusForbidden, "this action cannot be performed with a personal access token")
+	ErrGroupArchived   = echo.NewHTTPError(http.StatusForbidden, "the group is archived and cannot be changed")
+)
+
+// Subject is the user performing the action
+type Subject struct {
+	User    *api.User
+	Profile *api.Profile
+	// Membership is the membership of the user in the group of the
+	// resource, if any
+	Membership *api.Membership
+	// ViaToken is true when the user authenticated with a personal access
+	// token instead of a browser session
+	ViaToken bool
+}
+
+// Resource is what the action is performed on. Only the fields relevant to
+// the action need to be set
+type Resource struct {
+	Group *api.Group
+	// User and Membership are the user targeted by the action, and its
+	// membership in the group
+	User       *api.User
+	Membership *api.Membership
+	Post       *api.Post
+	// Exchange is an exchange responding to the post
+	Exchange *api.Exchange
+	// Role is the role assigned by AssignRole, or created by ManageRoles
+	Role *api.Role
+	// Conversation is a conversation of the targeted user
+	Conversation *api.Conversation
+	// Source is the account credits or acknowledgements are sent from
+	Source *api.Target
+	// OwnerCount is the number of active owners of the group. It is
+	// required by the actions that could leave a group without owner
+	OwnerCount int
+}
+
+type rule func(s Subject, r Resource) error
+
+var rules = map[Action]rule{
+	ListGroups:                authenticated,
+	CreateGroup:               authenticated,
+	ViewGroup:                 authenticated,
+	ViewGroupMembers:          any(isActiveMember, isTargetUser),
+	ViewGroupAcknowledgements: isActiveMember,
+	ViewGroupHistory:          isActiveMember,
+	ViewGroupSettings:         isActiveMember,
+	UpdateGroupSettings:       all(notArchived, hasCapability(api.ManageSettingsCapability)),
+	ImportGroupData:           all(notArchived, hasCapability(api.ManageSettingsCapability), hasCapability(api.ManageMembersCapability)),
+	ArchiveGroup:              hasCapability(api.DeleteGroupCapability),
+	DeleteGroup:               hasCapability(api.DeleteGroupCapability),
+	RestoreGroup:              hasCapability(api.DeleteGroupCapability),
+	ViewCredits:               isActiveMember,
+	ViewGroupBalance:          hasCapability(api.SendFromGroupCapability),
+	SendCredits:               all(notArchived, isActiveMember, canSendFrom),
+	ReverseCredits:            all(notArchived, hasCapability(api.SendFromGroupCapability)),
+	SendAcknowledgement:       all(notArchived, isActiveMember, canSendFrom),
+	ManageInvitations:         all(notArchived, hasCapability(api.ManageMembersCapability)),
+	ManageRoles:               all(notArchived, hasCapability(api.ManageRolesCapability), canGrant),
+	RedeemInvitation:          authenticated,
+	Search:                    authenticated,
+
+	JoinGroup:         all(notArchived, isTargetUser),
+	AddMember:         all(notArchived, not(isTargetUser, ErrSelfAction), hasCapability(api.ManageMembersCapability), outranksTarget, notLastOwner),
+	LeaveGroup:        all(isTargetUser, notLastOwner),
+	RemoveMember:      all(notArchived, not(isTargetUser, ErrSelfAction), hasCapability(api.ManageMembersCapability), outranksTarget, notLastOwner),
+	ApproveMembership: all(notArchived, not(isTargetUser, ErrSelfAction), hasCapability(api.ManageMembersCapability)),
+	RejectMembership:  all(notArchived, not(isTargetUser, ErrSelfAction), hasCapability(api.ManageMembersCapability)),
+	AssignRole:        all(notArchived, hasCapability(api.ManageMembersCapability), outranksTarget, canGrant, notLastOwner),
+
+	CreatePost:     all(notArchived, isActiveMember),
+	ViewPost:       authenticated,
+	ViewPostImages: isActiveMember,
+	EditPost:       all(notArchived, isActiveMember, isPostAuthor),
+	DeletePost:     all(notArchived, any(isPostAuthor, hasCapability(api.DeleteAnyPostCapability))),
+	SendMessage:    all(notArchived, isActiveMember),
+
+	ProposeExchange:  all(notArchived, isActiveMember, not(isPostAuthor, ErrSelfAction)),
+	AcceptExchange:   all(notArchived, isActiveMember, isPostAuthor),
+	DeclineExchange:  all(notArchived, isActiveMember, isPostAuthor),
+	CancelExchange:   all(notArchived, isActiveMember, isExchangeParty),
+	CompleteExchange: all(notArchived, isActiveMember, isExchangeParty),
+
+	ViewUser:                authenticated,
+	EditUserProfile:         isTargetUser,
+	ViewUserNotifications:   isTargetUser,
+	ManageUserNotifications: isTargetUser,
+	ManageUserTokens:        all(isTargetUser, notViaToken),
+
+	ViewConversations: isTargetUser,
+	StartConversation: all(notArchived, isTargetUser, isActiveMember),
+	ViewConversation:  all(isTargetUser, isParticipant),
+	SendDirectMessage: all(notArchived, isTargetUser, isParticipant, isActiveMember),
+
+	AdministerSite: isSiteAdministrator,
+}
+
+// Can returns nil if the subject is allowed to perform the action on the
+// resource. Unknown actions are always denied
+func Can(s Subject, action Action, r Resource) error {
+	rule, ok := rules[action]
+	if !ok {
+		return ErrForbidden
+	}
+	return rule(s, r)
+}
+
+func all(rules ...rule) rule {
+	return func(s Subject, r Resource) error {
+		for _, rule := range rules {
+			if err := rule(s, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// any passes if one of the rules passes, and otherwise returns the error of
+// the first rule
+func any(rules ...rule) rule {
+	return func(s Subject, r Resource) error {
+		var first error
+		for _, rule := range rules {
+			err := rule(s, r)
+			if err == nil {
+				return nil
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+}
+
+// not inverts the rule, returning err when the rule passes
+func not(rule rule, err error) rule {
+	return func(s Subject, r Resource) error {
+		if rule(s, r) == nil {
+			return err
+		}
+		return nil
+	}
+}
+
+func authenticated(s Subject, r Resource) error {
+	if s.User == nil {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+// hasMembership makes sure the subject has a membership in the group,
+// confirmed or not
+func hasMembership(s Subject, r Resource) error {
+	if err := authenticated(s, r); err != nil {
+		return err
+	}
+	if s.Membership == nil || s.Membership.UserID != s.User.ID {
+		return ErrForbidden
+	}
+	if r.Group != nil && s.Membership.GroupID != r.Group.ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func isActiveMember(s Subject, r Resource) error {
+	if err := hasMembership(s, r); err != nil {
+		return err
+	}
+	if !s.Membership.IsActive() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// hasCapability makes sure the subject is an active member whose role has
+// the capability
+func hasCapability(capability api.Capability) rule {
+	return func(s Subject, r Resource) error {
+		if err := hasMembership(s, r); err != nil {
+			return err
+		}
+		if !s.Membership.HasCapability(capability) {
+			return ErrForbidden
+		}
+		return nil
+	}
+}
+
+func isTargetUser(s Subject, r Resource) error {
+	if err := authenticated(s, r); err != nil {
+		return err
+	}
+	if r.User == nil || r.User.ID != s.User.ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func isPostAuthor(s Subject, r Resource) error {
+	if err := authenticated(s, r); err != nil {
+		return err
+	}
+	if r.Post == nil || r.Post.AuthorID != s.User.ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func isExchangeParty(s Subject, r Resource) error {
+	if err := authenticated(s, r); err != nil {
+		return err
+	}
+	if r.Exchange == nil || !r.Exchange.IsParty(s.User.ID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func isParticipant(s Subject, r Resource) error {
+	if err := authenticated(s, r); err != nil {
+		return err
+	}
+	if r.Conversation == nil || !r.Conversation.IsParticipant(s.User.ID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// notArchived denies the changes to the archived groups, which are read only
+func notArchived(s Subject, r Resource) error {
+	if r.Group != nil && r.Group.IsArchived() {
+		return ErrGroupArchived
+	}
+	return nil
+}
+
+func notViaToken(s Subject, r Resource) error {
+	if s.ViaToken {
+		return ErrTokenNotAllowed
+	}
+	return nil
+}
+
+func isSiteAdministrator(s Subject, r Resource) error {
+	if err := authenticated(s, r); err != nil {
+		return err
+	}
+	if s.Profile != nil && s.Profile.IsInGroup(SiteAdministratorsGroup) {
+		return nil
+	}
+	// Token profiles have no groups, so tokens cannot administer the site
+	// for the users granted from the command line either
+	if s.User != nil && s.User.SiteAdministrator && !s.ViaToken {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// outranksTarget makes sure the subject has at least the permission of the
+// targeted membership. Without membership, the targeted user is outranked by
+// every member
+func outranksTarget(s Subject, r Resource) error {
+	target := api.None
+	if r.Membership != nil {
+		target = r.Membership.Permission
+	}
+	if s.Membership == nil || !s.Membership.Permission.Gte(target) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// canGrant makes sure the role does not rank higher than the role of the
+// subject, and does not have capabilities the subject does not have
+func canGrant(s Subject, r Resource) error {
+	if r.Role == nil {
+		return nil
+	}
+	if !s.Membership.Permission.Gte(r.Role.Permission) {
+		return ErrForbidden
+	}
+	if !s.Membership.GetRole().Includes(r.Role) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// notLastOwner prevents the targeted membership from leaving the group or
+// giving up ownership, when it is the last active owner of the group
+func notLastOwner(s Subject, r Resource) error {
+	if r.Membership == nil || !r.Membership.IsOwner() {
+		return nil
+	}
+	if r.Role != nil && r.Role.Permission == api.Owner {
+		return nil
+	}
+	if r.OwnerCount <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// canSendFrom makes sure the subject can send from the source. Users can
+// only send from their own account, and only roles with the send from group
+// capability can send from the group account. Without source, only the
+// membership is checked
+func canSendFrom(s Subject, r Resource) error {
+	if r.Source == nil {
+		return nil
+	}
+	if r.Source.IsUser() && r.Source.GetUserID() != s.User.ID {
+		return ErrForbidden
+	}
+	if r.Source.IsGroup() {
+		if r.Source.GetGroupID() != s.Membership.GroupID || !s.Membership.HasCapability(api.SendFromGroupCapability) {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+package policy
+
+import (
+	"cp/pkg/api"
+	"testing"
+	"time"
+)
+
+var (
+	group = &api.Group{ID: "group"}
+
+	ownerUser     = &api.User{ID: "owner"}
+	adminUser     = &api.User{ID: "admin"}
+	memberUser    = &api.User{ID: "member"}
+	pendingUser   = &api.User{ID: "pending"}
+	outsiderUser  = &api.User{ID: "outsider"}
+	siteAdminUser = &api.User{ID: "site-admin", SiteAdministrator: true}
+
+	ownerMembership   = newMembership(ownerUser, api.Owner, true)
+	adminMembership   = newMembership(adminUser, api.Admin, true)
+	memberMembership  = newMembership(memberUser, api.Member, true)
+	pendingMembership = newMembership(pendingUser, api.None, false)
+
+	anonymous = Subject{}
+	outsider  = Subject{User: outsiderUser}
+	pending   = Subject{User: pendingUser, Membership: pendingMembership}
+	member    = Subject{User: memberUser, Membership: memberMembership}
+	admin     = Subject{User: adminUser, Membership: adminMembership}
+	owner     = Subject{User: ownerUser, Membership: ownerMembership}
+	token     = Subject{User: memberUser, Membership: memberMembership, ViaToken: true}
+
+	post     = &api.Post{ID: "post", GroupID: group.ID, AuthorID: memberUser.ID}
+	exchange = &api.Exchange{ID: "exchange", GroupID: group.ID, Post: post, PostID: post.ID, ResponderID: adminUser.ID}
+)
+
+func newMembership(user *api.User, permission api.MembershipPermission, confirmed bool) *api.Membership {
+	return &api.Membership{
+		GroupID:         group.ID,
+		UserID:          user.ID,
+		Permission:      permission,
+		MemberConfirmed: true,
+		GroupConfirmed:  confirmed,
+	}
+}
+
+func archived() *api.Group {
+	now := time.Now()
+	return &api.Group{ID: group.ID, ArchivedAt: &now}
+}
+
+type testCase struct {
+	name     string
+	subject  Subject
+	action   Action
+	resource Resource
+	want     error
+}
+
+func run(t *testing.T, tests []testCase) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Can(test.subject, test.action, test.resource); got != test.want {
+				t.Errorf("Can(%s) = %v, want %v", test.action, got, test.want)
+			}
+		})
+	}
+}
+
+// subjects are the subjects of the group actions, in the order of the
+// expected errors of groupActions
+var subjects = []struct {
+	name    string
+	subject Subject
+}{
+	{"anonymous", anonymous},
+	{"outsider", outsider},
+	{"pending", pending},
+	{"member", member},
+	{"admin", admin},
+	{"owner", owner},
+	{"token", token},
+}
+
+var (
+	unauthenticated = ErrUnauthenticated
+	forbidden       = ErrForbidden
+)
+
+// groupActions are the actions on a group, with the expected error of each
+// subject
+var groupActions = []struct {
+	action Action
+	want   []error
+}{
+	{ListGroups, []error{unauthenticated, nil, nil, nil, nil, nil, nil}},
+	{CreateGroup, []error{unauthenticated, nil, nil, nil, nil, nil, nil}},
+	{ViewGroup, []error{unauthenticated, nil, nil, nil, nil, nil, nil}},
+	{Search, []error{unauthenticated, nil, nil, nil, nil, nil, nil}},
+	{RedeemInvitation, []error{unauthenticated, nil, nil, nil, nil, nil, nil}},
+	{ViewPost, []error{unauthenticated, nil, nil, nil, nil, nil, nil}},
+	{ViewGroupMembers, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{ViewGroupAcknowledgements, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{ViewGroupHistory, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{ViewGroupSettings, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{ViewCredits, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{ViewPostImages, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{CreatePost, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{SendMessage, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{SendCredits, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{SendAcknowledgement, []error{unauthenticated, forbidden, forbidden, nil, nil, nil, nil}},
+	{ViewGroupBalance, []error{unauthenticated, forbidden, forbidden, forbidden, nil, nil, forbidden}},
+	{ReverseCredits, []error{unauthenticated, forbidden, forbidden, forbidden, nil, nil, forbidden}},
+	{ManageInvitations, []error{unauthenticated, forbidden, forbidden, forbidden, nil, nil, forbidden}},
+	{ManageRoles, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, nil, forbidden}},
+	{UpdateGroupSettings, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, nil, forbidden}},
+	{ImportGroupData, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, nil, forbidden}},
+	{ArchiveGroup, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, nil, forbidden}},
+	{DeleteGroup, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, nil, forbidden}},
+	{RestoreGroup, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, nil, forbidden}},
+	{AdministerSite, []error{unauthenticated, forbidden, forbidden, forbidden, forbidden, forbidden, forbidden}},
+	{Action("unknown"), []error{forbidden, forbidden, forbidden, forbidden, forbidden, forbidden, forbidden}},
+}
+
+func TestGroupActions(t *testing.T) {
+	var tests []testCase
+	for _, groupAction := range groupActions {
+		for i, subject := range subjects {
+			tests = append(tests, testCase{
+				name:     string(groupAction.action) + "/" + subject.name,
+				subject:  subject.subject,
+				action:   groupAction.action,
+				resource: Resource{Group: group},
+				want:     groupAction.want[i],
+			})
+		}
+	}
+	run(t, tests)
+}
+
+// TestArchivedGroup makes sure the archived groups can be read, unarchived
+// and deleted, but not changed
+func TestArchivedGroup(t *testing.T) {
+	allowed := []Action{
+		ViewGroup, ViewGroupMembers, ViewGroupAcknowledgements, ViewGroupHistory, ViewGroupSettings,
+		ViewCredits, ViewGroupBalance, ViewPost, ViewPostImages, ArchiveGroup, DeleteGroup, RestoreGroup,
+	}
+	denied := []Action{
+		UpdateGroupSettings, ImportGroupData, ManageInvitations, ManageRoles, SendCredits, ReverseCredits,
+		SendAcknowledgement, CreatePost, SendMessage,
+	}
+	var tests []testCase
+	for _, action := range allowed {
+		tests = append(tests, testCase{string(action), owner, action, Resource{Group: archived()}, nil})
+	}
+	for _, action := range denied {
+		tests = append(tests, testCase{string(action), owner, action, Resource{Group: archived()}, ErrGroupArchived})
+	}
+	tests = append(tests, []testCase{
+		{"join", outsider, JoinGroup, Resource{Group: archived(), User: outsiderUser}, ErrGroupArchived},
+		{"add member", owner, AddMember, Resource{Group: archived(), User: outsiderUser}, ErrGroupArchived},
+		{"leave", member, LeaveGroup, Resource{Group: archived(), User: memberUser, Membership: memberMembership, OwnerCount: 1}, nil},
+		{"remove member", owner, RemoveMember, Resource{Group: archived(), User: memberUser, Membership: memberMembership, OwnerCount: 1}, ErrGroupArchived},
+		{"approve", owner, ApproveMembership, Resource{Group: archived(), User: pendingUser, Membership: pendingMembership}, ErrGroupArchived},
+		{"assign role", owner, AssignRole, Resource{Group: archived(), User: memberUser, Membership: memberMembership, Role: api.AdminRole, OwnerCount: 1}, ErrGroupArchived},
+		{"edit post", member, EditPost, Resource{Group: archived(), Post: post}, ErrGroupArchived},
+		{"delete post", member, DeletePost, Resource{Group: archived(), Post: post}, ErrGroupArchived},
+		{"propose exchange", admin, ProposeExchange, Resource{Group: archived(), Post: post}, ErrGroupArchived},
+		{"complete exchange", admin, CompleteExchange, Resource{Group: archived(), Post: post, Exchange: exchange}, ErrGroupArchived},
+		{"start conversation", member, StartConversation, Resource{Group: archived(), User: memberUser}, ErrGroupArchived},
+	}...)
+	run(t, tests)
+}
+
+func TestMembershipActions(t *testing.T) {
+	otherOwnerMembership := newMembership(&api.User{ID: "other-owner"}, api.Owner, true)
+	run(t, []testCase{
+		{"join", outsider, JoinGroup, Resource{Group: group, User: outsiderUser}, nil},
+		{"join for another user", outsider, JoinGroup, Resource{Group: group, User: memberUser, Membership: memberMembership}, forbidden},
+		{"confirm own membership", pending, JoinGroup, Resource{Group: group, User: pendingUser, Membership: pendingMembership}, nil},
+
+		{"add new member", admin, AddMember, Resource{Group: group, User: outsiderUser, OwnerCount: 1}, nil},
+		{"approve pending member", admin, AddMember, Resource{Group: group, User: pendingUser, Membership: pendingMembership, OwnerCount: 1}, nil},
+		{"add self", admin, AddMember, Resource{Group: group, User: adminUser, Membership: adminMembership, OwnerCount: 1}, ErrSelfAction},
+		{"add by member", member, AddMember, Resource{Group: group, User: outsiderUser, OwnerCount: 1}, forbidden},
+		{"add by pending", pending, AddMember, Resource{Group: group, User: outsiderUser, OwnerCount: 1}, forbidden},
+		{"add owner by admin", admin, AddMember, Resource{Group: group, User: ownerUser, Membership: ownerMembership, OwnerCount: 1}, forbidden},
+		{"add the last owner again", owner, AddMember, Resource{Group: group, User: &api.User{ID: "other-owner"}, Membership: otherOwnerMembership, OwnerCount: 1}, ErrLastOwner},
+
+		{"leave", member, LeaveGroup, Resource{Group: group, User: memberUser, Membership: memberMembership, OwnerCount: 1}, nil},
+		{"cancel join request", pending, LeaveGroup, Resource{Group: group, User: pendingUser, Membership: pendingMembership, OwnerCount: 1}, nil},
+		{"leave as last owner", owner, LeaveGroup, Resource{Group: group, User: ownerUser, Membership: ownerMembership, OwnerCount: 1}, ErrLastOwner},
+		{"leave as one of the owners", owner, LeaveGroup, Resource{Group: group, User: ownerUser, Membership: ownerMembership, OwnerCount: 2}, nil},
+		{"leave for another user", member, LeaveGroup, Resource{Group: group, User: adminUser, Membership: adminMembership, OwnerCount: 1}, forbidden},
+
+		{"remove member", admin, RemoveMember, Resource{Group: group, User: memberUser, Membership: memberMembership, OwnerCount: 1}, nil},
+		{"remove admin by owner", owner, RemoveMember, Resource{Group: group, User: adminUser, Membership: adminMembership, OwnerCount: 1}, nil},
+		{"remove owner by admin", admin, RemoveMember, Resource{Group: group, User: ownerUser, Membership: ownerMembership, OwnerCount: 1}, forbidden},
+		{"remove another owner", owner, RemoveMember, Resource{Group: group, User: &api.User{ID: "other-owner"}, Membership: otherOwnerMembership, OwnerCount: 2}, nil},
+		{"remove self", admin, RemoveMember, Resource{Group: group, User: adminUser, Membership: adminMembership, OwnerCount: 1}, ErrSelfAction},
+		{"remove by member", member, RemoveMember, Resource{Group: group, User: adminUser, Membership: adminMembership, OwnerCount: 1}, forbidden},
+		{"remove by token", Subject{User: adminUser, Membership: adminMembership, ViaToken: true}, RemoveMember, Resource{Group: group, User: memberUser, Membership: memberMembership, OwnerCount: 1}, nil},
+
+		{"approve", admin, ApproveMembership, Resource{Group: group, User: pendingUser, Membership: pendingMembership}, nil},
+		{"approve self", pending, ApproveMembership, Resource{Group: group, User: pendingUser, Membership: pendingMembership}, ErrSelfAction},
+		{"approve by member", member, ApproveMembership, Resource{Group: group, User: pendingUser, Membership: pendingMembership}, forbidden},
+		{"reject", admin, RejectMembership, Resource{Group: group, User: pendingUser, Membership: pendingMembership}, nil},
+		{"reject by member", member, RejectMembership, Resource{Group: group, User: pendingUser, Membership: pendingMembership}, forbidden},
+	})
+}
+
+func TestAssignRole(t *testing.T) {
+	moderator := &api.Role{ID: "moderator", GroupID: group.ID, Name: "Moderator", Permission: api.Member,
+		Capabilities: api.Capabilities{api.DeleteAnyPostCapability}}
+	moderatorMembership := newMembership(&api.User{ID: "moderator"}, api.Member, true)
+	moderatorMembership.RoleID = &moderator.ID
+	moderatorMembership.Role = moderator
+	resource := func(user *api.User, membership *api.Membership, role *api.Role, ownerCount int) Resource {
+		return Resource{Group: group, User: user, Membership: membership, Role: role, OwnerCount: ownerCount}
+	}
+	run(t, []testCase{
+		{"promote member to admin by owner", owner, AssignRole, resource(memberUser, memberMembership, api.AdminRole, 1), nil},
+		{"promote member to owner by owner", owner, AssignRole, resource(memberUser, memberMembership, api.OwnerRole, 1), nil},
+		{"grant custom role by owner", owner, AssignRole, resource(memberUser, memberMembership, moderator, 1), nil},
+		{"demote admin by admin", admin, AssignRole, resource(adminUser, adminMembership, api.MemberRole, 1), nil},
+		{"promote member to owner by admin", admin, AssignRole, resource(memberUser, memberMembership, api.OwnerRole, 1), forbidden},
+		{"grant capability the admin lacks", admin, AssignRole, resource(memberUser, memberMembership, moderator, 1), forbidden},
+		{"demote owner by admin", admin, AssignRole, resource(ownerUser, ownerMembership, api.MemberRole, 1), forbidden},
+		{"demote last owner", owner, AssignRole, resource(ownerUser, ownerMembership, api.AdminRole, 1), ErrLastOwner},
+		{"demote one of the owners", owner, AssignRole, resource(ownerUser, ownerMembership, api.AdminRole, 2), nil},
+		{"keep last owner an owner", owner, AssignRole, resource(ownerUser, ownerMembership, api.OwnerRole, 1), nil},
+		{"assign by member", member, AssignRole, resource(memberUser, memberMembership, api.MemberRole, 1), forbidden},
+		{"assign by custom role without capability", Subject{User: &api.User{ID: "moderator"}, Membership: moderatorMembership}, AssignRole, resource(memberUser, memberMembership, api.MemberRole, 1), forbidden},
+		{"delete any post with custom role", Subject{User: &api.User{ID: "moderator"}, Membership: moderatorMembership}, DeletePost, Resource{Group: group, Post: post}, nil},
+	})
+}
+
+func TestPostActions(t *testing.T) {
+	run(t, []testCase{
+		{"edit by author", member, EditPost, Resource{Group: group, Post: post}, nil},
+		{"edit by token", token, EditPost, Resource{Group: group, Post: post}, nil},
+		{"edit by owner", owner, EditPost, Resource{Group: group, Post: post}, forbidden},
+		{"delete by author", member, DeletePost, Resource{Group: group, Post: post}, nil},
+		{"delete by admin", admin, DeletePost, Resource{Group: group, Post: post}, forbidden},
+		{"delete by owner", owner, DeletePost, Resource{Group: group, Post: post}, nil},
+		{"delete anonymously", anonymous, DeletePost, Resource{Group: group, Post: post}, unauthenticated},
+
+		{"propose", admin, ProposeExchange, Resource{Group: group, Post: post}, nil},
+		{"propose on own post", member, ProposeExchange, Resource{Group: group, Post: post}, ErrSelfAction},
+		{"propose by pending", pending, ProposeExchange, Resource{Group: group, Post: post}, forbidden},
+		{"accept by author", member, AcceptExchange, Resource{Group: group, Post: post, Exchange: exchange}, nil},
+		{"accept by responder", admin, AcceptExchange, Resource{Group: group, Post: post, Exchange: exchange}, forbidden},
+		{"decline by author", member, DeclineExchange, Resource{Group: group, Post: post, Exchange: exchange}, nil},
+		{"decline by responder", admin, DeclineExchange, Resource{Group: group, Post: post, Exchange: exchange}, forbidden},
+		{"cancel by author", member, CancelExchange, Resource{Group: group, Post: post, Exchange: exchange}, nil},
+		{"cancel by responder", admin, CancelExchange, Resource{Group: group, Post: post, Exchange: exchange}, nil},
+		{"cancel by owner", owner, CancelExchange, Resource{Group: group, Post: post, Exchange: exchange}, forbidden},
+		{"complete by author", member, CompleteExchange, Resource{Group: group, Post: post, Exchange: exchange}, nil},
+		{"complete by responder", admin, CompleteExchange, Resource{Group: group, Post: post, Exchange: exchange}, nil},
+		{"complete by owner", owner, CompleteExchange, Resource{Group: group, Post: post, Exchange: exchange}, forbidden},
+	})
+}
+
+func TestSendFrom(t *testing.T) {
+	groupID := group.ID
+	fromMember := &api.Target{Type: api.UserTarget, UserID: &memberUser.ID}
+	fromAdmin := &api.Target{Type: api.UserTarget, UserID: &adminUser.ID}
+	fromGroup := &api.Target{Type: api.GroupTarget, GroupID: &groupID}
+	otherGroupID := "other-group"
+	fromOtherGroup := &api.Target{Type: api.GroupTarget, GroupID: &otherGroupID}
+	run(t, []testCase{
+		{"from own account", member, SendCredits, Resource{Group: group, Source: fromMember}, nil},
+		{"from another account", member, SendCredits, Resource{Group: group, Source: fromAdmin}, forbidden},
+		{"from group by member", member, SendCredits, Resource{Group: group, Source: fromGroup}, forbidden},
+		{"from group by admin", admin, SendCredits, Resource{Group: group, Source: fromGroup}, nil},
+		{"from another group", admin, SendCredits, Resource{Group: group, Source: fromOtherGroup}, forbidden},
+		{"acknowledge from group by admin", admin, SendAcknowledgement, Resource{Group: group, Source: fromGroup}, nil},
+		{"acknowledge from another account", admin, SendAcknowledgement, Resource{Group: group, Source: fromMember}, forbidden},
+	})
+}
+
+func TestUserActions(t *testing.T) {
+	conversation := &api.Conversation{ID: "conversation", GroupID: group.ID, Participants: []*api.ConversationParticipant{
+		{ConversationID: "conversation", UserID: memberUser.ID},
+		{ConversationID: "conversation", UserID: adminUser.ID},
+	}}
+	run(t, []testCase{
+		{"view user", outsider, ViewUser, Resource{User: memberUser}, nil},
+		{"view user anonymously", anonymous, ViewUser, Resource{User: memberUser}, unauthenticated},
+		{"edit own profile", member, EditUserProfile, Resource{User: memberUser}, nil},
+		{"edit another profile", owner, EditUserProfile, Resource{User: memberUser}, forbidden},
+		{"view own notifications", member, ViewUserNotifications, Resource{User: memberUser}, nil},
+		{"view other notifications", admin, ViewUserNotifications, Resource{User: memberUser}, forbidden},
+		{"manage own notifications", member, ManageUserNotifications, Resource{User: memberUser}, nil},
+		{"manage own tokens", member, ManageUserTokens, Resource{User: memberUser}, nil},
+		{"manage tokens by token", token, ManageUserTokens, Resource{User: memberUser}, ErrTokenNotAllowed},
+		{"manage other tokens", admin, ManageUserTokens, Resource{User: memberUser}, forbidden},
+
+		{"view own conversations", member, ViewConversations, Resource{User: memberUser}, nil},
+		{"view other conversations", admin, ViewConversations, Resource{User: memberUser}, forbidden},
+		{"start conversation", member, StartConversation, Resource{Group: group, User: memberUser}, nil},
+		{"start conversation by pending", pending, StartConversation, Resource{Group: group, User: pendingUser}, forbidden},
+		{"start conversation by outsider", outsider, StartConversation, Resource{Group: group, User: outsiderUser}, forbidden},
+		{"view conversation", member, ViewConversation, Resource{User: memberUser, Conversation: conversation}, nil},
+		{"view conversation of another user", owner, ViewConversation, Resource{User: memberUser, Conversation: conversation}, forbidden},
+		{"view conversation as non participant", owner, ViewConversation, Resource{User: ownerUser, Conversation: conversation}, forbidden},
+		{"send direct message", member, SendDirectMessage, Resource{Group: group, User: memberUser, Conversation: conversation}, nil},
+		{"send direct message after leaving", Subject{User: memberUser}, SendDirectMessage, Resource{Group: group, User: memberUser, Conversation: conversation}, forbidden},
+	})
+}
+
+func TestAdministerSite(t *testing.T) {
+	profile := &api.Profile{ID: outsiderUser.ID, Groups: []string{SiteAdministratorsGroup}}
+	run(t, []testCase{
+		{"identity provider group", Subject{User: outsiderUser, Profile: profile}, AdministerSite, Resource{}, nil},
+		{"other identity provider group", Subject{User: outsiderUser, Profile: &api.Profile{Groups: []string{"users"}}}, AdministerSite, Resource{}, forbidden},
+		{"granted from the command line", Subject{User: siteAdminUser}, AdministerSite, Resource{}, nil},
+		{"granted from the command line via token", Subject{User: siteAdminUser, ViaToken: true}, AdministerSite, Resource{}, forbidden},
+		{"member", member, AdministerSite, Resource{}, forbidden},
+		{"anonymous", anonymous, AdministerSite, Resource{}, unauthenticated},
+		// Site administrators have no say in the groups they are not member of
+		{"site administrator in a group", Subject{User: siteAdminUser}, DeleteGroup, Resource{Group: group}, forbidden},
+	})
+}
@@ -2,24 +2,40 @@ package posts
 
 import (
 	"cp/pkg/api"
+	"cp/pkg/pagination"
 	"cp/pkg/utils"
 	"errors"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"time"
 )
 
 type FindPostsOptions struct {
 	IncludeDeleted bool
 	Type           *api.PostType
-	Query          *string
+	// Page restricts the results to a page of the posts, newest first. All
+	// the posts are returned without page
+	Page *pagination.Page
+	// After and Before restrict the results to the posts created or deleted
+	// strictly between them. A zero time leaves that side of the range open
+	After  time.Time
+	Before time.Time
+}
+
+func (o *FindPostsOptions) page() *pagination.Page {
+	if o == nil {
+		return nil
+	}
+	return o.Page
 }
 
 type Store interface {
 	Create(post *api.Post) error
 	Update(post *api.Post) error
 	Get(postID string) (*api.Post, error)
-	GetByAuthor(authorID string, options ...*FindPostsOptions) ([]*api.Post, error)
-	GetByGroup(groupID string, options ...*FindPostsOptions) ([]*api.Post, error)
+	GetByKeys(postIDs []string) ([]*api.Post, error)
+	GetByAuthor(authorID string, options ...*FindPostsOptions) ([]*api.Post, *pagination.Cursor, error)
+	GetByGroup(groupID string, options ...*FindPostsOptions) ([]*api.Post, *pagination.Cursor, error)
 	Delete(postID string) error
 }
 
@@ -57,61 +73,117 @@ func (p *PostStore) Get(postID string) (*api.Post, error) {
 	return &result, nil
 }
 
-func (p *PostStore) GetByAuthor(authorID string, options ...*FindPostsOptions) ([]*api.Post, error) {
-	var result []*api.Post
-	db := p.db
-	if len(options) > 0 && options[0].IncludeDeleted {
-		db = db.Unscoped()
+// GetByKeys returns the posts in the order of the given keys. Unknown keys
+// are ignored
+func (p *PostStore) GetByKeys(postIDs []string) ([]*api.Post, error) {
+	var posts []*api.Post
+	if len(postIDs) == 0 {
+		return posts, nil
 	}
-	if err := db.
+	if err := p.db.
 		Preload("Group").
 		Preload("Author").
 		Preload("Images").
 		Model(&api.Post{}).
-		Order("created_at desc").
-		Find(&result, "author_id = ?", authorID).
+		Find(&posts, "id in ?", postIDs).
 		Error; err != nil {
 		return nil, err
 	}
-	if err := utils.CountMessages(db, result); err != nil {
+	if err := utils.CountMessages(p.db, posts); err != nil {
 		return nil, err
 	}
+	postMap := map[string]*api.Post{}
+	for _, post := range posts {
+		postMap[post.ID] = post
+	}
+	var result []*api.Post
+	for _, postID := range postIDs {
+		if post, ok := postMap[postID]; ok {
+			result = append(result, post)
+		}
+	}
 	return result, nil
 }
 
-func (p *PostStore) GetByGroup(groupID string, options ...*FindPostsOptions) ([]*api.Post, error) {
+func (p *PostStore) GetByAuthor(authorID string, options ...*FindPostsOptions) ([]*api.Post, *pagination.Cursor, error) {
 	var result []*api.Post
+	var option *FindPostsOptions
 	db := p.db
-	if len(options) > 0 && options[0].IncludeDeleted {
-		db = db.Unscoped()
+	if len(options) > 0 {
+		option = options[0]
+		if option.IncludeDeleted {
+			// the session keeps the unscoped statement from being
+			// modified by the queries built from it
+			db = db.Unscoped().Session(&gorm.Session{})
+		}
 	}
 	query := db.
 		Preload("Group").
 		Preload("Author").
 		Preload("Images").
 		Model(&api.Post{})
+	if err := option.page().Apply(query, "posts", true).
+		Where("posts.group_id in (select id from groups where deleted_at is null)").
+		Find(&result, "author_id = ?", authorID).
+		Error; err != nil {
+		return nil, nil, err
+	}
+	result, next := trim(option.page(), result)
+	if err := utils.CountMessages(db, result); err != nil {
+		return nil, nil, err
+	}
+	return result, next, nil
+}
 
+func (p *PostStore) GetByGroup(groupID string, options ...*FindPostsOptions) ([]*api.Post, *pagination.Cursor, error) {
+	var result []*api.Post
+	var option *FindPostsOptions
+	db := p.db
 	if len(options) > 0 {
-		if options[0].Query != nil {
-			qry := "%" + *options[0].Query + "%"
-			query = query.Where("title like ? or description like ?", qry, qry)
-		}
-		if options[0].Type != nil {
-			query = query.Where("type = ?", *options[0].Type)
+		option = options[0]
+		if option.IncludeDeleted {
+			// the session keeps the unscoped statement from being
+			// modified by the queries built from it
+			db = db.Unscoped().Session(&gorm.Session{})
 		}
 	}
+	query := db.
+		Preload("Group").
+		Preload("Author").
+		Preload("Images").
+		Model(&api.Post{})
+
+	if option != nil && option.Type != nil {
+		query = query.Where("type = ?", *option.Type)
+	}
+	if option != nil && (!option.After.IsZero() || !option.Before.IsZero()) {
+		query = query.Where(
+			utils.Between(p.db, "created_at", option.After, option.Before).
+				Or(utils.Between(p.db.Where("deleted_at is not null"), "deleted_at", option.After, option.Before)))
+	}
 
-	if err := query.
-		Debug().
-		Order("created_at desc").
+	if err := option.page().Apply(query, "posts", true).
 		Find(&result, "group_id = ?", groupID).
 		Error; err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	result, next := trim(option.page(), result)
 	if err := utils.CountMessages(db, result); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return result, nil
+	return result, next, nil
+}
+
+// trim removes the extra post fetched to know if there is a next page, and
+// returns the cursor of that page
+func trim(page *pagination.Page, posts []*api.Post) ([]*api.Post, *pagination.Cursor) {
+	count, more := page.Trim(len(posts))
+	posts = posts[:count]
+	if !more {
+		return posts, nil
+	}
+	last := posts[count-1]
+	return posts, &pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
 }
 
 func (p *PostStore) Delete(postID string) error {
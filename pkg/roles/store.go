@@ -0,0 +1,83 @@
+package roles
+
+import (
+	"cp/pkg/api"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type Store interface {
+	GetForGroup(groupID string) ([]*api.Role, error)
+	Get(groupID string, roleID string) (*api.Role, error)
+	Create(role *api.Role) error
+	Delete(groupID string, roleID string) error
+}
+
+type RoleStore struct {
+	db *gorm.DB
+}
+
+func NewRoleStore(db *gorm.DB) *RoleStore {
+	return &RoleStore{db: db}
+}
+
+var _ Store = &RoleStore{}
+
+// GetForGroup returns the built-in roles, followed by the custom roles of
+// the group
+func (s *RoleStore) GetForGroup(groupID string) ([]*api.Role, error) {
+	var custom []*api.Role
+	if err := s.db.
+		Model(&api.Role{}).
+		Order("created_at asc").
+		Find(&custom, "group_id = ?", groupID).
+		Error; err != nil {
+		return nil, err
+	}
+	result := append([]*api.Role{}, api.BuiltInRoles...)
+	return append(result, custom...), nil
+}
+
+// Get returns a built-in role, or a custom role of the group
+func (s *RoleStore) Get(groupID string, roleID string) (*api.Role, error) {
+	for _, role := range api.BuiltInRoles {
+		if role.ID == roleID {
+			return role, nil
+		}
+	}
+	var result api.Role
+	err := s.db.Model(&api.Role{}).First(&result, "group_id = ? and id = ?", groupID, roleID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *RoleStore) Create(role *api.Role) error {
+	return s.db.Create(role).Error
+}
+
+// Delete deletes the custom role. The members with that role fall back to
+// the built-in role of their permission
+func (s *RoleStore) Delete(groupID string, roleID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&api.Membership{}).
+			Where("group_id = ? and role_id = ?", groupID, roleID).
+			Update("role_id", nil).
+			Error; err != nil {
+			return err
+		}
+		result := tx.Where("group_id = ? and id = ?", groupID, roleID).Delete(&api.Role{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return echo.ErrNotFound
+		}
+		return nil
+	})
+}
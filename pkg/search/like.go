@@ -0,0 +1,116 @@
+package search
+
+import (
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// LikeEngine matches the terms of the query with case-insensitive patterns.
+// It does not need any index, and ranks the results by recency. It is used
+// when the database has no full-text search support
+type LikeEngine struct {
+	db *gorm.DB
+}
+
+func NewLikeEngine(db *gorm.DB) *LikeEngine {
+	return &LikeEngine{db: db}
+}
+
+var _ Engine = &LikeEngine{}
+
+func (e *LikeEngine) Init() error {
+	return nil
+}
+
+// likeWhere requires every term to be found in one of the columns
+func likeWhere(termList []string, columns ...string) (string, []interface{}) {
+	var clauses []string
+	var params []interface{}
+	for _, term := range termList {
+		var alternatives []string
+		for _, column := range columns {
+			alternatives = append(alternatives, "lower("+column+") like ?")
+			params = append(params, "%"+strings.ToLower(term)+"%")
+		}
+		clauses = append(clauses, "("+strings.Join(alternatives, " or ")+")")
+	}
+	return strings.Join(clauses, " and "), params
+}
+
+func (e *LikeEngine) Search(query *Query) ([]*Result, error) {
+	termList := terms(query.Text)
+	if len(termList) == 0 || len(query.GroupIDs) == 0 {
+		return []*Result{}, nil
+	}
+
+	var selects []string
+	var params []interface{}
+
+	if query.includes(PostKind) {
+		where, whereParams := likeWhere(termList, "p.title", "p.description")
+		sql := `select 'post' as kind, p.id as id, p.group_id as group_id, g.name as group_name, p.id as post_id, p.title as title,
+				p.description as snippet, p.created_at as created_at
+			from posts p join groups g on g.id = p.group_id
+			where p.deleted_at is null and p.group_id in ? and ` + where
+		params = append(append(params, query.GroupIDs), whereParams...)
+		if query.PostType != nil {
+			sql += " and p.type = ?"
+			params = append(params, *query.PostType)
+		}
+		selects = append(selects, sql)
+	}
+
+	if query.includes(MessageKind) {
+		where, whereParams := likeWhere(termList, "m.content")
+		selects = append(selects, `select 'message' as kind, m.id as id, p.group_id as group_id, g.name as group_name, p.id as post_id, p.title as title,
+				m.content as snippet, m.created_at as created_at
+			from messages m join posts p on p.id = m.thread_id join groups g on g.id = p.group_id
+			where p.deleted_at is null and p.group_id in ? and `+where)
+		params = append(append(params, query.GroupIDs), whereParams...)
+	}
+
+	if query.includes(UserKind) {
+		where, whereParams := likeWhere(termList, "u.username", "u.name", "u.about")
+		selects = append(selects, `select 'user' as kind, u.id as id, '' as group_id, '' as group_name, '' as post_id, u.username as title,
+				u.about as snippet, u.created_at as created_at
+			from users u
+			where u.id in (
+				select user_id from memberships where group_id in ? and member_confirmed and group_confirmed
+			) and `+where)
+		params = append(append(params, query.GroupIDs), whereParams...)
+	}
+
+	if len(selects) == 0 {
+		return []*Result{}, nil
+	}
+
+	sql := "select * from (" + strings.Join(selects, " union all ") + ") results order by created_at desc limit ?"
+	params = append(params, query.limit())
+
+	var results []*Result
+	if err := e.db.Raw(sql, params...).Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		result.Snippet = highlight(excerpt(result.Snippet, termList))
+	}
+	return results, nil
+}
+
+const excerptLength = 200
+
+// excerpt returns the beginning of the text, with the terms surrounded by
+// the highlight markers
+func excerpt(text string, termList []string) string {
+	if utf8.RuneCountInString(text) > excerptLength {
+		text = string([]rune(text)[:excerptLength]) + "…"
+	}
+	var quoted []string
+	for _, term := range termList {
+		quoted = append(quoted, regexp.QuoteMeta(term))
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	return pattern.ReplaceAllString(text, highlightStart+"$0"+highlightStop)
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// The documents are computed by expressions matching the expression
+// indexes created by Init, so that the indexes are used by the queries
+const (
+	postgresConfig      = "english"
+	postgresPostDoc     = "to_tsvector('english', coalesce(p.title, '') || ' ' || coalesce(p.description, ''))"
+	postgresMessageDoc  = "to_tsvector('english', coalesce(m.content, ''))"
+	postgresUserDoc     = "to_tsvector('english', coalesce(u.username, '') || ' ' || coalesce(u.name, '') || ' ' || coalesce(u.about, ''))"
+	postgresPostText    = "coalesce(p.title, '') || ' ' || coalesce(p.description, '')"
+	postgresMessageText = "coalesce(m.content, '')"
+	postgresUserText    = "coalesce(u.name, '') || ' ' || coalesce(u.about, '')"
+)
+
+var postgresHeadlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxFragments=2, MaxWords=30, MinWords=10`, highlightStart, highlightStop)
+
+type PostgresEngine struct {
+	db *gorm.DB
+}
+
+func NewPostgresEngine(db *gorm.DB) *PostgresEngine {
+	return &PostgresEngine{db: db}
+}
+
+var _ Engine = &PostgresEngine{}
+
+func (e *PostgresEngine) Init() error {
+	indexes := []string{
+		"create index if not exists posts_search_idx on posts using gin (" + strings.ReplaceAll(postgresPostDoc, "p.", "") + ")",
+		"create index if not exists messages_search_idx on messages using gin (" + strings.ReplaceAll(postgresMessageDoc, "m.", "") + ")",
+		"create index if not exists users_search_idx on users using gin (" + strings.ReplaceAll(postgresUserDoc, "u.", "") + ")",
+	}
+	for _, index := range indexes {
+		if err := e.db.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *PostgresEngine) Search(query *Query) ([]*Result, error) {
+	text := strings.Join(terms(query.Text), " ")
+	if text == "" || len(query.GroupIDs) == 0 {
+		return []*Result{}, nil
+	}
+
+	var selects []string
+	var params []interface{}
+
+	if query.includes(PostKind) {
+		sql := fmt.Sprintf(`select 'post' as kind, p.id as id, p.group_id as group_id, g.name as group_name, p.id as post_id, p.title as title,
+				ts_headline('%[1]s', %[2]s, q, ?) as snippet, ts_rank(%[3]s, q) as rank
+			from posts p join groups g on g.id = p.group_id, plainto_tsquery('%[1]s', ?) q
+			where %[3]s @@ q and p.deleted_at is null and p.group_id in ?`, postgresConfig, postgresPostText, postgresPostDoc)
+		params = append(params, postgresHeadlineOptions, text, query.GroupIDs)
+		if query.PostType != nil {
+			sql += " and p.type = ?"
+			params = append(params, *query.PostType)
+		}
+		selects = append(selects, sql)
+	}
+
+	if query.includes(MessageKind) {
+		selects = append(selects, fmt.Sprintf(`select 'message' as kind, m.id as id, p.group_id as group_id, g.name as group_name, p.id as post_id, p.title as title,
+				ts_headline('%[1]s', %[2]s, q, ?) as snippet, ts_rank(%[3]s, q) as rank
+			from messages m join posts p on p.id = m.thread_id join groups g on g.id = p.group_id, plainto_tsquery('%[1]s', ?) q
+			where %[3]s @@ q and p.deleted_at is null and p.group_id in ?`, postgresConfig, postgresMessageText, postgresMessageDoc))
+		params = append(params, postgresHeadlineOptions, text, query.GroupIDs)
+	}
+
+	if query.includes(UserKind) {
+		selects = append(selects, fmt.Sprintf(`select 'user' as kind, u.id as id, '' as group_id, '' as group_name, '' as post_id, u.username as title,
+				ts_headline('%[1]s', %[2]s, q, ?) as snippet, ts_rank(%[3]s, q) as rank
+			from users u, plainto_tsquery('%[1]s', ?) q
+			where %[3]s @@ q and u.id in (
+				select user_id from memberships where group_id in ? and member_confirmed and group_confirmed
+			)`, postgresConfig, postgresUserText, postgresUserDoc))
+		params = append(params, postgresHeadlineOptions, text, query.GroupIDs)
+	}
+
+	if len(selects) == 0 {
+		return []*Result{}, nil
+	}
+
+	sql := strings.Join(selects, " union all ") + " order by rank desc limit ?"
+	params = append(params, query.limit())
+
+	var results []*Result
+	if err := e.db.Raw(sql, params...).Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		result.Snippet = highlight(result.Snippet)
+	}
+	return results, nil
+}
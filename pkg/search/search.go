@@ -0,0 +1,138 @@
+// Package search finds posts, messages and member profiles matching a text
+// query. The Engine is picked according to the database: Postgres uses
+// tsvector indexes, SQLite uses FTS5 tables when the driver was built with
+// the sqlite_fts5 tag, and other databases fall back to case-insensitive
+// pattern matching.
+package search
+
+import (
+	"cp/pkg/api"
+	"fmt"
+	"gorm.io/gorm"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+)
+
+type Kind string
+
+const (
+	PostKind    Kind = "post"
+	MessageKind Kind = "message"
+	UserKind    Kind = "user"
+)
+
+func (k Kind) IsPost() bool {
+	return k == PostKind
+}
+
+func (k Kind) IsMessage() bool {
+	return k == MessageKind
+}
+
+func (k Kind) IsUser() bool {
+	return k == UserKind
+}
+
+const defaultLimit = 50
+
+type Query struct {
+	Text string
+	// GroupIDs restricts the results to the posts and messages of these
+	// groups, and to the profiles of their members
+	GroupIDs []string
+	// Kinds restricts the kind of results. All kinds are searched when empty
+	Kinds    []Kind
+	PostType *api.PostType
+	Limit    int
+}
+
+func (q *Query) includes(kind Kind) bool {
+	if len(q.Kinds) == 0 {
+		return true
+	}
+	for _, k := range q.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Query) limit() int {
+	if q.Limit <= 0 {
+		return defaultLimit
+	}
+	return q.Limit
+}
+
+// Result is a single match. PostID is the post of a message result, and
+// the post itself for a post result
+type Result struct {
+	Kind      Kind
+	ID        string
+	GroupID   string
+	GroupName string
+	PostID    string
+	Title     string
+	// Snippet is the matching text, HTML escaped, with the matching terms
+	// wrapped in mark tags
+	Snippet string
+	Rank    float64
+}
+
+func (r *Result) Link() string {
+	switch r.Kind {
+	case PostKind:
+		return fmt.Sprintf("/groups/%s/posts/%s", r.GroupID, r.PostID)
+	case MessageKind:
+		return fmt.Sprintf("/groups/%s/posts/%s#replies", r.GroupID, r.PostID)
+	case UserKind:
+		return fmt.Sprintf("/users/%s", r.ID)
+	}
+	return ""
+}
+
+type Engine interface {
+	// Init creates the indexes of the engine. It must be called after the
+	// tables were migrated
+	Init() error
+	Search(query *Query) ([]*Result, error)
+}
+
+// NewEngine returns the best engine available for the database
+func NewEngine(db *gorm.DB) Engine {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return NewPostgresEngine(db)
+	case "sqlite":
+		if hasFTS5(db) {
+			return NewSQLiteEngine(db)
+		}
+		log.Println("search: sqlite was built without FTS5, falling back to pattern matching. Build with -tags sqlite_fts5 to enable it")
+	}
+	return NewLikeEngine(db)
+}
+
+// highlightStart and highlightStop surround the matching terms in the
+// snippets returned by the database. They are replaced by mark tags once
+// the snippet is escaped
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+func highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, highlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStop, "</mark>")
+}
+
+var termRegexp = regexp.MustCompile(`[\pL\pN]+`)
+
+// terms splits the query text into words, leaving out the operators and
+// punctuation of the query syntax of the engines
+func terms(text string) []string {
+	return termRegexp.FindAllString(text, -1)
+}
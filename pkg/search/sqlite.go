@@ -0,0 +1,155 @@
+package search
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// sqliteIndex is an FTS5 table indexing the columns of a table. The FTS5
+// table does not store a copy of the rows, and is kept up to date by
+// triggers
+type sqliteIndex struct {
+	table   string
+	columns []string
+}
+
+func (i sqliteIndex) name() string {
+	return i.table + "_fts"
+}
+
+func (i sqliteIndex) statements() []string {
+	columns := strings.Join(i.columns, ", ")
+	var newValues, oldValues []string
+	for _, column := range i.columns {
+		newValues = append(newValues, "new."+column)
+		oldValues = append(oldValues, "old."+column)
+	}
+	insert := fmt.Sprintf("insert into %s(rowid, %s) values (new.rowid, %s);", i.name(), columns, strings.Join(newValues, ", "))
+	remove := fmt.Sprintf("insert into %s(%s, rowid, %s) values ('delete', old.rowid, %s);", i.name(), i.name(), columns, strings.Join(oldValues, ", "))
+	return []string{
+		fmt.Sprintf("create virtual table %s using fts5(%s, content='%s', tokenize='porter unicode61')", i.name(), columns, i.table),
+		fmt.Sprintf("create trigger %s_ai after insert on %s begin %s end", i.name(), i.table, insert),
+		fmt.Sprintf("create trigger %s_ad after delete on %s begin %s end", i.name(), i.table, remove),
+		fmt.Sprintf("create trigger %s_au after update on %s begin %s %s end", i.name(), i.table, remove, insert),
+		fmt.Sprintf("insert into %s(%s) values ('rebuild')", i.name(), i.name()),
+	}
+}
+
+var sqliteIndexes = []sqliteIndex{
+	{table: "posts", columns: []string{"title", "description"}},
+	{table: "messages", columns: []string{"content"}},
+	{table: "users", columns: []string{"username", "name", "about"}},
+}
+
+type SQLiteEngine struct {
+	db *gorm.DB
+}
+
+func NewSQLiteEngine(db *gorm.DB) *SQLiteEngine {
+	return &SQLiteEngine{db: db}
+}
+
+var _ Engine = &SQLiteEngine{}
+
+func hasFTS5(db *gorm.DB) bool {
+	var enabled bool
+	if err := db.Raw("select sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return false
+	}
+	return enabled
+}
+
+// Init creates the FTS5 tables that do not exist yet, and indexes the
+// existing rows of their table
+func (e *SQLiteEngine) Init() error {
+	for _, index := range sqliteIndexes {
+		var count int64
+		if err := e.db.Raw("select count(*) from sqlite_master where type = 'table' and name = ?", index.name()).Scan(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := e.db.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range index.statements() {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to create search index %s: %w", index.name(), err)
+		}
+	}
+	return nil
+}
+
+// match quotes every term of the query, so that the FTS5 query syntax
+// cannot be used. The terms are all required to match
+func match(text string) string {
+	var quoted []string
+	for _, term := range terms(text) {
+		quoted = append(quoted, `"`+term+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (e *SQLiteEngine) Search(query *Query) ([]*Result, error) {
+	text := match(query.Text)
+	if text == "" || len(query.GroupIDs) == 0 {
+		return []*Result{}, nil
+	}
+
+	var selects []string
+	var params []interface{}
+
+	// bm25 returns better matches as lower values, it is negated so that
+	// the rank of every engine sorts the same way
+	if query.includes(PostKind) {
+		sql := `select 'post' as kind, p.id as id, p.group_id as group_id, g.name as group_name, p.id as post_id, p.title as title,
+				snippet(posts_fts, -1, ?, ?, '…', 20) as snippet, -bm25(posts_fts, 5.0, 1.0) as rank
+			from posts_fts join posts p on p.rowid = posts_fts.rowid join groups g on g.id = p.group_id
+			where posts_fts match ? and p.deleted_at is null and p.group_id in ?`
+		params = append(params, highlightStart, highlightStop, text, query.GroupIDs)
+		if query.PostType != nil {
+			sql += " and p.type = ?"
+			params = append(params, *query.PostType)
+		}
+		selects = append(selects, sql)
+	}
+
+	if query.includes(MessageKind) {
+		selects = append(selects, `select 'message' as kind, m.id as id, p.group_id as group_id, g.name as group_name, p.id as post_id, p.title as title,
+				snippet(messages_fts, -1, ?, ?, '…', 20) as snippet, -bm25(messages_fts) as rank
+			from messages_fts join messages m on m.rowid = messages_fts.rowid join posts p on p.id = m.thread_id join groups g on g.id = p.group_id
+			where messages_fts match ? and p.deleted_at is null and p.group_id in ?`)
+		params = append(params, highlightStart, highlightStop, text, query.GroupIDs)
+	}
+
+	if query.includes(UserKind) {
+		selects = append(selects, `select 'user' as kind, u.id as id, '' as group_id, '' as group_name, '' as post_id, u.username as title,
+				snippet(users_fts, -1, ?, ?, '…', 20) as snippet, -bm25(users_fts, 5.0, 2.0, 1.0) as rank
+			from users_fts join users u on u.rowid = users_fts.rowid
+			where users_fts match ? and u.id in (
+				select user_id from memberships where group_id in ? and member_confirmed and group_confirmed
+			)`)
+		params = append(params, highlightStart, highlightStop, text, query.GroupIDs)
+	}
+
+	if len(selects) == 0 {
+		return []*Result{}, nil
+	}
+
+	sql := "select * from (" + strings.Join(selects, " union all ") + ") order by rank desc limit ?"
+	params = append(params, query.limit())
+
+	var results []*Result
+	if err := e.db.Raw(sql, params...).Scan(&results).Error; err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		result.Snippet = highlight(result.Snippet)
+	}
+	return results, nil
+}
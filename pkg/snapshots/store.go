@@ -0,0 +1,78 @@
+package snapshots
+
+import (
+	"cp/pkg/api"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"time"
+)
+
+type Store interface {
+	GetForGroup(groupID string) ([]*api.HistorySnapshot, error)
+	Get(id string) (*api.HistorySnapshot, error)
+	Create(snapshot *api.HistorySnapshot) error
+	DeleteFrom(groupID string, since time.Time) error
+}
+
+type SnapshotStore struct {
+	db *gorm.DB
+}
+
+func NewSnapshotStore(db *gorm.DB) *SnapshotStore {
+	return &SnapshotStore{db: db}
+}
+
+var _ Store = &SnapshotStore{}
+
+// GetForGroup returns the snapshots of the group, oldest first, without
+// their users
+func (s *SnapshotStore) GetForGroup(groupID string) ([]*api.HistorySnapshot, error) {
+	var result []*api.HistorySnapshot
+	if err := s.db.
+		Model(&api.HistorySnapshot{}).
+		Order("until asc").
+		Find(&result, "group_id = ?", groupID).
+		Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get returns the snapshot with the totals of its users
+func (s *SnapshotStore) Get(id string) (*api.HistorySnapshot, error) {
+	var result api.HistorySnapshot
+	err := s.db.
+		Preload("Users.User").
+		Model(&api.HistorySnapshot{}).
+		First(&result, "id = ?", id).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *SnapshotStore) Create(snapshot *api.HistorySnapshot) error {
+	return s.db.Create(snapshot).Error
+}
+
+// DeleteFrom removes the snapshots of the group taken after the given time.
+// They must be recomputed when an entry of the history is changed or removed
+func (s *SnapshotStore) DeleteFrom(groupID string, since time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Where("snapshot_id in (select id from history_snapshots where group_id = ? and until >= ?)", groupID, since).
+			Delete(&api.HistorySnapshotUser{}).
+			Error; err != nil {
+			return err
+		}
+		return tx.
+			Where("group_id = ? and until >= ?", groupID, since).
+			Delete(&api.HistorySnapshot{}).
+			Error
+	})
+}
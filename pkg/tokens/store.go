@@ -0,0 +1,115 @@
+package tokens
+
+import (
+	"cp/pkg/api"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+const tokenPrefix = "cp_"
+
+type Store interface {
+	Create(userID string, name string, scope api.TokenScope) (*api.PersonalAccessToken, string, error)
+	Authenticate(rawToken string) (*api.PersonalAccessToken, error)
+	GetByUser(userID string) ([]*api.PersonalAccessToken, error)
+	Revoke(userID string, tokenID string) error
+}
+
+type TokenStore struct {
+	db *gorm.DB
+}
+
+func NewTokenStore(db *gorm.DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+var _ Store = &TokenStore{}
+
+// Create generates a new token for the user. The raw token is returned only
+// once, and cannot be retrieved afterwards.
+func (s *TokenStore) Create(userID string, name string, scope api.TokenScope) (*api.PersonalAccessToken, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	rawToken := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	token := &api.PersonalAccessToken{
+		ID:        uuid.NewV4().String(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: HashToken(rawToken),
+		Prefix:    rawToken[:len(tokenPrefix)+6],
+		Scope:     scope,
+	}
+	if err := s.db.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, rawToken, nil
+}
+
+// Authenticate returns the token matching the raw token, and records its
+// usage. Revoked and unknown tokens return echo.ErrUnauthorized
+func (s *TokenStore) Authenticate(rawToken string) (*api.PersonalAccessToken, error) {
+	var token api.PersonalAccessToken
+	err := s.db.
+		Preload("User").
+		Model(&api.PersonalAccessToken{}).
+		First(&token, "token_hash = ?", HashToken(rawToken)).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.IsRevoked() || token.User == nil {
+		return nil, echo.ErrUnauthorized
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&api.PersonalAccessToken{}).Where("id = ?", token.ID).Update("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+	token.LastUsedAt = &now
+
+	return &token, nil
+}
+
+func (s *TokenStore) GetByUser(userID string) ([]*api.PersonalAccessToken, error) {
+	var result []*api.PersonalAccessToken
+	if err := s.db.
+		Model(&api.PersonalAccessToken{}).
+		Order("created_at desc").
+		Find(&result, "user_id = ?", userID).
+		Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *TokenStore) Revoke(userID string, tokenID string) error {
+	result := s.db.
+		Model(&api.PersonalAccessToken{}).
+		Where("id = ? and user_id = ? and revoked_at is null", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
+
+func HashToken(rawToken string) string {
+	hash := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(hash[:])
+}
@@ -2,6 +2,8 @@ package users
 
 import (
 	"cp/pkg/api"
+	"errors"
+	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"strings"
@@ -10,8 +12,10 @@ import (
 type Store interface {
 	Get(userID string) (*api.User, error)
 	GetByKeys(userIDs []string) ([]*api.User, error)
+	GetByEmail(email string) (*api.User, error)
 	Upsert(user *api.User) error
 	Save(user *api.User) error
+	SetSiteAdministrator(userID string, value bool) error
 }
 
 type UserStore struct {
@@ -56,6 +60,22 @@ func (u UserStore) GetByKeys(userIDs []string) ([]*api.User, error) {
 	return result, nil
 }
 
+// GetByEmail returns the oldest user with the given email, ignoring case
+func (u UserStore) GetByEmail(email string) (*api.User, error) {
+	var result api.User
+	err := u.db.
+		Order("created_at asc").
+		First(&result, "lower(email) = lower(?)", strings.TrimSpace(email)).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, echo.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (u UserStore) Save(user *api.User) error {
 	return u.db.Save(user).Error
 }
@@ -69,3 +89,14 @@ func (u UserStore) Upsert(user *api.User) error {
 		}),
 	}).Create(user).Error
 }
+
+func (u UserStore) SetSiteAdministrator(userID string, value bool) error {
+	result := u.db.Model(&api.User{}).Where("id = ?", userID).Update("site_administrator", value)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+	return nil
+}
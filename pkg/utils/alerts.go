@@ -25,8 +25,18 @@ func NewAlertManager(store sessions.Store) *AlertManager {
 	}
 }
 
-func (a *AlertManager) AddAlert(r *http.Request, w http.ResponseWriter, alert Alert) error {
+// getSession returns the session of the alerts. A cookie that cannot be
+// decoded starts a new session, the alerts it held are lost
+func (a *AlertManager) getSession(r *http.Request) (*sessions.Session, error) {
 	session, err := a.store.Get(r, "alerts")
+	if err != nil && session != nil && session.IsNew {
+		return session, nil
+	}
+	return session, err
+}
+
+func (a *AlertManager) AddAlert(r *http.Request, w http.ResponseWriter, alert Alert) error {
+	session, err := a.getSession(r)
 	if err != nil {
 		return err
 	}
@@ -41,7 +51,7 @@ func (a *AlertManager) AddAlert(r *http.Request, w http.ResponseWriter, alert Al
 }
 
 func (a *AlertManager) GetAlerts(r *http.Request) ([]Alert, error) {
-	session, err := a.store.Get(r, "alerts")
+	session, err := a.getSession(r)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +64,7 @@ func (a *AlertManager) GetAlerts(r *http.Request) ([]Alert, error) {
 }
 
 func (a *AlertManager) ClearAlerts(r *http.Request, w http.ResponseWriter) error {
-	session, err := a.store.Get(r, "alerts")
+	session, err := a.getSession(r)
 	if err != nil {
 		return err
 	}
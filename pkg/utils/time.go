@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Between restricts the query to the rows whose column is strictly between
+// after and before. A zero time leaves that side of the range open
+func Between(query *gorm.DB, column string, after, before time.Time) *gorm.DB {
+	if !after.IsZero() {
+		query = query.Where(column+" > ?", after)
+	}
+	if !before.IsZero() {
+		query = query.Where(column+" < ?", before)
+	}
+	return query
+}
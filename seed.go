@@ -0,0 +1,235 @@
+package main
+
+import (
+	"cp/pkg/api"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// demoNamespace derives the IDs of the demo data, so that seeding twice
+// finds the existing demo group
+var demoNamespace = uuid.NewV5(uuid.NamespaceURL, "https://commonpool/demo")
+
+func demoID(name string) string {
+	return uuid.NewV5(demoNamespace, name).String()
+}
+
+type demoPost struct {
+	author      string
+	postType    api.PostType
+	title       string
+	description string
+	valueFrom   time.Duration
+	valueTo     time.Duration
+	age         time.Duration
+	messages    []demoMessage
+}
+
+type demoMessage struct {
+	author  string
+	content string
+}
+
+var demoUsers = []string{"alice", "bob", "carol", "dave"}
+
+var demoPosts = []demoPost{
+	{
+		author:      "alice",
+		postType:    api.OfferPost,
+		title:       "Bike repair",
+		description: "I can fix flat tires, brakes and gears. Bring your bike on Saturday mornings.",
+		valueFrom:   time.Hour,
+		valueTo:     2 * time.Hour,
+		age:         21 * 24 * time.Hour,
+		messages: []demoMessage{
+			{author: "bob", content: "Could you look at my gears next week?"},
+			{author: "alice", content: "Sure, Saturday at 10?"},
+		},
+	},
+	{
+		author:      "bob",
+		postType:    api.RequestPost,
+		title:       "Help moving boxes",
+		description: "Moving to a new flat, I need two people for an afternoon.",
+		valueFrom:   3 * time.Hour,
+		valueTo:     4 * time.Hour,
+		age:         14 * 24 * time.Hour,
+		messages: []demoMessage{
+			{author: "carol", content: "I can help on Sunday."},
+		},
+	},
+	{
+		author:      "carol",
+		postType:    api.OfferPost,
+		title:       "French lessons",
+		description: "Conversation practice for beginners, one hour per week.",
+		valueFrom:   time.Hour,
+		valueTo:     time.Hour,
+		age:         7 * 24 * time.Hour,
+	},
+	{
+		author:      "dave",
+		postType:    api.CommentPost,
+		description: "Thanks everyone for the warm welcome!",
+		age:         2 * 24 * time.Hour,
+	},
+}
+
+// runSeed adds a demo group. The demo users cannot sign in, so --owner
+// makes an existing user the owner of the group to explore it
+func runSeed(s *stores, args []string) error {
+	flags := newFlagSet("seed")
+	demo := flags.Bool("demo", false, "add the demo group")
+	owner := flags.String("owner", "", "ID or email of an existing user to add as owner of the demo group")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !*demo || flags.NArg() != 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	groupID := demoID("group")
+	_, err := s.groupStore.Get(groupID)
+	if err == nil {
+		fmt.Printf("demo group %s already exists\n", groupID)
+		return nil
+	}
+	if !errors.Is(err, echo.ErrNotFound) {
+		return err
+	}
+
+	var ownerUser *api.User
+	if *owner != "" {
+		ownerUser, err = findUser(s, *owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return seedDemo(newStores(tx, s.broker, s.deliverer, s.jobRunner, s.blobStore), groupID, ownerUser)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created demo group %s\n", groupID)
+	return nil
+}
+
+func seedDemo(s *stores, groupID string, ownerUser *api.User) error {
+	group := &api.Group{
+		ID:                   groupID,
+		Name:                 "Demo group",
+		MemberOverdraftLimit: api.DefaultMemberOverdraftLimit,
+		GroupOverdraftLimit:  api.DefaultGroupOverdraftLimit,
+	}
+	if err := s.groupStore.Create(group); err != nil {
+		return err
+	}
+
+	users := map[string]*api.User{}
+	for i, name := range demoUsers {
+		user := &api.User{
+			ID:       demoID("user:" + name),
+			Username: name,
+			Email:    name + "@demo.example.org",
+			Name:     fmt.Sprintf("%s (demo)", name),
+		}
+		if err := s.userStore.Upsert(user); err != nil {
+			return err
+		}
+		users[name] = user
+
+		permission := api.Member
+		if i == 0 {
+			permission = api.Admin
+		}
+		if err := s.membershipStore.Create(&api.Membership{
+			GroupID:         group.ID,
+			UserID:          user.ID,
+			Permission:      permission,
+			MemberConfirmed: true,
+			GroupConfirmed:  true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if ownerUser != nil {
+		if err := s.membershipStore.Create(&api.Membership{
+			GroupID:         group.ID,
+			UserID:          ownerUser.ID,
+			Permission:      api.Owner,
+			MemberConfirmed: true,
+			GroupConfirmed:  true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, p := range demoPosts {
+		post := &api.Post{
+			ID:          demoID("post:" + p.title + p.description),
+			GroupID:     group.ID,
+			AuthorID:    users[p.author].ID,
+			Title:       p.title,
+			Description: p.description,
+			Type:        p.postType,
+			CreatedAt:   now.Add(-p.age),
+		}
+		if p.postType != api.CommentPost {
+			valueFrom, valueTo := p.valueFrom, p.valueTo
+			post.ValueFrom = &valueFrom
+			post.ValueTo = &valueTo
+		}
+		if err := s.postStore.Create(post); err != nil {
+			return err
+		}
+		for _, m := range p.messages {
+			if err := s.messageStore.SendMessage(&api.Message{
+				ID:       uuid.NewV4().String(),
+				AuthorID: users[m.author].ID,
+				Content:  m.content,
+				ThreadID: post.ID,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	groupTarget := &api.Target{GroupID: &group.ID, Type: api.GroupTarget}
+	userTarget := func(name string) *api.Target {
+		return &api.Target{UserID: &users[name].ID, Type: api.UserTarget}
+	}
+	for _, name := range demoUsers {
+		if _, err := s.ledgerStore.Transfer(group.ID, groupTarget, userTarget(name), 5*time.Hour, "Welcome credits"); err != nil {
+			return err
+		}
+	}
+	if _, err := s.ledgerStore.Transfer(group.ID, userTarget("bob"), userTarget("alice"), 90*time.Minute, "Bike repair"); err != nil {
+		return err
+	}
+	if _, err := s.ledgerStore.Transfer(group.ID, userTarget("bob"), userTarget("carol"), 3*time.Hour, "Moving boxes"); err != nil {
+		return err
+	}
+
+	if err := s.acknowledgementStore.Save(&api.Acknowledgement{
+		ID:      uuid.NewV4().String(),
+		GroupID: group.ID,
+		SentBy:  userTarget("bob"),
+		SentTo:  userTarget("carol"),
+		Type:    api.ThanksServiceGift,
+		Notes:   "Thanks for the help with the move!",
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}